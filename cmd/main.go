@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"quota-manager/internal/auth"
 	"quota-manager/internal/config"
 	"quota-manager/internal/database"
 	"quota-manager/internal/handlers"
@@ -123,7 +124,12 @@ func main() {
 	)
 
 	// Initialize services
-	voucherService := services.NewVoucherService(cfg.Voucher.SigningKey)
+	voucherKeyring, err := services.NewVoucherKeyring(&cfg.Voucher)
+	if err != nil {
+		logger.Error("Failed to initialize voucher keyring", zap.Error(err))
+		os.Exit(1)
+	}
+	voucherService := services.NewVoucherServiceWithKeyring(voucherKeyring, cfg.Voucher.GetTTL())
 	quotaService := services.NewQuotaService(db, configManager, gateway, voucherService)
 	strategyService := services.NewStrategyService(db, gateway, quotaService, &cfg.EmployeeSync)
 
@@ -131,6 +137,7 @@ func main() {
 	permissionService := services.NewPermissionService(db, &cfg.AiGateway, &cfg.EmployeeSync, gateway)
 	starCheckPermissionService := services.NewStarCheckPermissionService(db, &cfg.AiGateway, &cfg.EmployeeSync, gateway)
 	quotaCheckPermissionService := services.NewQuotaCheckPermissionService(db, &cfg.AiGateway, &cfg.EmployeeSync, gateway)
+	quotaService.SetPermissionServices(permissionService, starCheckPermissionService, quotaCheckPermissionService)
 	unifiedPermissionService := services.NewUnifiedPermissionService(permissionService, starCheckPermissionService, quotaCheckPermissionService, nil) // employeeSyncService will be set later
 	employeeSyncService := services.NewEmployeeSyncService(db, configManager, permissionService, starCheckPermissionService, quotaCheckPermissionService)
 
@@ -152,9 +159,26 @@ func main() {
 		// Log error but don't exit, let the service continue running
 	}
 
+	// Initialize user token verifier
+	tokenVerifier, err := auth.NewTokenVerifier(&cfg.Server.JWT)
+	if err != nil {
+		logger.Error("Failed to initialize token verifier", zap.Error(err))
+		os.Exit(1)
+	}
+
+	// Initialize route authorization, accepting user tokens, service accounts and API keys
+	apiKeyService := services.NewAPIKeyService(db)
+	authorizer, err := auth.NewAuthorizer(&cfg.Server, tokenVerifier, apiKeyService, auth.DefaultRoutePolicies)
+	if err != nil {
+		logger.Error("Failed to initialize authorizer", zap.Error(err))
+		os.Exit(1)
+	}
+
 	// Initialize HTTP handlers
 	strategyHandler := handlers.NewStrategyHandler(strategyService)
-	quotaHandler := handlers.NewQuotaHandler(quotaService, &cfg.Server)
+	quotaHandler := handlers.NewQuotaHandler(quotaService, &cfg.Server, tokenVerifier)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	outboxHandler := handlers.NewOutboxHandler(quotaService.Outbox())
 	modelPermissionHandler := handlers.NewModelPermissionHandler(permissionService)
 	starCheckPermissionHandler := handlers.NewStarCheckPermissionHandler(starCheckPermissionService)
 	quotaCheckPermissionHandler := handlers.NewQuotaCheckPermissionHandler(quotaCheckPermissionService)
@@ -182,6 +206,8 @@ func main() {
 		"Accept",
 		"Cache-Control",
 		"X-Requested-With",
+		"X-API-Key",
+		"Idempotency-Key",
 	}
 	corsConfig.AllowMethods = []string{
 		"GET",
@@ -203,6 +229,7 @@ func main() {
 
 		// API routes
 		v1 := quotaManager.Group("/api/v1")
+		v1.Use(authorizer.Middleware())
 		{
 			// Strategy management API
 			strategies := v1.Group("/strategies")
@@ -216,6 +243,7 @@ func main() {
 				// Strategy status management
 				strategies.POST("/:id/enable", strategyHandler.EnableStrategy)
 				strategies.POST("/:id/disable", strategyHandler.DisableStrategy)
+				strategies.POST("/:id/revert", strategyHandler.RevertStrategy)
 
 				// Strategy execution records
 				strategies.GET("/:id/executions", strategyHandler.GetStrategyExecuteRecords)
@@ -251,6 +279,12 @@ func main() {
 				quotaCheckPermissions.GET("/department", quotaCheckPermissionHandler.GetDepartmentQuotaCheckSetting)
 			}
 
+			// API key management
+			handlers.RegisterAPIKeyRoutes(v1, apiKeyHandler)
+
+			// AiGateway outbox inspection and replay
+			handlers.RegisterOutboxRoutes(v1, outboxHandler)
+
 			// Unified query and sync interfaces
 			v1.GET("/effective-permissions", unifiedPermissionHandler.GetEffectivePermissions)
 
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// minForcedRefreshInterval limits how often an unknown kid can trigger a JWKS reload
+const minForcedRefreshInterval = time.Minute
+
+// jsonWebKey is a single key entry of a JWKS document
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jsonWebKeySet is a JWKS document
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwksCache caches public keys loaded from a JWKS file or URL, keyed by kid
+type jwksCache struct {
+	file            string
+	url             string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+
+	mu            sync.RWMutex
+	keys          map[string]interface{} // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	fetchedAt     time.Time
+	lastRefreshAt time.Time
+}
+
+// newJWKSCache creates a JWKS cache and performs the initial load
+func newJWKSCache(file, url string, refreshInterval time.Duration) (*jwksCache, error) {
+	c := &jwksCache{
+		file:            file,
+		url:             url,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// key returns the public key for kid, reloading the key set when it is stale or kid is unknown
+func (c *jwksCache) key(kid, alg string) (interface{}, error) {
+	k, found, stale := c.lookup(kid)
+	if stale || !found {
+		c.mu.RLock()
+		canRefresh := stale || time.Since(c.lastRefreshAt) >= minForcedRefreshInterval
+		c.mu.RUnlock()
+
+		if canRefresh {
+			if err := c.refresh(); err != nil {
+				// Keep serving cached keys if the JWKS source is temporarily unavailable
+				logger.Warn("Failed to refresh JWKS, using cached keys", zap.Error(err))
+			}
+			k, found, _ = c.lookup(kid)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no JWKS key found for kid %q", kid)
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		if _, ok := k.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("JWKS key %q is not an RSA key", kid)
+		}
+	case strings.HasPrefix(alg, "ES"):
+		if _, ok := k.(*ecdsa.PublicKey); !ok {
+			return nil, fmt.Errorf("JWKS key %q is not an EC key", kid)
+		}
+	}
+
+	return k, nil
+}
+
+// lookup finds a cached key. An empty kid matches only when the set holds exactly one key.
+func (c *jwksCache) lookup(kid string) (interface{}, bool, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stale := time.Since(c.fetchedAt) > c.refreshInterval
+
+	if kid == "" {
+		if len(c.keys) == 1 {
+			for _, k := range c.keys {
+				return k, true, stale
+			}
+		}
+		return nil, false, stale
+	}
+
+	k, ok := c.keys[kid]
+	return k, ok, stale
+}
+
+// refresh reloads the key set from its source
+func (c *jwksCache) refresh() error {
+	c.mu.Lock()
+	c.lastRefreshAt = time.Now()
+	c.mu.Unlock()
+
+	data, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to unmarshal JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		pub, err := jwk.publicKey()
+		if err != nil {
+			logger.Warn("Skipping invalid JWKS key", zap.String("kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+		keys[jwk.Kid] = pub
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS contains no usable signing keys")
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	logger.Info("JWKS loaded", zap.Int("key_count", len(keys)))
+	return nil
+}
+
+// load reads the raw JWKS document from the configured file or URL
+func (c *jwksCache) load() ([]byte, error) {
+	if c.file != "" {
+		data, err := os.ReadFile(c.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	resp, err := c.httpClient.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS response: %w", err)
+	}
+	return data, nil
+}
+
+// publicKey converts the JWK into an RSA or ECDSA public key
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() <= 1 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("unsupported RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url-encoded big-endian unsigned integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is the path prefix of all versioned API routes
+const APIPrefix = "/quota-manager/api/v1"
+
+// DefaultRoutePolicies maps "METHOD /route/path" to the minimum role required.
+// Self-service endpoints are open to users, reads of other users' data need operator,
+// and anything that changes strategies, permissions or quota on behalf of others needs admin.
+var DefaultRoutePolicies = map[string]Role{
+	// Self-service quota endpoints
+	RouteKey(http.MethodGet, APIPrefix+"/quota"):                       RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/audit"):                 RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/expiring"):              RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/balance-history"):       RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/transfer-out"):         RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/transfer-out/batch"):   RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/transfer-in"):          RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/transfer-cancel"):      RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/red-packets"):          RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/red-packets/claim"):    RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/redeem"):               RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/requests"):             RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/requests"):              RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/requests/inbox"):        RoleUser,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/requests/:id"):          RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/requests/:id/approve"): RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/requests/:id/reject"):  RoleUser,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/requests/:id/cancel"):  RoleUser,
+
+	// Quota administration
+	RouteKey(http.MethodPost, APIPrefix+"/quota/merge"):                     RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/merge/preview"):              RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/merges"):                     RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/merges/:id/undo"):           RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/deduct"):                    RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/adjust"):                    RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/adjust/bulk"):               RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/promo-codes"):               RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/promo-codes/:id/disable"):   RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/promo-codes"):                RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/reconciliation/reports"):     RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/reconciliation/reports/:id"): RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/expiring/summary"):           RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/balance-history/:user_id"):   RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/audit/"):                     RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/audit/:user_id"):             RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/audits"):                     RoleOperator,
+
+	// Quota reservations
+	RouteKey(http.MethodPost, APIPrefix+"/quota/reservations"):             RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/quota/reservations/:id"):          RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/reservations/:id/capture"): RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota/reservations/:id/release"): RoleAdmin,
+
+	// Strategy management
+	RouteKey(http.MethodGet, APIPrefix+"/strategies"):                RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/strategies/:id"):            RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/strategies/:id/executions"): RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/strategies"):               RoleAdmin,
+	RouteKey(http.MethodPut, APIPrefix+"/strategies/:id"):            RoleAdmin,
+	RouteKey(http.MethodDelete, APIPrefix+"/strategies/:id"):         RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/strategies/:id/enable"):    RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/strategies/:id/disable"):   RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/strategies/:id/revert"):    RoleAdmin,
+
+	// Permission management
+	RouteKey(http.MethodGet, APIPrefix+"/model-permissions/user"):              RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/model-permissions/department"):        RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/model-permissions/user"):             RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/model-permissions/department"):       RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/star-check-permissions/user"):         RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/star-check-permissions/department"):   RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/star-check-permissions/user"):        RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/star-check-permissions/department"):  RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/quota-check-permissions/user"):        RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/quota-check-permissions/department"):  RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/quota-check-permissions/user"):       RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/quota-check-permissions/department"): RoleAdmin,
+	RouteKey(http.MethodGet, APIPrefix+"/effective-permissions"):               RoleOperator,
+
+	// API key management, not reachable with API keys themselves
+	RouteKey(http.MethodGet, APIPrefix+"/api-keys"):             RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/api-keys"):            RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/api-keys/:id/rotate"): RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/api-keys/:id/revoke"): RoleAdmin,
+
+	// Manual scan
+	RouteKey(http.MethodPost, APIPrefix+"/scan"): RoleAdmin,
+
+	// AiGateway passthrough
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/quota"):                   RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/quota-used"):              RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/star/projects"):           RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/permission/star-check"):   RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/permission/quota-check"):  RoleOperator,
+	RouteKey(http.MethodGet, APIPrefix+"/aigateway/permission/models"):       RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/quota/refresh"):          RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/quota/delta"):            RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/quota-used/refresh"):     RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/quota-used/delta"):       RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/star/projects"):          RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/permission/star-check"):  RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/permission/quota-check"): RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/aigateway/permission/models"):      RoleAdmin,
+
+	// AiGateway outbox
+	RouteKey(http.MethodGet, APIPrefix+"/outbox"):              RoleOperator,
+	RouteKey(http.MethodPost, APIPrefix+"/outbox/:id/replay"):  RoleAdmin,
+	RouteKey(http.MethodPost, APIPrefix+"/outbox/replay-dead"): RoleAdmin,
+}
+
+// ScopeGroups are the route groups API keys can be scoped to. Each group has a
+// "<group>:read" scope for GET routes and a "<group>:write" scope for everything else.
+var ScopeGroups = []string{
+	"quota",
+	"quota-admin",
+	"strategies",
+	"model-permissions",
+	"star-check-permissions",
+	"quota-check-permissions",
+	"effective-permissions",
+	"aigateway",
+	"outbox",
+	"scan",
+}
+
+// adminScopeGroups gives the admin routes of a group that also serves other callers their own group,
+// so a key scoped for the group cannot merge, adjust or deduct quota unless it was granted explicitly
+var adminScopeGroups = map[string]string{
+	"quota": "quota-admin",
+}
+
+// Scope access levels
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// IsValidScope reports whether scope names a known group and access level
+func IsValidScope(scope string) bool {
+	group, access, ok := strings.Cut(scope, ":")
+	if !ok || (access != ScopeRead && access != ScopeWrite) {
+		return false
+	}
+	for _, g := range ScopeGroups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// RouteScope returns the scope required to call a route that requires the given role with an API key,
+// or an empty string when the route is not reachable with API keys
+func RouteScope(method, fullPath string, required Role) string {
+	rest, ok := strings.CutPrefix(fullPath, APIPrefix+"/")
+	if !ok {
+		return ""
+	}
+	group, _, _ := strings.Cut(rest, "/")
+	if adminGroup, ok := adminScopeGroups[group]; ok && required == RoleAdmin {
+		group = adminGroup
+	}
+
+	access := ScopeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		access = ScopeRead
+	}
+
+	scope := group + ":" + access
+	if !IsValidScope(scope) {
+		return ""
+	}
+	return scope
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Role is an authorization level. Higher roles include the permissions of lower ones.
+type Role string
+
+const (
+	RolePublic   Role = "public"   // No authentication required
+	RoleUser     Role = "user"     // Any authenticated user, self-service endpoints
+	RoleOperator Role = "operator" // Read access to admin data
+	RoleAdmin    Role = "admin"    // Full management access
+)
+
+// roleRank orders roles for hierarchical checks
+var roleRank = map[Role]int{
+	RolePublic:   0,
+	RoleUser:     1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// principalContextKey is the gin context key holding the authenticated *Principal
+const principalContextKey = "quota-manager.principal"
+
+// ParseRole converts a role name into a Role
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := roleRank[role]; !ok || role == RolePublic {
+		return "", fmt.Errorf("unknown role: %s", name)
+	}
+	return role, nil
+}
+
+// APIKeyValidator resolves plaintext API keys to active stored keys
+type APIKeyValidator interface {
+	ValidateAPIKey(rawKey string) (*models.APIKey, error)
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	User           *models.AuthUser // Nil for service accounts and API keys
+	ServiceAccount string           // Service account name, empty for users
+	APIKey         *models.APIKey   // Set when authenticated with an API key
+	Roles          []Role
+}
+
+// HasRole reports whether the principal holds required or a higher role
+func (p *Principal) HasRole(required Role) bool {
+	for _, role := range p.Roles {
+		if roleRank[role] >= roleRank[required] {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether an API key principal was granted scope. Write scopes include read access.
+func (p *Principal) HasScope(scope string) bool {
+	if p.APIKey == nil || scope == "" {
+		return false
+	}
+	group, access, _ := strings.Cut(scope, ":")
+	for _, granted := range p.APIKey.GetScopesAsSlice() {
+		if granted == scope || (access == ScopeRead && granted == group+":"+ScopeWrite) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns an identifier of the principal for logging and auditing
+func (p *Principal) Name() string {
+	if p.APIKey != nil {
+		return fmt.Sprintf("apikey:%d:%s", p.APIKey.ID, p.APIKey.Name)
+	}
+	if p.ServiceAccount != "" {
+		return "service:" + p.ServiceAccount
+	}
+	if p.User != nil {
+		return p.User.ID
+	}
+	return ""
+}
+
+// PrincipalFromContext returns the principal set by the authorization middleware
+func PrincipalFromContext(c *gin.Context) (*Principal, bool) {
+	value, exists := c.Get(principalContextKey)
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
+
+// serviceAccount is a configured service account with its token digest
+type serviceAccount struct {
+	name        string
+	tokenDigest [sha256.Size]byte
+	roles       []Role
+}
+
+// Authorizer authenticates requests and enforces a per-route role policy
+type Authorizer struct {
+	verifier        *TokenVerifier
+	apiKeys         APIKeyValidator
+	tokenHeader     string
+	apiKeyHeader    string
+	policies        map[string]Role
+	userRoles       map[string][]Role
+	serviceAccounts []serviceAccount
+}
+
+// NewAuthorizer creates an authorizer from server configuration and a route policy table.
+// Routes missing from the policy table require the admin role. apiKeys may be nil to disable API keys.
+func NewAuthorizer(cfg *config.ServerConfig, verifier *TokenVerifier, apiKeys APIKeyValidator, policies map[string]Role) (*Authorizer, error) {
+	tokenHeader := cfg.TokenHeader
+	if tokenHeader == "" {
+		tokenHeader = "authorization"
+	}
+	apiKeyHeader := cfg.APIKeyHeader
+	if apiKeyHeader == "" {
+		apiKeyHeader = "x-api-key"
+	}
+
+	a := &Authorizer{
+		verifier:     verifier,
+		apiKeys:      apiKeys,
+		tokenHeader:  tokenHeader,
+		apiKeyHeader: apiKeyHeader,
+		policies:     policies,
+		userRoles:    make(map[string][]Role),
+	}
+
+	for _, userID := range cfg.Authz.Admins {
+		a.userRoles[userID] = append(a.userRoles[userID], RoleAdmin)
+	}
+	for _, userID := range cfg.Authz.Operators {
+		a.userRoles[userID] = append(a.userRoles[userID], RoleOperator)
+	}
+
+	for _, sa := range cfg.Authz.ServiceAccounts {
+		if sa.Name == "" {
+			return nil, fmt.Errorf("service account name is required")
+		}
+		if len(sa.Token) < 16 {
+			return nil, fmt.Errorf("service account %s: token must be at least 16 characters", sa.Name)
+		}
+		if len(sa.Roles) == 0 {
+			return nil, fmt.Errorf("service account %s: at least one role is required", sa.Name)
+		}
+		roles := make([]Role, 0, len(sa.Roles))
+		for _, name := range sa.Roles {
+			role, err := ParseRole(name)
+			if err != nil {
+				return nil, fmt.Errorf("service account %s: %w", sa.Name, err)
+			}
+			roles = append(roles, role)
+		}
+		a.serviceAccounts = append(a.serviceAccounts, serviceAccount{
+			name:        sa.Name,
+			tokenDigest: sha256.Sum256([]byte(sa.Token)),
+			roles:       roles,
+		})
+	}
+
+	return a, nil
+}
+
+// Middleware authenticates the caller and checks the role required by the matched route.
+// API key callers are checked against the route's scope instead of a role.
+// Unauthenticated callers get 401 with TokenInvalidCode, insufficient roles get 403 with UnauthorizedCode.
+func (a *Authorizer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required := a.requiredRole(c.Request.Method, c.FullPath())
+		if required == RolePublic {
+			c.Next()
+			return
+		}
+
+		principal, err := a.Authenticate(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+				"Failed to extract user from token: "+err.Error()))
+			return
+		}
+
+		if principal.APIKey != nil {
+			scope := RouteScope(c.Request.Method, c.FullPath(), required)
+			if !principal.HasScope(scope) {
+				logger.Warn("Authorization denied",
+					zap.String("principal", principal.Name()),
+					zap.String("method", c.Request.Method),
+					zap.String("route", c.FullPath()),
+					zap.String("required_scope", scope))
+				message := "API keys cannot access this operation"
+				if scope != "" {
+					message = fmt.Sprintf("Scope %s is required for this operation", scope)
+				}
+				c.AbortWithStatusJSON(http.StatusForbidden, response.NewErrorResponse(response.UnauthorizedCode, message))
+				return
+			}
+		} else if !principal.HasRole(required) {
+			logger.Warn("Authorization denied",
+				zap.String("principal", principal.Name()),
+				zap.String("method", c.Request.Method),
+				zap.String("route", c.FullPath()),
+				zap.String("required_role", string(required)))
+			c.AbortWithStatusJSON(http.StatusForbidden, response.NewErrorResponse(response.UnauthorizedCode,
+				fmt.Sprintf("Role %s is required for this operation", required)))
+			return
+		}
+
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// Authenticate resolves the caller from the API key header or the token header.
+// The token header may carry a service account token or a verified user token.
+func (a *Authorizer) Authenticate(c *gin.Context) (*Principal, error) {
+	if rawKey := strings.TrimSpace(c.GetHeader(a.apiKeyHeader)); rawKey != "" {
+		if a.apiKeys == nil {
+			return nil, fmt.Errorf("api keys are not enabled")
+		}
+		key, err := a.apiKeys.ValidateAPIKey(rawKey)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{APIKey: key}, nil
+	}
+
+	token := stripBearer(c.GetHeader(a.tokenHeader))
+	if token == "" {
+		return nil, fmt.Errorf("missing token in header: %s", a.tokenHeader)
+	}
+
+	if sa := a.matchServiceAccount(token); sa != nil {
+		return &Principal{ServiceAccount: sa.name, Roles: sa.roles}, nil
+	}
+
+	user, claimRoles, err := a.verifier.ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []Role{RoleUser}
+	for _, name := range claimRoles {
+		if role, err := ParseRole(name); err == nil {
+			roles = append(roles, role)
+		}
+	}
+	roles = append(roles, a.userRoles[user.ID]...)
+
+	return &Principal{User: user, Roles: roles}, nil
+}
+
+// matchServiceAccount finds the service account owning token
+func (a *Authorizer) matchServiceAccount(token string) *serviceAccount {
+	digest := sha256.Sum256([]byte(token))
+	for i := range a.serviceAccounts {
+		if subtle.ConstantTimeCompare(digest[:], a.serviceAccounts[i].tokenDigest[:]) == 1 {
+			return &a.serviceAccounts[i]
+		}
+	}
+	return nil
+}
+
+// requiredRole looks up the role required for a route, defaulting to admin
+func (a *Authorizer) requiredRole(method, fullPath string) Role {
+	if role, ok := a.policies[RouteKey(method, fullPath)]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// RouteKey builds the policy table key for a method and gin route path
+func RouteKey(method, fullPath string) string {
+	return method + " " + fullPath
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultJWKSRefreshInterval is used when jwks_refresh_interval is not configured
+const defaultJWKSRefreshInterval = time.Hour
+
+// userClaims is the claim set carried by user access tokens
+type userClaims struct {
+	models.AuthUser
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// TokenVerifier verifies user access tokens and extracts the authenticated user
+type TokenVerifier struct {
+	hmacSecret []byte
+	jwks       *jwksCache
+	parser     *jwt.Parser
+}
+
+// NewTokenVerifier creates a token verifier from configuration.
+// At least one of hmac_secret, jwks_file or jwks_url must be configured.
+func NewTokenVerifier(cfg *config.JWTConfig) (*TokenVerifier, error) {
+	v := &TokenVerifier{}
+	var methods []string
+
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	if cfg.JWKSFile != "" || cfg.JWKSURL != "" {
+		refreshInterval := defaultJWKSRefreshInterval
+		if cfg.JWKSRefreshInterval > 0 {
+			refreshInterval = time.Duration(cfg.JWKSRefreshInterval) * time.Second
+		}
+		cache, err := newJWKSCache(cfg.JWKSFile, cfg.JWKSURL, refreshInterval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWKS: %w", err)
+		}
+		v.jwks = cache
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no token verification key configured: set server.jwt.hmac_secret, jwks_file or jwks_url")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	if cfg.Leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(time.Duration(cfg.Leeway)*time.Second))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// ParseUserInfo verifies the token signature and registered claims, then returns the user info it carries
+func (v *TokenVerifier) ParseUserInfo(accessToken string) (*models.AuthUser, error) {
+	user, _, err := v.ParseToken(accessToken)
+	return user, err
+}
+
+// ParseToken verifies the token and returns the user info and the role names from its "roles" claim
+func (v *TokenVerifier) ParseToken(accessToken string) (*models.AuthUser, []string, error) {
+	accessToken = stripBearer(accessToken)
+
+	claims := &userClaims{}
+	if _, err := v.parser.ParseWithClaims(accessToken, claims, v.keyFunc); err != nil {
+		return nil, nil, fmt.Errorf("invalid JWT token: %w", err)
+	}
+
+	if claims.AuthUser.ID == "" {
+		return nil, nil, fmt.Errorf("user ID not found in JWT token")
+	}
+
+	user := claims.AuthUser
+	return &user, claims.Roles, nil
+}
+
+// stripBearer removes surrounding whitespace and an optional "Bearer " prefix
+func stripBearer(token string) string {
+	token = strings.TrimSpace(token)
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// keyFunc selects the verification key for the token's signing method
+func (v *TokenVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if v.hmacSecret == nil {
+			return nil, fmt.Errorf("HMAC tokens are not accepted")
+		}
+		return v.hmacSecret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if v.jwks == nil {
+			return nil, fmt.Errorf("asymmetric tokens are not accepted")
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.jwks.key(kid, token.Method.Alg())
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+}
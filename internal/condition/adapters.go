@@ -1,6 +1,9 @@
 package condition
 
-import "quota-manager/pkg/aigateway"
+import (
+	"quota-manager/pkg/aigateway"
+	"quota-manager/pkg/decimal"
+)
 
 // AiGatewayQuotaQuerier adapts aigateway.Client to implement QuotaQuerier interface
 type AiGatewayQuotaQuerier struct {
@@ -13,6 +16,6 @@ func NewAiGatewayQuotaQuerier(client *aigateway.Client) QuotaQuerier {
 }
 
 // QueryQuota implements QuotaQuerier interface
-func (a *AiGatewayQuotaQuerier) QueryQuota(userID string) (float64, error) {
+func (a *AiGatewayQuotaQuerier) QueryQuota(userID string) (decimal.Amount, error) {
 	return a.client.QueryQuotaValue(userID)
 }
@@ -3,6 +3,7 @@ package condition
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 	"strconv"
 	"strings"
 	"time"
@@ -10,7 +11,7 @@ import (
 
 // QuotaQuerier interface for querying quota information
 type QuotaQuerier interface {
-	QueryQuota(userID string) (float64, error)
+	QueryQuota(userID string) (decimal.Amount, error)
 }
 
 // DatabaseQuerier interface for querying database information
@@ -132,7 +133,7 @@ func (g *GithubStarExpr) Evaluate(user *models.UserInfo, ctx *EvaluationContext)
 // QuotaLEExpr quota less than or equal expression
 type QuotaLEExpr struct {
 	Model  string
-	Amount float64
+	Amount decimal.Amount
 }
 
 func (q *QuotaLEExpr) Evaluate(user *models.UserInfo, ctx *EvaluationContext) (bool, error) {
@@ -144,7 +145,7 @@ func (q *QuotaLEExpr) Evaluate(user *models.UserInfo, ctx *EvaluationContext) (b
 	if err != nil {
 		return false, err
 	}
-	return quota <= q.Amount, nil
+	return !quota.GreaterThan(q.Amount), nil
 }
 
 // IsVipExpr VIP level expression
@@ -492,7 +493,7 @@ func (p *Parser) buildFunction(funcName string, args []string) (Evaluator, error
 		if len(args) != 2 {
 			return nil, fmt.Errorf("quota-le expects 2 arguments, got %d", len(args))
 		}
-		amount, err := strconv.ParseFloat(args[1], 64)
+		amount, err := decimal.Parse(args[1])
 		if err != nil {
 			return nil, fmt.Errorf("invalid amount: %w", err)
 		}
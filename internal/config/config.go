@@ -2,7 +2,14 @@ package config
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
 
+	"quota-manager/pkg/decimal"
+
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +20,13 @@ type Config struct {
 	Server          ServerConfig          `mapstructure:"server"`
 	Scheduler       SchedulerConfig       `mapstructure:"scheduler"`
 	Voucher         VoucherConfig         `mapstructure:"voucher"`
+	Reservation     ReservationConfig     `mapstructure:"reservation"`
+	Outbox          OutboxConfig          `mapstructure:"outbox"`
+	ExpiryNotify    ExpiryNotifyConfig    `mapstructure:"expiry_notify"`
+	ExpiryPolicy    ExpiryPolicyConfig    `mapstructure:"expiry_policy"`
+	QuotaRequest    QuotaRequestConfig    `mapstructure:"quota_request"`
+	TransferPolicy  TransferPolicyConfig  `mapstructure:"transfer_policy"`
+	Merge           MergeConfig           `mapstructure:"merge"`
 	Log             LogConfig             `mapstructure:"log"`
 	EmployeeSync    EmployeeSyncConfig    `mapstructure:"employee_sync"`
 	GithubStarCheck GithubStarCheckConfig `mapstructure:"github_star_check"`
@@ -37,9 +51,37 @@ type AiGatewayConfig struct {
 }
 
 type ServerConfig struct {
-	Port        int    `mapstructure:"port"`
-	Mode        string `mapstructure:"mode"`
-	TokenHeader string `mapstructure:"token_header"`
+	Port         int         `mapstructure:"port"`
+	Mode         string      `mapstructure:"mode"`
+	TokenHeader  string      `mapstructure:"token_header"`
+	APIKeyHeader string      `mapstructure:"api_key_header"` // Header carrying API keys, defaults to x-api-key
+	JWT          JWTConfig   `mapstructure:"jwt"`
+	Authz        AuthzConfig `mapstructure:"authz"`
+}
+
+// JWTConfig configures verification of user access tokens
+type JWTConfig struct {
+	HMACSecret          string `mapstructure:"hmac_secret"`           // Shared secret for HS256 tokens
+	JWKSFile            string `mapstructure:"jwks_file"`             // Local JWKS document for RS256/ES256 tokens
+	JWKSURL             string `mapstructure:"jwks_url"`              // Remote JWKS endpoint for RS256/ES256 tokens
+	JWKSRefreshInterval int    `mapstructure:"jwks_refresh_interval"` // Seconds between JWKS reloads, defaults to 3600
+	Issuer              string `mapstructure:"issuer"`                // Expected "iss" claim, not checked when empty
+	Audience            string `mapstructure:"audience"`              // Expected "aud" claim, not checked when empty
+	Leeway              int    `mapstructure:"leeway"`                // Allowed clock skew in seconds for exp/nbf/iat
+}
+
+// AuthzConfig grants roles to callers that do not carry them in token claims
+type AuthzConfig struct {
+	Admins          []string               `mapstructure:"admins"`           // User IDs granted the admin role
+	Operators       []string               `mapstructure:"operators"`        // User IDs granted the operator role
+	ServiceAccounts []ServiceAccountConfig `mapstructure:"service_accounts"` // Static credentials for internal automation
+}
+
+// ServiceAccountConfig is a non-user caller authenticated by a static token
+type ServiceAccountConfig struct {
+	Name  string   `mapstructure:"name"`
+	Token string   `mapstructure:"token"`
+	Roles []string `mapstructure:"roles"`
 }
 
 type SchedulerConfig struct {
@@ -47,7 +89,94 @@ type SchedulerConfig struct {
 }
 
 type VoucherConfig struct {
-	SigningKey string `mapstructure:"signing_key"`
+	SigningKey  string             `mapstructure:"signing_key"`   // Legacy key verifying vouchers without a key ID, signs new vouchers when no active key is set
+	ActiveKeyID string             `mapstructure:"active_key_id"` // ID of the key in Keys that signs new vouchers
+	Keys        []VoucherKeyConfig `mapstructure:"keys"`          // Keyring, every key verifies vouchers carrying its ID
+	TTLHours    int                `mapstructure:"ttl_hours"`     // Hours a voucher stays redeemable, defaults to 168 (7 days)
+	ShortCodes  bool               `mapstructure:"short_codes"`   // Store vouchers server side and issue 12-character codes
+}
+
+// VoucherKeyConfig is a voucher signing key identified by the key ID embedded in vouchers
+type VoucherKeyConfig struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// ReservationConfig configures quota holds
+type ReservationConfig struct {
+	DefaultTTLMinutes int `mapstructure:"default_ttl_minutes"` // Hold lifetime when the request sets none, defaults to 60
+	MaxTTLMinutes     int `mapstructure:"max_ttl_minutes"`     // Longest hold a caller may request, defaults to 1440 (1 day)
+}
+
+// OutboxConfig configures the dispatcher that applies queued AiGateway quota operations
+type OutboxConfig struct {
+	PollIntervalSeconds int `mapstructure:"poll_interval_seconds"` // How often pending operations are retried, defaults to 5
+	MaxAttempts         int `mapstructure:"max_attempts"`          // Attempts before an operation is dead-lettered, defaults to 10
+	BatchSize           int `mapstructure:"batch_size"`            // Users dispatched per poll, defaults to 100
+}
+
+// ExpiryNotifyConfig configures warnings sent to users before their quota expires
+type ExpiryNotifyConfig struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Schedule       string `mapstructure:"schedule"`        // Cron expression (6 fields) of the warning job, defaults to 09:00 daily
+	LeadDays       []int  `mapstructure:"lead_days"`       // Days before expiry to warn, defaults to 7 and 1
+	WebhookURL     string `mapstructure:"webhook_url"`     // Endpoint receiving warning events, warnings are only logged when empty
+	WebhookSecret  string `mapstructure:"webhook_secret"`  // Signs the event body with HMAC-SHA256 when set
+	TimeoutSeconds int    `mapstructure:"timeout_seconds"` // Webhook request timeout, defaults to 10
+}
+
+// QuotaRequestConfig configures quota requests users file to each other
+type QuotaRequestConfig struct {
+	TTLHours            int                        `mapstructure:"ttl_hours"`            // Hours a request stays pending before it expires, defaults to 72
+	DepartmentApprovers []DepartmentApproverConfig `mapstructure:"department_approvers"` // Who approves requests sent to a department admin
+	WebhookURL          string                     `mapstructure:"webhook_url"`          // Endpoint receiving request events, events are only logged when empty
+	WebhookSecret       string                     `mapstructure:"webhook_secret"`       // Signs the event body with HMAC-SHA256 when set
+	TimeoutSeconds      int                        `mapstructure:"timeout_seconds"`      // Webhook request timeout, defaults to 10
+}
+
+// DepartmentApproverConfig names the user approving quota requests for a department
+type DepartmentApproverConfig struct {
+	Department string `mapstructure:"department"`  // Department name as synced from the HR system
+	ApproverID string `mapstructure:"approver_id"` // User ID of the approver
+}
+
+// TransferPolicyConfig configures guardrails on quota users send to each other. The first rule whose
+// giver condition matches the giver applies, givers matching no rule are not restricted.
+type TransferPolicyConfig struct {
+	Rules []TransferRuleConfig `mapstructure:"rules"`
+}
+
+// Receiver scopes of transfer rules
+const (
+	TransferScopeAny            = ""
+	TransferScopeSameDepartment = "same_department"
+	TransferScopeSameCompany    = "same_company"
+)
+
+// TransferRuleConfig limits the transfers of the givers it applies to. Zero values disable a check.
+type TransferRuleConfig struct {
+	Name              string         `mapstructure:"name"`                 // Reported in violations, the rule's 1-based position when empty
+	GiverCondition    string         `mapstructure:"giver_condition"`      // Condition expression selecting the givers, all givers when empty
+	DailyLimit        decimal.Amount `mapstructure:"daily_limit"`          // Most quota a giver may send per day
+	MonthlyLimit      decimal.Amount `mapstructure:"monthly_limit"`        // Most quota a giver may send per month
+	MaxSingleTransfer decimal.Amount `mapstructure:"max_single_transfer"`  // Most quota sent to one receiver at once
+	MinAccountAgeDays int            `mapstructure:"min_account_age_days"` // Giver accounts younger than this cannot send quota
+	ReceiverScope     string         `mapstructure:"receiver_scope"`       // same_department or same_company, any receiver when empty
+	ReceiverCondition string         `mapstructure:"receiver_condition"`   // Condition expression receivers must match
+}
+
+// MergeConfig configures user quota merges
+type MergeConfig struct {
+	UndoWindowHours int `mapstructure:"undo_window_hours"` // Hours an admin can undo a merge, defaults to 168 (7 days)
+}
+
+// ExpiryPolicyConfig configures what happens to quota when it expires. Strategies can override the
+// rollover percentage for the quota they grant.
+type ExpiryPolicyConfig struct {
+	GraceHours      int            `mapstructure:"grace_hours"`      // Quota stays usable this long after its expiry date
+	RolloverPercent int            `mapstructure:"rollover_percent"` // Share of unused expiring quota carried over, 0 disables rollover
+	RolloverCap     decimal.Amount `mapstructure:"rollover_cap"`     // Most quota carried over per user and expiry run, 0 for no cap
+	RolloverMonths  int            `mapstructure:"rollover_months"`  // Carried quota expires at the end of the month this many months after the original expiry, defaults to 1
 }
 
 type LogConfig struct {
@@ -80,6 +209,178 @@ func (a *AiGatewayConfig) GetBaseURL() string {
 	return "http://localhost:8002"
 }
 
+// GetTTL returns the voucher time-to-live
+func (v *VoucherConfig) GetTTL() time.Duration {
+	if v.TTLHours > 0 {
+		return time.Duration(v.TTLHours) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// GetDefaultTTL returns the hold lifetime used when a request sets none
+func (r *ReservationConfig) GetDefaultTTL() time.Duration {
+	if r.DefaultTTLMinutes > 0 {
+		return time.Duration(r.DefaultTTLMinutes) * time.Minute
+	}
+	return time.Hour
+}
+
+// GetMaxTTL returns the longest hold a caller may request
+func (r *ReservationConfig) GetMaxTTL() time.Duration {
+	if r.MaxTTLMinutes > 0 {
+		return time.Duration(r.MaxTTLMinutes) * time.Minute
+	}
+	return 24 * time.Hour
+}
+
+// GetPollInterval returns how often the dispatcher looks for due operations
+func (o *OutboxConfig) GetPollInterval() time.Duration {
+	if o.PollIntervalSeconds > 0 {
+		return time.Duration(o.PollIntervalSeconds) * time.Second
+	}
+	return 5 * time.Second
+}
+
+// GetMaxAttempts returns how many times an operation is tried before it is dead-lettered
+func (o *OutboxConfig) GetMaxAttempts() int {
+	if o.MaxAttempts > 0 {
+		return o.MaxAttempts
+	}
+	return 10
+}
+
+// GetBatchSize returns how many users are dispatched per poll
+func (o *OutboxConfig) GetBatchSize() int {
+	if o.BatchSize > 0 {
+		return o.BatchSize
+	}
+	return 100
+}
+
+// GetSchedule returns the cron expression of the expiry warning job
+func (e *ExpiryNotifyConfig) GetSchedule() string {
+	if e.Schedule != "" {
+		return e.Schedule
+	}
+	return "0 0 9 * * *"
+}
+
+// GetLeadDays returns the lead times to warn at, longest first
+func (e *ExpiryNotifyConfig) GetLeadDays() []int {
+	leadDays := make([]int, 0, len(e.LeadDays))
+	for _, days := range e.LeadDays {
+		if days > 0 {
+			leadDays = append(leadDays, days)
+		}
+	}
+	if len(leadDays) == 0 {
+		return []int{7, 1}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(leadDays)))
+	return leadDays
+}
+
+// GetTimeout returns the webhook request timeout
+func (e *ExpiryNotifyConfig) GetTimeout() time.Duration {
+	if e.TimeoutSeconds > 0 {
+		return time.Duration(e.TimeoutSeconds) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetTTL returns how long a quota request stays pending
+func (q *QuotaRequestConfig) GetTTL() time.Duration {
+	if q.TTLHours > 0 {
+		return time.Duration(q.TTLHours) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+// GetTimeout returns the webhook request timeout
+func (q *QuotaRequestConfig) GetTimeout() time.Duration {
+	if q.TimeoutSeconds > 0 {
+		return time.Duration(q.TimeoutSeconds) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// GetUndoWindow returns how long a merge can be undone
+func (m *MergeConfig) GetUndoWindow() time.Duration {
+	if m.UndoWindowHours > 0 {
+		return time.Duration(m.UndoWindowHours) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// GetGracePeriod returns how long quota stays usable after its expiry date
+func (e *ExpiryPolicyConfig) GetGracePeriod() time.Duration {
+	if e.GraceHours > 0 {
+		return time.Duration(e.GraceHours) * time.Hour
+	}
+	return 0
+}
+
+// GetRolloverPercent returns the default rollover percentage, limited to 0-100
+func (e *ExpiryPolicyConfig) GetRolloverPercent() int {
+	return min(max(e.RolloverPercent, 0), 100)
+}
+
+// GetRolloverCap returns the most quota carried over per user and run, zero for no cap
+func (e *ExpiryPolicyConfig) GetRolloverCap() decimal.Amount {
+	return positiveAmount(e.RolloverCap)
+}
+
+// GetRolloverMonths returns how many months after the original expiry carried quota expires
+func (e *ExpiryPolicyConfig) GetRolloverMonths() int {
+	if e.RolloverMonths > 0 {
+		return e.RolloverMonths
+	}
+	return 1
+}
+
+// GetDailyLimit returns the most quota a giver may send per day, zero for no limit
+func (t *TransferRuleConfig) GetDailyLimit() decimal.Amount {
+	return positiveAmount(t.DailyLimit)
+}
+
+// GetMonthlyLimit returns the most quota a giver may send per month, zero for no limit
+func (t *TransferRuleConfig) GetMonthlyLimit() decimal.Amount {
+	return positiveAmount(t.MonthlyLimit)
+}
+
+// GetMaxSingleTransfer returns the most quota sent to one receiver at once, zero for no limit
+func (t *TransferRuleConfig) GetMaxSingleTransfer() decimal.Amount {
+	return positiveAmount(t.MaxSingleTransfer)
+}
+
+// positiveAmount returns a configured amount, treating non-positive values as unset
+func positiveAmount(value decimal.Amount) decimal.Amount {
+	if value.IsPositive() {
+		return value
+	}
+	return decimal.Zero
+}
+
+// amountDecodeHook decodes configured numbers and strings into exact amounts, so a limit such as 0.1
+// is not rounded through a float
+func amountDecodeHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(decimal.Amount{}) {
+		return data, nil
+	}
+	switch value := data.(type) {
+	case string:
+		return decimal.Parse(value)
+	case int:
+		return decimal.New(int64(value)), nil
+	case int64:
+		return decimal.New(value), nil
+	case float64:
+		return decimal.Parse(strconv.FormatFloat(value, 'f', -1, 64))
+	default:
+		return nil, fmt.Errorf("cannot decode %s into an amount", from)
+	}
+}
+
 func LoadConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.AutomaticEnv()
@@ -89,7 +390,11 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := viper.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		amountDecodeHook,
+	))); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
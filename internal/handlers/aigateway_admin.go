@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"quota-manager/internal/response"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,13 +20,13 @@ func NewAiGatewayAdminHandler(svc *services.AiGatewayAdminService) *AiGatewayAdm
 
 // -------- Quota total --------
 type quotaBody struct {
-	UserID string  `json:"user_id"`
-	Quota  float64 `json:"quota"`
+	UserID string         `json:"user_id"`
+	Quota  decimal.Amount `json:"quota"`
 }
 
 type quotaDeltaBody struct {
-	UserID string  `json:"user_id"`
-	Value  float64 `json:"value"`
+	UserID string         `json:"user_id"`
+	Value  decimal.Amount `json:"value"`
 }
 
 func (h *AiGatewayAdminHandler) QueryQuota(c *gin.Context) {
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles API key management HTTP requests
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKey handles POST /quota-manager/api/v1/api-keys
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req services.CreateAPIKeyRequest
+	if err := validation.ValidateJSON(c, &req); err != nil {
+		return
+	}
+
+	createdBy := ""
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		createdBy = principal.Name()
+	}
+
+	key, err := h.apiKeyService.CreateAPIKey(&req, createdBy)
+	if err != nil {
+		h.handleError(c, err, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(key, "API key created successfully, store the key now as it cannot be retrieved again"))
+}
+
+// ListAPIKeys handles GET /quota-manager/api/v1/api-keys
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeyService.ListAPIKeys()
+	if err != nil {
+		h.handleError(c, err, "Failed to list API keys")
+		return
+	}
+
+	data := gin.H{
+		"total":    len(keys),
+		"api_keys": keys,
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "API keys retrieved successfully"))
+}
+
+// RotateAPIKey handles POST /quota-manager/api/v1/api-keys/:id/rotate
+func (h *APIKeyHandler) RotateAPIKey(c *gin.Context) {
+	id, ok := h.parseID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.RotateAPIKey(id)
+	if err != nil {
+		h.handleError(c, err, "Failed to rotate API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(key, "API key rotated successfully, store the key now as it cannot be retrieved again"))
+}
+
+// RevokeAPIKey handles POST /quota-manager/api/v1/api-keys/:id/revoke
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, ok := h.parseID(c)
+	if !ok {
+		return
+	}
+
+	key, err := h.apiKeyService.RevokeAPIKey(id)
+	if err != nil {
+		h.handleError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(key, "API key revoked successfully"))
+}
+
+// parseID parses the :id route parameter, writing a 400 response when it is invalid
+func (h *APIKeyHandler) parseID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid API key ID format"))
+		return 0, false
+	}
+	return id, true
+}
+
+// handleError maps service errors to HTTP responses
+func (h *APIKeyHandler) handleError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.APIKeyNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode, message+": "+err.Error()))
+}
+
+// RegisterAPIKeyRoutes registers API key management routes
+func RegisterAPIKeyRoutes(r *gin.RouterGroup, apiKeyHandler *APIKeyHandler) {
+	apiKeys := r.Group("/api-keys")
+	{
+		apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+		apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+		apiKeys.POST("/:id/rotate", apiKeyHandler.RotateAPIKey)
+		apiKeys.POST("/:id/revoke", apiKeyHandler.RevokeAPIKey)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BalanceHistoryQuery selects a single point (at) or a daily series (from, to)
+type BalanceHistoryQuery struct {
+	At   string `form:"at"`   // RFC3339 timestamp, defaults to now
+	From string `form:"from"` // First day of a daily series, YYYY-MM-DD
+	To   string `form:"to"`   // Last day of a daily series, YYYY-MM-DD, defaults to today
+}
+
+// GetBalanceHistory handles GET /quota-manager/api/v1/quota/balance-history
+func (h *QuotaHandler) GetBalanceHistory(c *gin.Context) {
+	userID, err := h.getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	h.respondBalanceHistory(c, userID)
+}
+
+// GetUserBalanceHistoryAdmin handles GET /quota-manager/api/v1/quota/balance-history/:user_id
+func (h *QuotaHandler) GetUserBalanceHistoryAdmin(c *gin.Context) {
+	var uriReq UserIDUri
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid user_id: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	h.respondBalanceHistory(c, uriReq.UserID)
+}
+
+// respondBalanceHistory answers a balance history query for userID
+func (h *QuotaHandler) respondBalanceHistory(c *gin.Context, userID string) {
+	var query BalanceHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid query parameters: "+err.Error()))
+		return
+	}
+	if query.At != "" && (query.From != "" || query.To != "") {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "at cannot be combined with from and to"))
+		return
+	}
+	if query.To != "" && query.From == "" {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "from is required with to"))
+		return
+	}
+
+	var data any
+	var err error
+	if query.From != "" {
+		data, err = h.quotaService.GetBalanceHistory(userID, query.From, query.To)
+	} else {
+		at := time.Now()
+		if query.At != "" {
+			if at, err = time.Parse(time.RFC3339, query.At); err != nil {
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "at must be an RFC3339 timestamp"))
+				return
+			}
+		}
+		data, err = h.quotaService.GetBalanceAt(userID, at)
+	}
+	if err != nil {
+		if serviceErr, ok := err.(*services.ServiceError); ok && serviceErr.Code == services.ErrorValidationFailed {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
+			"Failed to retrieve balance history: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Balance history retrieved successfully"))
+}
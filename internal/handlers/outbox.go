@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OutboxHandler handles AiGateway outbox inspection and replay requests
+type OutboxHandler struct {
+	dispatcher *services.OutboxDispatcher
+}
+
+// NewOutboxHandler creates a new outbox handler
+func NewOutboxHandler(dispatcher *services.OutboxDispatcher) *OutboxHandler {
+	return &OutboxHandler{
+		dispatcher: dispatcher,
+	}
+}
+
+// OutboxListQuery defines the filters for listing outbox operations
+type OutboxListQuery struct {
+	PaginationQuery
+	Status string `form:"status"`
+	UserID string `form:"user_id"`
+}
+
+// ListOutbox handles GET /quota-manager/api/v1/outbox
+func (h *OutboxHandler) ListOutbox(c *gin.Context) {
+	var req OutboxListQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+
+	switch req.Status {
+	case "", models.OutboxStatusPending, models.OutboxStatusDispatched, models.OutboxStatusDead:
+	default:
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"status must be one of PENDING, DISPATCHED or DEAD"))
+		return
+	}
+
+	page, pageSize, err := validation.ValidatePageParams(req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	result, err := h.dispatcher.ListItems(req.Status, req.UserID, page, pageSize)
+	if err != nil {
+		h.handleError(c, err, "Failed to list outbox operations")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, "Outbox operations retrieved successfully"))
+}
+
+// ReplayOutboxItem handles POST /quota-manager/api/v1/outbox/:id/replay
+func (h *OutboxHandler) ReplayOutboxItem(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid outbox operation ID format"))
+		return
+	}
+
+	item, err := h.dispatcher.Replay(id)
+	if err != nil {
+		h.handleError(c, err, "Failed to replay outbox operation")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(item, "Outbox operation replayed"))
+}
+
+// ReplayDeadOutbox handles POST /quota-manager/api/v1/outbox/replay-dead
+func (h *OutboxHandler) ReplayDeadOutbox(c *gin.Context) {
+	replayed, err := h.dispatcher.ReplayDead()
+	if err != nil {
+		h.handleError(c, err, "Failed to replay dead-lettered outbox operations")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(gin.H{"replayed": replayed}, "Dead-lettered outbox operations replayed"))
+}
+
+// handleError maps service errors to HTTP responses
+func (h *OutboxHandler) handleError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.OutboxItemNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode, message+": "+err.Error()))
+}
+
+// RegisterOutboxRoutes registers AiGateway outbox routes
+func RegisterOutboxRoutes(r *gin.RouterGroup, outboxHandler *OutboxHandler) {
+	outbox := r.Group("/outbox")
+	{
+		outbox.GET("", outboxHandler.ListOutbox)
+		outbox.POST("/:id/replay", outboxHandler.ReplayOutboxItem)
+		outbox.POST("/replay-dead", outboxHandler.ReplayDeadOutbox)
+	}
+}
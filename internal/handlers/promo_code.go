@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePromoCode handles POST /quota-manager/api/v1/quota/promo-codes
+func (h *QuotaHandler) CreatePromoCode(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract caller from request"))
+		return
+	}
+
+	var req services.CreatePromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	promo, err := h.quotaService.CreatePromoCode(principal.Name(), &req)
+	if err != nil {
+		h.handlePromoCodeError(c, err, "Failed to create promo code")
+		return
+	}
+
+	c.JSON(http.StatusCreated, response.NewSuccessResponse(promo, "Promo code created successfully"))
+}
+
+// GetPromoCodes handles GET /quota-manager/api/v1/quota/promo-codes
+func (h *QuotaHandler) GetPromoCodes(c *gin.Context) {
+	promos, err := h.quotaService.GetPromoCodes()
+	if err != nil {
+		h.handlePromoCodeError(c, err, "Failed to list promo codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(promos, "Promo codes retrieved successfully"))
+}
+
+// DisablePromoCode handles POST /quota-manager/api/v1/quota/promo-codes/:id/disable
+func (h *QuotaHandler) DisablePromoCode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid promo code ID format"))
+		return
+	}
+
+	promo, err := h.quotaService.DisablePromoCode(id)
+	if err != nil {
+		h.handlePromoCodeError(c, err, "Failed to disable promo code")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(promo, "Promo code disabled successfully"))
+}
+
+// RedeemPromoCode handles POST /quota-manager/api/v1/quota/redeem
+func (h *QuotaHandler) RedeemPromoCode(c *gin.Context) {
+	user, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req services.RedeemPromoCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	resp, err := h.quotaService.RedeemPromoCode(user, &req)
+	if err != nil {
+		h.handlePromoCodeError(c, err, "Failed to redeem promo code")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Promo code redeemed successfully"))
+}
+
+// handlePromoCodeError maps promo code service errors to HTTP responses
+func (h *QuotaHandler) handlePromoCodeError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.PromoCodeNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.PromoCodeUnavailableCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
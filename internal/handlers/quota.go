@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"quota-manager/internal/auth"
 	"quota-manager/internal/config"
 	"quota-manager/internal/models"
 	"quota-manager/internal/response"
@@ -14,22 +15,35 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// IdempotencyKeyHeader carries the client-chosen key that makes a write request safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
 // QuotaHandler handles quota-related HTTP requests
 type QuotaHandler struct {
-	quotaService *services.QuotaService
-	serverConfig *config.ServerConfig
+	quotaService  *services.QuotaService
+	serverConfig  *config.ServerConfig
+	tokenVerifier *auth.TokenVerifier
 }
 
 // NewQuotaHandler creates a new quota handler
-func NewQuotaHandler(quotaService *services.QuotaService, serverConfig *config.ServerConfig) *QuotaHandler {
+func NewQuotaHandler(quotaService *services.QuotaService, serverConfig *config.ServerConfig, tokenVerifier *auth.TokenVerifier) *QuotaHandler {
 	return &QuotaHandler{
-		quotaService: quotaService,
-		serverConfig: serverConfig,
+		quotaService:  quotaService,
+		serverConfig:  serverConfig,
+		tokenVerifier: tokenVerifier,
 	}
 }
 
-// getUserFromToken extracts user info from token in request header
+// getUserFromToken extracts user info from token in request header.
+// When the authorization middleware already authenticated the caller, its principal is reused.
 func (h *QuotaHandler) getUserFromToken(c *gin.Context) (*models.AuthUser, error) {
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		if principal.User == nil {
+			return nil, fmt.Errorf("caller %s has no user identity", principal.Name())
+		}
+		return principal.User, nil
+	}
+
 	tokenHeader := h.serverConfig.TokenHeader
 	if tokenHeader == "" {
 		tokenHeader = "authorization"
@@ -40,7 +54,7 @@ func (h *QuotaHandler) getUserFromToken(c *gin.Context) (*models.AuthUser, error
 		return nil, fmt.Errorf("missing token in header: %s", tokenHeader)
 	}
 
-	return models.ParseUserInfoFromToken(token)
+	return h.tokenVerifier.ParseUserInfo(token)
 }
 
 // getUserIDFromToken extracts user ID from token in request header
@@ -82,44 +96,6 @@ type UserIDUri struct {
 	UserID string `uri:"user_id" binding:"required" validate:"required,uuid"`
 }
 
-// GetQuotaAuditRecords handles GET /quota-manager/api/v1/quota/audit
-func (h *QuotaHandler) GetQuotaAuditRecords(c *gin.Context) {
-	userID, err := h.getUserIDFromToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
-			"Failed to extract user from token: "+err.Error()))
-		return
-	}
-
-	var req PaginationQuery
-	if err := c.ShouldBindQuery(&req); err != nil {
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
-			"Invalid query parameters: "+err.Error()))
-		return
-	}
-
-	// Validate and normalize pagination parameters
-	page, pageSize, err := validation.ValidatePageParams(req.Page, req.PageSize)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
-		return
-	}
-
-	records, total, err := h.quotaService.GetQuotaAuditRecords(userID, page, pageSize)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
-			"Failed to retrieve quota audit records: "+err.Error()))
-		return
-	}
-
-	data := gin.H{
-		"total":   total,
-		"records": records,
-	}
-
-	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Quota audit records retrieved successfully"))
-}
-
 // TransferOut handles POST /quota-manager/api/v1/quota/transfer-out
 func (h *QuotaHandler) TransferOut(c *gin.Context) {
 	giver, err := h.getUserFromToken(c)
@@ -158,6 +134,9 @@ func (h *QuotaHandler) TransferOut(c *gin.Context) {
 
 	resp, err := h.quotaService.TransferOut(giver, &req)
 	if err != nil {
+		if respondTransferPolicyError(c, err) {
+			return
+		}
 		// Business logic errors (insufficient quota, etc.) should return 400
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "receiver_id cannot be empty") ||
@@ -176,6 +155,61 @@ func (h *QuotaHandler) TransferOut(c *gin.Context) {
 	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota transferred out successfully"))
 }
 
+// respondTransferPolicyError writes a 403 response when err is a transfer rule violation
+func respondTransferPolicyError(c *gin.Context, err error) bool {
+	serviceErr, ok := err.(*services.ServiceError)
+	if !ok || serviceErr.Code != services.ErrorTransferPolicy {
+		return false
+	}
+	c.JSON(http.StatusForbidden, response.NewErrorResponse(response.TransferPolicyCode, serviceErr.Message))
+	return true
+}
+
+// BatchTransferOut handles POST /quota-manager/api/v1/quota/transfer-out/batch
+func (h *QuotaHandler) BatchTransferOut(c *gin.Context) {
+	giver, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req services.BatchTransferOutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	for i := range req.Receivers {
+		req.Receivers[i].ReceiverID = strings.TrimSpace(req.Receivers[i].ReceiverID)
+	}
+
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	resp, err := h.quotaService.BatchTransferOut(giver, &req)
+	if err != nil {
+		if respondTransferPolicyError(c, err) {
+			return
+		}
+		errMsg := err.Error()
+		if serviceErr, ok := err.(*services.ServiceError); (ok && serviceErr.Code == services.ErrorValidationFailed) ||
+			strings.Contains(errMsg, "insufficient") ||
+			strings.Contains(errMsg, "quota not found") {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.QuotaTransferFailedCode,
+				"Transfer validation failed: "+errMsg))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.QuotaTransferFailedCode,
+			"Failed to transfer out quota: "+errMsg))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota transferred out successfully"))
+}
+
 // TransferIn handles POST /quota-manager/api/v1/quota/transfer-in
 func (h *QuotaHandler) TransferIn(c *gin.Context) {
 	receiver, err := h.getUserFromToken(c)
@@ -205,6 +239,12 @@ func (h *QuotaHandler) TransferIn(c *gin.Context) {
 		return
 	}
 
+	if resp.Status == services.TransferStatusVoucherExpired {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.VoucherExpiredCode,
+			resp.Message))
+		return
+	}
+
 	// Check if the transfer had business logic issues (voucher validation, etc.)
 	if resp.Status == services.TransferStatusFailed {
 		// These are business logic failures, should return 400
@@ -216,92 +256,109 @@ func (h *QuotaHandler) TransferIn(c *gin.Context) {
 	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota transferred in successfully"))
 }
 
-// MergeUserQuota handles POST /quota-manager/api/v1/quota/merge
-func (h *QuotaHandler) MergeUserQuota(c *gin.Context) {
-	_, err := h.getUserFromToken(c)
+// TransferCancel handles POST /quota-manager/api/v1/quota/transfer-cancel
+func (h *QuotaHandler) TransferCancel(c *gin.Context) {
+	giver, err := h.getUserFromToken(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
 			"Failed to extract user from token: "+err.Error()))
 		return
 	}
 
-	var req services.MergeQuotaRequest
+	var req services.TransferCancelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
 			"Invalid request body: "+err.Error()))
 		return
 	}
-
 	if err := validation.ValidateStruct(&req); err != nil {
 		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
 		return
 	}
 
-	resp, err := h.quotaService.MergeUserQuota(&req)
+	resp, err := h.quotaService.CancelTransfer(giver, &req)
 	if err != nil {
-		// Database/system errors
-		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode,
-			"Failed to merge quota: "+err.Error()))
-		return
-	}
-
-	// Check if the merge had business logic issues
-	if resp.Status == "FAILED" {
-		// Business logic failures, should return 400
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, resp.Message))
+		if serviceErr, ok := err.(*services.ServiceError); ok {
+			switch serviceErr.Code {
+			case services.ErrorValidationFailed:
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.VoucherInvalidCode, serviceErr.Message))
+				return
+			case services.ErrorConflict:
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.VoucherRedeemedCode, serviceErr.Message))
+				return
+			}
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.QuotaTransferFailedCode,
+			"Failed to cancel transfer: "+err.Error()))
 		return
 	}
 
-	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota merged successfully"))
-}
-
-// GetUserQuotaAuditRecordsAdminEmptyID handles the case when user_id is empty
-func (h *QuotaHandler) GetUserQuotaAuditRecordsAdminEmptyID(c *gin.Context) {
-	c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
-		"user_id is required and cannot be empty"))
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Transfer cancelled successfully"))
 }
 
-// GetUserQuotaAuditRecordsAdmin gets quota audit records for a specific user (admin function)
-func (h *QuotaHandler) GetUserQuotaAuditRecordsAdmin(c *gin.Context) {
-	// Bind user_id from URI
-	var uriReq UserIDUri
-	if err := c.ShouldBindUri(&uriReq); err != nil {
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid user_id: "+err.Error()))
+// DeductQuota handles POST /quota-manager/api/v1/quota/deduct.
+// The Idempotency-Key header, or reference_id when the header is absent, makes retries safe.
+func (h *QuotaHandler) DeductQuota(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract caller from request"))
 		return
 	}
 
-	// Validate user_id
-	if err := validation.ValidateStruct(&uriReq); err != nil {
+	var req services.DeductQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	req.UserID = strings.TrimSpace(req.UserID)
+	if err := validation.ValidateStruct(&req); err != nil {
 		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
 		return
 	}
 
-	// Bind pagination parameters from query
-	var queryReq PaginationQuery
-	if err := c.ShouldBindQuery(&queryReq); err != nil {
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid query parameters: "+err.Error()))
+	idempotencyKey := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+	if idempotencyKey == "" {
+		idempotencyKey = req.ReferenceID
+	}
+	if idempotencyKey == "" {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			IdempotencyKeyHeader+" header or reference_id is required"))
 		return
 	}
-
-	// Validate and normalize pagination parameters
-	page, pageSize, err := validation.ValidatePageParams(queryReq.Page, queryReq.PageSize)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+	if len(idempotencyKey) > 255 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			IdempotencyKeyHeader+" must be at most 255 characters"))
 		return
 	}
 
-	records, total, err := h.quotaService.GetUserQuotaAuditRecords(uriReq.UserID, page, pageSize)
+	resp, err := h.quotaService.DeductQuotaIdempotent(principal.Name(), idempotencyKey, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode, "Failed to retrieve quota audit records: "+err.Error()))
+		if serviceErr, ok := err.(*services.ServiceError); ok {
+			switch serviceErr.Code {
+			case services.ErrorValidationFailed:
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+				return
+			case services.ErrorInsufficientQuota:
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.InsufficientQuotaCode, serviceErr.Message))
+				return
+			case services.ErrorConflict:
+				c.JSON(http.StatusConflict, response.NewErrorResponse(response.IdempotencyConflictCode, serviceErr.Message))
+				return
+			}
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode,
+			"Failed to deduct quota: "+err.Error()))
 		return
 	}
 
-	data := gin.H{
-		"total":   total,
-		"records": records,
+	if resp.Replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota deduction already processed"))
+		return
 	}
-
-	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "User quota audit records retrieved successfully"))
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota deducted successfully"))
 }
 
 // RegisterQuotaRoutes registers quota-related routes
@@ -310,9 +367,41 @@ func RegisterQuotaRoutes(r *gin.RouterGroup, quotaHandler *QuotaHandler) {
 	{
 		quota.GET("", quotaHandler.GetUserQuota)
 		quota.GET("/audit", quotaHandler.GetQuotaAuditRecords)
+		quota.GET("/audits", quotaHandler.SearchQuotaAudit)
+		quota.GET("/expiring", quotaHandler.GetExpiringQuota)
+		quota.GET("/expiring/summary", quotaHandler.GetExpiringQuotaSummary)
+		quota.GET("/balance-history", quotaHandler.GetBalanceHistory)
+		quota.GET("/balance-history/:user_id", quotaHandler.GetUserBalanceHistoryAdmin)
 		quota.POST("/transfer-out", quotaHandler.TransferOut)
+		quota.POST("/transfer-out/batch", quotaHandler.BatchTransferOut)
 		quota.POST("/transfer-in", quotaHandler.TransferIn)
+		quota.POST("/transfer-cancel", quotaHandler.TransferCancel)
+		quota.POST("/red-packets", quotaHandler.CreateRedPacket)
+		quota.POST("/red-packets/claim", quotaHandler.ClaimRedPacket)
+		quota.POST("/redeem", quotaHandler.RedeemPromoCode)
+		quota.POST("/requests", quotaHandler.CreateQuotaRequest)
+		quota.GET("/requests", quotaHandler.GetSentQuotaRequests)
+		quota.GET("/requests/inbox", quotaHandler.GetQuotaRequestInbox)
+		quota.GET("/requests/:id", quotaHandler.GetQuotaRequest)
+		quota.POST("/requests/:id/approve", quotaHandler.ApproveQuotaRequest)
+		quota.POST("/requests/:id/reject", quotaHandler.RejectQuotaRequest)
+		quota.POST("/requests/:id/cancel", quotaHandler.CancelQuotaRequest)
+		quota.POST("/promo-codes", quotaHandler.CreatePromoCode)
+		quota.GET("/promo-codes", quotaHandler.GetPromoCodes)
+		quota.POST("/promo-codes/:id/disable", quotaHandler.DisablePromoCode)
 		quota.POST("/merge", quotaHandler.MergeUserQuota)
+		quota.GET("/merge/preview", quotaHandler.PreviewMergeUserQuota)
+		quota.GET("/merges", quotaHandler.GetQuotaMerges)
+		quota.POST("/merges/:id/undo", quotaHandler.UndoQuotaMerge)
+		quota.POST("/deduct", quotaHandler.DeductQuota)
+		quota.POST("/reservations", quotaHandler.CreateReservation)
+		quota.GET("/reservations/:id", quotaHandler.GetReservation)
+		quota.POST("/reservations/:id/capture", quotaHandler.CaptureReservation)
+		quota.POST("/reservations/:id/release", quotaHandler.ReleaseReservation)
+		quota.POST("/adjust", quotaHandler.AdjustQuota)
+		quota.POST("/adjust/bulk", quotaHandler.BulkAdjustQuota)
+		quota.GET("/reconciliation/reports", quotaHandler.GetReconciliationReports)
+		quota.GET("/reconciliation/reports/:id", quotaHandler.GetReconciliationReport)
 		// Handle empty user_id case (must be before parameterized route)
 		quota.GET("/audit/", quotaHandler.GetUserQuotaAuditRecordsAdminEmptyID)
 		quota.GET("/audit/:user_id", quotaHandler.GetUserQuotaAuditRecordsAdmin)
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdjustQuota handles POST /quota-manager/api/v1/quota/adjust
+func (h *QuotaHandler) AdjustQuota(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract caller from request"))
+		return
+	}
+
+	var req services.AdjustQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	req.UserID = strings.TrimSpace(req.UserID)
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	result, err := h.quotaService.AdjustQuota(principal.Name(), &req)
+	if err != nil {
+		h.handleAdjustError(c, err, "Failed to adjust quota")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, "Quota adjusted successfully"))
+}
+
+// BulkAdjustQuota handles POST /quota-manager/api/v1/quota/adjust/bulk
+func (h *QuotaHandler) BulkAdjustQuota(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract caller from request"))
+		return
+	}
+
+	var req services.BulkAdjustQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	result, err := h.quotaService.BulkAdjustQuota(principal.Name(), &req)
+	if err != nil {
+		h.handleAdjustError(c, err, "Failed to adjust quota")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, "Bulk quota adjustment completed"))
+}
+
+// handleAdjustError maps adjustment service errors to HTTP responses
+func (h *QuotaHandler) handleAdjustError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorInsufficientQuota:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.InsufficientQuotaCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
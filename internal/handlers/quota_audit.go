@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"quota-manager/pkg/decimal"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditSearchQuery represents the query parameters for filtering and paging quota audit records
+type AuditSearchQuery struct {
+	PaginationQuery
+	Operation    string `form:"operation"` // One operation, or several separated by commas
+	StrategyID   int    `form:"strategy_id" validate:"omitempty,gt=0"`
+	StrategyName string `form:"strategy_name"`
+	RelatedUser  string `form:"related_user"`
+	VoucherCode  string `form:"voucher_code"`
+	MinAmount    string `form:"min_amount"` // Inclusive, compared with the absolute amount
+	MaxAmount    string `form:"max_amount"` // Inclusive, compared with the absolute amount
+	Since        string `form:"since"`      // RFC3339 timestamp, inclusive
+	Until        string `form:"until"`      // RFC3339 timestamp, exclusive
+	Order        string `form:"order" validate:"omitempty,oneof=asc desc"`
+	Cursor       string `form:"cursor"`                            // next_cursor of the previous page, replaces page
+	UserID       string `form:"user_id" validate:"omitempty,uuid"` // Only used by the search across all users
+}
+
+// GetQuotaAuditRecords handles GET /quota-manager/api/v1/quota/audit
+func (h *QuotaHandler) GetQuotaAuditRecords(c *gin.Context) {
+	userID, err := h.getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	h.respondQuotaAudit(c, userID, "Quota audit records retrieved successfully")
+}
+
+// GetUserQuotaAuditRecordsAdminEmptyID handles the case when user_id is empty
+func (h *QuotaHandler) GetUserQuotaAuditRecordsAdminEmptyID(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+		"user_id is required and cannot be empty"))
+}
+
+// GetUserQuotaAuditRecordsAdmin gets quota audit records for a specific user (admin function)
+func (h *QuotaHandler) GetUserQuotaAuditRecordsAdmin(c *gin.Context) {
+	// Bind user_id from URI
+	var uriReq UserIDUri
+	if err := c.ShouldBindUri(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid user_id: "+err.Error()))
+		return
+	}
+
+	// Validate user_id
+	if err := validation.ValidateStruct(&uriReq); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	h.respondQuotaAudit(c, uriReq.UserID, "User quota audit records retrieved successfully")
+}
+
+// SearchQuotaAudit handles GET /quota-manager/api/v1/quota/audits, searching the audit records of all
+// users unless the user_id parameter selects one
+func (h *QuotaHandler) SearchQuotaAudit(c *gin.Context) {
+	h.respondQuotaAudit(c, "", "Quota audit records retrieved successfully")
+}
+
+// respondQuotaAudit answers an audit search over the records of userID, or of the user_id parameter
+// when userID is empty
+func (h *QuotaHandler) respondQuotaAudit(c *gin.Context, userID, message string) {
+	var query AuditSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+	query.Order = strings.ToLower(query.Order)
+	if err := validation.ValidateStruct(&query); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	// Validate and normalize pagination parameters
+	page, pageSize, err := validation.ValidatePageParams(query.Page, query.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	filter, err := query.toFilter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+	if userID != "" {
+		filter.UserID = userID
+	}
+
+	result, err := h.quotaService.SearchQuotaAudit(filter, query.Cursor, page, pageSize)
+	if err != nil {
+		if serviceErr, ok := err.(*services.ServiceError); ok && serviceErr.Code == services.ErrorValidationFailed {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
+			"Failed to retrieve quota audit records: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, message))
+}
+
+// toFilter parses the query into an audit search filter
+func (q *AuditSearchQuery) toFilter() (*services.QuotaAuditFilter, error) {
+	filter := &services.QuotaAuditFilter{
+		UserID:       q.UserID,
+		StrategyID:   q.StrategyID,
+		StrategyName: q.StrategyName,
+		RelatedUser:  q.RelatedUser,
+		VoucherCode:  q.VoucherCode,
+		Ascending:    q.Order == "asc",
+	}
+	for _, operation := range strings.Split(q.Operation, ",") {
+		if operation = strings.ToUpper(strings.TrimSpace(operation)); operation != "" {
+			filter.Operations = append(filter.Operations, operation)
+		}
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value string
+		dest  **decimal.Amount
+	}{
+		{"min_amount", q.MinAmount, &filter.MinAmount},
+		{"max_amount", q.MaxAmount, &filter.MaxAmount},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		amount, err := decimal.Parse(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number", bound.name)
+		}
+		*bound.dest = &amount
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && filter.MinAmount.GreaterThan(*filter.MaxAmount) {
+		return nil, fmt.Errorf("min_amount cannot be greater than max_amount")
+	}
+
+	for _, bound := range []struct {
+		name  string
+		value string
+		dest  **time.Time
+	}{
+		{"since", q.Since, &filter.Since},
+		{"until", q.Until, &filter.Until},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC3339 timestamp", bound.name)
+		}
+		*bound.dest = &at
+	}
+	if filter.Since != nil && filter.Until != nil && !filter.Since.Before(*filter.Until) {
+		return nil, fmt.Errorf("since must be before until")
+	}
+	return filter, nil
+}
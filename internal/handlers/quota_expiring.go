@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"quota-manager/internal/response"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultExpiringWithin = 7 * 24 * time.Hour
+	maxExpiringWithin     = 366 * 24 * time.Hour
+)
+
+// GetExpiringQuota handles GET /quota-manager/api/v1/quota/expiring?within=7d
+func (h *QuotaHandler) GetExpiringQuota(c *gin.Context) {
+	userID, err := h.getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	within, err := parseWithin(c.Query("within"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	expiring, err := h.quotaService.GetExpiringQuota(userID, within)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode,
+			"Failed to retrieve expiring quota: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(expiring, "Expiring quota retrieved successfully"))
+}
+
+// GetExpiringQuotaSummary handles GET /quota-manager/api/v1/quota/expiring/summary?within=30d
+func (h *QuotaHandler) GetExpiringQuotaSummary(c *gin.Context) {
+	within, err := parseWithin(c.Query("within"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	summary, err := h.quotaService.GetExpiringQuotaSummary(within)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
+			"Failed to retrieve expiring quota summary: "+err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(summary, "Expiring quota summary retrieved successfully"))
+}
+
+// parseWithin parses a look-ahead window given in days ("7d") or as a Go duration ("36h").
+// An empty value means 7 days.
+func parseWithin(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultExpiringWithin, nil
+	}
+
+	var within time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid within %q, expected e.g. 7d or 36h", value)
+		}
+		within = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if within, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("invalid within %q, expected e.g. 7d or 36h", value)
+		}
+	}
+
+	if within <= 0 || within > maxExpiringWithin {
+		return 0, fmt.Errorf("within must be positive and at most %d days", int(maxExpiringWithin/(24*time.Hour)))
+	}
+	return within, nil
+}
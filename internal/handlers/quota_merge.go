@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MergePreviewQuery represents the query parameters for previewing a merge
+type MergePreviewQuery struct {
+	MainUserID       string `form:"main_user_id" validate:"required,uuid"`
+	OtherUserID      string `form:"other_user_id" validate:"required,uuid"`
+	CarryPermissions bool   `form:"carry_permissions"`
+}
+
+// QuotaMergeListQuery represents the query parameters for listing merge records
+type QuotaMergeListQuery struct {
+	PaginationQuery
+	UserID string `form:"user_id" validate:"omitempty,uuid"`
+}
+
+// MergeUserQuota handles POST /quota-manager/api/v1/quota/merge
+func (h *QuotaHandler) MergeUserQuota(c *gin.Context) {
+	operator, ok := h.mergeOperator(c)
+	if !ok {
+		return
+	}
+
+	var req services.MergeQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	resp, err := h.quotaService.MergeUserQuota(operator, &req)
+	if err != nil {
+		h.handleMergeError(c, err, "Failed to merge quota")
+		return
+	}
+
+	// Check if the merge had business logic issues
+	if resp.Status == "FAILED" {
+		// Business logic failures, should return 400
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, resp.Message))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Quota merged successfully"))
+}
+
+// PreviewMergeUserQuota handles GET /quota-manager/api/v1/quota/merge/preview
+func (h *QuotaHandler) PreviewMergeUserQuota(c *gin.Context) {
+	var req MergePreviewQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	preview, err := h.quotaService.PreviewMergeUserQuota(&services.MergeQuotaRequest{
+		MainUserID:       req.MainUserID,
+		OtherUserID:      req.OtherUserID,
+		CarryPermissions: req.CarryPermissions,
+	})
+	if err != nil {
+		h.handleMergeError(c, err, "Failed to preview merge")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(preview, "Merge preview retrieved successfully"))
+}
+
+// GetQuotaMerges handles GET /quota-manager/api/v1/quota/merges
+func (h *QuotaHandler) GetQuotaMerges(c *gin.Context) {
+	var req QuotaMergeListQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+	page, pageSize, err := validation.ValidatePageParams(req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	merges, total, err := h.quotaService.GetQuotaMerges(req.UserID, page, pageSize)
+	if err != nil {
+		h.handleMergeError(c, err, "Failed to list merge records")
+		return
+	}
+
+	data := gin.H{
+		"total":  total,
+		"merges": merges,
+	}
+	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Merge records retrieved successfully"))
+}
+
+// UndoQuotaMerge handles POST /quota-manager/api/v1/quota/merges/:id/undo
+func (h *QuotaHandler) UndoQuotaMerge(c *gin.Context) {
+	operator, ok := h.mergeOperator(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid merge ID format"))
+		return
+	}
+
+	merge, err := h.quotaService.UndoQuotaMerge(operator, id)
+	if err != nil {
+		h.handleMergeError(c, err, "Failed to undo merge")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(merge, "Merge undone successfully"))
+}
+
+// mergeOperator names the caller of a merge operation, writing a 401 response when there is none.
+// Merges are admin operations and may be invoked by a service account or API key.
+func (h *QuotaHandler) mergeOperator(c *gin.Context) (string, bool) {
+	if principal, ok := auth.PrincipalFromContext(c); ok {
+		return principal.Name(), true
+	}
+	user, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return "", false
+	}
+	return user.Name, true
+}
+
+// handleMergeError maps merge service errors to HTTP responses
+func (h *QuotaHandler) handleMergeError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.QuotaMergeNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.MergeNotUndoableCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
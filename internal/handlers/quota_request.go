@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuotaRequestListQuery represents the query parameters for listing quota requests
+type QuotaRequestListQuery struct {
+	PaginationQuery
+	Status string `form:"status" validate:"omitempty,oneof=PENDING APPROVED REJECTED CANCELLED EXPIRED"`
+}
+
+// CreateQuotaRequest handles POST /quota-manager/api/v1/quota/requests
+func (h *QuotaHandler) CreateQuotaRequest(c *gin.Context) {
+	requester, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req services.CreateQuotaRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	request, err := h.quotaService.CreateQuotaRequest(requester, &req)
+	if err != nil {
+		h.handleQuotaRequestError(c, err, "Failed to create quota request")
+		return
+	}
+
+	c.JSON(http.StatusCreated, response.NewSuccessResponse(request, "Quota request created successfully"))
+}
+
+// GetSentQuotaRequests handles GET /quota-manager/api/v1/quota/requests
+func (h *QuotaHandler) GetSentQuotaRequests(c *gin.Context) {
+	h.listQuotaRequests(c, false)
+}
+
+// GetQuotaRequestInbox handles GET /quota-manager/api/v1/quota/requests/inbox
+func (h *QuotaHandler) GetQuotaRequestInbox(c *gin.Context) {
+	h.listQuotaRequests(c, true)
+}
+
+// listQuotaRequests lists the caller's sent requests, or the requests waiting on the caller when inbox is set
+func (h *QuotaHandler) listQuotaRequests(c *gin.Context, inbox bool) {
+	userID, err := h.getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req QuotaRequestListQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+	req.Status = strings.ToUpper(req.Status)
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+	page, pageSize, err := validation.ValidatePageParams(req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	requests, total, err := h.quotaService.GetQuotaRequests(userID, inbox, req.Status, page, pageSize)
+	if err != nil {
+		h.handleQuotaRequestError(c, err, "Failed to list quota requests")
+		return
+	}
+
+	data := gin.H{
+		"total":    total,
+		"requests": requests,
+	}
+	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Quota requests retrieved successfully"))
+}
+
+// GetQuotaRequest handles GET /quota-manager/api/v1/quota/requests/:id
+func (h *QuotaHandler) GetQuotaRequest(c *gin.Context) {
+	userID, err := h.getUserIDFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+	id, ok := parseQuotaRequestID(c)
+	if !ok {
+		return
+	}
+
+	detail, err := h.quotaService.GetQuotaRequest(userID, id)
+	if err != nil {
+		h.handleQuotaRequestError(c, err, "Failed to get quota request")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(detail, "Quota request retrieved successfully"))
+}
+
+// ApproveQuotaRequest handles POST /quota-manager/api/v1/quota/requests/:id/approve
+func (h *QuotaHandler) ApproveQuotaRequest(c *gin.Context) {
+	approver, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+	id, ok := parseQuotaRequestID(c)
+	if !ok {
+		return
+	}
+
+	var req services.ApproveQuotaRequestRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+				"Invalid request body: "+err.Error()))
+			return
+		}
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	result, err := h.quotaService.ApproveQuotaRequest(approver, id, &req)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "insufficient") || strings.Contains(errMsg, "quota not found") {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.QuotaTransferFailedCode,
+				"Transfer validation failed: "+errMsg))
+			return
+		}
+		h.handleQuotaRequestError(c, err, "Failed to approve quota request")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, "Quota request approved successfully"))
+}
+
+// RejectQuotaRequest handles POST /quota-manager/api/v1/quota/requests/:id/reject
+func (h *QuotaHandler) RejectQuotaRequest(c *gin.Context) {
+	h.closeQuotaRequest(c, models.QuotaRequestStatusRejected)
+}
+
+// CancelQuotaRequest handles POST /quota-manager/api/v1/quota/requests/:id/cancel
+func (h *QuotaHandler) CancelQuotaRequest(c *gin.Context) {
+	h.closeQuotaRequest(c, models.QuotaRequestStatusCancelled)
+}
+
+// closeQuotaRequest rejects the request as its approver, or cancels it as its requester
+func (h *QuotaHandler) closeQuotaRequest(c *gin.Context, status string) {
+	user, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+	id, ok := parseQuotaRequestID(c)
+	if !ok {
+		return
+	}
+
+	var req services.DecideQuotaRequestRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+				"Invalid request body: "+err.Error()))
+			return
+		}
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	var request *models.QuotaRequest
+	if status == models.QuotaRequestStatusRejected {
+		request, err = h.quotaService.RejectQuotaRequest(user, id, &req)
+	} else {
+		request, err = h.quotaService.CancelQuotaRequest(user, id, &req)
+	}
+	if err != nil {
+		h.handleQuotaRequestError(c, err, "Failed to update quota request")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(request, "Quota request "+strings.ToLower(status)+" successfully"))
+}
+
+// parseQuotaRequestID parses the :id route parameter, writing a 400 response when it is invalid
+func parseQuotaRequestID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid quota request ID format"))
+		return 0, false
+	}
+	return id, true
+}
+
+// handleQuotaRequestError maps quota request service errors to HTTP responses
+func (h *QuotaHandler) handleQuotaRequestError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorInsufficientQuota:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.QuotaTransferFailedCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.QuotaRequestNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.QuotaRequestClosedCode, serviceErr.Message))
+			return
+		case services.ErrorTransferPolicy:
+			c.JSON(http.StatusForbidden, response.NewErrorResponse(response.TransferPolicyCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetReconciliationReports handles GET /quota-manager/api/v1/quota/reconciliation/reports
+func (h *QuotaHandler) GetReconciliationReports(c *gin.Context) {
+	var req PaginationQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid query parameters: "+err.Error()))
+		return
+	}
+
+	page, pageSize, err := validation.ValidatePageParams(req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	reports, total, err := h.quotaService.GetReconciliationReports(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
+			"Failed to retrieve reconciliation reports: "+err.Error()))
+		return
+	}
+
+	data := gin.H{
+		"total":   total,
+		"reports": reports,
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Reconciliation reports retrieved successfully"))
+}
+
+// GetReconciliationReport handles GET /quota-manager/api/v1/quota/reconciliation/reports/:id.
+// With ?format=csv the mismatches are returned as a CSV file instead of JSON.
+func (h *QuotaHandler) GetReconciliationReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid report ID format"))
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "format must be json or csv"))
+		return
+	}
+
+	report, err := h.quotaService.GetReconciliationReport(id)
+	if err != nil {
+		if serviceErr, ok := err.(*services.ServiceError); ok && serviceErr.Code == services.ErrorResourceNotFound {
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.ReportNotFoundCode, serviceErr.Message))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode,
+			"Failed to retrieve reconciliation report: "+err.Error()))
+		return
+	}
+
+	if format == "csv" {
+		data, err := reconciliationReportCSV(report)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode,
+				"Failed to encode reconciliation report: "+err.Error()))
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="reconciliation-report-%d.csv"`, report.ID))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(report, "Reconciliation report retrieved successfully"))
+}
+
+// reconciliationReportCSV encodes the mismatches of a report, one row per mismatch
+func reconciliationReportCSV(report *services.ReconciliationReportDetail) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	rows := [][]string{{"user_id", "category", "db_quota", "gateway_quota", "gateway_used", "audit_sum",
+		"pending_operations", "difference", "fixed", "message"}}
+	for _, item := range report.Items {
+		rows = append(rows, []string{
+			item.UserID,
+			item.Category,
+			item.DBQuota.String(),
+			item.GatewayQuota.String(),
+			item.GatewayUsed.String(),
+			item.AuditSum.String(),
+			strconv.FormatInt(item.PendingOperations, 10),
+			item.Difference.String(),
+			strconv.FormatBool(item.Fixed),
+			item.Message,
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateRedPacket handles POST /quota-manager/api/v1/quota/red-packets
+func (h *QuotaHandler) CreateRedPacket(c *gin.Context) {
+	giver, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req services.CreateRedPacketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	packet, err := h.quotaService.CreateRedPacket(giver, &req)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "insufficient") || strings.Contains(errMsg, "quota not found") {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.QuotaTransferFailedCode,
+				"Transfer validation failed: "+errMsg))
+			return
+		}
+		h.handleRedPacketError(c, err, "Failed to create red packet")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(packet, "Red packet created successfully"))
+}
+
+// ClaimRedPacket handles POST /quota-manager/api/v1/quota/red-packets/claim
+func (h *QuotaHandler) ClaimRedPacket(c *gin.Context) {
+	user, err := h.getUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract user from token: "+err.Error()))
+		return
+	}
+
+	var req services.ClaimRedPacketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	resp, err := h.quotaService.ClaimRedPacket(user, &req)
+	if err != nil {
+		h.handleRedPacketError(c, err, "Failed to claim red packet")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(resp, "Red packet claimed successfully"))
+}
+
+// handleRedPacketError maps red packet service errors to HTTP responses
+func (h *QuotaHandler) handleRedPacketError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.RedPacketNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.RedPacketUnavailableCode, serviceErr.Message))
+			return
+		case services.ErrorTransferPolicy:
+			c.JSON(http.StatusForbidden, response.NewErrorResponse(response.TransferPolicyCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/internal/validation"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateReservation handles POST /quota-manager/api/v1/quota/reservations
+func (h *QuotaHandler) CreateReservation(c *gin.Context) {
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode,
+			"Failed to extract caller from request"))
+		return
+	}
+
+	var req services.CreateReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+			"Invalid request body: "+err.Error()))
+		return
+	}
+	req.UserID = strings.TrimSpace(req.UserID)
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	reservation, err := h.quotaService.CreateReservation(principal.Name(), &req)
+	if err != nil {
+		h.handleReservationError(c, err, "Failed to create reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(reservation, "Quota reserved successfully"))
+}
+
+// GetReservation handles GET /quota-manager/api/v1/quota/reservations/:id
+func (h *QuotaHandler) GetReservation(c *gin.Context) {
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+
+	reservation, err := h.quotaService.GetReservation(id)
+	if err != nil {
+		h.handleReservationError(c, err, "Failed to get reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(reservation, "Reservation retrieved successfully"))
+}
+
+// CaptureReservation handles POST /quota-manager/api/v1/quota/reservations/:id/capture
+func (h *QuotaHandler) CaptureReservation(c *gin.Context) {
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+
+	// An empty body captures the full hold
+	var req services.CaptureReservationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode,
+				"Invalid request body: "+err.Error()))
+			return
+		}
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	reservation, err := h.quotaService.CaptureReservation(id, &req)
+	if err != nil {
+		h.handleReservationError(c, err, "Failed to capture reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(reservation, "Reservation captured successfully"))
+}
+
+// ReleaseReservation handles POST /quota-manager/api/v1/quota/reservations/:id/release
+func (h *QuotaHandler) ReleaseReservation(c *gin.Context) {
+	id, ok := parseReservationID(c)
+	if !ok {
+		return
+	}
+
+	reservation, err := h.quotaService.ReleaseReservation(id)
+	if err != nil {
+		h.handleReservationError(c, err, "Failed to release reservation")
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(reservation, "Reservation released successfully"))
+}
+
+// parseReservationID parses the :id route parameter, writing a 400 response when it is invalid
+func parseReservationID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid reservation ID format"))
+		return 0, false
+	}
+	return id, true
+}
+
+// handleReservationError maps reservation service errors to HTTP responses
+func (h *QuotaHandler) handleReservationError(c *gin.Context, err error, message string) {
+	if serviceErr, ok := err.(*services.ServiceError); ok {
+		switch serviceErr.Code {
+		case services.ErrorValidationFailed:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+			return
+		case services.ErrorInsufficientQuota:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.InsufficientQuotaCode, serviceErr.Message))
+			return
+		case services.ErrorResourceNotFound:
+			c.JSON(http.StatusNotFound, response.NewErrorResponse(response.ReservationNotFoundCode, serviceErr.Message))
+			return
+		case services.ErrorConflict:
+			c.JSON(http.StatusConflict, response.NewErrorResponse(response.ReservationNotHeldCode, serviceErr.Message))
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.InternalErrorCode, message+": "+err.Error()))
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
 	"quota-manager/internal/response"
 	"quota-manager/internal/services"
 
@@ -28,7 +30,9 @@ func NewScanHandler(strategyService *services.StrategyService, unifiedPermission
 
 // ScanRequest represents the scan request body
 type ScanRequest struct {
-	Type string `json:"type" validate:"required,oneof=strategy employee-sync expire-quotas sync-quotas"`
+	Type    string   `json:"type" validate:"required,oneof=strategy employee-sync expire-quotas expiry-warnings balance-snapshots expire-quota-requests sync-quotas"`
+	Mode    string   `json:"mode,omitempty"`     // sync-quotas only: dry-run or fix (default)
+	UserIDs []string `json:"user_ids,omitempty"` // sync-quotas only: limit the run to these users
 }
 
 // TriggerScan handles unified scan triggering
@@ -52,9 +56,39 @@ func (h *ScanHandler) TriggerScan(c *gin.Context) {
 	case "expire-quotas":
 		go h.schedulerService.ExpireQuotasTask()
 		c.JSON(http.StatusOK, response.NewSuccessResponse(nil, "Quota expiry task triggered successfully"))
+	case "expiry-warnings":
+		go h.schedulerService.SendExpiryWarningsTask()
+		c.JSON(http.StatusOK, response.NewSuccessResponse(nil, "Expiry warning task triggered successfully"))
+	case "balance-snapshots":
+		go h.schedulerService.SnapshotBalancesTask()
+		c.JSON(http.StatusOK, response.NewSuccessResponse(nil, "Balance snapshot task triggered successfully"))
+	case "expire-quota-requests":
+		go h.schedulerService.ExpireQuotaRequestsTask()
+		c.JSON(http.StatusOK, response.NewSuccessResponse(nil, "Quota request expiry task triggered successfully"))
 	case "sync-quotas":
-		go h.quotaService.SyncQuotasWithAiGateway()
-		c.JSON(http.StatusOK, response.NewSuccessResponse(nil, "Quota sync task triggered successfully"))
+		mode := models.ReconcileModeFix
+		switch req.Mode {
+		case "", "fix":
+		case "dry-run":
+			mode = models.ReconcileModeDryRun
+		default:
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid sync mode: "+req.Mode+", must be dry-run or fix"))
+			return
+		}
+		triggeredBy := ""
+		if principal, ok := auth.PrincipalFromContext(c); ok {
+			triggeredBy = principal.Name()
+		}
+		report, err := h.quotaService.StartReconciliation(&services.ReconciliationRequest{
+			Mode:        mode,
+			UserIDs:     req.UserIDs,
+			TriggeredBy: triggeredBy,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.DatabaseErrorCode, "Failed to start quota sync: "+err.Error()))
+			return
+		}
+		c.JSON(http.StatusOK, response.NewSuccessResponse(report, "Quota sync task triggered successfully"))
 	default:
 		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid scan type: "+req.Type))
 	}
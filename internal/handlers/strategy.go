@@ -2,11 +2,13 @@ package handlers
 
 import (
 	"net/http"
+	"quota-manager/internal/auth"
 	"quota-manager/internal/condition"
 	"quota-manager/internal/models"
 	"quota-manager/internal/response"
 	"quota-manager/internal/services"
 	"quota-manager/internal/validation"
+	"quota-manager/pkg/decimal"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -126,16 +128,17 @@ func (h *StrategyHandler) UpdateStrategy(c *gin.Context) {
 	}
 
 	type UpdateStrategyRequest struct {
-		Name           *string  `json:"name" validate:"omitempty,min=1,max=100"`
-		Title          *string  `json:"title" validate:"omitempty,min=1,max=200"`
-		Type           *string  `json:"type" validate:"omitempty,oneof=single periodic"`
-		Amount         *float64 `json:"amount" validate:"omitempty"`
-		PeriodicExpr   *string  `json:"periodic_expr" validate:"omitempty,cron"`
-		Model          *string  `json:"model" validate:"omitempty,min=1,max=100"`
-		Condition      *string  `json:"condition" validate:"omitempty"`
-		Status         *bool    `json:"status"`
-		MaxExecPerUser *int     `json:"max_exec_per_user" validate:"omitempty,gte=0"`
-		ExpiryDays     *int     `json:"expiry_days" validate:"omitempty,gte=1"`
+		Name            *string         `json:"name" validate:"omitempty,min=1,max=100"`
+		Title           *string         `json:"title" validate:"omitempty,min=1,max=200"`
+		Type            *string         `json:"type" validate:"omitempty,oneof=single periodic"`
+		Amount          *decimal.Amount `json:"amount" validate:"omitempty"`
+		PeriodicExpr    *string         `json:"periodic_expr" validate:"omitempty,cron"`
+		Model           *string         `json:"model" validate:"omitempty,min=1,max=100"`
+		Condition       *string         `json:"condition" validate:"omitempty"`
+		Status          *bool           `json:"status"`
+		MaxExecPerUser  *int            `json:"max_exec_per_user" validate:"omitempty,gte=0"`
+		ExpiryDays      *int            `json:"expiry_days" validate:"omitempty,gte=1"`
+		RolloverPercent *int            `json:"rollover_percent" validate:"omitempty,gte=0,lte=100"`
 	}
 
 	var req UpdateStrategyRequest
@@ -204,6 +207,9 @@ func (h *StrategyHandler) UpdateStrategy(c *gin.Context) {
 		// if expiry_days is not set, set it to nil
 		updates["expiry_days"] = nil
 	}
+	if req.RolloverPercent != nil {
+		updates["rollover_percent"] = *req.RolloverPercent
+	}
 
 	if err := h.service.UpdateStrategy(id, updates); err != nil {
 		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.StrategyUpdateFailedCode, "Failed to update strategy: "+err.Error()))
@@ -305,3 +311,51 @@ func (h *StrategyHandler) GetStrategyExecuteRecords(c *gin.Context) {
 
 	c.JSON(http.StatusOK, response.NewSuccessResponse(data, "Strategy execution records retrieved successfully"))
 }
+
+// RevertStrategy claws back the unconsumed quota granted by a batch or time range of strategy executions
+func (h *StrategyHandler) RevertStrategy(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.InvalidStrategyIDCode, "Invalid strategy ID format"))
+		return
+	}
+
+	principal, ok := auth.PrincipalFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(response.TokenInvalidCode, "Failed to extract caller from request"))
+		return
+	}
+
+	var req services.RevertStrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, "Invalid request body: "+err.Error()))
+		return
+	}
+	if err := validation.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, err.Error()))
+		return
+	}
+
+	result, err := h.service.RevertStrategy(principal.Name(), id, &req)
+	if err != nil {
+		if serviceErr, ok := err.(*services.ServiceError); ok {
+			switch serviceErr.Code {
+			case services.ErrorValidationFailed:
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(response.BadRequestCode, serviceErr.Message))
+				return
+			case services.ErrorResourceNotFound:
+				c.JSON(http.StatusNotFound, response.NewErrorResponse(response.StrategyNotFoundCode, serviceErr.Message))
+				return
+			}
+		}
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(response.StrategyUpdateFailedCode, "Failed to revert strategy: "+err.Error()))
+		return
+	}
+
+	message := "Strategy reverted successfully"
+	if req.Preview {
+		message = "Strategy revert previewed successfully"
+	}
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result, message))
+}
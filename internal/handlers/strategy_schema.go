@@ -7,6 +7,7 @@ import (
 	"quota-manager/internal/response"
 	"quota-manager/internal/services"
 	"quota-manager/internal/validation"
+	"quota-manager/pkg/decimal"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -91,8 +92,11 @@ func (h *StrategySchemaHandler) UpdateStrategySchema(c *gin.Context) {
 		}
 	}
 	if amount, exists := updates["amount"]; exists {
-		if amountFloat, ok := amount.(float64); ok {
-			tempStrategy.Amount = amountFloat
+		switch v := amount.(type) {
+		case decimal.Amount:
+			tempStrategy.Amount = v
+		case float64:
+			tempStrategy.Amount = decimal.FromFloat(v)
 		}
 	}
 	if model, exists := updates["model"]; exists {
@@ -1,7 +1,6 @@
 package models
 
 import (
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -9,9 +8,10 @@ import (
 
 	"quota-manager/internal/config"
 	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
 )
 
-// AuthUser struct for parsing user info from JWT
+// AuthUser holds the user info carried in verified JWT claims
 type AuthUser struct {
 	ID      string `json:"universal_id"`
 	Name    string `json:"name"`
@@ -20,75 +20,37 @@ type AuthUser struct {
 	Phone   string `json:"phone"`
 }
 
-// parseUserInfoFromToken parses user info from JWT token
-func ParseUserInfoFromToken(accessToken string) (*AuthUser, error) {
-	// Remove "Bearer " prefix if present
-	if strings.HasPrefix(accessToken, "Bearer ") {
-		accessToken = accessToken[7:]
-	}
-
-	// Split JWT token into parts
-	parts := strings.Split(accessToken, ".")
-	if len(parts) != 3 {
-		return nil, fmt.Errorf("invalid JWT token format")
-	}
-
-	// Decode payload (second part)
-	payload := parts[1]
-	// Add padding if needed
-	if m := len(payload) % 4; m != 0 {
-		payload += strings.Repeat("=", 4-m)
-	}
-
-	payloadBytes, err := base64.URLEncoding.DecodeString(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode JWT payload: %w", err)
-	}
-
-	// Parse claims
-	var claims map[string]interface{}
-	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JWT claims: %w", err)
-	}
-
-	// Extract user ID
-	var userInfo AuthUser
-	if id, ok := claims["universal_id"].(string); ok {
-		userInfo.ID = id
-	} else {
-		return nil, fmt.Errorf("user ID not found in JWT token")
-	}
-
-	return &userInfo, nil
-}
-
 // QuotaStrategy strategy table structure
 type QuotaStrategy struct {
-	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name           string    `gorm:"uniqueIndex;not null" json:"name" validate:"required,min=1,max=100"`
-	Title          string    `gorm:"not null" json:"title" validate:"required,min=1,max=200"`
-	Type           string    `gorm:"not null" json:"type" validate:"required,oneof=single periodic"` // periodic/single
-	Amount         float64   `gorm:"not null" json:"amount"`
-	Model          string    `json:"model" validate:"omitempty,min=1,max=100"`
-	PeriodicExpr   string    `gorm:"column:periodic_expr" json:"periodic_expr" validate:"omitempty,cron"`
-	Condition      string    `json:"condition" validate:"omitempty"`
-	MaxExecPerUser int       `gorm:"column:max_exec_per_user;default:0" json:"max_exec_per_user" validate:"gte=0"`
-	ExpiryDays     *int      `gorm:"column:expiry_days" json:"expiry_days" validate:"omitempty,gte=1"`
-	Status         bool      `gorm:"not null;default:true" json:"status"` // true=enabled, false=disabled
-	CreateTime     time.Time `gorm:"autoCreateTime" json:"create_time"`
-	UpdateTime     time.Time `gorm:"autoUpdateTime" json:"update_time"`
+	ID              int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name            string         `gorm:"uniqueIndex;not null" json:"name" validate:"required,min=1,max=100"`
+	Title           string         `gorm:"not null" json:"title" validate:"required,min=1,max=200"`
+	Type            string         `gorm:"not null" json:"type" validate:"required,oneof=single periodic"` // periodic/single
+	Amount          decimal.Amount `gorm:"not null" json:"amount"`
+	Model           string         `json:"model" validate:"omitempty,min=1,max=100"`
+	PeriodicExpr    string         `gorm:"column:periodic_expr" json:"periodic_expr" validate:"omitempty,cron"`
+	Condition       string         `json:"condition" validate:"omitempty"`
+	MaxExecPerUser  int            `gorm:"column:max_exec_per_user;default:0" json:"max_exec_per_user" validate:"gte=0"`
+	ExpiryDays      *int           `gorm:"column:expiry_days" json:"expiry_days" validate:"omitempty,gte=1"`
+	RolloverPercent *int           `gorm:"column:rollover_percent" json:"rollover_percent" validate:"omitempty,gte=0,lte=100"` // Overrides the expiry policy rollover percentage for granted quota, 0 never rolls over
+	Status          bool           `gorm:"not null;default:true" json:"status"`                                                // true=enabled, false=disabled
+	CreateTime      time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime      time.Time      `gorm:"autoUpdateTime" json:"update_time"`
 }
 
 // QuotaExecute execution status table
 type QuotaExecute struct {
-	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	StrategyID  int       `gorm:"not null;index" json:"strategy_id"`
-	User        string    `gorm:"column:user_id;not null;index" json:"user"`
-	BatchNumber string    `gorm:"not null;index" json:"batch_number"`
-	Status      string    `gorm:"not null" json:"status"`
-	ExpiryDate  time.Time `gorm:"not null" json:"expiry_date"`
-	CreateTime  time.Time `gorm:"autoCreateTime" json:"create_time"`
-	UpdateTime  time.Time `gorm:"autoUpdateTime" json:"update_time"`
+	ID          int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	StrategyID  int            `gorm:"not null;index" json:"strategy_id"`
+	User        string         `gorm:"column:user_id;not null;index" json:"user"`
+	BatchNumber string         `gorm:"not null;index" json:"batch_number"`
+	Status      string         `gorm:"not null" json:"status"`
+	RecipientID string         `gorm:"size:255;index" json:"recipient_id"` // User the quota was granted to, differs from user for inviter strategies
+	Amount      decimal.Amount `gorm:"not null;default:0" json:"amount"`   // Amount granted, 0 for executions recorded before it was tracked
+	Model       string         `gorm:"not null;default:'';size:100" json:"model"`
+	ExpiryDate  time.Time      `gorm:"not null" json:"expiry_date"`
+	CreateTime  time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime  time.Time      `gorm:"autoUpdateTime" json:"update_time"`
 }
 
 // UserInfo user information table
@@ -117,28 +79,38 @@ type UserInfo struct {
 
 // Quota user quota table with expiry time
 type Quota struct {
-	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID     string    `gorm:"not null;index;size:255" json:"user_id"`
-	Amount     float64   `gorm:"not null" json:"amount"`
-	ExpiryDate time.Time `gorm:"not null;index" json:"expiry_date"`
-	Status     string    `gorm:"not null;default:VALID;index;size:20" json:"status"` // VALID/EXPIRED
-	CreateTime time.Time `gorm:"autoCreateTime" json:"create_time"`
-	UpdateTime time.Time `gorm:"autoUpdateTime" json:"update_time"`
+	ID         int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     string         `gorm:"not null;index;size:255" json:"user_id"`
+	Amount     decimal.Amount `gorm:"not null" json:"amount"`
+	Model      string         `gorm:"not null;default:'';index;size:100" json:"model,omitempty"` // Model or model group the quota is restricted to, empty for the general pool
+	ExpiryDate time.Time      `gorm:"not null;index" json:"expiry_date"`
+	Status     string         `gorm:"not null;default:VALID;index;size:20" json:"status"` // VALID/EXPIRED
+	CreateTime time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime time.Time      `gorm:"autoUpdateTime" json:"update_time"`
 }
 
 // QuotaAudit quota change audit log
 type QuotaAudit struct {
-	ID           int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID       string    `gorm:"not null;index;size:255" json:"user_id"`
-	Amount       float64   `gorm:"not null" json:"amount"`                  // positive or negative
-	Operation    string    `gorm:"not null;index;size:50" json:"operation"` // RECHARGE/TRANSFER_IN/TRANSFER_OUT
-	VoucherCode  string    `gorm:"index;size:1000" json:"voucher_code,omitempty"`
-	RelatedUser  string    `gorm:"size:255" json:"related_user,omitempty"`
-	StrategyID   *int      `gorm:"index" json:"strategy_id,omitempty"`            // Strategy ID for RECHARGE operations
-	StrategyName string    `gorm:"index;size:100" json:"strategy_name,omitempty"` // Strategy name for RECHARGE operations
-	ExpiryDate   time.Time `gorm:"not null" json:"expiry_date"`
-	Details      string    `gorm:"type:text" json:"details,omitempty"` // JSON string with detailed operation info
-	CreateTime   time.Time `gorm:"autoCreateTime;index" json:"create_time"`
+	ID            int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        string         `gorm:"not null;index;size:255" json:"user_id"`
+	Amount        decimal.Amount `gorm:"not null" json:"amount"`                  // positive or negative
+	Operation     string         `gorm:"not null;index;size:50" json:"operation"` // RECHARGE/TRANSFER_IN/TRANSFER_OUT
+	VoucherCode   string         `gorm:"index;size:1000" json:"voucher_code,omitempty"`
+	RelatedUser   string         `gorm:"size:255" json:"related_user,omitempty"`
+	StrategyID    *int           `gorm:"index" json:"strategy_id,omitempty"`            // Strategy ID for RECHARGE operations
+	StrategyName  string         `gorm:"index;size:100" json:"strategy_name,omitempty"` // Strategy name for RECHARGE operations
+	Reason        string         `gorm:"size:255" json:"reason,omitempty"`              // Caller-supplied reason for DEDUCT and ADMIN_ADJUST operations
+	ReferenceID   string         `gorm:"index;size:255" json:"reference_id,omitempty"`  // Caller-side reference for DEDUCT, ticket for ADMIN_ADJUST operations
+	Model         string         `gorm:"size:255" json:"model,omitempty"`               // Model bucket for RECHARGE, model charged for DEDUCT operations
+	ReservationID *int           `gorm:"index" json:"reservation_id,omitempty"`         // Reservation for RESERVATION_* operations
+	Operator      string         `gorm:"index;size:255" json:"operator,omitempty"`      // Acting admin for ADMIN_ADJUST operations
+	RedPacketID   *int           `gorm:"index" json:"red_packet_id,omitempty"`          // Red packet funded, claimed or refunded by TRANSFER_* operations
+	PromoCode     string         `gorm:"index;size:50" json:"promo_code,omitempty"`     // Code redeemed by PROMO_REDEEM operations
+	RequestID     *int           `gorm:"index" json:"request_id,omitempty"`             // Approved quota request behind TRANSFER_* operations
+	MergeID       *int           `gorm:"index" json:"merge_id,omitempty"`               // Merge behind MERGE_* operations
+	ExpiryDate    time.Time      `gorm:"not null" json:"expiry_date"`
+	Details       string         `gorm:"type:text" json:"details,omitempty"` // JSON string with detailed operation info
+	CreateTime    time.Time      `gorm:"autoCreateTime;index" json:"create_time"`
 }
 
 // QuotaAuditDetails contains detailed information about quota operations
@@ -150,32 +122,309 @@ type QuotaAuditDetails struct {
 
 // QuotaAuditSummary contains summary information
 type QuotaAuditSummary struct {
-	TotalAmount        float64 `json:"total_amount"`
-	TotalItems         int     `json:"total_items"`
-	SuccessfulItems    int     `json:"successful_items,omitempty"`
-	FailedItems        int     `json:"failed_items,omitempty"`
-	ExpiredItems       int     `json:"expired_items,omitempty"`
-	EarliestExpiryDate string  `json:"earliest_expiry_date"`
+	TotalAmount        decimal.Amount `json:"total_amount"`
+	TotalItems         int            `json:"total_items"`
+	SuccessfulItems    int            `json:"successful_items,omitempty"`
+	FailedItems        int            `json:"failed_items,omitempty"`
+	ExpiredItems       int            `json:"expired_items,omitempty"`
+	EarliestExpiryDate string         `json:"earliest_expiry_date"`
 }
 
 // QuotaAuditDetailItem represents individual quota item in audit
 type QuotaAuditDetailItem struct {
-	Amount        float64 `json:"amount"`
-	ExpiryDate    string  `json:"expiry_date"`
-	Status        string  `json:"status"` // SUCCESS/FAILED/EXPIRED
-	FailureReason string  `json:"failure_reason,omitempty"`
-	OriginalQuota float64 `json:"original_quota,omitempty"` // For TRANSFER_IN: existing quota before transfer
-	NewQuota      float64 `json:"new_quota,omitempty"`      // For TRANSFER_IN: quota after transfer
-}
-
-// VoucherRedemption track redeemed vouchers to prevent duplicate redemption
+	Amount        decimal.Amount `json:"amount"`
+	ExpiryDate    string         `json:"expiry_date"`
+	Status        string         `json:"status"` // SUCCESS/FAILED/EXPIRED
+	FailureReason string         `json:"failure_reason,omitempty"`
+	OriginalQuota decimal.Amount `json:"original_quota"`         // For TRANSFER_IN: existing quota before transfer
+	NewQuota      decimal.Amount `json:"new_quota"`              // For TRANSFER_IN: quota after transfer
+	RelatedUser   string         `json:"related_user,omitempty"` // For batch TRANSFER_OUT: receiver of the item
+	VoucherCode   string         `json:"voucher_code,omitempty"` // For batch TRANSFER_OUT: voucher issued to the receiver
+}
+
+// VoucherRedemption track redeemed vouchers to prevent duplicate redemption.
+// A voucher is claimed exactly once: redeemed by the receiver, cancelled by the giver, or refunded on expiry.
 type VoucherRedemption struct {
 	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
 	VoucherCode string    `gorm:"uniqueIndex;not null;size:1000" json:"voucher_code"`
-	ReceiverID  string    `gorm:"not null;size:255" json:"receiver_id"`
+	ReceiverID  string    `gorm:"not null;size:255" json:"receiver_id"`            // User who claimed the voucher, the giver for cancellations and refunds
+	Status      string    `gorm:"not null;default:REDEEMED;size:20" json:"status"` // REDEEMED/CANCELLED/REFUNDED
 	CreateTime  time.Time `gorm:"autoCreateTime" json:"create_time"`
 }
 
+// QuotaReservation is a hold on part of a user's quota that is later captured as a deduction or released.
+// Holds only reduce available balance, quota rows and AiGateway change when the hold is captured.
+type QuotaReservation struct {
+	ID             int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         string         `gorm:"not null;index;size:255" json:"user_id"`
+	Amount         decimal.Amount `gorm:"not null" json:"amount"`                            // Amount held
+	CapturedAmount decimal.Amount `gorm:"not null;default:0" json:"captured_amount"`         // Amount converted into a deduction
+	Status         string         `gorm:"not null;default:HELD;index;size:20" json:"status"` // HELD/CAPTURED/RELEASED/EXPIRED
+	Items          string         `gorm:"type:text;not null" json:"-"`                       // JSON-encoded per-bucket holds
+	Reason         string         `gorm:"size:255" json:"reason,omitempty"`
+	ReferenceID    string         `gorm:"index;size:255" json:"reference_id,omitempty"`
+	CreatedBy      string         `gorm:"size:255" json:"created_by"`
+	ExpiresAt      time.Time      `gorm:"not null;index" json:"expires_at"`
+	SettledAt      *time.Time     `json:"settled_at,omitempty"` // When the hold was captured, released or expired
+	CreateTime     time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime     time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// ReservationItem is the part of a hold placed on one quota bucket
+type ReservationItem struct {
+	Amount     decimal.Amount `json:"amount"`
+	ExpiryDate time.Time      `json:"expiry_date"`
+}
+
+// GatewayOutbox is an AiGateway quota operation written in the same transaction as the quota change it mirrors.
+// The outbox dispatcher applies pending operations of a user in ID order.
+type GatewayOutbox struct {
+	ID            int64          `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        string         `gorm:"not null;size:255;index:idx_gateway_outbox_user_status,priority:1" json:"user_id"`
+	Operation     string         `gorm:"not null;size:50" json:"operation"` // DELTA_QUOTA/DELTA_MODEL_QUOTA/REFRESH_MODEL_QUOTA/DELTA_USED_QUOTA/REFRESH_QUOTA
+	Model         string         `gorm:"not null;default:'';size:100" json:"model,omitempty"`
+	Value         decimal.Amount `gorm:"not null" json:"value"`
+	Source        string         `gorm:"size:50" json:"source"`                                                                          // Audit operation that produced it, e.g. TRANSFER_OUT
+	Status        string         `gorm:"not null;default:PENDING;size:20;index:idx_gateway_outbox_user_status,priority:2" json:"status"` // PENDING/DISPATCHED/DEAD
+	Attempts      int            `gorm:"not null;default:0" json:"attempts"`
+	LastError     string         `gorm:"type:text" json:"last_error,omitempty"`
+	NextAttemptAt time.Time      `gorm:"not null;index" json:"next_attempt_at"`
+	DispatchedAt  *time.Time     `json:"dispatched_at,omitempty"`
+	CreateTime    time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime    time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// ReconciliationReport is one run comparing the quota table, AiGateway and the audit ledger
+type ReconciliationReport struct {
+	ID              int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Mode            string     `gorm:"not null;size:20" json:"mode"`                   // DRY_RUN/FIX
+	Status          string     `gorm:"not null;default:RUNNING;size:20" json:"status"` // RUNNING/COMPLETED/FAILED
+	TriggeredBy     string     `gorm:"size:255" json:"triggered_by,omitempty"`         // Principal that started the run
+	UserIDs         string     `gorm:"type:text" json:"user_ids,omitempty"`            // Comma-separated users the run was limited to, empty for all
+	TotalUsers      int        `gorm:"not null;default:0" json:"total_users"`          // Users checked
+	MismatchedUsers int        `gorm:"not null;default:0" json:"mismatched_users"`     // Users with at least one mismatch
+	Mismatches      int        `gorm:"not null;default:0" json:"mismatches"`           // Mismatches found
+	Fixed           int        `gorm:"not null;default:0" json:"fixed"`                // Mismatches corrected in FIX mode
+	Error           string     `gorm:"type:text" json:"error,omitempty"`               // Why a FAILED run stopped
+	StartedAt       time.Time  `gorm:"not null" json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreateTime      time.Time  `gorm:"autoCreateTime;index" json:"create_time"`
+}
+
+// ReconciliationItem is one mismatch found for a user in a reconciliation run
+type ReconciliationItem struct {
+	ID                int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReportID          int            `gorm:"not null;index" json:"report_id"`
+	UserID            string         `gorm:"not null;index;size:255" json:"user_id"`
+	Category          string         `gorm:"not null;size:50" json:"category"` // GATEWAY_QUOTA_MISMATCH/USED_EXCEEDS_QUOTA/AUDIT_MISMATCH/GATEWAY_UNAVAILABLE
+	DBQuota           decimal.Amount `gorm:"column:db_quota;not null;default:0" json:"db_quota"`
+	GatewayQuota      decimal.Amount `gorm:"not null;default:0" json:"gateway_quota"` // AiGateway total including queued outbox deltas
+	GatewayUsed       decimal.Amount `gorm:"not null;default:0" json:"gateway_used"`  // AiGateway used including queued outbox deltas
+	AuditSum          decimal.Amount `gorm:"not null;default:0" json:"audit_sum"`
+	PendingOperations int64          `gorm:"not null;default:0" json:"pending_operations"` // Pending or dead outbox operations of the user
+	Difference        decimal.Amount `gorm:"not null;default:0" json:"difference"`         // Expected minus actual value for the category
+	Fixed             bool           `gorm:"not null;default:false" json:"fixed"`
+	Message           string         `gorm:"type:text" json:"message,omitempty"` // Error details or why the mismatch was not fixed
+	CreateTime        time.Time      `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// ExpiryNotification records an expiry warning sent for one of a user's expiry dates, so each lead time
+// is announced once
+type ExpiryNotification struct {
+	ID         int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     string         `gorm:"not null;size:255;uniqueIndex:idx_expiry_notifications_user_expiry_lead" json:"user_id"`
+	ExpiryDate time.Time      `gorm:"not null;uniqueIndex:idx_expiry_notifications_user_expiry_lead" json:"expiry_date"`
+	LeadDays   int            `gorm:"not null;uniqueIndex:idx_expiry_notifications_user_expiry_lead" json:"lead_days"` // Lead time the warning was sent for
+	Amount     decimal.Amount `gorm:"not null" json:"amount"`                                                          // Amount announced as expiring
+	CreateTime time.Time      `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// QuotaBalanceSnapshot records a user's cumulative balance totals at a point in time, so balance history
+// queries only replay the audit records created after it
+type QuotaBalanceSnapshot struct {
+	ID           int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       string         `gorm:"not null;size:255;uniqueIndex:idx_quota_balance_snapshots_user_time" json:"user_id"`
+	SnapshotTime time.Time      `gorm:"not null;uniqueIndex:idx_quota_balance_snapshots_user_time" json:"snapshot_time"` // Covers audit records created before this time
+	ValidQuota   decimal.Amount `gorm:"not null" json:"valid_quota"`
+	ExpiredQuota decimal.Amount `gorm:"not null" json:"expired_quota"` // Total expired before snapshot time
+	UsedQuota    decimal.Amount `gorm:"not null" json:"used_quota"`    // AiGateway used quota when the snapshot was created
+	CreateTime   time.Time      `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// IdempotencyKey records a processed idempotent request with its response, so retries replay the original result
+type IdempotencyKey struct {
+	ID          int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Caller      string    `gorm:"not null;size:255;uniqueIndex:idx_idempotency_caller_op_key" json:"caller"`
+	Operation   string    `gorm:"not null;size:50;uniqueIndex:idx_idempotency_caller_op_key" json:"operation"`
+	Key         string    `gorm:"column:idempotency_key;not null;size:255;uniqueIndex:idx_idempotency_caller_op_key" json:"idempotency_key"`
+	RequestHash string    `gorm:"not null;size:64" json:"-"` // SHA-256 of the request, a reused key must carry the same request
+	Response    string    `gorm:"type:text" json:"-"`        // JSON-encoded response of the original request
+	CreateTime  time.Time `gorm:"autoCreateTime;index" json:"create_time"`
+}
+
+// Voucher stores the payload of a short-code voucher server side, so the code itself carries no user data
+type Voucher struct {
+	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code       string    `gorm:"uniqueIndex;not null;size:20" json:"code"`
+	GiverID    string    `gorm:"not null;index;size:255" json:"giver_id"`
+	ReceiverID string    `gorm:"not null;index;size:255" json:"receiver_id"`
+	Payload    string    `gorm:"type:text;not null" json:"-"`                         // JSON-encoded voucher data
+	Status     string    `gorm:"not null;default:ISSUED;index;size:20" json:"status"` // ISSUED/REDEEMED/CANCELLED/EXPIRED
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+	CreateTime time.Time `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime time.Time `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// JobWatermark records how far a scheduled job has processed, so later runs skip what it already covered
+type JobWatermark struct {
+	Job            string    `gorm:"primaryKey;size:100" json:"job"`
+	ProcessedUntil time.Time `gorm:"not null" json:"processed_until"` // Records before this time need no more processing
+	UpdateTime     time.Time `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// RedPacket is an open voucher: a pot of quota funded by a giver that any other user can claim one share of
+// until every share is claimed or the pot expires, when the remainder is refunded to the giver
+type RedPacket struct {
+	ID              int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code            string         `gorm:"uniqueIndex;not null;size:20" json:"code"`
+	GiverID         string         `gorm:"not null;index;size:255" json:"giver_id"`
+	TotalAmount     decimal.Amount `gorm:"not null" json:"total_amount"`
+	RemainingAmount decimal.Amount `gorm:"not null" json:"remaining_amount"`
+	MaxClaims       int            `gorm:"not null" json:"max_claims"`
+	ClaimCount      int            `gorm:"not null;default:0" json:"claim_count"`
+	SplitMode       string         `gorm:"not null;size:10" json:"split_mode"`                                                  // equal/random
+	QuotaExpiryDate time.Time      `gorm:"not null" json:"quota_expiry_date"`                                                   // Expiry of the quota in the pot
+	Status          string         `gorm:"not null;default:OPEN;size:20;index:idx_red_packets_status_expires_at" json:"status"` // OPEN/EXHAUSTED/REFUNDED/EXPIRED
+	ExpiresAt       time.Time      `gorm:"not null;index:idx_red_packets_status_expires_at" json:"expires_at"`
+	CreateTime      time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime      time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// RedPacketClaim records the share of a red packet claimed by one user
+type RedPacketClaim struct {
+	ID          int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	RedPacketID int            `gorm:"not null;uniqueIndex:idx_red_packet_claims_packet_user" json:"red_packet_id"`
+	UserID      string         `gorm:"not null;size:255;uniqueIndex:idx_red_packet_claims_packet_user" json:"user_id"`
+	Amount      decimal.Amount `gorm:"not null" json:"amount"`
+	CreateTime  time.Time      `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// PromoCode is an admin-issued campaign code that every eligible user can redeem for a fixed grant
+type PromoCode struct {
+	ID              int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Code            string         `gorm:"uniqueIndex;not null;size:50" json:"code"` // Stored upper case
+	Amount          decimal.Amount `gorm:"not null" json:"amount"`
+	Model           string         `gorm:"not null;default:'';size:100" json:"model,omitempty"` // Model bucket the grant goes into, empty for the general pool
+	ExpiryDays      *int           `json:"expiry_days,omitempty"`                               // Granted quota expires after this many days, end of month when empty
+	MaxRedemptions  int            `gorm:"not null;default:0" json:"max_redemptions"`           // Total cap across all users, 0 for no cap
+	PerUserLimit    int            `gorm:"not null;default:1" json:"per_user_limit"`
+	RedemptionCount int            `gorm:"not null;default:0" json:"redemption_count"`
+	StartsAt        *time.Time     `json:"starts_at,omitempty"`
+	EndsAt          *time.Time     `json:"ends_at,omitempty"`
+	Condition       string         `gorm:"type:text" json:"condition,omitempty"`          // Eligibility condition in the strategy condition language
+	Status          string         `gorm:"not null;default:ACTIVE;size:20" json:"status"` // ACTIVE/DISABLED
+	CreatedBy       string         `gorm:"size:255" json:"created_by"`
+	CreateTime      time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime      time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// PromoRedemption records one redemption of a promo code by a user
+type PromoRedemption struct {
+	ID          int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	PromoCodeID int            `gorm:"not null;index:idx_promo_redemptions_code_user" json:"promo_code_id"`
+	UserID      string         `gorm:"not null;size:255;index:idx_promo_redemptions_code_user" json:"user_id"`
+	Amount      decimal.Amount `gorm:"not null" json:"amount"`
+	ExpiryDate  time.Time      `gorm:"not null" json:"expiry_date"`
+	CreateTime  time.Time      `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// QuotaRequest is a request from one user asking a colleague or their department approver for quota.
+// Approval transfers the quota directly, without a voucher.
+type QuotaRequest struct {
+	ID           int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequesterID  string         `gorm:"not null;index;size:255" json:"requester_id"`
+	ApproverID   string         `gorm:"not null;size:255;index:idx_quota_requests_approver_status" json:"approver_id"`
+	Department   string         `gorm:"size:255" json:"department,omitempty"` // Department whose approver was asked, empty for requests to a colleague
+	Amount       decimal.Amount `gorm:"not null" json:"amount"`
+	Reason       string         `gorm:"not null;size:255" json:"reason"`
+	Status       string         `gorm:"not null;default:PENDING;size:20;index:idx_quota_requests_approver_status;index:idx_quota_requests_status_expires_at" json:"status"` // PENDING/APPROVED/REJECTED/CANCELLED/EXPIRED
+	DecisionNote string         `gorm:"size:255" json:"decision_note,omitempty"`
+	ExpiresAt    time.Time      `gorm:"not null;index:idx_quota_requests_status_expires_at" json:"expires_at"`
+	DecidedAt    *time.Time     `json:"decided_at,omitempty"`
+	CreateTime   time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime   time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// QuotaRequestEvent records one state transition of a quota request
+type QuotaRequestEvent struct {
+	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	RequestID  int       `gorm:"not null;index" json:"request_id"`
+	FromStatus string    `gorm:"size:20" json:"from_status,omitempty"` // Empty for the creation event
+	ToStatus   string    `gorm:"not null;size:20" json:"to_status"`
+	Actor      string    `gorm:"not null;size:255" json:"actor"` // User ID, or "system" for expiry
+	Note       string    `gorm:"size:255" json:"note,omitempty"`
+	CreateTime time.Time `gorm:"autoCreateTime" json:"create_time"`
+}
+
+// QuotaMerge records a merge of one user's quota into another, with a snapshot of what moved so an
+// admin can undo it within the undo window
+type QuotaMerge struct {
+	ID            int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	MainUserID    string         `gorm:"not null;index;size:255" json:"main_user_id"`
+	OtherUserID   string         `gorm:"not null;index;size:255" json:"other_user_id"`
+	Amount        decimal.Amount `gorm:"not null" json:"amount"`
+	Snapshot      string         `gorm:"type:text;not null" json:"-"` // JSON encoded QuotaMergeSnapshot
+	Status        string         `gorm:"not null;default:MERGED;size:20" json:"status"`
+	Operator      string         `gorm:"size:255" json:"operator"`
+	UndoableUntil time.Time      `gorm:"not null" json:"undoable_until"`
+	UndoneAt      *time.Time     `json:"undone_at,omitempty"`
+	UndoneBy      string         `gorm:"size:255" json:"undone_by,omitempty"`
+	CreateTime    time.Time      `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime    time.Time      `gorm:"autoUpdateTime" json:"update_time"`
+}
+
+// QuotaMergeSnapshot is what a merge moved from the other user to the main user
+type QuotaMergeSnapshot struct {
+	Buckets     []QuotaMergeBucket     `json:"buckets"`
+	UsedQuota   decimal.Amount         `json:"used_quota"`            // The other user's AiGateway used quota moved with the buckets
+	ExecuteIDs  []int                  `json:"execute_ids,omitempty"` // Strategy executions re-assigned to the main user
+	Permissions *QuotaMergePermissions `json:"permissions,omitempty"`
+}
+
+// QuotaMergeBucket is one of the other user's quota buckets moved by a merge
+type QuotaMergeBucket struct {
+	QuotaID     int            `json:"quota_id"`      // The other user's bucket
+	MainQuotaID int            `json:"main_quota_id"` // Main user's bucket receiving the amount, QuotaID when the bucket moves as is
+	Model       string         `json:"model,omitempty"`
+	ExpiryDate  time.Time      `json:"expiry_date"`
+	Amount      decimal.Amount `json:"amount"`
+}
+
+// QuotaMergePermissions are the other user's personal settings copied to the main user. Settings the
+// main user already has are kept and listed in Skipped.
+type QuotaMergePermissions struct {
+	MainIdentifier string   `json:"main_identifier"` // Employee number, or user ID without employee sync
+	ModelWhitelist []string `json:"model_whitelist,omitempty"`
+	StarCheck      *bool    `json:"star_check,omitempty"`
+	QuotaCheck     *bool    `json:"quota_check,omitempty"`
+	Skipped        []string `json:"skipped,omitempty"`
+}
+
+// APIKey is a credential for machine-to-machine callers. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID         int        `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name       string     `gorm:"not null;size:100" json:"name"`
+	KeyPrefix  string     `gorm:"not null;size:20" json:"key_prefix"` // Leading characters of the key for identification
+	KeyHash    string     `gorm:"uniqueIndex;not null;size:64" json:"-"`
+	Scopes     string     `gorm:"type:text;not null" json:"-"` // Store as comma-separated string
+	CreatedBy  string     `gorm:"size:255" json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreateTime time.Time  `gorm:"autoCreateTime" json:"create_time"`
+	UpdateTime time.Time  `gorm:"autoUpdateTime" json:"update_time"`
+}
+
 // TableName sets the table name
 func (QuotaStrategy) TableName() string {
 	return "quota_strategy"
@@ -201,6 +450,95 @@ func (VoucherRedemption) TableName() string {
 	return "voucher_redemption"
 }
 
+func (QuotaReservation) TableName() string {
+	return "quota_reservations"
+}
+
+func (GatewayOutbox) TableName() string {
+	return "gateway_outbox"
+}
+
+func (ReconciliationReport) TableName() string {
+	return "reconciliation_reports"
+}
+
+func (ReconciliationItem) TableName() string {
+	return "reconciliation_items"
+}
+
+func (ExpiryNotification) TableName() string {
+	return "expiry_notifications"
+}
+
+func (QuotaBalanceSnapshot) TableName() string {
+	return "quota_balance_snapshots"
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+func (Voucher) TableName() string {
+	return "vouchers"
+}
+
+func (JobWatermark) TableName() string {
+	return "job_watermarks"
+}
+
+func (RedPacket) TableName() string {
+	return "red_packets"
+}
+
+func (RedPacketClaim) TableName() string {
+	return "red_packet_claims"
+}
+
+func (PromoCode) TableName() string {
+	return "promo_codes"
+}
+
+func (PromoRedemption) TableName() string {
+	return "promo_redemptions"
+}
+
+func (QuotaRequest) TableName() string {
+	return "quota_requests"
+}
+
+func (QuotaRequestEvent) TableName() string {
+	return "quota_request_events"
+}
+
+func (QuotaMerge) TableName() string {
+	return "quota_merges"
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// GetScopesAsSlice returns the scopes as a slice
+func (k *APIKey) GetScopesAsSlice() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// SetScopesFromSlice sets the scopes from a slice
+func (k *APIKey) SetScopesFromSlice(scopes []string) {
+	k.Scopes = strings.Join(scopes, ",")
+}
+
+// IsActive checks if the key is neither revoked nor expired
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
 // EmployeeDepartment represents the employee department mapping
 type EmployeeDepartment struct {
 	ID                 int       `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -423,6 +761,120 @@ const (
 	OperationTransferOut = "TRANSFER_OUT"
 	OperationDeduct      = "DEDUCT"
 	OperationMergeIn     = "MERGE_IN"
+	OperationMergeOut    = "MERGE_OUT"  // Quota moved to the main user of a merge
+	OperationMergeUndo   = "MERGE_UNDO" // Merged quota moved back to the other user
+	OperationExpire      = "EXPIRE"
+
+	OperationTransferCancel = "TRANSFER_CANCEL" // Giver revoked an unredeemed voucher
+	OperationTransferRefund = "TRANSFER_REFUND" // Unredeemed voucher expired and was refunded to the giver
+
+	OperationReservationHold    = "RESERVATION_HOLD"    // Quota held, balance unchanged
+	OperationReservationCapture = "RESERVATION_CAPTURE" // Held quota converted into a deduction
+	OperationReservationRelease = "RESERVATION_RELEASE" // Hold released by the caller
+	OperationReservationExpire  = "RESERVATION_EXPIRE"  // Hold released after its TTL
+
+	OperationAdminAdjust = "ADMIN_ADJUST" // Manual grant (positive) or clawback (negative) by an admin
+
+	OperationStrategyRevert = "STRATEGY_REVERT" // Unconsumed strategy grants clawed back
+
+	OperationReconcile = "RECONCILE" // Correction applied by a reconciliation run
+
+	OperationRollover = "ROLLOVER" // Unused expiring quota carried into a new bucket
+
+	OperationPromoRedeem = "PROMO_REDEEM" // Grant from a redeemed promo code
+)
+
+// Reservation status constants
+const (
+	ReservationStatusHeld     = "HELD"
+	ReservationStatusCaptured = "CAPTURED"
+	ReservationStatusReleased = "RELEASED"
+	ReservationStatusExpired  = "EXPIRED"
+)
+
+// Gateway outbox operation constants
+const (
+	OutboxDeltaQuota        = "DELTA_QUOTA"
+	OutboxDeltaModelQuota   = "DELTA_MODEL_QUOTA"
+	OutboxRefreshModelQuota = "REFRESH_MODEL_QUOTA"
+	OutboxDeltaUsedQuota    = "DELTA_USED_QUOTA"
+	OutboxRefreshQuota      = "REFRESH_QUOTA"
+)
+
+// Gateway outbox status constants
+const (
+	OutboxStatusPending    = "PENDING"    // Waiting to be applied, possibly after failed attempts
+	OutboxStatusDispatched = "DISPATCHED" // Applied to AiGateway
+	OutboxStatusDead       = "DEAD"       // Gave up after the maximum attempts, waits for a replay
+)
+
+// Reconciliation mode constants
+const (
+	ReconcileModeDryRun = "DRY_RUN" // Only report mismatches
+	ReconcileModeFix    = "FIX"     // Report and correct mismatches
+)
+
+// Reconciliation report status constants
+const (
+	ReconcileStatusRunning   = "RUNNING"
+	ReconcileStatusCompleted = "COMPLETED"
+	ReconcileStatusFailed    = "FAILED"
+)
+
+// Reconciliation mismatch categories
+const (
+	ReconcileGatewayQuotaMismatch = "GATEWAY_QUOTA_MISMATCH" // AiGateway total differs from the valid quota in the database
+	ReconcileUsedExceedsQuota     = "USED_EXCEEDS_QUOTA"     // AiGateway used quota is above the valid quota in the database
+	ReconcileAuditMismatch        = "AUDIT_MISMATCH"         // Audit ledger does not add up to the valid quota in the database
+	ReconcileGatewayUnavailable   = "GATEWAY_UNAVAILABLE"    // AiGateway could not be queried for the user
+)
+
+// Voucher claim status constants
+const (
+	VoucherStatusRedeemed  = "REDEEMED"
+	VoucherStatusCancelled = "CANCELLED"
+	VoucherStatusRefunded  = "REFUNDED"
+)
+
+// Stored voucher status constants, a stored voucher leaves ISSUED when it is claimed
+const (
+	VoucherStatusIssued  = "ISSUED"
+	VoucherStatusExpired = "EXPIRED"
+)
+
+// Red packet status constants
+const (
+	RedPacketStatusOpen      = "OPEN"      // Shares can be claimed
+	RedPacketStatusExhausted = "EXHAUSTED" // Every share was claimed
+	RedPacketStatusRefunded  = "REFUNDED"  // Expired, the remainder went back to the giver
+	RedPacketStatusExpired   = "EXPIRED"   // Expired together with its quota, nothing was refunded
+)
+
+// Red packet split modes
+const (
+	RedPacketSplitEqual  = "equal"
+	RedPacketSplitRandom = "random"
+)
+
+// Promo code status constants
+const (
+	PromoCodeStatusActive   = "ACTIVE"
+	PromoCodeStatusDisabled = "DISABLED"
+)
+
+// Quota request status constants
+const (
+	QuotaRequestStatusPending   = "PENDING"
+	QuotaRequestStatusApproved  = "APPROVED" // Quota transferred from the approver to the requester
+	QuotaRequestStatusRejected  = "REJECTED"
+	QuotaRequestStatusCancelled = "CANCELLED" // Withdrawn by the requester
+	QuotaRequestStatusExpired   = "EXPIRED"   // Not decided before its expiry
+)
+
+// Quota merge status constants
+const (
+	QuotaMergeStatusMerged = "MERGED"
+	QuotaMergeStatusUndone = "UNDONE"
 )
 
 // Status constants for quota audit detail items
@@ -470,15 +922,64 @@ const (
 
 // MonthlyQuotaUsage monthly quota usage record table
 type MonthlyQuotaUsage struct {
-	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID     string    `gorm:"column:user_id;not null;index" json:"user_id"`
-	YearMonth  string    `gorm:"column:year_month;not null;index" json:"year_month"` // 格式: YYYY-MM
-	UsedQuota  float64   `gorm:"column:used_quota;not null" json:"used_quota"`
-	RecordTime time.Time `gorm:"column:record_time;type:timestamptz(0)" json:"record_time"`
-	CreateTime time.Time `gorm:"column:create_time;type:timestamptz(0);autoCreateTime" json:"create_time"`
+	ID         int            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID     string         `gorm:"column:user_id;not null;index" json:"user_id"`
+	YearMonth  string         `gorm:"column:year_month;not null;index" json:"year_month"` // 格式: YYYY-MM
+	UsedQuota  decimal.Amount `gorm:"column:used_quota;not null" json:"used_quota"`
+	RecordTime time.Time      `gorm:"column:record_time;type:timestamptz(0)" json:"record_time"`
+	CreateTime time.Time      `gorm:"column:create_time;type:timestamptz(0);autoCreateTime" json:"create_time"`
 }
 
 // TableName sets the table name
 func (MonthlyQuotaUsage) TableName() string {
 	return "monthly_quota_usage"
 }
+
+// MarshalItems converts reservation items to JSON string
+func (r *QuotaReservation) MarshalItems(items []ReservationItem) error {
+	jsonBytes, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reservation items: %w", err)
+	}
+
+	r.Items = string(jsonBytes)
+	return nil
+}
+
+// UnmarshalItems converts JSON string back to reservation items
+func (r *QuotaReservation) UnmarshalItems() ([]ReservationItem, error) {
+	if r.Items == "" {
+		return nil, nil
+	}
+
+	var items []ReservationItem
+	if err := json.Unmarshal([]byte(r.Items), &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reservation items: %w", err)
+	}
+
+	return items, nil
+}
+
+// MarshalSnapshot stores the snapshot as JSON
+func (m *QuotaMerge) MarshalSnapshot(snapshot *QuotaMergeSnapshot) error {
+	jsonBytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal merge snapshot: %w", err)
+	}
+	m.Snapshot = string(jsonBytes)
+	return nil
+}
+
+// Carries reports whether any setting is carried over
+func (p *QuotaMergePermissions) Carries() bool {
+	return p != nil && (len(p.ModelWhitelist) > 0 || p.StarCheck != nil || p.QuotaCheck != nil)
+}
+
+// UnmarshalSnapshot parses the stored snapshot
+func (m *QuotaMerge) UnmarshalSnapshot() (*QuotaMergeSnapshot, error) {
+	var snapshot QuotaMergeSnapshot
+	if err := json.Unmarshal([]byte(m.Snapshot), &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal merge snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
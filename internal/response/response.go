@@ -43,16 +43,31 @@ const (
 	InternalErrorCode = "quota-manager.internal_error"
 
 	// Business logic error codes
-	InvalidStrategyIDCode   = "quota-manager.invalid_strategy_id"
-	StrategyNotFoundCode    = "quota-manager.strategy_not_found"
-	InsufficientQuotaCode   = "quota-manager.insufficient_quota"
-	VoucherInvalidCode      = "quota-manager.voucher_invalid"
-	VoucherExpiredCode      = "quota-manager.voucher_expired"
-	VoucherRedeemedCode     = "quota-manager.voucher_already_redeemed"
-	TokenInvalidCode        = "quota-manager.token_invalid"
-	QuotaTransferFailedCode = "quota-manager.quota_transfer_failed"
-	DatabaseErrorCode       = "quota-manager.database_error"
-	AiGatewayErrorCode      = "quota-manager.aigateway_error"
+	InvalidStrategyIDCode    = "quota-manager.invalid_strategy_id"
+	StrategyNotFoundCode     = "quota-manager.strategy_not_found"
+	InsufficientQuotaCode    = "quota-manager.insufficient_quota"
+	VoucherInvalidCode       = "quota-manager.voucher_invalid"
+	VoucherExpiredCode       = "quota-manager.voucher_expired"
+	VoucherRedeemedCode      = "quota-manager.voucher_already_redeemed"
+	TokenInvalidCode         = "quota-manager.token_invalid"
+	QuotaTransferFailedCode  = "quota-manager.quota_transfer_failed"
+	DatabaseErrorCode        = "quota-manager.database_error"
+	AiGatewayErrorCode       = "quota-manager.aigateway_error"
+	APIKeyNotFoundCode       = "quota-manager.api_key_not_found"
+	IdempotencyConflictCode  = "quota-manager.idempotency_conflict"
+	ReservationNotFoundCode  = "quota-manager.reservation_not_found"
+	ReservationNotHeldCode   = "quota-manager.reservation_not_held"
+	OutboxItemNotFoundCode   = "quota-manager.outbox_item_not_found"
+	ReportNotFoundCode       = "quota-manager.report_not_found"
+	RedPacketNotFoundCode    = "quota-manager.red_packet_not_found"
+	RedPacketUnavailableCode = "quota-manager.red_packet_unavailable"
+	PromoCodeNotFoundCode    = "quota-manager.promo_code_not_found"
+	PromoCodeUnavailableCode = "quota-manager.promo_code_unavailable"
+	QuotaRequestNotFoundCode = "quota-manager.quota_request_not_found"
+	QuotaRequestClosedCode   = "quota-manager.quota_request_closed"
+	TransferPolicyCode       = "quota-manager.transfer_policy_violation"
+	QuotaMergeNotFoundCode   = "quota-manager.merge_not_found"
+	MergeNotUndoableCode     = "quota-manager.merge_not_undoable"
 
 	// The following codes are used for internal only
 
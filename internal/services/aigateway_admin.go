@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"quota-manager/pkg/aigateway"
+	"quota-manager/pkg/decimal"
 )
 
 // AiGatewayAdminService is a thin wrapper around aigateway.Client for admin passthrough APIs
@@ -15,28 +16,28 @@ func NewAiGatewayAdminService(client *aigateway.Client) *AiGatewayAdminService {
 }
 
 // Quota total
-func (s *AiGatewayAdminService) QueryQuota(userID string) (float64, error) {
+func (s *AiGatewayAdminService) QueryQuota(userID string) (decimal.Amount, error) {
 	return s.client.QueryQuotaValue(userID)
 }
 
-func (s *AiGatewayAdminService) RefreshQuota(userID string, quota float64) error {
+func (s *AiGatewayAdminService) RefreshQuota(userID string, quota decimal.Amount) error {
 	return s.client.RefreshQuota(userID, quota)
 }
 
-func (s *AiGatewayAdminService) DeltaQuota(userID string, value float64) error {
+func (s *AiGatewayAdminService) DeltaQuota(userID string, value decimal.Amount) error {
 	return s.client.DeltaQuota(userID, value)
 }
 
 // Quota used
-func (s *AiGatewayAdminService) QueryUsedQuota(userID string) (float64, error) {
+func (s *AiGatewayAdminService) QueryUsedQuota(userID string) (decimal.Amount, error) {
 	return s.client.QueryUsedQuotaValue(userID)
 }
 
-func (s *AiGatewayAdminService) RefreshUsedQuota(userID string, quota float64) error {
+func (s *AiGatewayAdminService) RefreshUsedQuota(userID string, quota decimal.Amount) error {
 	return s.client.RefreshUsedQuota(userID, quota)
 }
 
-func (s *AiGatewayAdminService) DeltaUsedQuota(userID string, value float64) error {
+func (s *AiGatewayAdminService) DeltaUsedQuota(userID string, value decimal.Amount) error {
 	return s.client.DeltaUsedQuota(userID, value)
 }
 
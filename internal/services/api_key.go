@@ -0,0 +1,254 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/database"
+	"quota-manager/internal/models"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix marks quota-manager API keys so leaked keys are easy to recognize
+	apiKeyPrefix = "qm_"
+	// apiKeyDisplayLength is the number of leading key characters kept for identification
+	apiKeyDisplayLength = 11
+	// apiKeyLastUsedInterval limits how often last_used_at is written for a busy key
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// APIKeyService manages API keys for machine-to-machine callers
+type APIKeyService struct {
+	db *database.DB
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(db *database.DB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// CreateAPIKeyRequest represents an API key creation request
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyInfo is the public view of an API key
+type APIKeyInfo struct {
+	*models.APIKey
+	Scopes []string `json:"scopes"`
+	Status string   `json:"status"` // ACTIVE/EXPIRED/REVOKED
+}
+
+// APIKeyWithSecret is returned once when a key is created or rotated
+type APIKeyWithSecret struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// API key status constants
+const (
+	APIKeyStatusActive  = "ACTIVE"
+	APIKeyStatusExpired = "EXPIRED"
+	APIKeyStatusRevoked = "REVOKED"
+)
+
+// CreateAPIKey creates a new API key and returns its plaintext value, which is not stored
+func (s *APIKeyService) CreateAPIKey(req *CreateAPIKeyRequest, createdBy string) (*APIKeyWithSecret, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, NewValidationFailedError("expires_at must be in the future")
+	}
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.APIKey{
+		Name:      strings.TrimSpace(req.Name),
+		KeyPrefix: rawKey[:apiKeyDisplayLength],
+		KeyHash:   hashAPIKey(rawKey),
+		CreatedBy: createdBy,
+		ExpiresAt: req.ExpiresAt,
+	}
+	key.SetScopesFromSlice(scopes)
+
+	if err := s.db.DB.Create(key).Error; err != nil {
+		return nil, NewDatabaseError("create api key", err)
+	}
+
+	logger.Info("API key created",
+		zap.Int("id", key.ID),
+		zap.String("name", key.Name),
+		zap.Strings("scopes", scopes),
+		zap.String("created_by", createdBy))
+
+	return &APIKeyWithSecret{APIKeyInfo: newAPIKeyInfo(key), Key: rawKey}, nil
+}
+
+// ListAPIKeys returns all API keys without their secrets
+func (s *APIKeyService) ListAPIKeys() ([]APIKeyInfo, error) {
+	var keys []models.APIKey
+	if err := s.db.DB.Order("id ASC").Find(&keys).Error; err != nil {
+		return nil, NewDatabaseError("list api keys", err)
+	}
+
+	result := make([]APIKeyInfo, 0, len(keys))
+	for i := range keys {
+		result = append(result, newAPIKeyInfo(&keys[i]))
+	}
+	return result, nil
+}
+
+// RotateAPIKey replaces the secret of an active key, keeping its name, scopes and expiry.
+// The previous secret stops working immediately.
+func (s *APIKeyService) RotateAPIKey(id int) (*APIKeyWithSecret, error) {
+	key, err := s.getAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, NewConflictError(fmt.Sprintf("api key %d is revoked", id))
+	}
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	key.KeyPrefix = rawKey[:apiKeyDisplayLength]
+	key.KeyHash = hashAPIKey(rawKey)
+	key.LastUsedAt = nil
+	if err := s.db.DB.Save(key).Error; err != nil {
+		return nil, NewDatabaseError("rotate api key", err)
+	}
+
+	logger.Info("API key rotated", zap.Int("id", key.ID), zap.String("name", key.Name))
+
+	return &APIKeyWithSecret{APIKeyInfo: newAPIKeyInfo(key), Key: rawKey}, nil
+}
+
+// RevokeAPIKey permanently disables a key. Revoking an already revoked key is a no-op.
+func (s *APIKeyService) RevokeAPIKey(id int) (*APIKeyInfo, error) {
+	key, err := s.getAPIKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := s.db.DB.Model(key).Update("revoked_at", now).Error; err != nil {
+			return nil, NewDatabaseError("revoke api key", err)
+		}
+		logger.Info("API key revoked", zap.Int("id", key.ID), zap.String("name", key.Name))
+	}
+
+	info := newAPIKeyInfo(key)
+	return &info, nil
+}
+
+// ValidateAPIKey looks up an active key by its plaintext value and records its use
+func (s *APIKeyService) ValidateAPIKey(rawKey string) (*models.APIKey, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, fmt.Errorf("malformed api key")
+	}
+
+	var key models.APIKey
+	if err := s.db.DB.Where("key_hash = ?", hashAPIKey(rawKey)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("unknown api key")
+		}
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("api key has been revoked")
+	}
+	if !key.IsActive(now) {
+		return nil, fmt.Errorf("api key has expired")
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedInterval {
+		if err := s.db.DB.Model(&key).UpdateColumn("last_used_at", now).Error; err != nil {
+			// Tracking usage must not block the request
+			logger.Warn("Failed to update api key last_used_at", zap.Int("id", key.ID), zap.Error(err))
+		} else {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return &key, nil
+}
+
+// getAPIKey loads a key by ID
+func (s *APIKeyService) getAPIKey(id int) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := s.db.DB.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("api key", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get api key", err)
+	}
+	return &key, nil
+}
+
+// newAPIKeyInfo builds the public view of a key
+func newAPIKeyInfo(key *models.APIKey) APIKeyInfo {
+	status := APIKeyStatusActive
+	switch {
+	case key.RevokedAt != nil:
+		status = APIKeyStatusRevoked
+	case !key.IsActive(time.Now()):
+		status = APIKeyStatusExpired
+	}
+	return APIKeyInfo{APIKey: key, Scopes: key.GetScopesAsSlice(), Status: status}
+}
+
+// normalizeScopes validates scopes against the known route scopes and removes duplicates
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !auth.IsValidScope(scope) {
+			return nil, NewValidationFailedError(fmt.Sprintf("unknown scope: %s", scope))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// generateAPIKey creates a random API key
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// hashAPIKey returns the hex SHA-256 digest of a key
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBalanceHistoryDays limits the length of a daily balance series
+const maxBalanceHistoryDays = 366
+
+// BalancePoint represents a user's balance totals at one point in time
+type BalancePoint struct {
+	At           time.Time      `json:"at"`
+	Date         string         `json:"date,omitempty"` // Day of a daily series point, in the configured timezone
+	ValidQuota   decimal.Amount `json:"valid_quota"`    // Granted quota not yet expired, spent or transferred
+	ExpiredQuota decimal.Amount `json:"expired_quota"`  // Quota expired up to At
+	UsedQuota    decimal.Amount `json:"used_quota"`     // Last used quota recorded at or before At
+	UsedAsOf     *time.Time     `json:"used_as_of,omitempty"`
+}
+
+// BalanceHistoryResponse represents a user's daily balance series
+type BalanceHistoryResponse struct {
+	UserID string         `json:"user_id"`
+	From   string         `json:"from"`
+	To     string         `json:"to"`
+	Points []BalancePoint `json:"points"`
+}
+
+// ledgerTotals are cumulative valid and expired quota
+type ledgerTotals struct {
+	Valid   decimal.Amount
+	Expired decimal.Amount
+}
+
+// usedRecord is a used quota value recorded at a point in time
+type usedRecord struct {
+	at   time.Time
+	used decimal.Amount
+}
+
+// GetBalanceAt reconstructs the user's balance totals at the given time. Valid and expired quota are
+// replayed from audit records after the latest snapshot. Used quota is only known when AiGateway was
+// read, so it is the last value recorded by a snapshot or the monthly usage record, or the live value
+// for the current time.
+func (s *QuotaService) GetBalanceAt(userID string, at time.Time) (*BalancePoint, error) {
+	now := time.Now()
+	if at.After(now) {
+		return nil, NewValidationFailedError("at must not be in the future")
+	}
+	at = at.Truncate(time.Second)
+	// Audit times have second precision, so the point includes everything in its second
+	before := at.Add(time.Second)
+
+	totals, err := s.ledgerTotalsBefore(userID, before)
+	if err != nil {
+		return nil, err
+	}
+	point := &BalancePoint{
+		At:           at,
+		ValidQuota:   totals.Valid,
+		ExpiredQuota: totals.Expired,
+	}
+
+	if now.Sub(at) < time.Second {
+		usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get used quota: %w", err)
+		}
+		point.UsedQuota = usedQuota
+		point.UsedAsOf = &now
+		return point, nil
+	}
+
+	records, err := s.usedRecords(userID, before, before)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 {
+		latest := records[len(records)-1]
+		point.UsedQuota = latest.used
+		point.UsedAsOf = &latest.at
+	}
+	return point, nil
+}
+
+// GetBalanceHistory returns the user's balance totals at the end of each day from fromDate to toDate
+// (YYYY-MM-DD in the configured timezone, inclusive, toDate defaults to today). Audit records are summed
+// per day, so the cost does not grow with the number of operations in the range.
+func (s *QuotaService) GetBalanceHistory(userID, fromDate, toDate string) (*BalanceHistoryResponse, error) {
+	cfg := s.configManager.GetDirect()
+	if toDate == "" {
+		toDate = utils.NowInConfigTimezone(cfg).Format("2006-01-02")
+	}
+	from, err := utils.ParseInConfigTimezone(cfg, "2006-01-02", fromDate)
+	if err != nil {
+		return nil, NewValidationFailedError("from must be a date in YYYY-MM-DD format")
+	}
+	to, err := utils.ParseInConfigTimezone(cfg, "2006-01-02", toDate)
+	if err != nil {
+		return nil, NewValidationFailedError("to must be a date in YYYY-MM-DD format")
+	}
+	if to.Before(from) {
+		return nil, NewValidationFailedError("to must not be before from")
+	}
+	days := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days++
+	}
+	if days > maxBalanceHistoryDays {
+		return nil, NewValidationFailedError(fmt.Sprintf("at most %d days can be requested at once", maxBalanceHistoryDays))
+	}
+
+	now := time.Now()
+	end := to.AddDate(0, 0, 1)
+
+	totals, err := s.ledgerTotalsBefore(userID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	// Audit deltas per day of the range
+	var dailyDeltas []struct {
+		Day     string
+		Valid   decimal.Amount
+		Expired decimal.Amount
+	}
+	if err := s.db.DB.Model(&models.QuotaAudit{}).
+		Select("to_char(create_time AT TIME ZONE ?, 'YYYY-MM-DD') AS day, "+
+			"COALESCE(SUM(amount), 0) AS valid, "+
+			"COALESCE(SUM(CASE WHEN operation = ? THEN -amount ELSE 0 END), 0) AS expired",
+			utils.GetTimezone(cfg).String(), models.OperationExpire).
+		Where("user_id = ? AND create_time >= ? AND create_time < ?", userID, from, end).
+		Group("day").Scan(&dailyDeltas).Error; err != nil {
+		return nil, NewDatabaseError("sum audit records by day", err)
+	}
+	deltas := make(map[string]ledgerTotals, len(dailyDeltas))
+	for _, delta := range dailyDeltas {
+		deltas[delta.Day] = ledgerTotals{Valid: delta.Valid, Expired: delta.Expired}
+	}
+
+	records, err := s.usedRecords(userID, from, end)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BalanceHistoryResponse{
+		UserID: userID,
+		From:   fromDate,
+		To:     toDate,
+		Points: make([]BalancePoint, 0, days),
+	}
+	next := 0
+	var used *usedRecord
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1)
+		if day.After(now) {
+			break
+		}
+		date := day.Format("2006-01-02")
+		totals.Valid = totals.Valid.Add(deltas[date].Valid)
+		totals.Expired = totals.Expired.Add(deltas[date].Expired)
+		for next < len(records) && records[next].at.Before(dayEnd) {
+			used = &records[next]
+			next++
+		}
+
+		point := BalancePoint{
+			At:           dayEnd.Add(-time.Second),
+			Date:         date,
+			ValidQuota:   totals.Valid,
+			ExpiredQuota: totals.Expired,
+		}
+		if used != nil {
+			point.UsedQuota = used.used
+			point.UsedAsOf = &used.at
+		}
+		resp.Points = append(resp.Points, point)
+	}
+	return resp, nil
+}
+
+// ledgerTotalsBefore returns the user's valid and expired quota from audit records created before the given
+// time, starting from the latest snapshot at or before it
+func (s *QuotaService) ledgerTotalsBefore(userID string, before time.Time) (ledgerTotals, error) {
+	var totals ledgerTotals
+	since := time.Time{}
+
+	var snapshot models.QuotaBalanceSnapshot
+	err := s.db.DB.Where("user_id = ? AND snapshot_time <= ?", userID, before).
+		Order("snapshot_time DESC").First(&snapshot).Error
+	if err == nil {
+		totals.Valid, totals.Expired = snapshot.ValidQuota, snapshot.ExpiredQuota
+		since = snapshot.SnapshotTime
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return totals, NewDatabaseError("get balance snapshot", err)
+	}
+
+	var delta ledgerTotals
+	if err := s.db.DB.Model(&models.QuotaAudit{}).
+		Select("COALESCE(SUM(amount), 0) AS valid, "+
+			"COALESCE(SUM(CASE WHEN operation = ? THEN -amount ELSE 0 END), 0) AS expired", models.OperationExpire).
+		Where("user_id = ? AND create_time >= ? AND create_time < ?", userID, since, before).
+		Scan(&delta).Error; err != nil {
+		return totals, NewDatabaseError("sum audit records", err)
+	}
+	totals.Valid = totals.Valid.Add(delta.Valid)
+	totals.Expired = totals.Expired.Add(delta.Expired)
+	return totals, nil
+}
+
+// usedRecords returns the used quota recorded by snapshots and monthly usage records from the given time
+// until before, ordered by time, preceded by the latest one recorded before from
+func (s *QuotaService) usedRecords(userID string, from, before time.Time) ([]usedRecord, error) {
+	records := make([]usedRecord, 0)
+
+	var snapshots []models.QuotaBalanceSnapshot
+	if err := s.db.DB.Where("user_id = ? AND create_time >= ? AND create_time < ?", userID, from, before).
+		Find(&snapshots).Error; err != nil {
+		return nil, NewDatabaseError("get balance snapshots", err)
+	}
+	var earlierSnapshot models.QuotaBalanceSnapshot
+	if err := s.db.DB.Where("user_id = ? AND create_time < ?", userID, from).
+		Order("create_time DESC").Limit(1).Find(&earlierSnapshot).Error; err != nil {
+		return nil, NewDatabaseError("get balance snapshots", err)
+	}
+	if earlierSnapshot.ID != 0 {
+		snapshots = append(snapshots, earlierSnapshot)
+	}
+	for _, snapshot := range snapshots {
+		records = append(records, usedRecord{at: snapshot.CreateTime, used: snapshot.UsedQuota})
+	}
+
+	var usages []models.MonthlyQuotaUsage
+	if err := s.db.DB.Where("user_id = ? AND record_time >= ? AND record_time < ?", userID, from, before).
+		Find(&usages).Error; err != nil {
+		return nil, NewDatabaseError("get monthly quota usage", err)
+	}
+	var earlierUsage models.MonthlyQuotaUsage
+	if err := s.db.DB.Where("user_id = ? AND record_time < ?", userID, from).
+		Order("record_time DESC").Limit(1).Find(&earlierUsage).Error; err != nil {
+		return nil, NewDatabaseError("get monthly quota usage", err)
+	}
+	if earlierUsage.ID != 0 {
+		usages = append(usages, earlierUsage)
+	}
+	for _, usage := range usages {
+		records = append(records, usedRecord{at: usage.RecordTime, used: usage.UsedQuota})
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].at.Before(records[j].at) })
+	// Only the latest record before from matters
+	for len(records) > 1 && records[1].at.Before(from) {
+		records = records[1:]
+	}
+	return records, nil
+}
+
+// SnapshotBalances records the balance totals at the start of today of every user with audit records since
+// the previous snapshot run, together with the user's current used quota. It returns the number of
+// snapshots taken. Users whose used quota cannot be read are skipped and picked up by a later run.
+func (s *QuotaService) SnapshotBalances() (int, error) {
+	now := utils.NowInConfigTimezone(s.configManager.GetDirect())
+	snapshotTime := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var lastRun struct{ Last *time.Time }
+	if err := s.db.DB.Model(&models.QuotaBalanceSnapshot{}).
+		Select("MAX(snapshot_time) AS last").Where("snapshot_time < ?", snapshotTime).
+		Scan(&lastRun).Error; err != nil {
+		return 0, NewDatabaseError("get last balance snapshot", err)
+	}
+	since := time.Time{}
+	if lastRun.Last != nil {
+		since = *lastRun.Last
+	}
+
+	var userIDs []string
+	if err := s.db.DB.Model(&models.QuotaAudit{}).
+		Where("create_time >= ? AND create_time < ?", since, snapshotTime).
+		Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, NewDatabaseError("find users with audit records", err)
+	}
+
+	taken := 0
+	for _, userID := range userIDs {
+		totals, err := s.ledgerTotalsBefore(userID, snapshotTime)
+		if err != nil {
+			return taken, err
+		}
+		usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+		if err != nil {
+			logger.Warn("Skip balance snapshot, failed to get used quota",
+				zap.String("user_id", userID),
+				zap.Error(err))
+			continue
+		}
+
+		snapshot := &models.QuotaBalanceSnapshot{
+			UserID:       userID,
+			SnapshotTime: snapshotTime,
+			ValidQuota:   totals.Valid,
+			ExpiredQuota: totals.Expired,
+			UsedQuota:    usedQuota,
+		}
+		if err := s.db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(snapshot).Error; err != nil {
+			return taken, NewDatabaseError("create balance snapshot", err)
+		}
+		taken++
+	}
+
+	logger.Info("Balance snapshots taken",
+		zap.Time("snapshot_time", snapshotTime),
+		zap.Int("users", taken))
+	return taken, nil
+}
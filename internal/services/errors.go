@@ -1,6 +1,10 @@
 package services
 
-import "fmt"
+import (
+	"fmt"
+
+	"quota-manager/pkg/decimal"
+)
 
 // ServiceError represents custom error types for service operations
 type ServiceError struct {
@@ -14,12 +18,14 @@ func (e *ServiceError) Error() string {
 
 // Error constants for service operations
 const (
-	ErrorUserNotFound     = "user_not_found"
-	ErrorDeptNotFound     = "department_not_found"
-	ErrorDatabaseError    = "database_error"
-	ErrorValidationFailed = "validation_failed"
-	ErrorResourceNotFound = "resource_not_found"
-	ErrorConflict         = "conflict"
+	ErrorUserNotFound      = "user_not_found"
+	ErrorDeptNotFound      = "department_not_found"
+	ErrorDatabaseError     = "database_error"
+	ErrorValidationFailed  = "validation_failed"
+	ErrorResourceNotFound  = "resource_not_found"
+	ErrorConflict          = "conflict"
+	ErrorInsufficientQuota = "insufficient_quota"
+	ErrorTransferPolicy    = "transfer_policy_violation"
 )
 
 // NewUserNotFoundError creates a new user not found error
@@ -69,3 +75,19 @@ func NewConflictError(message string) *ServiceError {
 		Message: message,
 	}
 }
+
+// NewInsufficientQuotaError creates a new insufficient quota error
+func NewInsufficientQuotaError(available, needed decimal.Amount) *ServiceError {
+	return &ServiceError{
+		Code:    ErrorInsufficientQuota,
+		Message: fmt.Sprintf("insufficient quota: available %s, needed %s", available, needed),
+	}
+}
+
+// NewTransferPolicyError creates a new error for a transfer denied by check of the named transfer rule
+func NewTransferPolicyError(rule, check, message string) *ServiceError {
+	return &ServiceError{
+		Code:    ErrorTransferPolicy,
+		Message: fmt.Sprintf("transfer rule %q denied the transfer (%s): %s", rule, check, message),
+	}
+}
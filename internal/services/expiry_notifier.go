@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// ExpiryWarningEventType identifies expiry warning events
+const ExpiryWarningEventType = "quota.expiring"
+
+// ExpiryWarningEvent tells a user that part of their quota expires within LeadDays days
+type ExpiryWarningEvent struct {
+	Event       string              `json:"event"`
+	UserID      string              `json:"user_id"`
+	LeadDays    int                 `json:"lead_days"`
+	TotalAmount decimal.Amount      `json:"total_amount"`
+	Items       []ExpiringQuotaItem `json:"items"`
+	CreateTime  time.Time           `json:"create_time"`
+}
+
+// ExpiryNotifier delivers expiry warnings to users. A returned error leaves the warning unsent,
+// so it is tried again on the next run.
+type ExpiryNotifier interface {
+	NotifyExpiring(event *ExpiryWarningEvent) error
+}
+
+// newExpiryNotifier returns the webhook notifier when a webhook is configured, otherwise one that only logs
+func newExpiryNotifier(cfg *config.ExpiryNotifyConfig) ExpiryNotifier {
+	if cfg.WebhookURL != "" {
+		return NewWebhookExpiryNotifier(cfg)
+	}
+	return logExpiryNotifier{}
+}
+
+// WebhookExpiryNotifier posts expiry warnings as JSON to a configured URL
+type WebhookExpiryNotifier struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewWebhookExpiryNotifier creates a notifier posting to cfg.WebhookURL
+func NewWebhookExpiryNotifier(cfg *config.ExpiryNotifyConfig) *WebhookExpiryNotifier {
+	return &WebhookExpiryNotifier{
+		url:        cfg.WebhookURL,
+		secret:     cfg.WebhookSecret,
+		httpClient: &http.Client{Timeout: cfg.GetTimeout()},
+	}
+}
+
+// NotifyExpiring posts the event. With a secret, the body is signed with HMAC-SHA256 in the
+// X-Signature header as "sha256=<hex>". Any non-2xx response is an error.
+func (n *WebhookExpiryNotifier) NotifyExpiring(event *ExpiryWarningEvent) error {
+	return postWebhookEvent(n.httpClient, n.url, n.secret, event.Event, event, "expiry warning")
+}
+
+// postWebhookEvent posts payload as JSON to url, signing the body when secret is set. what names the
+// payload in errors.
+func postWebhookEvent(client *http.Client, url, secret, eventType string, payload interface{}, what string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", what, err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Type", eventType)
+	if secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s webhook returned status %d", what, resp.StatusCode)
+	}
+	return nil
+}
+
+// logExpiryNotifier only logs warnings, used when no webhook is configured
+type logExpiryNotifier struct{}
+
+func (logExpiryNotifier) NotifyExpiring(event *ExpiryWarningEvent) error {
+	logger.Info("Quota expiring soon",
+		zap.String("user_id", event.UserID),
+		zap.Int("lead_days", event.LeadDays),
+		zap.Stringer("amount", event.TotalAmount))
+	return nil
+}
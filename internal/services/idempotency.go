@@ -0,0 +1,68 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"quota-manager/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyRequestHash fingerprints a request so a reused key can be matched against its original request
+func idempotencyRequestHash(req interface{}) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadIdempotentResponse looks up a processed request and decodes its stored response into out.
+// It returns false when the key has not been used, and a conflict error when it was used for a different request.
+func loadIdempotentResponse(db *gorm.DB, caller, operation, key, requestHash string, out interface{}) (bool, error) {
+	var record models.IdempotencyKey
+	err := db.Where("caller = ? AND operation = ? AND idempotency_key = ?", caller, operation, key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, NewDatabaseError("get idempotency key", err)
+	}
+
+	if record.RequestHash != requestHash {
+		return false, NewConflictError(fmt.Sprintf("idempotency key %s was already used with a different request", key))
+	}
+	if err := json.Unmarshal([]byte(record.Response), out); err != nil {
+		return false, fmt.Errorf("failed to unmarshal stored response: %w", err)
+	}
+	return true, nil
+}
+
+// claimIdempotencyKey inserts the key inside tx before any work is done. A concurrent request with the
+// same key blocks on the unique index until tx finishes and then fails, so only one of them is processed.
+func claimIdempotencyKey(tx *gorm.DB, caller, operation, key, requestHash string) (*models.IdempotencyKey, error) {
+	record := &models.IdempotencyKey{
+		Caller:      caller,
+		Operation:   operation,
+		Key:         key,
+		RequestHash: requestHash,
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// storeIdempotentResponse saves the response of a claimed key inside the same transaction as the work
+func storeIdempotentResponse(tx *gorm.DB, record *models.IdempotencyKey, resp interface{}) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return tx.Model(record).Update("response", string(data)).Error
+}
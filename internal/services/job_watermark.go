@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"quota-manager/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// jobWatermark returns how far the job has processed, the zero time before its first run
+func (s *QuotaService) jobWatermark(job string) (time.Time, error) {
+	var watermark models.JobWatermark
+	if err := s.db.DB.Where("job = ?", job).First(&watermark).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, NewDatabaseError("get job watermark", err)
+	}
+	return watermark.ProcessedUntil, nil
+}
+
+// saveJobWatermark records that the job has processed everything before processedUntil
+func (s *QuotaService) saveJobWatermark(job string, processedUntil time.Time) error {
+	watermark := &models.JobWatermark{Job: job, ProcessedUntil: processedUntil}
+	if err := s.db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "job"}},
+		DoUpdates: clause.AssignmentColumns([]string{"processed_until", "update_time"}),
+	}).Create(watermark).Error; err != nil {
+		return NewDatabaseError("save job watermark", err)
+	}
+	return nil
+}
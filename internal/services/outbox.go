@@ -0,0 +1,379 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/database"
+	"quota-manager/internal/models"
+	"quota-manager/pkg/aigateway"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxOutboxBackoff caps the delay between attempts of a failing operation
+const maxOutboxBackoff = 10 * time.Minute
+
+// OutboxDispatcher applies queued AiGateway quota operations. Operations of one user are applied
+// one at a time in the order they were queued, and a failing operation holds back the ones after it
+// until it succeeds or is dead-lettered.
+type OutboxDispatcher struct {
+	db              *database.DB
+	configManager   *config.Manager
+	aiGatewayClient *aigateway.Client
+	stop            chan struct{}
+	wg              sync.WaitGroup
+}
+
+// OutboxStatus summarizes the outbox for operators
+type OutboxStatus struct {
+	Pending       int64      `json:"pending"`
+	Retrying      int64      `json:"retrying"` // Pending operations that already failed at least once
+	Dead          int64      `json:"dead"`
+	OldestPending *time.Time `json:"oldest_pending,omitempty"`
+}
+
+// OutboxListResponse represents a page of outbox operations with the overall status
+type OutboxListResponse struct {
+	Status OutboxStatus           `json:"status"`
+	Total  int64                  `json:"total"`
+	Items  []models.GatewayOutbox `json:"items"`
+}
+
+// NewOutboxDispatcher creates an outbox dispatcher
+func NewOutboxDispatcher(db *database.DB, configManager *config.Manager, aiGatewayClient *aigateway.Client) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		db:              db,
+		configManager:   configManager,
+		aiGatewayClient: aiGatewayClient,
+	}
+}
+
+// enqueueGatewayOp queues an AiGateway operation inside tx, the transaction that makes the matching quota change
+func enqueueGatewayOp(tx *gorm.DB, source, userID, operation, model string, value decimal.Amount) error {
+	item := &models.GatewayOutbox{
+		UserID:        userID,
+		Operation:     operation,
+		Model:         model,
+		Value:         value,
+		Source:        source,
+		Status:        models.OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := tx.Create(item).Error; err != nil {
+		return NewDatabaseError("queue AiGateway operation", err)
+	}
+	return nil
+}
+
+// enqueueQuotaDelta queues a quota change for AiGateway. Changes to a model bucket are also
+// applied to the part of the total that AiGateway restricts to that model.
+func enqueueQuotaDelta(tx *gorm.DB, source, userID, model string, value decimal.Amount) error {
+	if value.IsZero() {
+		return nil
+	}
+	if err := enqueueGatewayOp(tx, source, userID, models.OutboxDeltaQuota, "", value); err != nil {
+		return err
+	}
+	if model != "" {
+		return enqueueGatewayOp(tx, source, userID, models.OutboxDeltaModelQuota, model, value)
+	}
+	return nil
+}
+
+// pendingGatewayDelta sums the queued but not yet applied deltas of one operation type for a user
+func pendingGatewayDelta(db *gorm.DB, userID, operation string) (decimal.Amount, error) {
+	total, err := sumAmount(db.Model(&models.GatewayOutbox{}).
+		Where("user_id = ? AND operation = ? AND status = ?", userID, operation, models.OutboxStatusPending), "value")
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to sum pending AiGateway operations: %w", err)
+	}
+	return total, nil
+}
+
+// Start runs the dispatcher loop in a goroutine until Stop is called
+func (d *OutboxDispatcher) Start() {
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-time.After(d.config().GetPollInterval()):
+				d.DispatchDue()
+			}
+		}
+	}()
+	logger.Info("Outbox dispatcher started")
+}
+
+// Stop ends the dispatcher loop and waits for the current poll to finish
+func (d *OutboxDispatcher) Stop() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+	d.stop = nil
+	logger.Info("Outbox dispatcher stopped")
+}
+
+// DispatchDue dispatches the users whose next pending operation is due
+func (d *OutboxDispatcher) DispatchDue() {
+	var userIDs []string
+	if err := d.db.DB.Model(&models.GatewayOutbox{}).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxStatusPending, time.Now()).
+		Distinct("user_id").Limit(d.config().GetBatchSize()).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		logger.Error("Failed to query due outbox operations", zap.Error(err))
+		return
+	}
+
+	for _, userID := range userIDs {
+		d.DispatchUser(userID)
+	}
+}
+
+// DispatchUser applies the user's pending operations in order, stopping at the first one that fails
+// or is not due yet. It is called right after a quota change commits so AiGateway is usually current.
+func (d *OutboxDispatcher) DispatchUser(userID string) {
+	for {
+		progressed, err := d.dispatchNext(userID)
+		if err != nil {
+			logger.Error("Failed to dispatch outbox operation", zap.String("user_id", userID), zap.Error(err))
+			return
+		}
+		if !progressed {
+			return
+		}
+	}
+}
+
+// dispatchNext applies the user's oldest pending operation. It reports whether the dispatcher may
+// move on to the next one. A per-user advisory lock keeps concurrent dispatchers from reordering operations.
+func (d *OutboxDispatcher) dispatchNext(userID string) (bool, error) {
+	tx := d.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Wait for any other dispatcher working on this user, then pick up whatever it left
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "gateway_outbox:"+userID).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to lock user outbox: %w", err)
+	}
+
+	var item models.GatewayOutbox
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ?", userID, models.OutboxStatusPending).
+		Order("id ASC").First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		return false, nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to get pending outbox operation: %w", err)
+	}
+	now := time.Now()
+	if item.NextAttemptAt.After(now) {
+		tx.Rollback()
+		return false, nil
+	}
+
+	updates := map[string]interface{}{"attempts": item.Attempts + 1}
+	applyErr := d.apply(&item)
+	if applyErr == nil {
+		updates["status"] = models.OutboxStatusDispatched
+		updates["dispatched_at"] = now
+	} else {
+		updates["last_error"] = applyErr.Error()
+		if item.Attempts+1 >= d.config().GetMaxAttempts() {
+			updates["status"] = models.OutboxStatusDead
+		} else {
+			updates["next_attempt_at"] = now.Add(outboxBackoff(item.Attempts + 1))
+		}
+	}
+	if err := tx.Model(&item).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return false, fmt.Errorf("failed to update outbox operation: %w", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return false, fmt.Errorf("failed to commit outbox operation: %w", err)
+	}
+
+	if applyErr != nil {
+		if updates["status"] == models.OutboxStatusDead {
+			logger.Error("Outbox operation dead-lettered",
+				zap.Int64("id", item.ID),
+				zap.String("user_id", userID),
+				zap.String("operation", item.Operation),
+				zap.Int("attempts", item.Attempts+1),
+				zap.Error(applyErr))
+			// Later operations no longer wait for this one
+			return true, nil
+		}
+		logger.Warn("Outbox operation failed, will retry",
+			zap.Int64("id", item.ID),
+			zap.String("user_id", userID),
+			zap.String("operation", item.Operation),
+			zap.Int("attempts", item.Attempts+1),
+			zap.Error(applyErr))
+		return false, nil
+	}
+	return true, nil
+}
+
+// apply sends one operation to AiGateway
+func (d *OutboxDispatcher) apply(item *models.GatewayOutbox) error {
+	switch item.Operation {
+	case models.OutboxDeltaQuota:
+		return d.aiGatewayClient.DeltaQuota(item.UserID, item.Value)
+	case models.OutboxDeltaModelQuota:
+		return d.aiGatewayClient.DeltaModelQuota(item.UserID, item.Model, item.Value)
+	case models.OutboxRefreshModelQuota:
+		return d.aiGatewayClient.RefreshModelQuota(item.UserID, item.Model, item.Value)
+	case models.OutboxDeltaUsedQuota:
+		return d.aiGatewayClient.DeltaUsedQuota(item.UserID, item.Value)
+	case models.OutboxRefreshQuota:
+		return d.aiGatewayClient.RefreshQuota(item.UserID, item.Value)
+	default:
+		return fmt.Errorf("unknown outbox operation %s", item.Operation)
+	}
+}
+
+// outboxBackoff returns the delay before the next attempt, doubling from 5 seconds
+func outboxBackoff(attempts int) time.Duration {
+	backoff := 5 * time.Second
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxOutboxBackoff {
+			return maxOutboxBackoff
+		}
+	}
+	return backoff
+}
+
+// GetStatus returns pending, retrying and dead-lettered counts
+func (d *OutboxDispatcher) GetStatus() (*OutboxStatus, error) {
+	status := &OutboxStatus{}
+	if err := d.db.DB.Model(&models.GatewayOutbox{}).
+		Where("status = ?", models.OutboxStatusPending).Count(&status.Pending).Error; err != nil {
+		return nil, NewDatabaseError("count pending outbox operations", err)
+	}
+	if err := d.db.DB.Model(&models.GatewayOutbox{}).
+		Where("status = ? AND attempts > 0", models.OutboxStatusPending).Count(&status.Retrying).Error; err != nil {
+		return nil, NewDatabaseError("count retrying outbox operations", err)
+	}
+	if err := d.db.DB.Model(&models.GatewayOutbox{}).
+		Where("status = ?", models.OutboxStatusDead).Count(&status.Dead).Error; err != nil {
+		return nil, NewDatabaseError("count dead outbox operations", err)
+	}
+	if status.Pending > 0 {
+		var oldest models.GatewayOutbox
+		if err := d.db.DB.Where("status = ?", models.OutboxStatusPending).
+			Order("id ASC").First(&oldest).Error; err != nil {
+			return nil, NewDatabaseError("get oldest pending outbox operation", err)
+		}
+		status.OldestPending = &oldest.CreateTime
+	}
+	return status, nil
+}
+
+// ListItems returns outbox operations filtered by status and user, newest first
+func (d *OutboxDispatcher) ListItems(status, userID string, page, pageSize int) (*OutboxListResponse, error) {
+	overall, err := d.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	query := d.db.DB.Model(&models.GatewayOutbox{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, NewDatabaseError("count outbox operations", err)
+	}
+	items := make([]models.GatewayOutbox, 0)
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error; err != nil {
+		return nil, NewDatabaseError("list outbox operations", err)
+	}
+
+	return &OutboxListResponse{Status: *overall, Total: total, Items: items}, nil
+}
+
+// Replay queues a dead-lettered or retrying operation for an immediate attempt and dispatches its user
+func (d *OutboxDispatcher) Replay(id int64) (*models.GatewayOutbox, error) {
+	var item models.GatewayOutbox
+	if err := d.db.DB.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("outbox operation", strconv.FormatInt(id, 10))
+		}
+		return nil, NewDatabaseError("get outbox operation", err)
+	}
+	if item.Status == models.OutboxStatusDispatched {
+		return nil, NewConflictError("outbox operation was already dispatched")
+	}
+
+	if _, err := d.requeue(d.db.DB.Where("id = ?", id)); err != nil {
+		return nil, err
+	}
+	d.DispatchUser(item.UserID)
+
+	if err := d.db.DB.First(&item, id).Error; err != nil {
+		return nil, NewDatabaseError("get outbox operation", err)
+	}
+	return &item, nil
+}
+
+// ReplayDead queues every dead-lettered operation for an immediate attempt and returns how many were queued
+func (d *OutboxDispatcher) ReplayDead() (int64, error) {
+	var userIDs []string
+	if err := d.db.DB.Model(&models.GatewayOutbox{}).Where("status = ?", models.OutboxStatusDead).
+		Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, NewDatabaseError("query dead outbox operations", err)
+	}
+
+	replayed, err := d.requeue(d.db.DB.Where("status = ?", models.OutboxStatusDead))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range userIDs {
+		d.DispatchUser(userID)
+	}
+	return replayed, nil
+}
+
+// requeue resets the matched operations to pending with a fresh attempt budget
+func (d *OutboxDispatcher) requeue(query *gorm.DB) (int64, error) {
+	result := query.Model(&models.GatewayOutbox{}).Updates(map[string]interface{}{
+		"status":          models.OutboxStatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if result.Error != nil {
+		return 0, NewDatabaseError("replay outbox operations", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (d *OutboxDispatcher) config() *config.OutboxConfig {
+	return &d.configManager.GetDirect().Outbox
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"quota-manager/internal/condition"
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// promoCodePattern matches normalized promo codes such as LAUNCH2026 or SPRING-SALE
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,49}$`)
+
+// CreatePromoCodeRequest represents an admin request to issue a promo code
+type CreatePromoCodeRequest struct {
+	Code           string         `json:"code" validate:"required,min=3,max=50"`
+	Amount         decimal.Amount `json:"amount" validate:"required,gt=0"`
+	Model          string         `json:"model,omitempty" validate:"max=100"` // Empty for the general pool
+	ExpiryDays     *int           `json:"expiry_days,omitempty" validate:"omitempty,gte=1"`
+	MaxRedemptions int            `json:"max_redemptions" validate:"gte=0"`          // 0 for no total cap
+	PerUserLimit   int            `json:"per_user_limit" validate:"omitempty,gte=1"` // Defaults to 1
+	StartsAt       *time.Time     `json:"starts_at,omitempty"`
+	EndsAt         *time.Time     `json:"ends_at,omitempty"`
+	Condition      string         `json:"condition,omitempty"`
+}
+
+// RedeemPromoCodeRequest represents a user request to redeem a promo code
+type RedeemPromoCodeRequest struct {
+	Code string `json:"code" validate:"required,max=50"`
+}
+
+// RedeemPromoCodeResponse represents the quota granted by a promo code
+type RedeemPromoCodeResponse struct {
+	Code       string         `json:"code"`
+	Amount     decimal.Amount `json:"amount"`
+	Model      string         `json:"model,omitempty"`
+	ExpiryDate time.Time      `json:"expiry_date"`
+	Operation  string         `json:"operation"`
+}
+
+// normalizePromoCode upper-cases a promo code so redemption is case-insensitive
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CreatePromoCode issues a new promo code
+func (s *QuotaService) CreatePromoCode(operator string, req *CreatePromoCodeRequest) (*models.PromoCode, error) {
+	code := normalizePromoCode(req.Code)
+	if !promoCodePattern.MatchString(code) {
+		return nil, NewValidationFailedError("code must be 3-50 letters, digits, '-' or '_'")
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		return nil, NewValidationFailedError("ends_at must be after starts_at")
+	}
+	if req.EndsAt != nil && !req.EndsAt.After(time.Now()) {
+		return nil, NewValidationFailedError("ends_at must be in the future")
+	}
+	if req.Condition != "" {
+		if _, err := condition.NewParser(req.Condition).Parse(); err != nil {
+			return nil, NewValidationFailedError("invalid condition expression: " + err.Error())
+		}
+	}
+	perUserLimit := req.PerUserLimit
+	if perUserLimit == 0 {
+		perUserLimit = 1
+	}
+
+	var existing int64
+	if err := s.db.DB.Model(&models.PromoCode{}).Where("code = ?", code).Count(&existing).Error; err != nil {
+		return nil, NewDatabaseError("check promo code", err)
+	}
+	if existing > 0 {
+		return nil, NewConflictError(fmt.Sprintf("promo code %s already exists", code))
+	}
+
+	promo := &models.PromoCode{
+		Code:           code,
+		Amount:         req.Amount,
+		Model:          req.Model,
+		ExpiryDays:     req.ExpiryDays,
+		MaxRedemptions: req.MaxRedemptions,
+		PerUserLimit:   perUserLimit,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		Condition:      req.Condition,
+		Status:         models.PromoCodeStatusActive,
+		CreatedBy:      operator,
+	}
+	if err := s.db.DB.Create(promo).Error; err != nil {
+		return nil, NewDatabaseError("create promo code", err)
+	}
+
+	logger.Info("Promo code created",
+		zap.String("code", promo.Code),
+		zap.Stringer("amount", promo.Amount),
+		zap.Int("max_redemptions", promo.MaxRedemptions),
+		zap.String("operator", operator))
+	return promo, nil
+}
+
+// GetPromoCodes lists promo codes, newest first
+func (s *QuotaService) GetPromoCodes() ([]models.PromoCode, error) {
+	var promos []models.PromoCode
+	if err := s.db.DB.Order("id DESC").Find(&promos).Error; err != nil {
+		return nil, NewDatabaseError("list promo codes", err)
+	}
+	return promos, nil
+}
+
+// DisablePromoCode stops a promo code from being redeemed, past redemptions are kept
+func (s *QuotaService) DisablePromoCode(id int) (*models.PromoCode, error) {
+	var promo models.PromoCode
+	if err := s.db.DB.First(&promo, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("promo code", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get promo code", err)
+	}
+	if err := s.db.DB.Model(&promo).Update("status", models.PromoCodeStatusDisabled).Error; err != nil {
+		return nil, NewDatabaseError("disable promo code", err)
+	}
+	return &promo, nil
+}
+
+// RedeemPromoCode grants the promo code amount to the user. Eligibility is evaluated before the
+// transaction because conditions may query AiGateway. The promo row is then locked for the rest of
+// the redemption, so the total and per-user caps are checked and consumed one redemption at a time.
+func (s *QuotaService) RedeemPromoCode(user *models.AuthUser, req *RedeemPromoCodeRequest) (*RedeemPromoCodeResponse, error) {
+	code := normalizePromoCode(req.Code)
+	if !promoCodePattern.MatchString(code) {
+		return nil, NewValidationFailedError("invalid promo code")
+	}
+
+	var promo models.PromoCode
+	if err := s.db.DB.Where("code = ?", code).First(&promo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("promo code", code)
+		}
+		return nil, NewDatabaseError("get promo code", err)
+	}
+	if err := checkPromoCodeRedeemable(&promo, time.Now()); err != nil {
+		return nil, err
+	}
+	if promo.Condition != "" {
+		eligible, err := s.evaluatePromoCondition(user.ID, promo.Condition)
+		if err != nil {
+			return nil, err
+		}
+		if !eligible {
+			return nil, NewValidationFailedError("user is not eligible for this promo code")
+		}
+	}
+
+	now := utils.NowInConfigTimezone(s.configManager.GetDirect()).Truncate(time.Second)
+	expiryDate := utils.CalculateExpiryDate(now, promo.ExpiryDays)
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, user.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promo, promo.ID).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("lock promo code", err)
+	}
+	if err := checkPromoCodeRedeemable(&promo, time.Now()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var redeemed int64
+	if err := tx.Model(&models.PromoRedemption{}).Where("promo_code_id = ? AND user_id = ?", promo.ID, user.ID).Count(&redeemed).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("count promo redemptions", err)
+	}
+	if redeemed >= int64(promo.PerUserLimit) {
+		tx.Rollback()
+		return nil, NewConflictError("promo code has already been redeemed by this user")
+	}
+
+	if err := tx.Create(&models.PromoRedemption{PromoCodeID: promo.ID, UserID: user.ID, Amount: promo.Amount, ExpiryDate: expiryDate}).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("record promo redemption", err)
+	}
+	if err := tx.Model(&promo).Update("redemption_count", gorm.Expr("redemption_count + 1")).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update promo code", err)
+	}
+
+	bucket, err := addToQuotaBucket(tx, user.ID, promo.Model, expiryDate, promo.Amount)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: models.OperationPromoRedeem,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        promo.Amount,
+			TotalItems:         1,
+			SuccessfulItems:    1,
+			EarliestExpiryDate: expiryDate.Format(time.RFC3339),
+		},
+		Items: []models.QuotaAuditDetailItem{
+			{
+				Amount:        promo.Amount,
+				ExpiryDate:    expiryDate.Format(time.RFC3339),
+				Status:        models.AuditStatusSuccess,
+				OriginalQuota: bucket.Amount.Sub(promo.Amount),
+				NewQuota:      bucket.Amount,
+			},
+		},
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:     user.ID,
+		Amount:     promo.Amount,
+		Operation:  models.OperationPromoRedeem,
+		PromoCode:  promo.Code,
+		Model:      promo.Model,
+		ExpiryDate: expiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create audit record", err)
+	}
+	if err := enqueueQuotaDelta(tx, models.OperationPromoRedeem, user.ID, promo.Model, promo.Amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit promo redemption", err)
+	}
+	s.outbox.DispatchUser(user.ID)
+
+	logger.Info("Promo code redeemed",
+		zap.String("code", promo.Code),
+		zap.String("user_id", user.ID),
+		zap.Stringer("amount", promo.Amount),
+		zap.Time("expiry_date", expiryDate))
+	return &RedeemPromoCodeResponse{
+		Code:       promo.Code,
+		Amount:     promo.Amount,
+		Model:      promo.Model,
+		ExpiryDate: expiryDate,
+		Operation:  models.OperationPromoRedeem,
+	}, nil
+}
+
+// checkPromoCodeRedeemable rejects disabled, exhausted and out-of-window promo codes
+func checkPromoCodeRedeemable(promo *models.PromoCode, now time.Time) error {
+	if promo.Status != models.PromoCodeStatusActive {
+		return NewConflictError("promo code is disabled")
+	}
+	if promo.StartsAt != nil && now.Before(*promo.StartsAt) {
+		return NewConflictError("promo code is not valid yet")
+	}
+	if promo.EndsAt != nil && !now.Before(*promo.EndsAt) {
+		return NewConflictError("promo code has ended")
+	}
+	if promo.MaxRedemptions > 0 && promo.RedemptionCount >= promo.MaxRedemptions {
+		return NewConflictError("promo code has been fully redeemed")
+	}
+	return nil
+}
+
+// evaluatePromoCondition evaluates a promo code eligibility condition for the user
+func (s *QuotaService) evaluatePromoCondition(userID, expr string) (bool, error) {
+	var user models.UserInfo
+	if err := s.db.AuthDB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, NewDatabaseError("get user", err)
+	}
+
+	match, err := s.calcUserCondition(&user, expr)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate promo code condition: %w", err)
+	}
+	return match, nil
+}
+
+// calcUserCondition evaluates a condition expression for the user with the same queriers strategies use
+func (s *QuotaService) calcUserCondition(user *models.UserInfo, expr string) (bool, error) {
+	cfg := s.configManager.GetDirect()
+	ctx := &condition.EvaluationContext{
+		QuotaQuerier:    condition.NewAiGatewayQuotaQuerier(s.aiGatewayClient),
+		DatabaseQuerier: &StrategyDatabaseQuerier{db: s.db},
+		ConfigQuerier:   &StrategyConfigQuerier{employeeSyncConfig: &cfg.EmployeeSync},
+	}
+	return condition.CalcCondition(user, expr, ctx)
+}
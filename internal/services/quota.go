@@ -1,13 +1,16 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"quota-manager/internal/config"
 	"quota-manager/internal/database"
 	"quota-manager/internal/models"
 	"quota-manager/internal/utils"
 	"quota-manager/pkg/aigateway"
+	"quota-manager/pkg/decimal"
 	"quota-manager/pkg/logger"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,6 +25,12 @@ type QuotaService struct {
 	configManager   *config.Manager
 	aiGatewayClient *aigateway.Client
 	voucherSvc      *VoucherService
+	outbox          *OutboxDispatcher
+	expiryNotifier  ExpiryNotifier
+	requestNotifier QuotaRequestNotifier
+	permissionSvc   *PermissionService
+	starCheckSvc    *StarCheckPermissionService
+	quotaCheckSvc   *QuotaCheckPermissionService
 }
 
 // GetConfigManager returns the config manager
@@ -37,30 +46,66 @@ func NewQuotaService(db *database.DB, configManager *config.Manager, aiGatewayCl
 		configManager:   configManager,
 		aiGatewayClient: aiGatewayClient,
 		voucherSvc:      voucherSvc,
+		outbox:          NewOutboxDispatcher(db, configManager, aiGatewayClient),
+		expiryNotifier:  newExpiryNotifier(&configManager.GetDirect().ExpiryNotify),
+		requestNotifier: newQuotaRequestNotifier(&configManager.GetDirect().QuotaRequest),
 	}
 }
 
+// SetExpiryNotifier replaces the notifier that delivers expiry warnings
+func (s *QuotaService) SetExpiryNotifier(notifier ExpiryNotifier) {
+	s.expiryNotifier = notifier
+}
+
+// SetQuotaRequestNotifier replaces the notifier that delivers quota request notifications
+func (s *QuotaService) SetQuotaRequestNotifier(notifier QuotaRequestNotifier) {
+	s.requestNotifier = notifier
+}
+
+// SetPermissionServices sets the services that refresh effective permissions after merges
+// carry over or restore personal settings
+func (s *QuotaService) SetPermissionServices(permission *PermissionService, starCheck *StarCheckPermissionService, quotaCheck *QuotaCheckPermissionService) {
+	s.permissionSvc = permission
+	s.starCheckSvc = starCheck
+	s.quotaCheckSvc = quotaCheck
+}
+
+// Outbox returns the dispatcher that applies queued AiGateway quota operations
+func (s *QuotaService) Outbox() *OutboxDispatcher {
+	return s.outbox
+}
+
 // QuotaInfo represents user quota information
 type QuotaInfo struct {
-	TotalQuota float64           `json:"total_quota"`
-	UsedQuota  float64           `json:"used_quota"`
-	QuotaList  []QuotaDetailItem `json:"quota_list"`
-	IsStar     string            `json:"is_star,omitempty"`
+	TotalQuota  decimal.Amount            `json:"total_quota"`
+	UsedQuota   decimal.Amount            `json:"used_quota"`
+	HeldQuota   decimal.Amount            `json:"held_quota"` // Reserved by active holds, not available
+	QuotaList   []QuotaDetailItem         `json:"quota_list"`
+	ModelQuotas map[string]decimal.Amount `json:"model_quotas,omitempty"` // Remaining quota per model, usable only with that model
+	IsStar      string                    `json:"is_star,omitempty"`
 }
 
 // QuotaDetailItem represents quota detail item
 type QuotaDetailItem struct {
-	Amount     float64   `json:"amount"`
-	ExpiryDate time.Time `json:"expiry_date"`
+	Amount     decimal.Amount `json:"amount"`
+	Model      string         `json:"model,omitempty"` // Empty for the general pool
+	ExpiryDate time.Time      `json:"expiry_date"`
 }
 
 // QuotaAuditRecord represents quota audit record
 type QuotaAuditRecord struct {
-	Amount       float64                   `json:"amount"`
+	ID           int                       `json:"id"`
+	UserID       string                    `json:"user_id"`
+	Amount       decimal.Amount            `json:"amount"`
 	Operation    string                    `json:"operation"`
 	VoucherCode  string                    `json:"voucher_code,omitempty"`
 	RelatedUser  string                    `json:"related_user,omitempty"`
+	StrategyID   *int                      `json:"strategy_id,omitempty"`
 	StrategyName string                    `json:"strategy_name,omitempty"`
+	Reason       string                    `json:"reason,omitempty"`
+	ReferenceID  string                    `json:"reference_id,omitempty"`
+	Model        string                    `json:"model,omitempty"`
+	Operator     string                    `json:"operator,omitempty"`
 	ExpiryDate   time.Time                 `json:"expiry_date"`
 	Details      *models.QuotaAuditDetails `json:"details,omitempty"`
 	CreateTime   time.Time                 `json:"create_time"`
@@ -74,8 +119,8 @@ type TransferOutRequest struct {
 
 // TransferQuotaItem represents quota item for transfer
 type TransferQuotaItem struct {
-	Amount     float64   `json:"amount" validate:"required,gt=0"`
-	ExpiryDate time.Time `json:"expiry_date" validate:"required"`
+	Amount     decimal.Amount `json:"amount" validate:"required,gt=0"`
+	ExpiryDate time.Time      `json:"expiry_date" validate:"required"`
 }
 
 // TransferOutResponse represents transfer out response
@@ -99,6 +144,7 @@ const (
 	TransferStatusPartialSuccess  TransferStatus = "PARTIAL_SUCCESS"
 	TransferStatusFailed          TransferStatus = "FAILED"
 	TransferStatusAlreadyRedeemed TransferStatus = "ALREADY_REDEEMED"
+	TransferStatusVoucherExpired  TransferStatus = "VOUCHER_EXPIRED"
 )
 
 // TransferFailureReason represents the reason for transfer failure
@@ -119,36 +165,20 @@ type TransferInResponse struct {
 	QuotaList   []TransferQuotaResult `json:"quota_list"`
 	VoucherCode string                `json:"voucher_code"`
 	Operation   string                `json:"operation"`
-	Amount      float64               `json:"amount"`
+	Amount      decimal.Amount        `json:"amount"`
 	Status      TransferStatus        `json:"status"`
 	Message     string                `json:"message,omitempty"`
 }
 
 // TransferQuotaResult represents transfer quota result
 type TransferQuotaResult struct {
-	Amount        float64                `json:"amount"`
+	Amount        decimal.Amount         `json:"amount"`
 	ExpiryDate    time.Time              `json:"expiry_date"`
 	IsExpired     bool                   `json:"is_expired"`
 	Success       bool                   `json:"success"`
 	FailureReason *TransferFailureReason `json:"failure_reason,omitempty"`
 }
 
-// MergeQuotaRequest represents merge quota request
-type MergeQuotaRequest struct {
-	MainUserID  string `json:"main_user_id" validate:"required,uuid"`  // The user who will receive the merged quota
-	OtherUserID string `json:"other_user_id" validate:"required,uuid"` // The user who willbe merged into the main user
-}
-
-// MergeQuotaResponse represents merge quota response
-type MergeQuotaResponse struct {
-	MainUserID  string  `json:"main_user_id"`
-	OtherUserID string  `json:"other_user_id"`
-	Amount      float64 `json:"amount"`
-	Operation   string  `json:"operation"`
-	Status      string  `json:"status"`
-	Message     string  `json:"message,omitempty"`
-}
-
 // GetUserQuota retrieves user quota information
 func (s *QuotaService) GetUserQuota(userID string) (*QuotaInfo, error) {
 	// Get total quota from AiGateway
@@ -170,27 +200,44 @@ func (s *QuotaService) GetUserQuota(userID string) (*QuotaInfo, error) {
 		return nil, fmt.Errorf("failed to get quota list: %w", err)
 	}
 
+	// Active reservations hold part of the remaining quota
+	held, heldQuota, err := heldQuotaByExpiry(s.db.DB, userID, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
 	// Calculate remaining quotas considering used quota
 	quotaList := make([]QuotaDetailItem, 0)
+	modelQuotas := make(map[string]decimal.Amount)
 	remainingUsed := usedQuota
 
 	for _, quota := range quotas {
-		if remainingUsed <= 0 {
+		var remaining decimal.Amount
+		if !remainingUsed.IsPositive() {
 			// No more used quota to deduct
-			quotaList = append(quotaList, QuotaDetailItem{
-				Amount:     quota.Amount,
-				ExpiryDate: quota.ExpiryDate,
-			})
-		} else if quota.Amount > remainingUsed {
+			remaining = quota.Amount
+		} else if quota.Amount.GreaterThan(remainingUsed) {
 			// This quota is partially consumed
+			remaining = quota.Amount.Sub(remainingUsed)
+			remainingUsed = decimal.Zero
+		} else {
+			// This quota is fully consumed
+			remainingUsed = remainingUsed.Sub(quota.Amount)
+			continue
+		}
+
+		if quota.Model == "" {
+			remaining = remaining.Sub(held[quota.ExpiryDate.Unix()])
+		}
+		if remaining.IsPositive() {
 			quotaList = append(quotaList, QuotaDetailItem{
-				Amount:     quota.Amount - remainingUsed,
+				Amount:     remaining,
+				Model:      quota.Model,
 				ExpiryDate: quota.ExpiryDate,
 			})
-			remainingUsed = 0
-		} else {
-			// This quota is fully consumed
-			remainingUsed -= quota.Amount
+			if quota.Model != "" {
+				modelQuotas[quota.Model] = modelQuotas[quota.Model].Add(remaining)
+			}
 		}
 	}
 
@@ -217,65 +264,31 @@ func (s *QuotaService) GetUserQuota(userID string) (*QuotaInfo, error) {
 			}
 		}
 		return &QuotaInfo{
-			TotalQuota: totalQuota,
-			UsedQuota:  usedQuota,
-			QuotaList:  quotaList,
-			IsStar:     isStar,
+			TotalQuota:  totalQuota,
+			UsedQuota:   usedQuota,
+			HeldQuota:   heldQuota,
+			QuotaList:   quotaList,
+			ModelQuotas: modelQuotas,
+			IsStar:      isStar,
 		}, nil
 	}
 
 	return &QuotaInfo{
-		TotalQuota: totalQuota,
-		UsedQuota:  usedQuota,
-		QuotaList:  quotaList,
+		TotalQuota:  totalQuota,
+		UsedQuota:   usedQuota,
+		HeldQuota:   heldQuota,
+		QuotaList:   quotaList,
+		ModelQuotas: modelQuotas,
 	}, nil
 }
 
 // GetQuotaAuditRecords retrieves quota audit records
 func (s *QuotaService) GetQuotaAuditRecords(userID string, page, pageSize int) ([]QuotaAuditRecord, int64, error) {
-	var records []models.QuotaAudit
-	var total int64
-
-	offset := (page - 1) * pageSize
-
-	// Get total count
-	if err := s.db.DB.Model(&models.QuotaAudit{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count audit records: %w", err)
-	}
-
-	// Get records with pagination
-	if err := s.db.DB.Where("user_id = ?", userID).
-		Order("create_time DESC, id DESC").
-		Offset(offset).
-		Limit(pageSize).
-		Find(&records).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to get audit records: %w", err)
-	}
-
-	result := make([]QuotaAuditRecord, len(records))
-	for i, record := range records {
-		// Parse details if available
-		var details *models.QuotaAuditDetails
-		if record.Details != "" {
-			parsedDetails, err := record.UnmarshalDetails()
-			if err == nil {
-				details = parsedDetails
-			}
-		}
-
-		result[i] = QuotaAuditRecord{
-			Amount:       record.Amount,
-			Operation:    record.Operation,
-			VoucherCode:  record.VoucherCode,
-			RelatedUser:  record.RelatedUser,
-			StrategyName: record.StrategyName,
-			ExpiryDate:   record.ExpiryDate,
-			Details:      details,
-			CreateTime:   record.CreateTime,
-		}
+	result, err := s.SearchQuotaAudit(&QuotaAuditFilter{UserID: userID}, "", page, pageSize)
+	if err != nil {
+		return nil, 0, err
 	}
-
-	return result, total, nil
+	return result.Records, result.Total, nil
 }
 
 // TransferOut handles quota transfer out
@@ -285,40 +298,22 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 		return nil, fmt.Errorf("receiver_id cannot be empty")
 	}
 
+	// Check the giver's transfer rule before locking, its conditions may query AiGateway
+	transferAmount := decimal.Zero
+	for _, item := range req.QuotaList {
+		transferAmount = transferAmount.Add(item.Amount)
+	}
+	rule, err := s.checkTransferPolicy(giver.ID, []outgoingTransfer{{ReceiverID: strings.TrimSpace(req.ReceiverID), Amount: transferAmount}})
+	if err != nil {
+		return nil, err
+	}
+
 	// Get used quota from AiGateway to check availability
 	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(giver.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get used quota: %w", err)
 	}
 
-	// Get quota list ordered by expiry date to check availability
-	var quotas []models.Quota
-	if err := s.db.DB.Where("user_id = ? AND status = ?", giver.ID, models.StatusValid).
-		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
-		return nil, fmt.Errorf("failed to get quota list: %w", err)
-	}
-
-	// Calculate remaining quotas for each expiry date
-	quotaAvailabilityMap := make(map[string]float64) // key: expiry_date as string, value: available amount
-	remainingUsed := usedQuota
-
-	for _, quota := range quotas {
-		dateKey := quota.ExpiryDate.Format("2006-01-02T15:04:05Z07:00")
-		var availableFromThisQuota float64
-		if remainingUsed <= 0 {
-			availableFromThisQuota = quota.Amount
-		} else if quota.Amount > remainingUsed {
-			availableFromThisQuota = quota.Amount - remainingUsed
-			remainingUsed = 0
-		} else {
-			availableFromThisQuota = 0
-			remainingUsed -= quota.Amount
-		}
-
-		// Add to existing amount for the same expiry date (accumulate instead of overwriting)
-		quotaAvailabilityMap[dateKey] += availableFromThisQuota
-	}
-
 	// Start transaction
 	tx := s.db.DB.Begin()
 	defer func() {
@@ -327,37 +322,20 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 		}
 	}()
 
-	// Validate quota availability for each requested quota
-	for _, quotaItem := range req.QuotaList {
-		dateKey := quotaItem.ExpiryDate.Format("2006-01-02T15:04:05Z07:00")
-		available, exists := quotaAvailabilityMap[dateKey]
-		if !exists {
-			tx.Rollback()
-			return nil, fmt.Errorf("quota not found for expiry date %v", quotaItem.ExpiryDate)
-		}
-
-		if available < quotaItem.Amount {
-			tx.Rollback()
-			return nil, fmt.Errorf("insufficient available quota for expiry date %v: have %g, need %g",
-				quotaItem.ExpiryDate, available, quotaItem.Amount)
-		}
+	// Check availability under the giver's lock so concurrent transfers cannot spend the same quota
+	if err := lockUserQuota(tx, giver.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
-		// Also validate the total quota exists in database for this expiry date
-		var totalQuotaAmount float64
-		if err := tx.Model(&models.Quota{}).
-			Where("user_id = ? AND expiry_date = ? AND status = ?",
-				giver.ID, quotaItem.ExpiryDate, models.StatusValid).
-			Select("COALESCE(SUM(amount), 0)").
-			Scan(&totalQuotaAmount).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to check quota for expiry date %v: %w", quotaItem.ExpiryDate, err)
-		}
+	if err := s.checkTransferLimits(tx, rule, giver.ID, transferAmount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
 
-		if totalQuotaAmount < quotaItem.Amount {
-			tx.Rollback()
-			return nil, fmt.Errorf("insufficient quota for expiry date %v: have %f, need %f",
-				quotaItem.ExpiryDate, totalQuotaAmount, quotaItem.Amount)
-		}
+	if err := checkTransferable(tx, giver.ID, usedQuota, req.QuotaList); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
 	// Generate voucher code
@@ -390,36 +368,24 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 		QuotaList:       voucherQuotaList,
 	}
 
-	voucherCode, err := s.voucherSvc.GenerateVoucher(voucherData)
+	voucherCode, err := s.issueVoucher(tx, voucherData)
 	if err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to generate voucher: %w", err)
 	}
 
 	// Update quota table - reduce giver's quota
-	for _, quotaItem := range req.QuotaList {
-		if err := tx.Model(&models.Quota{}).
-			Where("user_id = ? AND expiry_date = ? AND status = ?",
-				giver.ID, quotaItem.ExpiryDate, models.StatusValid).
-			Update("amount", gorm.Expr("amount - ?", quotaItem.Amount)).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to update quota: %w", err)
-		}
-
-		// Delete quota records with zero or negative amounts
-		if err := tx.Where("user_id = ? AND expiry_date = ? AND status = ? AND amount <= 0",
-			giver.ID, quotaItem.ExpiryDate, models.StatusValid).Delete(&models.Quota{}).Error; err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("failed to delete zero quota records: %w", err)
-		}
+	if err := debitTransferQuota(tx, giver.ID, req.QuotaList); err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
 	// Calculate total amount for audit record
-	totalAmount := 0.0
+	totalAmount := decimal.Zero
 	// Find earliest expiry date for audit record
 	var earliestExpiryDate time.Time
 	for i, item := range req.QuotaList {
-		totalAmount += item.Amount
+		totalAmount = totalAmount.Add(item.Amount)
 		if i == 0 || item.ExpiryDate.Before(earliestExpiryDate) {
 			earliestExpiryDate = item.ExpiryDate
 		}
@@ -449,7 +415,7 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 	// Record audit log
 	auditRecord := &models.QuotaAudit{
 		UserID:      giver.ID,
-		Amount:      -totalAmount,
+		Amount:      totalAmount.Neg(),
 		Operation:   models.OperationTransferOut,
 		VoucherCode: voucherCode,
 		RelatedUser: cleanReceiverID,
@@ -465,13 +431,14 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 		return nil, fmt.Errorf("failed to create audit record: %w", err)
 	}
 
-	// Update AiGateway quota
-	if err := s.aiGatewayClient.DeltaQuota(giver.ID, -totalAmount); err != nil {
+	// Queue the AiGateway update with the quota change
+	if err := enqueueQuotaDelta(tx, models.OperationTransferOut, giver.ID, "", totalAmount.Neg()); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to update AiGateway quota: %w", err)
+		return nil, err
 	}
 
 	tx.Commit()
+	s.outbox.DispatchUser(giver.ID)
 
 	return &TransferOutResponse{
 		VoucherCode: voucherCode,
@@ -481,10 +448,136 @@ func (s *QuotaService) TransferOut(giver *models.AuthUser, req *TransferOutReque
 	}, nil
 }
 
+// checkTransferable verifies that the user can transfer every item of items. Used quota is taken from the
+// earliest buckets first, and model-scoped quota and quota held by active reservations cannot be transferred.
+// Items with the same expiry date are checked together, since they are debited from the same buckets.
+// Must be called under the user's quota lock.
+func checkTransferable(tx *gorm.DB, userID string, usedQuota decimal.Amount, items []TransferQuotaItem) error {
+	items = combineTransferItems(items)
+	transferable, err := transferableQuota(tx, userID, usedQuota)
+	if err != nil {
+		return err
+	}
+	quotaAvailabilityMap := make(map[string]decimal.Amount, len(transferable)) // key: expiry_date as string, value: available amount
+	for _, item := range transferable {
+		quotaAvailabilityMap[item.ExpiryDate.Format("2006-01-02T15:04:05Z07:00")] = item.Amount
+	}
+
+	// Validate quota availability for each requested quota
+	for _, quotaItem := range items {
+		dateKey := quotaItem.ExpiryDate.Format("2006-01-02T15:04:05Z07:00")
+		available, exists := quotaAvailabilityMap[dateKey]
+		if !exists {
+			return fmt.Errorf("quota not found for expiry date %v", quotaItem.ExpiryDate)
+		}
+
+		if available.LessThan(quotaItem.Amount) {
+			return fmt.Errorf("insufficient available quota for expiry date %v: have %s, need %s",
+				quotaItem.ExpiryDate, available, quotaItem.Amount)
+		}
+
+		// Also validate the total quota exists in database for this expiry date
+		totalQuotaAmount, err := sumAmount(tx.Model(&models.Quota{}).
+			Where("user_id = ? AND model = '' AND expiry_date = ? AND status = ?",
+				userID, quotaItem.ExpiryDate, models.StatusValid), "amount")
+		if err != nil {
+			return fmt.Errorf("failed to check quota for expiry date %v: %w", quotaItem.ExpiryDate, err)
+		}
+
+		if totalQuotaAmount.LessThan(quotaItem.Amount) {
+			return fmt.Errorf("insufficient quota for expiry date %v: have %s, need %s",
+				quotaItem.ExpiryDate, totalQuotaAmount, quotaItem.Amount)
+		}
+	}
+	return nil
+}
+
+// combineTransferItems adds up the amounts of items with the same expiry date, earliest first
+func combineTransferItems(items []TransferQuotaItem) []TransferQuotaItem {
+	var combined []TransferQuotaItem
+	index := make(map[int64]int, len(items))
+	for _, item := range items {
+		if idx, ok := index[item.ExpiryDate.Unix()]; ok {
+			combined[idx].Amount = combined[idx].Amount.Add(item.Amount)
+			continue
+		}
+		index[item.ExpiryDate.Unix()] = len(combined)
+		combined = append(combined, item)
+	}
+	sort.Slice(combined, func(i, j int) bool { return combined[i].ExpiryDate.Before(combined[j].ExpiryDate) })
+	return combined
+}
+
+// transferableQuota returns the quota the user can transfer per expiry date, earliest first, following the
+// rules of checkTransferable. Expiry dates with nothing left to transfer are kept with a zero amount.
+func transferableQuota(tx *gorm.DB, userID string, usedQuota decimal.Amount) ([]TransferQuotaItem, error) {
+	// Get quota list ordered by expiry date to check availability
+	var quotas []models.Quota
+	if err := tx.Where("user_id = ? AND status = ?", userID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
+	}
+
+	// Quota held by active reservations is not available for transfer
+	held, _, err := heldQuotaByExpiry(tx, userID, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calculate remaining quotas for each expiry date
+	var transferable []TransferQuotaItem
+	remainingUsed := usedQuota
+
+	for _, quota := range quotas {
+		var availableFromThisQuota decimal.Amount
+		if !remainingUsed.IsPositive() {
+			availableFromThisQuota = quota.Amount
+		} else if quota.Amount.GreaterThan(remainingUsed) {
+			availableFromThisQuota = quota.Amount.Sub(remainingUsed)
+			remainingUsed = decimal.Zero
+		} else {
+			availableFromThisQuota = decimal.Zero
+			remainingUsed = remainingUsed.Sub(quota.Amount)
+		}
+		if quota.Model != "" {
+			// Model-scoped quota cannot be transferred
+			continue
+		}
+		availableFromThisQuota = decimal.Max(availableFromThisQuota.Sub(held[quota.ExpiryDate.Unix()]), decimal.Zero)
+
+		// Add to existing amount for the same expiry date (accumulate instead of overwriting)
+		if n := len(transferable); n > 0 && transferable[n-1].ExpiryDate.Equal(quota.ExpiryDate) {
+			transferable[n-1].Amount = transferable[n-1].Amount.Add(availableFromThisQuota)
+			continue
+		}
+		transferable = append(transferable, TransferQuotaItem{Amount: availableFromThisQuota, ExpiryDate: quota.ExpiryDate})
+	}
+	return transferable, nil
+}
+
+// debitTransferQuota takes the transferred items out of the user's unscoped buckets
+func debitTransferQuota(tx *gorm.DB, userID string, items []TransferQuotaItem) error {
+	for _, quotaItem := range items {
+		if err := tx.Model(&models.Quota{}).
+			Where("user_id = ? AND model = '' AND expiry_date = ? AND status = ?",
+				userID, quotaItem.ExpiryDate, models.StatusValid).
+			Update("amount", gorm.Expr("amount - ?", quotaItem.Amount)).Error; err != nil {
+			return fmt.Errorf("failed to update quota: %w", err)
+		}
+
+		// Delete quota records with zero or negative amounts
+		if err := tx.Where("user_id = ? AND model = '' AND expiry_date = ? AND status = ? AND amount <= 0",
+			userID, quotaItem.ExpiryDate, models.StatusValid).Delete(&models.Quota{}).Error; err != nil {
+			return fmt.Errorf("failed to delete zero quota records: %w", err)
+		}
+	}
+	return nil
+}
+
 // TransferIn handles quota transfer in
 func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequest) (*TransferInResponse, error) {
-	// Validate voucher
-	voucherData, err := s.voucherSvc.ValidateAndDecodeVoucher(req.VoucherCode)
+	// Validate voucher, accepting both signed and short codes
+	voucherCode, voucherData, err := s.resolveVoucher(req.VoucherCode)
 	if err != nil {
 		return &TransferInResponse{
 			Status:  TransferStatusFailed,
@@ -500,22 +593,42 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		}, nil
 	}
 
-	// Check if voucher has already been redeemed
+	// Check if voucher has already been redeemed, cancelled or refunded
 	var existingRedemption models.VoucherRedemption
-	if err := s.db.DB.Where("voucher_code = ?", req.VoucherCode).First(&existingRedemption).Error; err == nil {
+	if err := s.db.DB.Where("voucher_code = ?", voucherCode).First(&existingRedemption).Error; err == nil {
+		switch existingRedemption.Status {
+		case models.VoucherStatusCancelled:
+			return &TransferInResponse{
+				Status:  TransferStatusFailed,
+				Message: "Voucher has been cancelled by the giver",
+			}, nil
+		case models.VoucherStatusRefunded:
+			return &TransferInResponse{
+				Status:  TransferStatusVoucherExpired,
+				Message: "Voucher has expired",
+			}, nil
+		}
 		return &TransferInResponse{
 			GiverID:     voucherData.GiverID,
 			GiverName:   voucherData.GiverName,
 			GiverPhone:  voucherData.GiverPhone,
 			GiverGithub: voucherData.GiverGithub,
 			ReceiverID:  receiver.ID,
-			VoucherCode: req.VoucherCode,
+			VoucherCode: voucherCode,
 			Operation:   models.OperationTransferIn,
 			Status:      TransferStatusAlreadyRedeemed,
 			Message:     "Voucher has already been redeemed",
 		}, nil
 	}
 
+	// Reject vouchers past their TTL, the giver gets them refunded by the refund job
+	if s.voucherSvc.IsExpired(voucherData, time.Now()) {
+		return &TransferInResponse{
+			Status:  TransferStatusVoucherExpired,
+			Message: fmt.Sprintf("Voucher expired at %s", s.voucherSvc.ExpiryTime(voucherData).Format(time.RFC3339)),
+		}, nil
+	}
+
 	// Start transaction
 	tx := s.db.DB.Begin()
 	defer func() {
@@ -524,10 +637,16 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		}
 	}()
 
+	if err := lockUserQuota(tx, receiver.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// Record redemption to prevent duplicate usage
 	redemption := &models.VoucherRedemption{
-		VoucherCode: req.VoucherCode,
+		VoucherCode: voucherCode,
 		ReceiverID:  receiver.ID,
+		Status:      models.VoucherStatusRedeemed,
 	}
 	if err := tx.Create(redemption).Error; err != nil {
 		tx.Rollback()
@@ -536,8 +655,15 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 			Message: "Failed to record voucher redemption",
 		}, nil
 	}
+	if err := markStoredVoucher(tx, voucherCode, models.VoucherStatusRedeemed); err != nil {
+		tx.Rollback()
+		return &TransferInResponse{
+			Status:  TransferStatusFailed,
+			Message: "Failed to record voucher redemption",
+		}, nil
+	}
 
-	totalAmount := 0.0
+	totalAmount := decimal.Zero
 	successCount := 0
 	quotaResults := make([]TransferQuotaResult, len(voucherData.QuotaList))
 	var earliestExpiryDate time.Time
@@ -557,7 +683,7 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		// Only process valid quota
 		if !isExpired {
 			var existingQuota models.Quota
-			if err := tx.Where("user_id = ? AND expiry_date = ? AND status = ?",
+			if err := tx.Where("user_id = ? AND model = '' AND expiry_date = ? AND status = ?",
 				receiver.ID, quotaItem.ExpiryDate, models.StatusValid).First(&existingQuota).Error; err != nil {
 				// Create new quota record
 				newQuota := &models.Quota{
@@ -573,7 +699,7 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 				} else {
 					quotaResult.Success = true
 					successCount++
-					totalAmount += quotaItem.Amount
+					totalAmount = totalAmount.Add(quotaItem.Amount)
 
 					// Track earliest expiry date for valid quota
 					if !hasValidQuota || quotaItem.ExpiryDate.Before(earliestExpiryDate) {
@@ -583,14 +709,14 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 				}
 			} else {
 				// Update existing quota
-				if err := tx.Model(&existingQuota).Update("amount", existingQuota.Amount+quotaItem.Amount).Error; err != nil {
+				if err := tx.Model(&existingQuota).Update("amount", existingQuota.Amount.Add(quotaItem.Amount)).Error; err != nil {
 					// Individual quota update failed, mark as pending
 					reason := TransferFailureReasonPending
 					quotaResult.FailureReason = &reason
 				} else {
 					quotaResult.Success = true
 					successCount++
-					totalAmount += quotaItem.Amount
+					totalAmount = totalAmount.Add(quotaItem.Amount)
 
 					// Track earliest expiry date for valid quota
 					if !hasValidQuota || quotaItem.ExpiryDate.Before(earliestExpiryDate) {
@@ -655,7 +781,7 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 			UserID:      receiver.ID,
 			Amount:      totalAmount,
 			Operation:   models.OperationTransferIn,
-			VoucherCode: req.VoucherCode,
+			VoucherCode: voucherCode,
 			RelatedUser: voucherData.GiverID,
 			ExpiryDate:  earliestExpiryDate, // Use earliest expiry date from valid quota
 			// StrategyName is empty for transfer operations
@@ -676,17 +802,23 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		}
 	}
 
-	// Update AiGateway quota only for valid quota
-	if totalAmount > 0 {
-		if err := s.aiGatewayClient.DeltaQuota(receiver.ID, totalAmount); err != nil {
-			tx.Rollback()
-			return &TransferInResponse{
-				Status:  TransferStatusFailed,
-				Message: "Failed to update AiGateway quota",
-			}, nil
-		}
+	// Queue the AiGateway update only for valid quota
+	if err := enqueueQuotaDelta(tx, models.OperationTransferIn, receiver.ID, "", totalAmount); err != nil {
+		tx.Rollback()
+		return &TransferInResponse{
+			Status:  TransferStatusFailed,
+			Message: "Failed to queue AiGateway quota update",
+		}, nil
 	}
 
+	if err := tx.Commit().Error; err != nil {
+		return &TransferInResponse{
+			Status:  TransferStatusFailed,
+			Message: "Failed to commit voucher redemption",
+		}, nil
+	}
+	s.outbox.DispatchUser(receiver.ID)
+
 	// Check and handle GitHub star status if giver has starred projects
 	if voucherData.GiverGithubStar != "" && s.aiGatewayClient != nil {
 		// If giver has starred projects, set starred projects in AiGateway for receiver
@@ -699,8 +831,6 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		}
 	}
 
-	tx.Commit()
-
 	// Determine overall transfer status
 	var status TransferStatus
 	var message string
@@ -733,7 +863,7 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 		GiverGithub: voucherData.GiverGithub,
 		ReceiverID:  receiver.ID,
 		QuotaList:   quotaResults,
-		VoucherCode: req.VoucherCode,
+		VoucherCode: voucherCode,
 		Operation:   models.OperationTransferIn,
 		Amount:      totalAmount,
 		Status:      status,
@@ -741,53 +871,127 @@ func (s *QuotaService) TransferIn(receiver *models.AuthUser, req *TransferInRequ
 	}, nil
 }
 
-// AddQuotaForStrategy adds quota for strategy execution
-func (s *QuotaService) AddQuotaForStrategy(userID string, amount float64, strategyID int, strategyName string, relatedUserID *string) error {
-	now := utils.NowInConfigTimezone(s.configManager.GetDirect()).Truncate(time.Second)
+// issueVoucher creates the code for a transfer out: a short code backed by the vouchers table when
+// voucher.short_codes is enabled, a self-contained signed code otherwise
+func (s *QuotaService) issueVoucher(tx *gorm.DB, data *VoucherData) (string, error) {
+	if !s.configManager.GetDirect().Voucher.ShortCodes {
+		return s.voucherSvc.GenerateVoucher(data)
+	}
 
-	// Get strategy information to determine expiry date
-	var strategy models.QuotaStrategy
-	if err := s.db.DB.First(&strategy, strategyID).Error; err != nil {
-		return fmt.Errorf("failed to get strategy: %w", err)
+	// 55 random bits make collisions unlikely, retry a few times rather than fail the transfer
+	for attempt := 0; attempt < 3; attempt++ {
+		voucher, err := s.voucherSvc.NewStoredVoucher(data)
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		if err := tx.Model(&models.Voucher{}).Where("code = ?", voucher.Code).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check voucher code: %w", err)
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Create(voucher).Error; err != nil {
+			return "", fmt.Errorf("failed to store voucher: %w", err)
+		}
+		return voucher.Code, nil
 	}
+	return "", fmt.Errorf("failed to allocate a unique voucher code")
+}
 
-	// Calculate expiry date based on strategy's ExpiryDays
-	expiryDate := utils.CalculateExpiryDate(now, strategy.ExpiryDays)
+// resolveVoucher decodes a signed or short voucher code, returning the canonical code with the voucher data
+func (s *QuotaService) resolveVoucher(code string) (string, *VoucherData, error) {
+	shortCode, ok := NormalizeShortVoucherCode(code)
+	if !ok {
+		data, err := s.voucherSvc.ValidateAndDecodeVoucher(code)
+		if err != nil {
+			return "", nil, err
+		}
+		return code, data, nil
+	}
 
-	// Start transaction
-	tx := s.db.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	var voucher models.Voucher
+	if err := s.db.DB.Where("code = ?", shortCode).First(&voucher).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, fmt.Errorf("voucher not found")
 		}
-	}()
+		return "", nil, fmt.Errorf("failed to get voucher: %w", err)
+	}
+	data, err := s.voucherSvc.DecodeStoredVoucher(&voucher)
+	if err != nil {
+		return "", nil, err
+	}
+	return voucher.Code, data, nil
+}
 
-	// Add or update quota
+// markStoredVoucher updates the status of a short-code voucher, signed codes have no stored record
+func markStoredVoucher(tx *gorm.DB, code, status string) error {
+	return tx.Model(&models.Voucher{}).
+		Where("code = ? AND status = ?", code, models.VoucherStatusIssued).
+		Update("status", status).Error
+}
+
+// addToQuotaBucket adds amount to the valid bucket of a user with the given model and expiry date,
+// creating the bucket when it does not exist. It returns the bucket with its new amount.
+func addToQuotaBucket(tx *gorm.DB, userID, model string, expiryDate time.Time, amount decimal.Amount) (*models.Quota, error) {
 	var quota models.Quota
-	err := tx.Where("user_id = ? AND expiry_date = ? AND status = ?",
-		userID, expiryDate, models.StatusValid).First(&quota).Error
+	err := tx.Where("user_id = ? AND model = ? AND expiry_date = ? AND status = ?",
+		userID, model, expiryDate, models.StatusValid).First(&quota).Error
 
 	if err == gorm.ErrRecordNotFound {
 		// Create new quota record
 		quota = models.Quota{
 			UserID:     userID,
 			Amount:     amount,
+			Model:      model,
 			ExpiryDate: expiryDate,
 			Status:     models.StatusValid,
 		}
 		if err := tx.Create(&quota).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to create quota: %w", err)
+			return nil, fmt.Errorf("failed to create quota: %w", err)
 		}
 	} else if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to query quota: %w", err)
+		return nil, fmt.Errorf("failed to query quota: %w", err)
 	} else {
 		// Update existing quota
-		if err := tx.Model(&quota).Update("amount", quota.Amount+amount).Error; err != nil {
+		if err := tx.Model(&quota).Update("amount", quota.Amount.Add(amount)).Error; err != nil {
+			return nil, fmt.Errorf("failed to update quota: %w", err)
+		}
+	}
+	return &quota, nil
+}
+
+// AddQuotaForStrategy adds quota for strategy execution
+func (s *QuotaService) AddQuotaForStrategy(userID string, amount decimal.Amount, strategyID int, strategyName string, relatedUserID *string) error {
+	now := utils.NowInConfigTimezone(s.configManager.GetDirect()).Truncate(time.Second)
+
+	// Get strategy information to determine expiry date
+	var strategy models.QuotaStrategy
+	if err := s.db.DB.First(&strategy, strategyID).Error; err != nil {
+		return fmt.Errorf("failed to get strategy: %w", err)
+	}
+
+	// Calculate expiry date based on strategy's ExpiryDays
+	expiryDate := utils.CalculateExpiryDate(now, strategy.ExpiryDays)
+
+	// Start transaction
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to update quota: %w", err)
 		}
+	}()
+
+	if err := lockUserQuota(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Add or update quota, strategies with a model grant into that model's bucket
+	quota, err := addToQuotaBucket(tx, userID, strategy.Model, expiryDate, amount)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	// Prepare detailed audit information for recharge
@@ -804,8 +1008,8 @@ func (s *QuotaService) AddQuotaForStrategy(userID string, amount float64, strate
 				Amount:        amount,
 				ExpiryDate:    expiryDate.Format(time.RFC3339),
 				Status:        models.AuditStatusSuccess,
-				OriginalQuota: quota.Amount - amount, // Before recharge
-				NewQuota:      quota.Amount,          // After recharge
+				OriginalQuota: quota.Amount.Sub(amount), // Before recharge
+				NewQuota:      quota.Amount,             // After recharge
 			},
 		},
 	}
@@ -822,6 +1026,7 @@ func (s *QuotaService) AddQuotaForStrategy(userID string, amount float64, strate
 		Operation:    models.OperationRecharge,
 		StrategyID:   &strategyID,
 		StrategyName: strategyName,
+		Model:        strategy.Model,
 		ExpiryDate:   expiryDate,
 	}
 	// Add related user if available
@@ -837,13 +1042,14 @@ func (s *QuotaService) AddQuotaForStrategy(userID string, amount float64, strate
 		return fmt.Errorf("failed to create audit record: %w", err)
 	}
 
-	// Update AiGateway quota
-	if err := s.aiGatewayClient.DeltaQuota(userID, amount); err != nil {
+	// Queue the AiGateway update with the recharge
+	if err := enqueueQuotaDelta(tx, models.OperationRecharge, userID, strategy.Model, amount); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to update AiGateway quota: %w", err)
+		return err
 	}
 
 	tx.Commit()
+	s.outbox.DispatchUser(userID)
 	return nil
 }
 
@@ -859,24 +1065,51 @@ func (s *QuotaService) ExpireQuotas() error {
 		// because monthly quota recording failure should not affect the main quota expiry functionality
 	}
 
-	// Step 2: Find expired but still valid quotas (original logic)
+	// Step 2: Find valid quotas whose expiry date and grace period have passed
 	logger.Info("Step 2: Finding expired but still valid quotas")
-	var expiredQuotas []models.Quota
-	if err := s.db.DB.Where("status = ? AND expiry_date < ?", models.StatusValid, now).Find(&expiredQuotas).Error; err != nil {
-		return fmt.Errorf("failed to find expired quotas: %w", err)
+	expiryPolicy := s.configManager.GetDirect().ExpiryPolicy
+	cutoff := now.Add(-expiryPolicy.GetGracePeriod())
+	var expiredUserIDs []string
+	if err := s.db.DB.Model(&models.Quota{}).Where("status = ? AND expiry_date < ?", models.StatusValid, cutoff).
+		Distinct().Pluck("user_id", &expiredUserIDs).Error; err != nil {
+		return fmt.Errorf("failed to find users with expired quotas: %w", err)
 	}
 
-	if len(expiredQuotas) == 0 {
+	if len(expiredUserIDs) == 0 {
 		return nil
 	}
 
-	// Group by user
-	userQuotaMap := make(map[string]float64)
-	for _, quota := range expiredQuotas {
-		userQuotaMap[quota.UserID] += quota.Amount
+	rollover, err := loadRolloverPolicy(s.db.DB, &expiryPolicy)
+	if err != nil {
+		return err
+	}
+
+	// Each user is expired in a short transaction of their own, so one slow user does not hold the
+	// quota locks of every other user with expiring quota
+	failed := 0
+	for _, userID := range expiredUserIDs {
+		if err := s.expireUserQuotas(userID, rollover, cutoff, now); err != nil {
+			logger.Error("Failed to expire quota",
+				zap.String("user_id", userID),
+				zap.Error(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to expire quota for %d of %d users", failed, len(expiredUserIDs))
+	}
+	return nil
+}
+
+// expireUserQuotas expires the user's valid quotas whose expiry date is before cutoff, rolls part of them
+// over per the expiry policy, and queues the AiGateway changes in the outbox
+func (s *QuotaService) expireUserQuotas(userID string, rollover *rolloverPolicy, cutoff, now time.Time) error {
+	// Used quota is read before taking the lock, operations still waiting in the outbox are added under it
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get used quota from AiGateway: %w", err)
 	}
 
-	// Start transaction
 	tx := s.db.DB.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -884,79 +1117,121 @@ func (s *QuotaService) ExpireQuotas() error {
 		}
 	}()
 
+	// Read the expired quotas again under the lock, so an operation that was running on the user
+	// either finished before expiry or sees the quotas already expired
+	if err := lockUserQuota(tx, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var expiredQuotas []models.Quota
+	if err := tx.Where("user_id = ? AND status = ? AND expiry_date < ?", userID, models.StatusValid, cutoff).
+		Order("expiry_date ASC").Find(&expiredQuotas).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to find expired quotas: %w", err)
+	}
+	if len(expiredQuotas) == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	var expiredAmount decimal.Amount
+	expiredModels := make(map[string]bool) // models with expired buckets
+	for _, quota := range expiredQuotas {
+		expiredAmount = expiredAmount.Add(quota.Amount)
+		if quota.Model != "" {
+			expiredModels[quota.Model] = true
+		}
+	}
+
+	pendingUsed, err := pendingGatewayDelta(tx, userID, models.OutboxDeltaUsedQuota)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	usedQuota = usedQuota.Add(pendingUsed)
+
+	validBefore, err := sumAmount(tx.Model(&models.Quota{}).
+		Where("user_id = ? AND status = ?", userID, models.StatusValid), "amount")
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to calculate valid quota: %w", err)
+	}
+
 	// Update status to expired
 	if err := tx.Model(&models.Quota{}).
-		Where("status = ? AND expiry_date < ?", models.StatusValid, now).
+		Where("user_id = ? AND status = ? AND expiry_date < ?", userID, models.StatusValid, cutoff).
 		Update("status", models.StatusExpired).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to update quota status: %w", err)
 	}
 
-	// Process each user
-	for userID, expiredAmount := range userQuotaMap {
-		// Get user's remaining valid quota
-		var validQuotaSum float64
-		if err := tx.Model(&models.Quota{}).
-			Where("user_id = ? AND status = ?", userID, models.StatusValid).
-			Select("COALESCE(SUM(amount), 0)").Scan(&validQuotaSum).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to calculate valid quota for user %s: %w", userID, err)
-		}
-
-		// Get current quota info from AiGateway
-		totalQuota, err := s.aiGatewayClient.QueryQuotaValue(userID)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to get total quota from AiGateway for user %s: %w", userID, err)
-		}
+	// Carry part of the unused quota into new buckets per the expiry policy
+	if _, err := s.rolloverQuotas(tx, rollover, userID, expiredQuotas, usedQuota, now); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
-		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to get used quota from AiGateway for user %s: %w", userID, err)
-		}
+	// Get user's remaining valid quota, including rolled over quota
+	validAfter, err := sumAmount(tx.Model(&models.Quota{}).
+		Where("user_id = ? AND status = ?", userID, models.StatusValid), "amount")
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to calculate valid quota: %w", err)
+	}
 
-		// Adjust used quota
-		// Calculate new used quota after expiry
-		var newUsedQuota float64
-		if usedQuota > expiredAmount {
-			newUsedQuota = usedQuota - expiredAmount
-		} else {
-			newUsedQuota = 0
-		}
+	// Adjust used quota
+	// Calculate new used quota after expiry
+	var newUsedQuota decimal.Amount
+	if usedQuota.GreaterThan(expiredAmount) {
+		newUsedQuota = usedQuota.Sub(expiredAmount)
+	} else {
+		newUsedQuota = decimal.Zero
+	}
 
-		deltaUsed := newUsedQuota - usedQuota
-		if err := s.aiGatewayClient.DeltaUsedQuota(userID, deltaUsed); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to adjust used quota for user %s: %w", userID, err)
-		}
+	deltaUsed := newUsedQuota.Sub(usedQuota)
+	if err := enqueueGatewayOp(tx, models.OperationExpire, userID, models.OutboxDeltaUsedQuota, "", deltaUsed); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		// Adjust total quota
-		validQuota := validQuotaSum
-		deltaQuota := validQuota - totalQuota
-		if deltaQuota != 0 {
-			if err := s.aiGatewayClient.DeltaQuota(userID, deltaQuota); err != nil {
-				tx.Rollback()
-				return fmt.Errorf("failed to adjust total quota for user %s: %w", userID, err)
-			}
-		}
+	// Adjust total quota by what left the valid buckets
+	if err := enqueueQuotaDelta(tx, models.OperationExpire, userID, "", validAfter.Sub(validBefore)); err != nil {
+		tx.Rollback()
+		return err
+	}
 
-		// Create audit record for quota expiry
-		auditRecord := &models.QuotaAudit{
-			UserID:       userID,
-			Amount:       -expiredAmount, // Negative amount for expiry
-			Operation:    "EXPIRE",
-			StrategyName: "Credit 到期失效",
-			ExpiryDate:   now, // Use current time as expiry time
-			CreateTime:   utils.NowInConfigTimezone(s.configManager.GetDirect()),
+	// Adjust the quota of each model that had buckets expire
+	for model := range expiredModels {
+		validModelSum, err := sumAmount(tx.Model(&models.Quota{}).
+			Where("user_id = ? AND model = ? AND status = ?", userID, model, models.StatusValid), "amount")
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to calculate valid quota of model %s: %w", model, err)
 		}
-		if err := tx.Create(auditRecord).Error; err != nil {
+		if err := enqueueGatewayOp(tx, models.OperationExpire, userID, models.OutboxRefreshModelQuota, model, validModelSum); err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to create expiry audit record for user %s: %w", userID, err)
+			return err
 		}
 	}
 
-	tx.Commit()
+	// Create audit record for quota expiry
+	auditRecord := &models.QuotaAudit{
+		UserID:       userID,
+		Amount:       expiredAmount.Neg(), // Negative amount for expiry
+		Operation:    models.OperationExpire,
+		StrategyName: "Credit 到期失效",
+		ExpiryDate:   now, // Use current time as expiry time
+		CreateTime:   utils.NowInConfigTimezone(s.configManager.GetDirect()),
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create expiry audit record: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit quota expiry: %w", err)
+	}
+	s.outbox.DispatchUser(userID)
 	return nil
 }
 
@@ -964,18 +1239,19 @@ func (s *QuotaService) ExpireQuotas() error {
 func (s *QuotaService) MergeQuotaRecords() error {
 	// QuotaGroup represents quota records grouped by user and expiry date
 	type QuotaGroup struct {
-		UserID      string    `gorm:"column:user_id"`
-		ExpiryDate  time.Time `gorm:"column:expiry_date"`
-		Status      string    `gorm:"column:status"`
-		TotalAmount float64   `gorm:"column:total_amount"`
-		RecordCount int       `gorm:"column:record_count"`
+		UserID      string         `gorm:"column:user_id"`
+		Model       string         `gorm:"column:model"`
+		ExpiryDate  time.Time      `gorm:"column:expiry_date"`
+		Status      string         `gorm:"column:status"`
+		TotalAmount decimal.Amount `gorm:"column:total_amount"`
+		RecordCount int            `gorm:"column:record_count"`
 	}
 
 	// Find groups with multiple records
 	var groups []QuotaGroup
 	result := s.db.DB.Model(&models.Quota{}).
-		Select("user_id, expiry_date, status, SUM(amount) as total_amount, COUNT(*) as record_count").
-		Group("user_id, expiry_date, status").
+		Select("user_id, model, expiry_date, status, SUM(amount) as total_amount, COUNT(*) as record_count").
+		Group("user_id, model, expiry_date, status").
 		Having("COUNT(*) > 1").
 		Scan(&groups)
 
@@ -994,17 +1270,18 @@ func (s *QuotaService) MergeQuotaRecords() error {
 	// Process each group that has duplicates
 	for _, group := range groups {
 		// Delete all existing records for this group
-		if err := tx.Where("user_id = ? AND expiry_date = ? AND status = ?",
-			group.UserID, group.ExpiryDate, group.Status).Delete(&models.Quota{}).Error; err != nil {
+		if err := tx.Where("user_id = ? AND model = ? AND expiry_date = ? AND status = ?",
+			group.UserID, group.Model, group.ExpiryDate, group.Status).Delete(&models.Quota{}).Error; err != nil {
 			tx.Rollback()
 			return fmt.Errorf("failed to delete duplicate quota records: %w", err)
 		}
 
 		// Create a single merged record (only if total amount is positive)
-		if group.TotalAmount > 0 {
+		if group.TotalAmount.IsPositive() {
 			mergedQuota := &models.Quota{
 				UserID:     group.UserID,
 				Amount:     group.TotalAmount,
+				Model:      group.Model,
 				ExpiryDate: group.ExpiryDate,
 				Status:     group.Status,
 			}
@@ -1019,53 +1296,6 @@ func (s *QuotaService) MergeQuotaRecords() error {
 	return nil
 }
 
-// GetUserQuotaAuditRecords gets quota audit records for a specific user (admin function)
-func (s *QuotaService) GetUserQuotaAuditRecords(userID string, page, pageSize int) ([]QuotaAuditRecord, int64, error) {
-	var auditRecords []models.QuotaAudit
-	var total int64
-
-	// Get total count
-	if err := s.db.Model(&models.QuotaAudit{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count quota audit records: %w", err)
-	}
-
-	// Get records with pagination
-	offset := (page - 1) * pageSize
-	if err := s.db.Where("user_id = ?", userID).
-		Order("create_time DESC").
-		Offset(offset).
-		Limit(pageSize).
-		Find(&auditRecords).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to query quota audit records: %w", err)
-	}
-
-	// Convert to response format
-	var records []QuotaAuditRecord
-	for _, record := range auditRecords {
-		auditRecord := QuotaAuditRecord{
-			Amount:       record.Amount,
-			Operation:    record.Operation,
-			VoucherCode:  record.VoucherCode,
-			RelatedUser:  record.RelatedUser,
-			StrategyName: record.StrategyName,
-			ExpiryDate:   record.ExpiryDate,
-			CreateTime:   record.CreateTime,
-		}
-
-		// Unmarshal details if present
-		if record.Details != "" {
-			details, err := record.UnmarshalDetails()
-			if err == nil {
-				auditRecord.Details = details
-			}
-		}
-
-		records = append(records, auditRecord)
-	}
-
-	return records, total, nil
-}
-
 // GetUsersWithValidQuota gets all users with valid quota
 func (s *QuotaService) GetUsersWithValidQuota() ([]string, error) {
 	var userIDs []string
@@ -1093,10 +1323,10 @@ func (s *QuotaService) recordUserMonthlyUsedQuota(userID string, yearMonth strin
 	}
 
 	// Do not record if used quota is 0 or does not exist
-	if usedQuota <= 0 {
+	if !usedQuota.IsPositive() {
 		logger.Info("Skip recording zero or negative used quota",
 			zap.String("user_id", userID),
-			zap.Float64("used_quota", usedQuota))
+			zap.Stringer("used_quota", usedQuota))
 		return nil
 	}
 
@@ -1123,7 +1353,7 @@ func (s *QuotaService) recordUserMonthlyUsedQuota(userID string, yearMonth strin
 			logger.Info("Updated existing monthly quota usage record",
 				zap.String("user_id", userID),
 				zap.String("year_month", yearMonth),
-				zap.Float64("used_quota", usedQuota))
+				zap.Stringer("used_quota", usedQuota))
 		} else {
 			return fmt.Errorf("failed to create monthly quota usage record for user %s: %w", userID, err)
 		}
@@ -1131,76 +1361,7 @@ func (s *QuotaService) recordUserMonthlyUsedQuota(userID string, yearMonth strin
 		logger.Info("Created monthly quota usage record",
 			zap.String("user_id", userID),
 			zap.String("year_month", yearMonth),
-			zap.Float64("used_quota", usedQuota))
-	}
-
-	return nil
-}
-
-// SyncQuotasWithAiGateway synchronizes all users' quotas with AiGateway
-func (s *QuotaService) SyncQuotasWithAiGateway() error {
-	logger.Info("Starting quota sync task")
-
-	// Step 1: Get all users with valid quotas from quota table
-	userIDs, err := s.GetUsersWithValidQuota()
-	if err != nil {
-		return fmt.Errorf("failed to get users with valid quota: %w", err)
-	}
-
-	logger.Info("Found users with valid quota", zap.Int("user_count", len(userIDs)))
-
-	// Step 2: Process each user
-	for _, userID := range userIDs {
-		if err := s.syncUserQuotaWithAiGateway(userID); err != nil {
-			logger.Error("Failed to sync user quota",
-				zap.String("user_id", userID),
-				zap.Error(err))
-			// Continue processing other users, don't interrupt the entire flow
-			continue
-		}
-	}
-
-	logger.Info("Quota sync task completed")
-	return nil
-}
-
-// syncUserQuotaWithAiGateway synchronizes a single user's quota with AiGateway
-func (s *QuotaService) syncUserQuotaWithAiGateway(userID string) error {
-	// Step 2.1: Get total quota from AiGateway
-	aigatewayTotalQuota, err := s.aiGatewayClient.QueryQuotaValue(userID)
-	if err != nil {
-		return fmt.Errorf("failed to get quota from AiGateway: %w", err)
-	}
-
-	// Step 2.2: Get total valid quota from quota table
-	var totalValidQuota float64
-	if err := s.db.DB.Model(&models.Quota{}).
-		Where("user_id = ? AND status = ?", userID, models.StatusValid).
-		Select("COALESCE(SUM(amount), 0)").
-		Scan(&totalValidQuota).Error; err != nil {
-		return fmt.Errorf("failed to calculate user valid quota: %w", err)
-	}
-
-	// Step 2.3: If a != b, set the user's quota to b using AiGateway refresh interface
-	if aigatewayTotalQuota != totalValidQuota {
-		logger.Warn("Detected quota inconsistency, will sync",
-			zap.String("user_id", userID),
-			zap.Float64("aigateway_quota", aigatewayTotalQuota),
-			zap.Float64("database_quota", totalValidQuota))
-
-		// Use RefreshQuota for full quota setting
-		if err := s.aiGatewayClient.RefreshQuota(userID, totalValidQuota); err != nil {
-			return fmt.Errorf("failed to refresh AiGateway quota: %w", err)
-		}
-
-		logger.Info("Quota sync completed",
-			zap.String("user_id", userID),
-			zap.Float64("original_quota", aigatewayTotalQuota),
-			zap.Float64("new_quota", totalValidQuota))
-	} else {
-		logger.Info("Quota is consistent, no sync needed",
-			zap.String("user_id", userID),
-			zap.Float64("quota_value", aigatewayTotalQuota))
+			zap.Stringer("used_quota", usedQuota))
 	}
 
 	return nil
@@ -1240,16 +1401,33 @@ func (s *QuotaService) recordMonthlyUsedQuota(now time.Time) error {
 }
 
 // DeductQuota deducts quota from a user's account
-func (s *QuotaService) DeductQuota(userID string, amount float64, reason, referenceID, model string) error {
+func (s *QuotaService) DeductQuota(userID string, amount decimal.Amount, reason, referenceID, model string) error {
+	_, err := s.deductQuota(&DeductQuotaRequest{
+		UserID:      userID,
+		Amount:      amount,
+		Reason:      reason,
+		ReferenceID: referenceID,
+		Model:       model,
+	}, nil)
+	return err
+}
+
+// deductQuota deducts quota from the model's buckets and then the general pool, starting from the earliest
+// expiry date. When idem is set, the idempotency key is claimed and its response stored in the same
+// transaction as the deduction.
+func (s *QuotaService) deductQuota(req *DeductQuotaRequest, idem *idempotencyClaim) (*DeductQuotaResponse, error) {
+	userID := req.UserID
+	amount := req.Amount
+
 	// Validate amount
-	if amount <= 0 {
-		return fmt.Errorf("amount must be positive")
+	if !amount.IsPositive() {
+		return nil, NewValidationFailedError("amount must be positive")
 	}
 
 	// Get used quota from AiGateway
 	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
 	if err != nil {
-		return fmt.Errorf("failed to get used quota: %w", err)
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
 	}
 
 	// Start database transaction
@@ -1260,95 +1438,109 @@ func (s *QuotaService) DeductQuota(userID string, amount float64, reason, refere
 		}
 	}()
 
+	// Claim the idempotency key first so a concurrent retry waits for this deduction
+	var idemRecord *models.IdempotencyKey
+	if idem != nil {
+		idemRecord, err = claimIdempotencyKey(tx, idem.caller, models.OperationDeduct, idem.key, idem.requestHash)
+		if err != nil {
+			tx.Rollback()
+			// Only a unique constraint conflict means another request holds the key
+			if strings.Contains(err.Error(), "duplicate key") {
+				return nil, errIdempotencyKeyTaken
+			}
+			return nil, NewDatabaseError("claim idempotency key", err)
+		}
+	}
+
+	// Check availability under the user's lock so concurrent deductions cannot spend the same quota
+	if err := lockUserQuota(tx, userID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// Get all valid quotas for the user, ordered by expiry date
 	var quotas []models.Quota
 	if err := tx.Where("user_id = ? AND status = ?", userID, models.StatusValid).
 		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to get quota list: %w", err)
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
 	}
 
-	// Calculate total available quota
-	totalDatabaseQuota := 0.0
-	for _, quota := range quotas {
-		totalDatabaseQuota += quota.Amount
+	// Quota held by active reservations is not available for deduction
+	held, _, err := heldQuotaByExpiry(tx, userID, time.Now(), 0)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
 
-	availableQuota := totalDatabaseQuota - usedQuota
-	if availableQuota < amount {
+	// Used quota is consumed from the earliest buckets, the deduction may only draw from
+	// the model's own buckets and the general pool
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	order := deductionOrder(quotas, req.Model)
+	availableQuota := decimal.Zero
+	for _, i := range order {
+		if quotas[i].Model == "" {
+			remaining[i] = decimal.Max(remaining[i].Sub(held[quotas[i].ExpiryDate.Unix()]), decimal.Zero)
+		}
+		availableQuota = availableQuota.Add(remaining[i])
+	}
+	if availableQuota.LessThan(amount) {
 		tx.Rollback()
-		return fmt.Errorf("insufficient quota: available %g, needed %g", availableQuota, amount)
+		return nil, NewInsufficientQuotaError(availableQuota, amount)
 	}
 
-	// Deduct the amount from quotas, starting from earliest expiry date
+	// Deduct the amount from the model's buckets first, then the general pool, each by earliest expiry
 	remainingDeduct := amount
-	updatedQuotas := make([]*models.Quota, 0)
-	deletedQuotaIDs := make([]int, 0)
-
-	for _, quota := range quotas {
-		if remainingDeduct <= 0 {
+	modelDeducted := decimal.Zero
+	auditItems := make([]models.QuotaAuditDetailItem, 0)
+	var earliestExpiryDate time.Time
+	for _, i := range order {
+		if !remainingDeduct.IsPositive() {
 			break
 		}
-
-		// Calculate how much to deduct from this quota
-		deductFromThis := min(remainingDeduct, quota.Amount)
-		quota.Amount -= deductFromThis
-		remainingDeduct -= deductFromThis
-
-		if quota.Amount > 0 {
-			// Update the quota record
-			updatedQuotas = append(updatedQuotas, &quota)
-		} else {
-			// Mark for deletion if amount becomes zero or negative
-			deletedQuotaIDs = append(deletedQuotaIDs, quota.ID)
+		deductFromThis := decimal.Min(remainingDeduct, remaining[i])
+		if !deductFromThis.IsPositive() {
+			continue
 		}
-	}
-
-	// Update quota records
-	for _, quota := range updatedQuotas {
-		if err := tx.Model(&models.Quota{}).Where("id = ?", quota.ID).
-			Update("amount", quota.Amount).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to update quota: %w", err)
+		quota := quotas[i]
+		remainingDeduct = remainingDeduct.Sub(deductFromThis)
+		if quota.Model != "" {
+			modelDeducted = modelDeducted.Add(deductFromThis)
 		}
-	}
 
-	// Delete zero amount quotas
-	if len(deletedQuotaIDs) > 0 {
-		if err := tx.Where("id IN ?", deletedQuotaIDs).Delete(&models.Quota{}).Error; err != nil {
+		newAmount := quota.Amount.Sub(deductFromThis)
+		if newAmount.IsPositive() {
+			if err := tx.Model(&models.Quota{}).Where("id = ?", quota.ID).
+				Update("amount", newAmount).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to update quota: %w", err)
+			}
+		} else if err := tx.Delete(&models.Quota{}, quota.ID).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to delete zero quota records: %w", err)
+			return nil, fmt.Errorf("failed to delete zero quota records: %w", err)
 		}
-	}
 
-	// Find earliest expiry date for audit record
-	var earliestExpiryDate time.Time
-	if len(quotas) > 0 {
-		earliestExpiryDate = quotas[0].ExpiryDate
-		for _, quota := range quotas {
-			if quota.ExpiryDate.Before(earliestExpiryDate) {
-				earliestExpiryDate = quota.ExpiryDate
-			}
+		if len(auditItems) == 0 || quota.ExpiryDate.Before(earliestExpiryDate) {
+			earliestExpiryDate = quota.ExpiryDate
 		}
-	} else {
-		earliestExpiryDate = time.Now().AddDate(0, 0, 30) // Default to 30 days if no quotas
+		auditItems = append(auditItems, models.QuotaAuditDetailItem{
+			Amount:        deductFromThis,
+			ExpiryDate:    quota.ExpiryDate.Format(time.RFC3339),
+			Status:        models.AuditStatusSuccess,
+			OriginalQuota: quota.Amount,
+			NewQuota:      newAmount,
+		})
 	}
 
 	// Record audit log
 	auditRecord := &models.QuotaAudit{
-		UserID:     userID,
-		Amount:     -amount, // Negative amount for deduction
-		Operation:  models.OperationDeduct,
-		ExpiryDate: earliestExpiryDate,
-	}
-
-	// Add reason, referenceID, and model to audit record if provided
-	if reason != "" {
-		auditRecord.StrategyName = reason // Use StrategyName field to store reason
-	}
-	if referenceID != "" {
-		// Store referenceID in RelatedUser field
-		auditRecord.RelatedUser = referenceID
+		UserID:      userID,
+		Amount:      amount.Neg(), // Negative amount for deduction
+		Operation:   models.OperationDeduct,
+		Reason:      req.Reason,
+		ReferenceID: req.ReferenceID,
+		Model:       req.Model,
+		ExpiryDate:  earliestExpiryDate,
 	}
 
 	// Prepare audit details
@@ -1356,271 +1548,55 @@ func (s *QuotaService) DeductQuota(userID string, amount float64, reason, refere
 		Operation: models.OperationDeduct,
 		Summary: models.QuotaAuditSummary{
 			TotalAmount:        amount,
-			TotalItems:         1,
-			SuccessfulItems:    1,
+			TotalItems:         len(auditItems),
+			SuccessfulItems:    len(auditItems),
 			EarliestExpiryDate: earliestExpiryDate.Format(time.RFC3339),
 		},
-		Items: []models.QuotaAuditDetailItem{
-			{
-				Amount:     amount,
-				ExpiryDate: earliestExpiryDate.Format(time.RFC3339),
-				Status:     models.AuditStatusSuccess,
-			},
-		},
+		Items: auditItems,
 	}
 	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to marshal audit details: %w", err)
+		return nil, fmt.Errorf("failed to marshal audit details: %w", err)
 	}
 	if err := tx.Create(auditRecord).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to create audit record: %w", err)
-	}
-
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	// Update AiGateway quota
-	if err := s.aiGatewayClient.DeltaQuota(userID, -amount); err != nil {
-		// Log the error but don't fail the operation since database is already updated
-		logger.Error("Failed to update AiGateway quota after deduction", zap.Error(err), zap.String("user_id", userID))
+		return nil, fmt.Errorf("failed to create audit record: %w", err)
 	}
 
-	return nil
-}
-
-// MergeUserQuota merges all quota from other user to main user
-func (s *QuotaService) MergeUserQuota(req *MergeQuotaRequest) (*MergeQuotaResponse, error) {
-	mainUserID := req.MainUserID
-	otherUserID := req.OtherUserID
-	// Validate request
-	if mainUserID == "" || otherUserID == "" {
-		logger.Warn("User quota merge: Failed - empty user IDs",
-			zap.String("main_user", mainUserID),
-			zap.String("other_user", otherUserID))
-		return &MergeQuotaResponse{
-			MainUserID:  mainUserID,
-			OtherUserID: otherUserID,
-			Amount:      0,
-			Operation:   models.OperationMergeIn,
-			Status:      "FAILED",
-			Message:     "Main user or other user cannot be empty",
-		}, nil
-	} else if mainUserID == otherUserID {
-		logger.Warn("User quota merge: Failed - same user IDs",
-			zap.String("user_id", mainUserID))
-		return &MergeQuotaResponse{
-			MainUserID:  mainUserID,
-			OtherUserID: otherUserID,
-			Amount:      0,
-			Operation:   models.OperationMergeIn,
-			Status:      "FAILED",
-			Message:     "Main user and other user cannot be the same",
-		}, nil
+	resp := &DeductQuotaResponse{
+		UserID:         userID,
+		Amount:         amount,
+		Reason:         req.Reason,
+		ReferenceID:    req.ReferenceID,
+		Model:          req.Model,
+		RemainingQuota: availableQuota.Sub(amount),
+		AuditID:        auditRecord.ID,
+		CreateTime:     auditRecord.CreateTime,
 	}
-
-	// Start transaction
-	tx := s.db.DB.Begin()
-	logger.Info("User quota merge: Starting",
-		zap.String("main_user", mainUserID),
-		zap.String("other_user", otherUserID))
-
-	defer func() {
-		if r := recover(); r != nil {
-			logger.Error("User quota merge: Panic occurred, rolling back transaction",
-				zap.String("main_user", mainUserID),
-				zap.String("other_user", otherUserID),
-				zap.Any("panic", r))
+	if idemRecord != nil {
+		if err := storeIdempotentResponse(tx, idemRecord, resp); err != nil {
 			tx.Rollback()
+			return nil, fmt.Errorf("failed to store idempotent response: %w", err)
 		}
-	}()
-
-	// Get all valid quotas from other user
-	var otherUserQuotas []models.Quota
-	if err := tx.Where("user_id = ? AND status = ? AND amount > 0", otherUserID, models.StatusValid).
-		Order("expiry_date ASC").Find(&otherUserQuotas).Error; err != nil {
-		logger.Error("User quota merge: Failed to get other user quotas",
-			zap.String("other_user", otherUserID),
-			zap.Error(err))
-		tx.Rollback()
-		return nil, fmt.Errorf("failed to get other user quotas: %w", err)
-	}
-
-	// If no quotas found, return success with empty result
-	if len(otherUserQuotas) == 0 {
-		logger.Info("User quota merge: No quotas found to merge",
-			zap.String("other_user", otherUserID))
-		return &MergeQuotaResponse{
-			MainUserID:  mainUserID,
-			OtherUserID: otherUserID,
-			Amount:      0,
-			Operation:   models.OperationMergeIn,
-			Status:      "SUCCESS",
-			Message:     "No quotas found to merge",
-		}, nil
 	}
 
-	// Pre-query all main user's valid quotas to create a memory map for efficient lookup
-	var mainUserQuotas []models.Quota
-	if err := tx.Where("user_id = ? AND status = ?", mainUserID, models.StatusValid).
-		Find(&mainUserQuotas).Error; err != nil {
-		logger.Error("User quota merge: failed to get main user quotas",
-			zap.String("main_user", mainUserID),
-			zap.Error(err))
+	// Queue the AiGateway update with the deduction, only the model's share touches its quota
+	if err := enqueueGatewayOp(tx, models.OperationDeduct, userID, models.OutboxDeltaQuota, "", amount.Neg()); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to get main user quotas: %w", err)
-	}
-
-	// Create a map for quick lookup: key is "expiry_date_status", value is pointer to quota
-	mainUserQuotaMap := make(map[string]*models.Quota)
-	for i := range mainUserQuotas {
-		key := fmt.Sprintf("%s_%s", mainUserQuotas[i].ExpiryDate.Format("2006-01-02"), mainUserQuotas[i].Status)
-		mainUserQuotaMap[key] = &mainUserQuotas[i]
+		return nil, err
 	}
-
-	var totalAmount float64 // merged quota amount
-	// Process each quota individually using the pre-built map for efficient conflict detection
-	for _, quota := range otherUserQuotas {
-		// Calculate results from original quotas for audit and response
-		totalAmount += quota.Amount
-
-		// Check if main user already has a quota with same expiry_date and status using the map
-		key := fmt.Sprintf("%s_%s", quota.ExpiryDate.Format("2006-01-02"), quota.Status)
-		if existingQuota, exists := mainUserQuotaMap[key]; exists {
-			// Main user already has a quota with same expiry_date and status
-			// Merge the amounts by adding to existing quota
-			newAmount := existingQuota.Amount + quota.Amount
-			if err := tx.Model(existingQuota).Update("amount", newAmount).Error; err != nil {
-				tx.Rollback()
-				return nil, fmt.Errorf("failed to merge quota amount for user %s, expiry %s: %w",
-					mainUserID, quota.ExpiryDate.Format("2006-01-02"), err)
-			}
-
-			// Delete the original quota from other user to avoid duplication
-			if err := tx.Delete(&quota).Error; err != nil {
-				tx.Rollback()
-				return nil, fmt.Errorf("failed to delete original quota from user %s: %w", otherUserID, err)
-			}
-		} else {
-			// No conflict found, safely update user_id
-			if err := tx.Model(&quota).Update("user_id", mainUserID).Error; err != nil {
-				tx.Rollback()
-				return nil, fmt.Errorf("failed to transfer quota from user %s to user %s: %w",
-					otherUserID, mainUserID, err)
-			}
-		}
-	}
-
-	// update aigateway
-	if totalAmount > 0 {
-		if err := s.aiGatewayClient.DeltaQuota(mainUserID, totalAmount); err != nil {
-			logger.Error("User quota merge: Failed to update AiGateway quota",
-				zap.String("main_user", mainUserID),
-				zap.Float64("amount", totalAmount),
-				zap.Error(err))
+	if modelDeducted.IsPositive() {
+		if err := enqueueGatewayOp(tx, models.OperationDeduct, userID, models.OutboxDeltaModelQuota, req.Model, modelDeducted.Neg()); err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("failed to update AiGateway quota for main user %s: %w", mainUserID, err)
+			return nil, err
 		}
 	}
 
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
-		logger.Error("User quota merge: Failed to commit transaction",
-			zap.String("main_user", mainUserID),
-			zap.String("other_user", otherUserID),
-			zap.Error(err))
-		return nil, fmt.Errorf("failed to commit transaction, for user quota merged: %w", err)
-	}
-
-	// Log the merge operation
-	logger.Info("User quota merge: Completed successfully",
-		zap.String("main_user", mainUserID),
-		zap.String("other_user", otherUserID),
-		zap.Float64("amount", totalAmount),
-		zap.Int("quota_items", len(otherUserQuotas)))
-
-	// Create audit record and update QuotaExecute records asynchronously without blocking main program
-	go func() {
-		// Get the latest expiry date (since ordered by expiry_date ASC, last element has the latest expiry)
-		var latestExpiryDate time.Time
-		if len(otherUserQuotas) > 0 {
-			latestExpiryDate = otherUserQuotas[len(otherUserQuotas)-1].ExpiryDate
-		}
-
-		// Update QuotaExecute records to maintain strategy execution consistency
-		// This prevents duplicate invitation rewards after user ID changes
-		if err := s.db.Model(&models.QuotaExecute{}).
-			Where("user_id = ?", otherUserID).
-			Update("user_id", mainUserID).Error; err != nil {
-			logger.Error("User quota merge: failed to update quota execute records asynchronously",
-				zap.String("main_user", mainUserID),
-				zap.String("other_user", otherUserID),
-				zap.Error(err))
-		}
-
-		// Prepare audit details
-		auditDetails := &models.QuotaAuditDetails{
-			Operation: models.OperationMergeIn,
-			Summary: models.QuotaAuditSummary{
-				TotalAmount:        totalAmount,
-				TotalItems:         len(otherUserQuotas),
-				SuccessfulItems:    len(otherUserQuotas),
-				EarliestExpiryDate: latestExpiryDate.Format(time.RFC3339),
-			},
-			Items: make([]models.QuotaAuditDetailItem, len(otherUserQuotas)),
-		}
-
-		// Fill audit detail items
-		for i, quota := range otherUserQuotas {
-			auditDetails.Items[i] = models.QuotaAuditDetailItem{
-				Amount:     quota.Amount,
-				ExpiryDate: quota.ExpiryDate.Format(time.RFC3339),
-				Status:     models.AuditStatusSuccess,
-			}
-		}
-
-		// Create quota audit record
-		auditRecord := &models.QuotaAudit{
-			UserID:      mainUserID,
-			Amount:      totalAmount,
-			Operation:   models.OperationMergeIn,
-			RelatedUser: otherUserID,
-			ExpiryDate:  latestExpiryDate,
-		}
-
-		// Create audit record using new database connection
-		if err := auditRecord.MarshalDetails(auditDetails); err != nil {
-			logger.Error("User quota merge: Failed to marshal audit details",
-				zap.Error(err),
-				zap.String("user_id", mainUserID),
-				zap.String("related_user", otherUserID))
-			return
-		}
-
-		if err := s.db.DB.Create(auditRecord).Error; err != nil {
-			logger.Error("User quota merge: Failed to create audit record",
-				zap.Error(err),
-				zap.String("user_id", mainUserID),
-				zap.String("related_user", otherUserID))
-		}
-	}()
-
-	return &MergeQuotaResponse{
-		MainUserID:  mainUserID,
-		OtherUserID: otherUserID,
-		Amount:      totalAmount,
-		Operation:   models.OperationMergeIn,
-		Status:      "SUCCESS",
-		Message:     "Quota merged successfully",
-	}, nil
-}
-
-// min returns the minimum of two float64 values
-func min(a, b float64) float64 {
-	if a < b {
-		return a
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
-	return b
+	s.outbox.DispatchUser(userID)
+
+	return resp, nil
 }
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxBulkAdjustUsers limits how many users one bulk adjustment may touch
+const maxBulkAdjustUsers = 1000
+
+// AdjustQuotaRequest represents an admin grant (positive amount) or clawback (negative amount)
+type AdjustQuotaRequest struct {
+	UserID     string         `json:"user_id" validate:"required,max=255"`
+	Amount     decimal.Amount `json:"amount" validate:"required"`
+	ExpiryDate time.Time      `json:"expiry_date" validate:"required"`
+	Model      string         `json:"model,omitempty" validate:"max=100"` // Empty for the general pool
+	Reason     string         `json:"reason" validate:"required,max=255"`
+	TicketRef  string         `json:"ticket_ref" validate:"required,max=255"`
+}
+
+// AdjustQuotaResponse represents the result of an admin adjustment
+type AdjustQuotaResponse struct {
+	UserID       string         `json:"user_id"`
+	Amount       decimal.Amount `json:"amount"`
+	Model        string         `json:"model,omitempty"`
+	ExpiryDate   time.Time      `json:"expiry_date"`
+	BucketAmount decimal.Amount `json:"bucket_amount"` // Amount left in the bucket after the adjustment
+	Operator     string         `json:"operator"`
+	AuditID      int            `json:"audit_id"`
+}
+
+// BulkAdjustQuotaRequest applies the same adjustment to many users.
+// User IDs come from user_ids, csv, or both.
+type BulkAdjustQuotaRequest struct {
+	UserIDs    []string       `json:"user_ids,omitempty" validate:"omitempty,dive,max=255"`
+	CSV        string         `json:"csv,omitempty"` // User IDs in the first column, a user_id header row is skipped
+	Amount     decimal.Amount `json:"amount" validate:"required"`
+	ExpiryDate time.Time      `json:"expiry_date" validate:"required"`
+	Model      string         `json:"model,omitempty" validate:"max=100"`
+	Reason     string         `json:"reason" validate:"required,max=255"`
+	TicketRef  string         `json:"ticket_ref" validate:"required,max=255"`
+}
+
+// BulkAdjustQuotaResult represents the outcome for one user of a bulk adjustment
+type BulkAdjustQuotaResult struct {
+	UserID  string `json:"user_id"`
+	Success bool   `json:"success"`
+	AuditID int    `json:"audit_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkAdjustQuotaResponse represents the result of a bulk adjustment
+type BulkAdjustQuotaResponse struct {
+	Total     int                     `json:"total"`
+	Succeeded int                     `json:"succeeded"`
+	Failed    int                     `json:"failed"`
+	Results   []BulkAdjustQuotaResult `json:"results"`
+}
+
+// AdjustQuota grants quota into, or claws it back from, the user's bucket with the given model and
+// expiry date. It takes the same transactional path as strategy recharges and records the acting admin.
+func (s *QuotaService) AdjustQuota(operator string, req *AdjustQuotaRequest) (*AdjustQuotaResponse, error) {
+	if req.Amount.IsZero() {
+		return nil, NewValidationFailedError("amount must not be zero")
+	}
+	expiryDate := req.ExpiryDate.Truncate(time.Second)
+	if !expiryDate.After(time.Now()) {
+		return nil, NewValidationFailedError("expiry_date must be in the future")
+	}
+
+	// Clawbacks may only take quota the user has not used or reserved
+	var usedQuota decimal.Amount
+	if req.Amount.IsNegative() {
+		var err error
+		if usedQuota, err = s.aiGatewayClient.QueryUsedQuotaValue(req.UserID); err != nil {
+			return nil, fmt.Errorf("failed to get used quota: %w", err)
+		}
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, req.UserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var bucket *models.Quota
+	var err error
+	if req.Amount.IsPositive() {
+		bucket, err = addToQuotaBucket(tx, req.UserID, req.Model, expiryDate, req.Amount)
+	} else {
+		bucket, err = s.clawBackFromBucket(tx, req.UserID, req.Model, expiryDate, req.Amount.Neg(), usedQuota)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: models.OperationAdminAdjust,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        req.Amount,
+			TotalItems:         1,
+			SuccessfulItems:    1,
+			EarliestExpiryDate: expiryDate.Format(time.RFC3339),
+		},
+		Items: []models.QuotaAuditDetailItem{
+			{
+				Amount:        req.Amount,
+				ExpiryDate:    expiryDate.Format(time.RFC3339),
+				Status:        models.AuditStatusSuccess,
+				OriginalQuota: bucket.Amount.Sub(req.Amount),
+				NewQuota:      bucket.Amount,
+			},
+		},
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Operation:   models.OperationAdminAdjust,
+		Reason:      req.Reason,
+		ReferenceID: req.TicketRef,
+		Model:       req.Model,
+		Operator:    operator,
+		ExpiryDate:  expiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create audit record", err)
+	}
+
+	if err := enqueueQuotaDelta(tx, models.OperationAdminAdjust, req.UserID, req.Model, req.Amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit quota adjustment", err)
+	}
+	s.outbox.DispatchUser(req.UserID)
+
+	logger.Info("Admin quota adjustment completed",
+		zap.String("user_id", req.UserID),
+		zap.String("operator", operator),
+		zap.Stringer("amount", req.Amount),
+		zap.String("model", req.Model),
+		zap.String("ticket_ref", req.TicketRef))
+
+	return &AdjustQuotaResponse{
+		UserID:       req.UserID,
+		Amount:       req.Amount,
+		Model:        req.Model,
+		ExpiryDate:   expiryDate,
+		BucketAmount: bucket.Amount,
+		Operator:     operator,
+		AuditID:      auditRecord.ID,
+	}, nil
+}
+
+// clawBackFromBucket removes amount from a valid bucket, limited to what is left of it after used quota
+// and active holds. The bucket is deleted when it reaches zero.
+func (s *QuotaService) clawBackFromBucket(tx *gorm.DB, userID, model string, expiryDate time.Time, amount, usedQuota decimal.Amount) (*models.Quota, error) {
+	var quotas []models.Quota
+	if err := tx.Where("user_id = ? AND status = ?", userID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
+	}
+	held, _, err := heldQuotaByExpiry(tx, userID, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	for i := range quotas {
+		bucket := quotas[i]
+		if bucket.Model != model || !bucket.ExpiryDate.Equal(expiryDate) {
+			continue
+		}
+
+		available := remaining[i]
+		if model == "" {
+			available = available.Sub(held[bucket.ExpiryDate.Unix()])
+		}
+		if available.LessThan(amount) {
+			return nil, NewInsufficientQuotaError(decimal.Max(available, decimal.Zero), amount)
+		}
+
+		bucket.Amount = bucket.Amount.Sub(amount)
+		if bucket.Amount.IsPositive() {
+			if err := tx.Model(&models.Quota{}).Where("id = ?", bucket.ID).
+				Update("amount", bucket.Amount).Error; err != nil {
+				return nil, fmt.Errorf("failed to update quota: %w", err)
+			}
+		} else if err := tx.Delete(&models.Quota{}, bucket.ID).Error; err != nil {
+			return nil, fmt.Errorf("failed to delete zero quota records: %w", err)
+		}
+		return &bucket, nil
+	}
+
+	return nil, NewInsufficientQuotaError(decimal.Zero, amount)
+}
+
+// BulkAdjustQuota applies one adjustment to every listed user. Each user is adjusted in its own
+// transaction, so a failure for one user does not undo the others.
+func (s *QuotaService) BulkAdjustQuota(operator string, req *BulkAdjustQuotaRequest) (*BulkAdjustQuotaResponse, error) {
+	userIDs, err := collectBulkUserIDs(req.UserIDs, req.CSV)
+	if err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, NewValidationFailedError("user_ids or csv must list at least one user")
+	}
+	if len(userIDs) > maxBulkAdjustUsers {
+		return nil, NewValidationFailedError(fmt.Sprintf("at most %d users can be adjusted at once", maxBulkAdjustUsers))
+	}
+
+	resp := &BulkAdjustQuotaResponse{
+		Total:   len(userIDs),
+		Results: make([]BulkAdjustQuotaResult, 0, len(userIDs)),
+	}
+	for _, userID := range userIDs {
+		result, err := s.AdjustQuota(operator, &AdjustQuotaRequest{
+			UserID:     userID,
+			Amount:     req.Amount,
+			ExpiryDate: req.ExpiryDate,
+			Model:      req.Model,
+			Reason:     req.Reason,
+			TicketRef:  req.TicketRef,
+		})
+		if err != nil {
+			var serviceErr *ServiceError
+			if errors.As(err, &serviceErr) && serviceErr.Code == ErrorValidationFailed {
+				// The same request fails validation for every user
+				return nil, err
+			}
+			resp.Failed++
+			resp.Results = append(resp.Results, BulkAdjustQuotaResult{UserID: userID, Message: err.Error()})
+			continue
+		}
+		resp.Succeeded++
+		resp.Results = append(resp.Results, BulkAdjustQuotaResult{UserID: userID, Success: true, AuditID: result.AuditID})
+	}
+
+	return resp, nil
+}
+
+// collectBulkUserIDs merges the listed and CSV user IDs, trimmed and without duplicates
+func collectBulkUserIDs(listed []string, csvData string) ([]string, error) {
+	seen := make(map[string]bool)
+	userIDs := make([]string, 0, len(listed))
+	add := func(userID string) {
+		userID = strings.TrimSpace(userID)
+		if userID == "" || seen[userID] {
+			return
+		}
+		seen[userID] = true
+		userIDs = append(userIDs, userID)
+	}
+
+	for _, userID := range listed {
+		add(userID)
+	}
+
+	if strings.TrimSpace(csvData) != "" {
+		reader := csv.NewReader(strings.NewReader(csvData))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for row := 0; ; row++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, NewValidationFailedError(fmt.Sprintf("invalid csv: %v", err))
+			}
+			if row == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "user_id") {
+				continue
+			}
+			add(record[0])
+		}
+	}
+
+	return userIDs, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+
+	"gorm.io/gorm"
+)
+
+// QuotaAuditFilter narrows an audit search. Zero values do not filter.
+type QuotaAuditFilter struct {
+	UserID       string   // Empty searches across all users
+	Operations   []string // Any of these operations
+	StrategyID   int
+	StrategyName string
+	RelatedUser  string
+	VoucherCode  string
+	MinAmount    *decimal.Amount // Inclusive, compared with the absolute amount so debits match too
+	MaxAmount    *decimal.Amount // Inclusive, compared with the absolute amount
+	Since        *time.Time      // Inclusive create time
+	Until        *time.Time      // Exclusive create time
+	Ascending    bool            // Oldest first instead of newest first
+}
+
+// QuotaAuditPage is one page of an audit search
+type QuotaAuditPage struct {
+	Total      int64              `json:"total"`
+	Records    []QuotaAuditRecord `json:"records"`
+	NextCursor string             `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// SearchQuotaAudit returns a page of the audit records matching filter. With a cursor from a previous
+// page, the page starts right after that page's last record, so deep pages are found through the
+// (create_time, id) order instead of an OFFSET scan. Without a cursor, page selects the page by offset.
+func (s *QuotaService) SearchQuotaAudit(filter *QuotaAuditFilter, cursor string, page, pageSize int) (*QuotaAuditPage, error) {
+	query := applyQuotaAuditFilter(s.db.DB.Model(&models.QuotaAudit{}), filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count audit records: %w", err)
+	}
+
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
+	query = query.Order("create_time " + direction + ", id " + direction)
+	if cursor != "" {
+		createTime, id, err := decodeAuditCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		comparison := "<"
+		if filter.Ascending {
+			comparison = ">"
+		}
+		query = query.Where("(create_time, id) "+comparison+" (?, ?)", createTime, id)
+	} else {
+		query = query.Offset((page - 1) * pageSize)
+	}
+
+	// One extra record tells whether there is a next page
+	var records []models.QuotaAudit
+	if err := query.Limit(pageSize + 1).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get audit records: %w", err)
+	}
+
+	result := &QuotaAuditPage{Total: total}
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		last := records[len(records)-1]
+		result.NextCursor = encodeAuditCursor(last.CreateTime, last.ID)
+	}
+	result.Records = make([]QuotaAuditRecord, len(records))
+	for i, record := range records {
+		// Parse details if available
+		var details *models.QuotaAuditDetails
+		if record.Details != "" {
+			parsedDetails, err := record.UnmarshalDetails()
+			if err == nil {
+				details = parsedDetails
+			}
+		}
+
+		result.Records[i] = QuotaAuditRecord{
+			ID:           record.ID,
+			UserID:       record.UserID,
+			Amount:       record.Amount,
+			Operation:    record.Operation,
+			VoucherCode:  record.VoucherCode,
+			RelatedUser:  record.RelatedUser,
+			StrategyID:   record.StrategyID,
+			StrategyName: record.StrategyName,
+			Reason:       record.Reason,
+			ReferenceID:  record.ReferenceID,
+			Model:        record.Model,
+			Operator:     record.Operator,
+			ExpiryDate:   record.ExpiryDate,
+			Details:      details,
+			CreateTime:   record.CreateTime,
+		}
+	}
+	return result, nil
+}
+
+// applyQuotaAuditFilter adds the conditions of filter to query
+func applyQuotaAuditFilter(query *gorm.DB, filter *QuotaAuditFilter) *gorm.DB {
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if len(filter.Operations) > 0 {
+		query = query.Where("operation IN ?", filter.Operations)
+	}
+	if filter.StrategyID > 0 {
+		query = query.Where("strategy_id = ?", filter.StrategyID)
+	}
+	if filter.StrategyName != "" {
+		query = query.Where("strategy_name = ?", filter.StrategyName)
+	}
+	if filter.RelatedUser != "" {
+		query = query.Where("related_user = ?", filter.RelatedUser)
+	}
+	if filter.VoucherCode != "" {
+		query = query.Where("voucher_code = ?", filter.VoucherCode)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("ABS(amount) >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("ABS(amount) <= ?", *filter.MaxAmount)
+	}
+	if filter.Since != nil {
+		query = query.Where("create_time >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("create_time < ?", *filter.Until)
+	}
+	return query
+}
+
+// encodeAuditCursor encodes the position of an audit record as an opaque cursor
+func encodeAuditCursor(createTime time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createTime.Format(time.RFC3339Nano) + "|" + strconv.Itoa(id)))
+}
+
+// decodeAuditCursor returns the position encoded by encodeAuditCursor
+func decodeAuditCursor(cursor string) (time.Time, int, error) {
+	invalid := NewValidationFailedError("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	createTimeText, idText, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, 0, invalid
+	}
+	createTime, err := time.Parse(time.RFC3339Nano, createTimeText)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	return createTime, id, nil
+}
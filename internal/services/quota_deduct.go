@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+)
+
+// DeductQuotaRequest represents a quota deduction requested by a trusted service
+type DeductQuotaRequest struct {
+	UserID      string         `json:"user_id" validate:"required,max=255"`
+	Amount      decimal.Amount `json:"amount" validate:"required,gt=0"`
+	Reason      string         `json:"reason,omitempty" validate:"max=255"`
+	ReferenceID string         `json:"reference_id,omitempty" validate:"max=255"`
+	Model       string         `json:"model,omitempty" validate:"max=255"`
+}
+
+// DeductQuotaResponse represents the result of a quota deduction
+type DeductQuotaResponse struct {
+	UserID         string         `json:"user_id"`
+	Amount         decimal.Amount `json:"amount"`
+	Reason         string         `json:"reason,omitempty"`
+	ReferenceID    string         `json:"reference_id,omitempty"`
+	Model          string         `json:"model,omitempty"`
+	RemainingQuota decimal.Amount `json:"remaining_quota"`
+	AuditID        int            `json:"audit_id"`
+	CreateTime     time.Time      `json:"create_time"`
+	Replayed       bool           `json:"replayed"` // True when the response was stored by an earlier request with the same key
+}
+
+// idempotencyClaim identifies the idempotency key a deduction is processed under
+type idempotencyClaim struct {
+	caller      string
+	key         string
+	requestHash string
+}
+
+// errIdempotencyKeyTaken reports that another request claimed the idempotency key first
+var errIdempotencyKeyTaken = errors.New("idempotency key is already claimed")
+
+// DeductQuotaIdempotent deducts quota once per caller and idempotency key.
+// Retries with the same key return the original response instead of charging again,
+// and reusing a key for a different request is rejected with a conflict error.
+func (s *QuotaService) DeductQuotaIdempotent(caller, idempotencyKey string, req *DeductQuotaRequest) (*DeductQuotaResponse, error) {
+	requestHash, err := idempotencyRequestHash(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored DeductQuotaResponse
+	if found, err := loadIdempotentResponse(s.db.DB, caller, models.OperationDeduct, idempotencyKey, requestHash, &stored); err != nil {
+		return nil, err
+	} else if found {
+		stored.Replayed = true
+		return &stored, nil
+	}
+
+	resp, err := s.deductQuota(req, &idempotencyClaim{caller: caller, key: idempotencyKey, requestHash: requestHash})
+	if errors.Is(err, errIdempotencyKeyTaken) {
+		// A concurrent request with the same key won, replay its result
+		found, lookupErr := loadIdempotentResponse(s.db.DB, caller, models.OperationDeduct, idempotencyKey, requestHash, &stored)
+		if lookupErr != nil {
+			return nil, lookupErr
+		}
+		if !found {
+			return nil, NewConflictError("a request with this idempotency key is still being processed")
+		}
+		stored.Replayed = true
+		return &stored, nil
+	}
+	return resp, err
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExpiringQuotaItem represents quota of one bucket that expires soon
+type ExpiringQuotaItem struct {
+	Amount     decimal.Amount `json:"amount"`
+	Model      string         `json:"model,omitempty"` // Empty for the general pool
+	ExpiryDate time.Time      `json:"expiry_date"`
+}
+
+// ExpiringQuotaResponse represents a user's quota expiring before Until
+type ExpiringQuotaResponse struct {
+	UserID      string              `json:"user_id"`
+	Until       time.Time           `json:"until"`
+	TotalAmount decimal.Amount      `json:"total_amount"`
+	Items       []ExpiringQuotaItem `json:"items"`
+}
+
+// ExpiringQuotaDay represents the quota of all users expiring on one day
+type ExpiringQuotaDay struct {
+	Day    string         `json:"date"` // YYYY-MM-DD in the configured timezone
+	Users  int64          `json:"users"`
+	Amount decimal.Amount `json:"amount"`
+}
+
+// ExpiringQuotaSummary represents the quota of all users expiring before Until, by day
+type ExpiringQuotaSummary struct {
+	Until       time.Time          `json:"until"`
+	TotalUsers  int64              `json:"total_users"`
+	TotalAmount decimal.Amount     `json:"total_amount"`
+	Days        []ExpiringQuotaDay `json:"days"`
+}
+
+// GetExpiringQuota returns the user's remaining quota that expires within the given duration.
+// Used quota is taken from the earliest buckets first and held quota is excluded, as in GetUserQuota.
+func (s *QuotaService) GetExpiringQuota(userID string, within time.Duration) (*ExpiringQuotaResponse, error) {
+	now := time.Now()
+	until := now.Add(within).Truncate(time.Second)
+
+	items, err := s.expiringQuotaItems(userID, now, until)
+	if err != nil {
+		return nil, err
+	}
+
+	total := decimal.Zero
+	for _, item := range items {
+		total = total.Add(item.Amount)
+	}
+	return &ExpiringQuotaResponse{
+		UserID:      userID,
+		Until:       until,
+		TotalAmount: total,
+		Items:       items,
+	}, nil
+}
+
+// expiringQuotaItems returns the remaining amount of each valid bucket expiring after now and up to until
+func (s *QuotaService) expiringQuotaItems(userID string, now, until time.Time) ([]ExpiringQuotaItem, error) {
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	var quotas []models.Quota
+	if err := s.db.DB.Where("user_id = ? AND status = ?", userID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
+	}
+
+	held, _, err := heldQuotaByExpiry(s.db.DB, userID, now, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]ExpiringQuotaItem, 0)
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	for i, quota := range quotas {
+		if !quota.ExpiryDate.After(now) || quota.ExpiryDate.After(until) {
+			continue
+		}
+		amount := remaining[i]
+		if quota.Model == "" {
+			amount = amount.Sub(held[quota.ExpiryDate.Unix()])
+		}
+		if amount.IsPositive() {
+			items = append(items, ExpiringQuotaItem{
+				Amount:     amount,
+				Model:      quota.Model,
+				ExpiryDate: quota.ExpiryDate,
+			})
+		}
+	}
+	return items, nil
+}
+
+// GetExpiringQuotaSummary aggregates the valid quota of all users expiring within the given duration by
+// day. Amounts are bucket amounts; used quota is tracked by AiGateway per user and is not subtracted.
+func (s *QuotaService) GetExpiringQuotaSummary(within time.Duration) (*ExpiringQuotaSummary, error) {
+	now := time.Now()
+	until := now.Add(within).Truncate(time.Second)
+	timezone := utils.GetTimezone(s.configManager.GetDirect()).String()
+
+	query := s.db.DB.Model(&models.Quota{}).
+		Where("status = ? AND expiry_date > ? AND expiry_date <= ?", models.StatusValid, now, until)
+
+	days := make([]ExpiringQuotaDay, 0)
+	if err := query.Session(&gorm.Session{}).
+		Select("to_char(expiry_date AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(DISTINCT user_id) AS users, COALESCE(SUM(amount), 0) AS amount", timezone).
+		Group("day").Order("day ASC").
+		Scan(&days).Error; err != nil {
+		return nil, NewDatabaseError("aggregate expiring quota", err)
+	}
+
+	summary := &ExpiringQuotaSummary{Until: until, TotalAmount: decimal.Zero, Days: days}
+	if err := query.Session(&gorm.Session{}).Distinct("user_id").Count(&summary.TotalUsers).Error; err != nil {
+		return nil, NewDatabaseError("count users with expiring quota", err)
+	}
+	for _, day := range days {
+		summary.TotalAmount = summary.TotalAmount.Add(day.Amount)
+	}
+	return summary, nil
+}
+
+// SendExpiryWarnings warns every user whose quota expires within one of the configured lead times.
+// Each bucket is announced at the shortest lead time that covers it, and each expiry date at most
+// once per lead time, so a bucket expiring in 5 days gets the 7-day warning now and the 1-day
+// warning later. It returns the number of warnings sent. A failure for one user is logged and
+// the user is retried on the next run.
+func (s *QuotaService) SendExpiryWarnings() (int, error) {
+	leadDays := s.configManager.GetDirect().ExpiryNotify.GetLeadDays()
+	now := time.Now()
+	until := now.Add(time.Duration(leadDays[0]) * 24 * time.Hour)
+
+	var userIDs []string
+	if err := s.db.DB.Model(&models.Quota{}).
+		Where("status = ? AND expiry_date > ? AND expiry_date <= ?", models.StatusValid, now, until).
+		Distinct("user_id").Order("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, NewDatabaseError("find users with expiring quota", err)
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		count, err := s.sendUserExpiryWarnings(userID, leadDays, now, until)
+		sent += count
+		if err != nil {
+			logger.Error("Failed to send expiry warnings",
+				zap.String("user_id", userID),
+				zap.Error(err))
+		}
+	}
+
+	logger.Info("Expiry warnings sent",
+		zap.Int("users", len(userIDs)),
+		zap.Int("warnings", sent))
+	return sent, nil
+}
+
+// sendUserExpiryWarnings sends the user one event per lead time with quota newly inside it
+func (s *QuotaService) sendUserExpiryWarnings(userID string, leadDays []int, now, until time.Time) (int, error) {
+	items, err := s.expiringQuotaItems(userID, now, until)
+	if err != nil {
+		return 0, err
+	}
+	if len(items) == 0 {
+		return 0, nil
+	}
+
+	var notified []models.ExpiryNotification
+	if err := s.db.DB.Where("user_id = ? AND expiry_date > ?", userID, now).
+		Find(&notified).Error; err != nil {
+		return 0, NewDatabaseError("get expiry notifications", err)
+	}
+	type notifiedKey struct {
+		expiry   int64
+		leadDays int
+	}
+	done := make(map[notifiedKey]bool, len(notified))
+	for _, n := range notified {
+		done[notifiedKey{n.ExpiryDate.Unix(), n.LeadDays}] = true
+	}
+
+	// leadDays is longest first, so the last lead time that covers an item is the shortest one
+	byLead := make(map[int][]ExpiringQuotaItem)
+	for _, item := range items {
+		lead := 0
+		for _, days := range leadDays {
+			if !item.ExpiryDate.After(now.Add(time.Duration(days) * 24 * time.Hour)) {
+				lead = days
+			}
+		}
+		if lead == 0 || done[notifiedKey{item.ExpiryDate.Unix(), lead}] {
+			continue
+		}
+		byLead[lead] = append(byLead[lead], item)
+	}
+
+	sent := 0
+	for _, lead := range leadDays {
+		leadItems := byLead[lead]
+		if len(leadItems) == 0 {
+			continue
+		}
+
+		event := &ExpiryWarningEvent{
+			Event:       ExpiryWarningEventType,
+			UserID:      userID,
+			LeadDays:    lead,
+			TotalAmount: decimal.Zero,
+			Items:       leadItems,
+			CreateTime:  now,
+		}
+		amountByExpiry := make(map[int64]decimal.Amount)
+		expiryDates := make([]time.Time, 0)
+		for _, item := range leadItems {
+			event.TotalAmount = event.TotalAmount.Add(item.Amount)
+			key := item.ExpiryDate.Unix()
+			if _, ok := amountByExpiry[key]; !ok {
+				expiryDates = append(expiryDates, item.ExpiryDate)
+			}
+			amountByExpiry[key] = amountByExpiry[key].Add(item.Amount)
+		}
+
+		if err := s.expiryNotifier.NotifyExpiring(event); err != nil {
+			return sent, fmt.Errorf("failed to notify %d-day expiry warning: %w", lead, err)
+		}
+		sent++
+
+		records := make([]models.ExpiryNotification, 0, len(expiryDates))
+		for _, expiryDate := range expiryDates {
+			records = append(records, models.ExpiryNotification{
+				UserID:     userID,
+				ExpiryDate: expiryDate,
+				LeadDays:   lead,
+				Amount:     amountByExpiry[expiryDate.Unix()],
+			})
+		}
+		if err := s.db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error; err != nil {
+			return sent, NewDatabaseError("record expiry notifications", err)
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// lockUserQuota serializes quota changes of the given users until tx ends. Every operation that checks a
+// user's available quota and then changes the user's buckets takes the lock before reading the buckets,
+// so two concurrent operations cannot both spend the same quota. Users are locked in a fixed order to
+// avoid deadlocks between operations that touch several users.
+func lockUserQuota(tx *gorm.DB, userIDs ...string) error {
+	ordered := append([]string(nil), userIDs...)
+	sort.Strings(ordered)
+	for i, userID := range ordered {
+		if i > 0 && userID == ordered[i-1] {
+			continue
+		}
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "quota:"+userID).Error; err != nil {
+			return NewDatabaseError("lock user quota", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,752 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Personal settings a merge can carry over, as listed in QuotaMergePermissions.Skipped
+const (
+	mergeSettingModelWhitelist = "model_whitelist"
+	mergeSettingStarCheck      = "star_check"
+	mergeSettingQuotaCheck     = "quota_check"
+)
+
+// MergeQuotaRequest represents merge quota request
+type MergeQuotaRequest struct {
+	MainUserID       string `json:"main_user_id" validate:"required,uuid"`  // The user who will receive the merged quota
+	OtherUserID      string `json:"other_user_id" validate:"required,uuid"` // The user who will be merged into the main user
+	CarryPermissions bool   `json:"carry_permissions"`                      // Also copy the other user's model whitelist and star/quota check settings
+}
+
+// MergeQuotaResponse represents merge quota response
+type MergeQuotaResponse struct {
+	MergeID       int                           `json:"merge_id,omitempty"`
+	MainUserID    string                        `json:"main_user_id"`
+	OtherUserID   string                        `json:"other_user_id"`
+	Amount        decimal.Amount                `json:"amount"`
+	UsedQuota     decimal.Amount                `json:"used_quota"`
+	Operation     string                        `json:"operation"`
+	Status        string                        `json:"status"`
+	Message       string                        `json:"message,omitempty"`
+	UndoableUntil *time.Time                    `json:"undoable_until,omitempty"`
+	Permissions   *models.QuotaMergePermissions `json:"permissions,omitempty"`
+}
+
+// MergeQuotaPreview is what a merge would move, without moving anything
+type MergeQuotaPreview struct {
+	MainUserID         string                        `json:"main_user_id"`
+	OtherUserID        string                        `json:"other_user_id"`
+	Amount             decimal.Amount                `json:"amount"`
+	Buckets            []models.QuotaMergeBucket     `json:"buckets"`
+	GatewayQuota       decimal.Amount                `json:"gateway_quota"` // The other user's AiGateway total quota
+	UsedQuota          decimal.Amount                `json:"used_quota"`    // The other user's AiGateway used quota, which moves with the buckets
+	StrategyExecutions int64                         `json:"strategy_executions"`
+	Permissions        *models.QuotaMergePermissions `json:"permissions,omitempty"`
+}
+
+// QuotaMergeRecord is a merge with its parsed snapshot
+type QuotaMergeRecord struct {
+	models.QuotaMerge
+	Snapshot *models.QuotaMergeSnapshot `json:"snapshot"`
+}
+
+// PreviewMergeUserQuota reports the buckets, used quota, strategy executions and, when requested, the
+// personal settings a merge of the two users would move
+func (s *QuotaService) PreviewMergeUserQuota(req *MergeQuotaRequest) (*MergeQuotaPreview, error) {
+	if req.MainUserID == req.OtherUserID {
+		return nil, NewValidationFailedError("main user and other user cannot be the same")
+	}
+
+	buckets, err := planQuotaMerge(s.db.DB, req.MainUserID, req.OtherUserID)
+	if err != nil {
+		return nil, err
+	}
+	gatewayQuota, usedQuota, err := s.gatewayBalance(s.db.DB, req.OtherUserID)
+	if err != nil {
+		return nil, err
+	}
+	preview := &MergeQuotaPreview{
+		MainUserID:   req.MainUserID,
+		OtherUserID:  req.OtherUserID,
+		Amount:       mergeBucketTotal(buckets),
+		Buckets:      buckets,
+		GatewayQuota: gatewayQuota,
+		UsedQuota:    usedQuota,
+	}
+	if err := s.db.DB.Model(&models.QuotaExecute{}).Where("user_id = ?", req.OtherUserID).
+		Count(&preview.StrategyExecutions).Error; err != nil {
+		return nil, NewDatabaseError("count strategy executions", err)
+	}
+	if req.CarryPermissions {
+		if preview.Permissions, err = s.planPermissionCarryOver(s.db.DB, req.MainUserID, req.OtherUserID); err != nil {
+			return nil, err
+		}
+	}
+	return preview, nil
+}
+
+// MergeUserQuota merges all quota from other user to main user. The buckets, used quota, strategy
+// executions and carried settings are recorded in a merge record, so the merge can be undone within
+// the configured undo window.
+func (s *QuotaService) MergeUserQuota(operator string, req *MergeQuotaRequest) (*MergeQuotaResponse, error) {
+	mainUserID := req.MainUserID
+	otherUserID := req.OtherUserID
+	// Validate request
+	if mainUserID == "" || otherUserID == "" {
+		logger.Warn("User quota merge: Failed - empty user IDs",
+			zap.String("main_user", mainUserID),
+			zap.String("other_user", otherUserID))
+		return &MergeQuotaResponse{
+			MainUserID:  mainUserID,
+			OtherUserID: otherUserID,
+			Amount:      decimal.Zero,
+			Operation:   models.OperationMergeIn,
+			Status:      "FAILED",
+			Message:     "Main user or other user cannot be empty",
+		}, nil
+	} else if mainUserID == otherUserID {
+		logger.Warn("User quota merge: Failed - same user IDs",
+			zap.String("user_id", mainUserID))
+		return &MergeQuotaResponse{
+			MainUserID:  mainUserID,
+			OtherUserID: otherUserID,
+			Amount:      decimal.Zero,
+			Operation:   models.OperationMergeIn,
+			Status:      "FAILED",
+			Message:     "Main user and other user cannot be the same",
+		}, nil
+	}
+
+	// Used quota only moves with quota, so the other user is not left with usage they have no quota for.
+	// It is read before taking the quota locks; operations still waiting in the outbox are added under them.
+	otherUsed, err := s.aiGatewayClient.QueryUsedQuotaValue(otherUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota from AiGateway for user %s: %w", otherUserID, err)
+	}
+
+	// Start transaction
+	tx := s.db.DB.Begin()
+	logger.Info("User quota merge: Starting",
+		zap.String("main_user", mainUserID),
+		zap.String("other_user", otherUserID))
+
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("User quota merge: Panic occurred, rolling back transaction",
+				zap.String("main_user", mainUserID),
+				zap.String("other_user", otherUserID),
+				zap.Any("panic", r))
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, mainUserID, otherUserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	buckets, err := planQuotaMerge(tx, mainUserID, otherUserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var permissions *models.QuotaMergePermissions
+	if req.CarryPermissions {
+		if permissions, err = s.planPermissionCarryOver(tx, mainUserID, otherUserID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// If nothing is found, return success with empty result
+	if len(buckets) == 0 && !permissions.Carries() {
+		tx.Rollback()
+		logger.Info("User quota merge: No quotas found to merge",
+			zap.String("other_user", otherUserID))
+		return &MergeQuotaResponse{
+			MainUserID:  mainUserID,
+			OtherUserID: otherUserID,
+			Amount:      decimal.Zero,
+			Operation:   models.OperationMergeIn,
+			Status:      "SUCCESS",
+			Message:     "No quotas found to merge",
+		}, nil
+	}
+
+	snapshot := &models.QuotaMergeSnapshot{Buckets: buckets, Permissions: permissions}
+	totalAmount := mergeBucketTotal(buckets)
+	if totalAmount.IsPositive() {
+		pendingUsed, err := pendingGatewayDelta(tx, otherUserID, models.OutboxDeltaUsedQuota)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		snapshot.UsedQuota = decimal.Max(otherUsed.Add(pendingUsed), decimal.Zero)
+	}
+
+	for _, bucket := range buckets {
+		if bucket.MainQuotaID != bucket.QuotaID {
+			// Main user already has a bucket with the same model, expiry date and status
+			if err := tx.Model(&models.Quota{}).Where("id = ?", bucket.MainQuotaID).
+				Update("amount", gorm.Expr("amount + ?", bucket.Amount)).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to merge quota amount for user %s, expiry %s: %w",
+					mainUserID, bucket.ExpiryDate.Format("2006-01-02"), err)
+			}
+			if err := tx.Delete(&models.Quota{}, bucket.QuotaID).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to delete original quota from user %s: %w", otherUserID, err)
+			}
+		} else if err := tx.Model(&models.Quota{}).Where("id = ?", bucket.QuotaID).
+			Update("user_id", mainUserID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to transfer quota from user %s to user %s: %w",
+				otherUserID, mainUserID, err)
+		}
+	}
+
+	// Re-assign strategy executions so the main user is not rewarded again for what the other user received
+	if err := tx.Model(&models.QuotaExecute{}).Where("user_id = ?", otherUserID).
+		Pluck("id", &snapshot.ExecuteIDs).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("get strategy executions", err)
+	}
+	if len(snapshot.ExecuteIDs) > 0 {
+		if err := tx.Model(&models.QuotaExecute{}).Where("id IN ?", snapshot.ExecuteIDs).
+			Update("user_id", mainUserID).Error; err != nil {
+			tx.Rollback()
+			return nil, NewDatabaseError("update strategy executions", err)
+		}
+	}
+
+	if err := applyPermissionCarryOver(tx, permissions); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	now := time.Now()
+	merge := &models.QuotaMerge{
+		MainUserID:    mainUserID,
+		OtherUserID:   otherUserID,
+		Amount:        totalAmount,
+		Status:        models.QuotaMergeStatusMerged,
+		Operator:      operator,
+		UndoableUntil: now.Add(s.configManager.GetDirect().Merge.GetUndoWindow()),
+	}
+	if err := merge.MarshalSnapshot(snapshot); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(merge).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create merge record", err)
+	}
+
+	if totalAmount.IsPositive() {
+		if err := s.recordMergeMovement(tx, merge.ID, models.OperationMergeIn, models.OperationMergeOut,
+			mainUserID, otherUserID, buckets, snapshot.UsedQuota); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit().Error; err != nil {
+		logger.Error("User quota merge: Failed to commit transaction",
+			zap.String("main_user", mainUserID),
+			zap.String("other_user", otherUserID),
+			zap.Error(err))
+		return nil, fmt.Errorf("failed to commit transaction, for user quota merged: %w", err)
+	}
+	s.outbox.DispatchUser(mainUserID)
+	s.outbox.DispatchUser(otherUserID)
+	s.refreshCarriedPermissions(permissions)
+
+	// Log the merge operation
+	logger.Info("User quota merge: Completed successfully",
+		zap.Int("merge_id", merge.ID),
+		zap.String("main_user", mainUserID),
+		zap.String("other_user", otherUserID),
+		zap.Stringer("amount", totalAmount),
+		zap.Stringer("used_quota", snapshot.UsedQuota),
+		zap.Int("quota_items", len(buckets)))
+
+	return &MergeQuotaResponse{
+		MergeID:       merge.ID,
+		MainUserID:    mainUserID,
+		OtherUserID:   otherUserID,
+		Amount:        totalAmount,
+		UsedQuota:     snapshot.UsedQuota,
+		Operation:     models.OperationMergeIn,
+		Status:        "SUCCESS",
+		Message:       "Quota merged successfully",
+		UndoableUntil: &merge.UndoableUntil,
+		Permissions:   permissions,
+	}, nil
+}
+
+// GetQuotaMerges lists merge records, newest first, optionally only those involving userID
+func (s *QuotaService) GetQuotaMerges(userID string, page, pageSize int) ([]QuotaMergeRecord, int64, error) {
+	query := s.db.DB.Model(&models.QuotaMerge{})
+	if userID != "" {
+		query = query.Where("main_user_id = ? OR other_user_id = ?", userID, userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, NewDatabaseError("count merge records", err)
+	}
+	var merges []models.QuotaMerge
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&merges).Error; err != nil {
+		return nil, 0, NewDatabaseError("list merge records", err)
+	}
+
+	records := make([]QuotaMergeRecord, len(merges))
+	for i := range merges {
+		snapshot, err := merges[i].UnmarshalSnapshot()
+		if err != nil {
+			return nil, 0, err
+		}
+		records[i] = QuotaMergeRecord{QuotaMerge: merges[i], Snapshot: snapshot}
+	}
+	return records, total, nil
+}
+
+// UndoQuotaMerge moves the merged buckets, used quota and strategy executions back to the other user and
+// removes the carried settings. It fails with a conflict when the undo window has passed or the main user
+// no longer holds the merged quota.
+func (s *QuotaService) UndoQuotaMerge(operator string, id int) (*QuotaMergeRecord, error) {
+	var merge models.QuotaMerge
+	if err := s.db.DB.First(&merge, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("merge record", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get merge record", err)
+	}
+	// Read before taking the quota locks; operations still waiting in the outbox are added under them
+	mainUsed, err := s.aiGatewayClient.QueryUsedQuotaValue(merge.MainUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota from AiGateway for user %s: %w", merge.MainUserID, err)
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, merge.MainUserID, merge.OtherUserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&merge, id).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("lock merge record", err)
+	}
+	if merge.Status != models.QuotaMergeStatusMerged {
+		tx.Rollback()
+		return nil, NewConflictError(fmt.Sprintf("merge %d has already been undone", id))
+	}
+	now := time.Now()
+	if now.After(merge.UndoableUntil) {
+		tx.Rollback()
+		return nil, NewConflictError(fmt.Sprintf("the undo window of merge %d closed at %s", id, merge.UndoableUntil.Format(time.RFC3339)))
+	}
+	snapshot, err := merge.UnmarshalSnapshot()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for _, bucket := range snapshot.Buckets {
+		var mainQuota models.Quota
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", bucket.MainQuotaID).
+			Find(&mainQuota).Error; err != nil {
+			tx.Rollback()
+			return nil, NewDatabaseError("lock merged quota", err)
+		}
+		if mainQuota.ID == 0 || mainQuota.UserID != merge.MainUserID || mainQuota.Status != models.StatusValid ||
+			mainQuota.Amount.LessThan(bucket.Amount) {
+			tx.Rollback()
+			return nil, NewConflictError(fmt.Sprintf("main user no longer holds the %s merged into quota %d", bucket.Amount, bucket.MainQuotaID))
+		}
+
+		if bucket.MainQuotaID == bucket.QuotaID && mainQuota.Amount == bucket.Amount {
+			// The bucket moved as is and has not changed since
+			if err := tx.Model(&mainQuota).Update("user_id", merge.OtherUserID).Error; err != nil {
+				tx.Rollback()
+				return nil, NewDatabaseError("restore merged quota", err)
+			}
+			continue
+		}
+		if err := tx.Model(&mainQuota).Update("amount", mainQuota.Amount.Sub(bucket.Amount)).Error; err != nil {
+			tx.Rollback()
+			return nil, NewDatabaseError("restore merged quota", err)
+		}
+		if _, err := addToQuotaBucket(tx, merge.OtherUserID, bucket.Model, bucket.ExpiryDate, bucket.Amount); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if len(snapshot.ExecuteIDs) > 0 {
+		if err := tx.Model(&models.QuotaExecute{}).Where("id IN ? AND user_id = ?", snapshot.ExecuteIDs, merge.MainUserID).
+			Update("user_id", merge.OtherUserID).Error; err != nil {
+			tx.Rollback()
+			return nil, NewDatabaseError("restore strategy executions", err)
+		}
+	}
+	if err := removePermissionCarryOver(tx, snapshot.Permissions); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if merge.Amount.IsPositive() {
+		// Never move back more used quota than the main user has left
+		pendingUsed, err := pendingGatewayDelta(tx, merge.MainUserID, models.OutboxDeltaUsedQuota)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		usedQuota := decimal.Max(decimal.Min(snapshot.UsedQuota, mainUsed.Add(pendingUsed)), decimal.Zero)
+		if err := s.recordMergeMovement(tx, merge.ID, models.OperationMergeUndo, models.OperationMergeUndo,
+			merge.OtherUserID, merge.MainUserID, snapshot.Buckets, usedQuota); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&merge).Updates(map[string]interface{}{
+		"status":    models.QuotaMergeStatusUndone,
+		"undone_at": now,
+		"undone_by": operator,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update merge record", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit merge undo", err)
+	}
+	s.outbox.DispatchUser(merge.MainUserID)
+	s.outbox.DispatchUser(merge.OtherUserID)
+	s.refreshCarriedPermissions(snapshot.Permissions)
+
+	logger.Info("User quota merge undone",
+		zap.Int("merge_id", merge.ID),
+		zap.String("main_user", merge.MainUserID),
+		zap.String("other_user", merge.OtherUserID),
+		zap.Stringer("amount", merge.Amount),
+		zap.String("operator", operator))
+	return &QuotaMergeRecord{QuotaMerge: merge, Snapshot: snapshot}, nil
+}
+
+// planQuotaMerge lists the other user's valid buckets with the main user's bucket each would merge into,
+// matched by model, expiry day and status. Buckets without a match move to the main user as they are.
+func planQuotaMerge(db *gorm.DB, mainUserID, otherUserID string) ([]models.QuotaMergeBucket, error) {
+	var otherUserQuotas []models.Quota
+	if err := db.Where("user_id = ? AND status = ? AND amount > 0", otherUserID, models.StatusValid).
+		Order("expiry_date ASC, id ASC").Find(&otherUserQuotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get other user quotas: %w", err)
+	}
+	if len(otherUserQuotas) == 0 {
+		return []models.QuotaMergeBucket{}, nil
+	}
+
+	var mainUserQuotas []models.Quota
+	if err := db.Where("user_id = ? AND status = ?", mainUserID, models.StatusValid).
+		Find(&mainUserQuotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get main user quotas: %w", err)
+	}
+	// Key is "model_expiry_date_status"
+	mainUserQuotaMap := make(map[string]int, len(mainUserQuotas))
+	for _, quota := range mainUserQuotas {
+		key := fmt.Sprintf("%s_%s_%s", quota.Model, quota.ExpiryDate.Format("2006-01-02"), quota.Status)
+		mainUserQuotaMap[key] = quota.ID
+	}
+
+	buckets := make([]models.QuotaMergeBucket, len(otherUserQuotas))
+	for i, quota := range otherUserQuotas {
+		mainQuotaID := quota.ID
+		key := fmt.Sprintf("%s_%s_%s", quota.Model, quota.ExpiryDate.Format("2006-01-02"), quota.Status)
+		if id, exists := mainUserQuotaMap[key]; exists {
+			mainQuotaID = id
+		}
+		buckets[i] = models.QuotaMergeBucket{
+			QuotaID:     quota.ID,
+			MainQuotaID: mainQuotaID,
+			Model:       quota.Model,
+			ExpiryDate:  quota.ExpiryDate,
+			Amount:      quota.Amount,
+		}
+	}
+	return buckets, nil
+}
+
+// recordMergeMovement writes the audit records and queues the AiGateway updates for buckets and used quota
+// moving from one user to another, toUser gaining and fromUser losing them
+func (s *QuotaService) recordMergeMovement(tx *gorm.DB, mergeID int, toOperation, fromOperation, toUser, fromUser string,
+	buckets []models.QuotaMergeBucket, usedQuota decimal.Amount) error {
+	totalAmount := mergeBucketTotal(buckets)
+	modelAmounts := make(map[string]decimal.Amount)
+	var latestExpiryDate time.Time
+	items := make([]models.QuotaAuditDetailItem, len(buckets))
+	for i, bucket := range buckets {
+		modelAmounts[bucket.Model] = modelAmounts[bucket.Model].Add(bucket.Amount)
+		if bucket.ExpiryDate.After(latestExpiryDate) {
+			latestExpiryDate = bucket.ExpiryDate
+		}
+		items[i] = models.QuotaAuditDetailItem{
+			Amount:     bucket.Amount,
+			ExpiryDate: bucket.ExpiryDate.Format(time.RFC3339),
+			Status:     models.AuditStatusSuccess,
+		}
+	}
+
+	for _, side := range []struct {
+		userID, relatedUser, operation string
+		sign                           int64
+	}{
+		{toUser, fromUser, toOperation, 1},
+		{fromUser, toUser, fromOperation, -1},
+	} {
+		auditDetails := &models.QuotaAuditDetails{
+			Operation: side.operation,
+			Summary: models.QuotaAuditSummary{
+				TotalAmount:        totalAmount,
+				TotalItems:         len(buckets),
+				SuccessfulItems:    len(buckets),
+				EarliestExpiryDate: latestExpiryDate.Format(time.RFC3339),
+			},
+			Items: items,
+		}
+		auditRecord := &models.QuotaAudit{
+			UserID:      side.userID,
+			Amount:      totalAmount.Mul(side.sign),
+			Operation:   side.operation,
+			RelatedUser: side.relatedUser,
+			MergeID:     &mergeID,
+			ExpiryDate:  latestExpiryDate,
+		}
+		if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+			return fmt.Errorf("failed to marshal audit details: %w", err)
+		}
+		if err := tx.Create(auditRecord).Error; err != nil {
+			return NewDatabaseError("create audit record", err)
+		}
+
+		for model, amount := range modelAmounts {
+			if err := enqueueQuotaDelta(tx, side.operation, side.userID, model, amount.Mul(side.sign)); err != nil {
+				return err
+			}
+		}
+		if usedQuota.IsPositive() {
+			if err := enqueueGatewayOp(tx, side.operation, side.userID, models.OutboxDeltaUsedQuota, "", usedQuota.Mul(side.sign)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// gatewayBalance returns the user's AiGateway total and used quota, including operations still waiting in the outbox
+func (s *QuotaService) gatewayBalance(db *gorm.DB, userID string) (decimal.Amount, decimal.Amount, error) {
+	totalQuota, err := s.aiGatewayClient.QueryQuotaValue(userID)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("failed to get total quota from AiGateway for user %s: %w", userID, err)
+	}
+	pendingQuota, err := pendingGatewayDelta(db, userID, models.OutboxDeltaQuota)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("failed to get used quota from AiGateway for user %s: %w", userID, err)
+	}
+	pendingUsed, err := pendingGatewayDelta(db, userID, models.OutboxDeltaUsedQuota)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return totalQuota.Add(pendingQuota), usedQuota.Add(pendingUsed), nil
+}
+
+// mergeBucketTotal sums the amounts of merged buckets
+func mergeBucketTotal(buckets []models.QuotaMergeBucket) decimal.Amount {
+	var total decimal.Amount
+	for _, bucket := range buckets {
+		total = total.Add(bucket.Amount)
+	}
+	return total
+}
+
+// planPermissionCarryOver lists the other user's personal model whitelist and star/quota check settings
+// to copy to the main user. Settings the main user already has are kept and reported as skipped.
+func (s *QuotaService) planPermissionCarryOver(db *gorm.DB, mainUserID, otherUserID string) (*models.QuotaMergePermissions, error) {
+	mainIdentifier, err := s.permissionIdentifier(mainUserID)
+	if err != nil {
+		return nil, err
+	}
+	if mainIdentifier == "" {
+		return nil, NewValidationFailedError(fmt.Sprintf("main user %s has no employee number to carry settings over to", mainUserID))
+	}
+	otherIdentifier, err := s.permissionIdentifier(otherUserID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := &models.QuotaMergePermissions{MainIdentifier: mainIdentifier}
+	if otherIdentifier == "" {
+		return permissions, nil
+	}
+
+	// personalSetting loads the user-level row of a settings table, reporting whether there is one
+	personalSetting := func(dest interface{}, identifier string) (bool, error) {
+		result := db.Where("target_type = ? AND target_identifier = ?", models.TargetTypeUser, identifier).Limit(1).Find(dest)
+		if result.Error != nil {
+			return false, NewDatabaseError("get personal settings", result.Error)
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	var otherWhitelist, mainWhitelist models.ModelWhitelist
+	if found, err := personalSetting(&otherWhitelist, otherIdentifier); err != nil {
+		return nil, err
+	} else if found && len(otherWhitelist.GetAllowedModelsAsSlice()) > 0 {
+		if exists, err := personalSetting(&mainWhitelist, mainIdentifier); err != nil {
+			return nil, err
+		} else if exists {
+			permissions.Skipped = append(permissions.Skipped, mergeSettingModelWhitelist)
+		} else {
+			permissions.ModelWhitelist = otherWhitelist.GetAllowedModelsAsSlice()
+		}
+	}
+
+	var otherStarCheck, mainStarCheck models.StarCheckSetting
+	if found, err := personalSetting(&otherStarCheck, otherIdentifier); err != nil {
+		return nil, err
+	} else if found {
+		if exists, err := personalSetting(&mainStarCheck, mainIdentifier); err != nil {
+			return nil, err
+		} else if exists {
+			permissions.Skipped = append(permissions.Skipped, mergeSettingStarCheck)
+		} else {
+			permissions.StarCheck = &otherStarCheck.Enabled
+		}
+	}
+
+	var otherQuotaCheck, mainQuotaCheck models.QuotaCheckSetting
+	if found, err := personalSetting(&otherQuotaCheck, otherIdentifier); err != nil {
+		return nil, err
+	} else if found {
+		if exists, err := personalSetting(&mainQuotaCheck, mainIdentifier); err != nil {
+			return nil, err
+		} else if exists {
+			permissions.Skipped = append(permissions.Skipped, mergeSettingQuotaCheck)
+		} else {
+			permissions.QuotaCheck = &otherQuotaCheck.Enabled
+		}
+	}
+	return permissions, nil
+}
+
+// permissionIdentifier returns the identifier personal settings of the user are stored under: the employee
+// number with employee sync, otherwise the user ID. It is empty for synced users without an employee number.
+func (s *QuotaService) permissionIdentifier(userID string) (string, error) {
+	if !s.configManager.GetDirect().EmployeeSync.Enabled {
+		return userID, nil
+	}
+	user, err := s.findUserInfo(userID)
+	if err != nil || user == nil {
+		return "", err
+	}
+	return user.EmployeeNumber, nil
+}
+
+// applyPermissionCarryOver creates the main user's carried personal settings
+func applyPermissionCarryOver(tx *gorm.DB, permissions *models.QuotaMergePermissions) error {
+	if !permissions.Carries() {
+		return nil
+	}
+	if len(permissions.ModelWhitelist) > 0 {
+		whitelist := &models.ModelWhitelist{TargetType: models.TargetTypeUser, TargetIdentifier: permissions.MainIdentifier}
+		whitelist.SetAllowedModelsFromSlice(permissions.ModelWhitelist)
+		if err := tx.Create(whitelist).Error; err != nil {
+			return NewDatabaseError("create whitelist", err)
+		}
+	}
+	if permissions.StarCheck != nil {
+		if err := tx.Create(&models.StarCheckSetting{TargetType: models.TargetTypeUser, TargetIdentifier: permissions.MainIdentifier,
+			Enabled: *permissions.StarCheck}).Error; err != nil {
+			return NewDatabaseError("create star check setting", err)
+		}
+	}
+	if permissions.QuotaCheck != nil {
+		if err := tx.Create(&models.QuotaCheckSetting{TargetType: models.TargetTypeUser, TargetIdentifier: permissions.MainIdentifier,
+			Enabled: *permissions.QuotaCheck}).Error; err != nil {
+			return NewDatabaseError("create quota check setting", err)
+		}
+	}
+	return nil
+}
+
+// removePermissionCarryOver deletes the main user's personal settings a merge carried over
+func removePermissionCarryOver(tx *gorm.DB, permissions *models.QuotaMergePermissions) error {
+	if !permissions.Carries() {
+		return nil
+	}
+	carried := []struct {
+		carried bool
+		model   interface{}
+	}{
+		{len(permissions.ModelWhitelist) > 0, &models.ModelWhitelist{}},
+		{permissions.StarCheck != nil, &models.StarCheckSetting{}},
+		{permissions.QuotaCheck != nil, &models.QuotaCheckSetting{}},
+	}
+	for _, setting := range carried {
+		if !setting.carried {
+			continue
+		}
+		if err := tx.Where("target_type = ? AND target_identifier = ?", models.TargetTypeUser, permissions.MainIdentifier).
+			Delete(setting.model).Error; err != nil {
+			return NewDatabaseError("remove carried settings", err)
+		}
+	}
+	return nil
+}
+
+// refreshCarriedPermissions recalculates the main user's effective permissions after carried settings
+// changed. Failures are logged, as the settings themselves are already saved.
+func (s *QuotaService) refreshCarriedPermissions(permissions *models.QuotaMergePermissions) {
+	if !permissions.Carries() {
+		return
+	}
+	identifier := permissions.MainIdentifier
+	if len(permissions.ModelWhitelist) > 0 && s.permissionSvc != nil {
+		if err := s.permissionSvc.UpdateEmployeePermissions(identifier); err != nil {
+			logger.Error("Failed to update effective permissions after merge",
+				zap.String("employee_number", identifier), zap.Error(err))
+		}
+	}
+	if permissions.StarCheck != nil && s.starCheckSvc != nil {
+		if err := s.starCheckSvc.UpdateEmployeeStarCheckPermissions(identifier); err != nil {
+			logger.Error("Failed to update effective star check setting after merge",
+				zap.String("employee_number", identifier), zap.Error(err))
+		}
+	}
+	if permissions.QuotaCheck != nil && s.quotaCheckSvc != nil {
+		if err := s.quotaCheckSvc.UpdateEmployeeQuotaCheckPermissions(identifier); err != nil {
+			logger.Error("Failed to update effective quota check setting after merge",
+				zap.String("employee_number", identifier), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"fmt"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+
+	"gorm.io/gorm"
+)
+
+// remainingAfterUsed returns what is left of each bucket once usedQuota is consumed from the
+// earliest buckets first. quotas must be ordered by expiry date.
+func remainingAfterUsed(quotas []models.Quota, usedQuota decimal.Amount) []decimal.Amount {
+	remaining := make([]decimal.Amount, len(quotas))
+	remainingUsed := usedQuota
+	for i, quota := range quotas {
+		consumed := decimal.Max(decimal.Min(remainingUsed, quota.Amount), decimal.Zero)
+		remaining[i] = quota.Amount.Sub(consumed)
+		remainingUsed = remainingUsed.Sub(consumed)
+	}
+	return remaining
+}
+
+// sumAmount returns the sum of an amount column over the rows selected by query, zero when none match
+func sumAmount(query *gorm.DB, column string) (decimal.Amount, error) {
+	var result struct{ Total decimal.Amount }
+	if err := query.Select(fmt.Sprintf("COALESCE(SUM(%s), 0) AS total", column)).Scan(&result).Error; err != nil {
+		return decimal.Zero, err
+	}
+	return result.Total, nil
+}
+
+// deductionOrder returns the indexes of the buckets a deduction for model may draw from:
+// the model's own buckets first, then the general pool, each by earliest expiry.
+func deductionOrder(quotas []models.Quota, model string) []int {
+	order := make([]int, 0, len(quotas))
+	if model != "" {
+		for i := range quotas {
+			if quotas[i].Model == model {
+				order = append(order, i)
+			}
+		}
+	}
+	for i := range quotas {
+		if quotas[i].Model == "" {
+			order = append(order, i)
+		}
+	}
+	return order
+}
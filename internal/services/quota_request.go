@@ -0,0 +1,573 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quotaRequestSystemActor is the actor recorded for transitions made by the scheduler
+const quotaRequestSystemActor = "system"
+
+// CreateQuotaRequestRequest represents a user asking for quota, either from a colleague by ID or from
+// the approver configured for their department
+type CreateQuotaRequestRequest struct {
+	ApproverID        string         `json:"approver_id,omitempty" validate:"omitempty,uuid"`
+	ToDepartmentAdmin bool           `json:"to_department_admin,omitempty"`
+	Amount            decimal.Amount `json:"amount" validate:"required,gt=0"`
+	Reason            string         `json:"reason" validate:"required,max=255"`
+}
+
+// ApproveQuotaRequestRequest represents the approver's decision to transfer the requested quota.
+// Without a quota list, the approver's transferable quota is used from the earliest expiry date on.
+type ApproveQuotaRequestRequest struct {
+	QuotaList []TransferQuotaItem `json:"quota_list,omitempty" validate:"omitempty,dive"`
+	Note      string              `json:"note,omitempty" validate:"max=255"`
+}
+
+// DecideQuotaRequestRequest represents a rejection or cancellation with an optional note
+type DecideQuotaRequestRequest struct {
+	Note string `json:"note,omitempty" validate:"max=255"`
+}
+
+// QuotaRequestDetail is a quota request with its state transitions, oldest first
+type QuotaRequestDetail struct {
+	models.QuotaRequest
+	Events []models.QuotaRequestEvent `json:"events"`
+}
+
+// ApproveQuotaRequestResponse represents an approved request and the quota it transferred
+type ApproveQuotaRequestResponse struct {
+	Request   *models.QuotaRequest `json:"request"`
+	QuotaList []TransferQuotaItem  `json:"quota_list"`
+	Operation string               `json:"operation"`
+}
+
+// CreateQuotaRequest files a pending quota request. It expires after quota_request.ttl_hours.
+func (s *QuotaService) CreateQuotaRequest(requester *models.AuthUser, req *CreateQuotaRequestRequest) (*models.QuotaRequest, error) {
+	approverID := strings.TrimSpace(req.ApproverID)
+	department := ""
+	switch {
+	case approverID != "" && req.ToDepartmentAdmin:
+		return nil, NewValidationFailedError("approver_id and to_department_admin are mutually exclusive")
+	case req.ToDepartmentAdmin:
+		var err error
+		if department, approverID, err = s.departmentApprover(requester.ID); err != nil {
+			return nil, err
+		}
+	case approverID == "":
+		return nil, NewValidationFailedError("approver_id or to_department_admin is required")
+	}
+	if approverID == requester.ID {
+		return nil, NewValidationFailedError("cannot request quota from yourself")
+	}
+
+	cfg := s.configManager.GetDirect()
+	request := &models.QuotaRequest{
+		RequesterID: requester.ID,
+		ApproverID:  approverID,
+		Department:  department,
+		Amount:      req.Amount,
+		Reason:      req.Reason,
+		Status:      models.QuotaRequestStatusPending,
+		ExpiresAt:   time.Now().Truncate(time.Second).Add(cfg.QuotaRequest.GetTTL()),
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(request).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create quota request", err)
+	}
+	if err := recordQuotaRequestEvent(tx, request, "", requester.ID, ""); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit quota request", err)
+	}
+
+	s.notifyQuotaRequest(QuotaRequestCreatedEvent, request.ApproverID, request)
+	logger.Info("Quota request created",
+		zap.Int("request_id", request.ID),
+		zap.String("requester_id", request.RequesterID),
+		zap.String("approver_id", request.ApproverID),
+		zap.Stringer("amount", request.Amount))
+	return request, nil
+}
+
+// GetQuotaRequests lists requests the user sent, or with inbox set, requests waiting on the user.
+// An empty status lists every status when sent, and pending requests for the inbox.
+func (s *QuotaService) GetQuotaRequests(userID string, inbox bool, status string, page, pageSize int) ([]models.QuotaRequest, int64, error) {
+	query := s.db.DB.Model(&models.QuotaRequest{})
+	if inbox {
+		if status == "" {
+			status = models.QuotaRequestStatusPending
+		}
+		query = query.Where("approver_id = ?", userID)
+	} else {
+		query = query.Where("requester_id = ?", userID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, NewDatabaseError("count quota requests", err)
+	}
+	var requests []models.QuotaRequest
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&requests).Error; err != nil {
+		return nil, 0, NewDatabaseError("list quota requests", err)
+	}
+	return requests, total, nil
+}
+
+// GetQuotaRequest returns a request with its state transitions to its requester or approver
+func (s *QuotaService) GetQuotaRequest(userID string, id int) (*QuotaRequestDetail, error) {
+	var request models.QuotaRequest
+	if err := s.db.DB.First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get quota request", err)
+	}
+	if request.RequesterID != userID && request.ApproverID != userID {
+		// Do not reveal requests of other users
+		return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+	}
+
+	detail := &QuotaRequestDetail{QuotaRequest: request}
+	if err := s.db.DB.Where("request_id = ?", id).Order("id ASC").Find(&detail.Events).Error; err != nil {
+		return nil, NewDatabaseError("get quota request events", err)
+	}
+	return detail, nil
+}
+
+// ApproveQuotaRequest transfers the requested quota from the approver to the requester in one
+// transaction, with a TRANSFER_OUT and a TRANSFER_IN audit record linked to the request
+func (s *QuotaService) ApproveQuotaRequest(approver *models.AuthUser, id int, req *ApproveQuotaRequestRequest) (*ApproveQuotaRequestResponse, error) {
+	// The requester and amount never change, so the approver's transfer rule is checked and the
+	// requester's quota lock taken before locking the request
+	var pending models.QuotaRequest
+	if err := s.db.DB.First(&pending, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get quota request", err)
+	}
+	if pending.ApproverID != approver.ID {
+		return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+	}
+	rule, err := s.checkTransferPolicy(approver.ID, []outgoingTransfer{{ReceiverID: pending.RequesterID, Amount: pending.Amount}})
+	if err != nil {
+		return nil, err
+	}
+
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(approver.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, approver.ID, pending.RequesterID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	request, err := lockPendingQuotaRequest(tx, id, approver.ID, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if request.RequesterID != pending.RequesterID || request.Amount != pending.Amount {
+		tx.Rollback()
+		return nil, NewConflictError("quota request changed while it was being approved")
+	}
+	if err := s.checkTransferLimits(tx, rule, approver.ID, request.Amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	items := req.QuotaList
+	if len(items) == 0 {
+		if items, err = planQuotaRequestTransfer(tx, approver.ID, usedQuota, request.Amount); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else {
+		// Like planQuotaRequestTransfer, never hand out quota that is only left in the expiry grace period
+		now := time.Now()
+		total := decimal.Zero
+		for _, item := range items {
+			if !item.ExpiryDate.After(now) {
+				tx.Rollback()
+				return nil, NewValidationFailedError(fmt.Sprintf("quota expiring at %s has already expired", item.ExpiryDate.Format(time.RFC3339)))
+			}
+			total = total.Add(item.Amount)
+		}
+		if total != request.Amount {
+			tx.Rollback()
+			return nil, NewValidationFailedError(fmt.Sprintf("quota_list must add up to the requested amount %s, got %s", request.Amount, total))
+		}
+		if err := checkTransferable(tx, approver.ID, usedQuota, items); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := debitTransferQuota(tx, approver.ID, items); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	inItems := make([]models.QuotaAuditDetailItem, len(items))
+	outItems := make([]models.QuotaAuditDetailItem, len(items))
+	earliestExpiryDate := items[0].ExpiryDate
+	for i, item := range items {
+		bucket, err := addToQuotaBucket(tx, request.RequesterID, "", item.ExpiryDate, item.Amount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		outItems[i] = models.QuotaAuditDetailItem{
+			Amount:     item.Amount,
+			ExpiryDate: item.ExpiryDate.Format(time.RFC3339),
+			Status:     models.AuditStatusSuccess,
+		}
+		inItems[i] = models.QuotaAuditDetailItem{
+			Amount:        item.Amount,
+			ExpiryDate:    item.ExpiryDate.Format(time.RFC3339),
+			Status:        models.AuditStatusSuccess,
+			OriginalQuota: bucket.Amount.Sub(item.Amount),
+			NewQuota:      bucket.Amount,
+		}
+		if item.ExpiryDate.Before(earliestExpiryDate) {
+			earliestExpiryDate = item.ExpiryDate
+		}
+	}
+	if err := createQuotaRequestAudit(tx, approver.ID, request, request.Amount.Neg(), models.OperationTransferOut, request.RequesterID, earliestExpiryDate, outItems); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := createQuotaRequestAudit(tx, request.RequesterID, request, request.Amount, models.OperationTransferIn, approver.ID, earliestExpiryDate, inItems); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := enqueueQuotaDelta(tx, models.OperationTransferOut, approver.ID, "", request.Amount.Neg()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := enqueueQuotaDelta(tx, models.OperationTransferIn, request.RequesterID, "", request.Amount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := decideQuotaRequest(tx, request, models.QuotaRequestStatusApproved, approver.ID, req.Note); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit quota request approval", err)
+	}
+	s.outbox.DispatchUser(approver.ID)
+	s.outbox.DispatchUser(request.RequesterID)
+
+	s.notifyQuotaRequest(QuotaRequestApprovedEvent, request.RequesterID, request)
+	logger.Info("Quota request approved",
+		zap.Int("request_id", request.ID),
+		zap.String("requester_id", request.RequesterID),
+		zap.String("approver_id", approver.ID),
+		zap.Stringer("amount", request.Amount))
+	return &ApproveQuotaRequestResponse{
+		Request:   request,
+		QuotaList: items,
+		Operation: models.OperationTransferOut,
+	}, nil
+}
+
+// RejectQuotaRequest declines a pending request and notifies the requester
+func (s *QuotaService) RejectQuotaRequest(approver *models.AuthUser, id int, req *DecideQuotaRequestRequest) (*models.QuotaRequest, error) {
+	request, err := s.closeQuotaRequest(id, approver.ID, true, models.QuotaRequestStatusRejected, req.Note)
+	if err != nil {
+		return nil, err
+	}
+	s.notifyQuotaRequest(QuotaRequestRejectedEvent, request.RequesterID, request)
+	return request, nil
+}
+
+// CancelQuotaRequest withdraws a pending request on behalf of its requester
+func (s *QuotaService) CancelQuotaRequest(requester *models.AuthUser, id int, req *DecideQuotaRequestRequest) (*models.QuotaRequest, error) {
+	return s.closeQuotaRequest(id, requester.ID, false, models.QuotaRequestStatusCancelled, req.Note)
+}
+
+// ExpireQuotaRequests expires every pending request past its expiry and notifies the requesters
+func (s *QuotaService) ExpireQuotaRequests() error {
+	var requestIDs []int
+	if err := s.db.DB.Model(&models.QuotaRequest{}).
+		Where("status = ? AND expires_at <= ?", models.QuotaRequestStatusPending, time.Now()).
+		Pluck("id", &requestIDs).Error; err != nil {
+		return fmt.Errorf("failed to query expired quota requests: %w", err)
+	}
+
+	expired := 0
+	for _, requestID := range requestIDs {
+		request, err := s.expireQuotaRequest(requestID)
+		if err != nil {
+			logger.Error("Failed to expire quota request",
+				zap.Int("request_id", requestID),
+				zap.Error(err))
+			continue
+		}
+		if request != nil {
+			expired++
+			s.notifyQuotaRequest(QuotaRequestExpiredEvent, request.RequesterID, request)
+		}
+	}
+
+	logger.Info("Quota request expiry completed",
+		zap.Int("due", len(requestIDs)),
+		zap.Int("expired", expired))
+	return nil
+}
+
+// expireQuotaRequest expires one request. It returns nil when the request was decided concurrently.
+func (s *QuotaService) expireQuotaRequest(id int) (*models.QuotaRequest, error) {
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var request models.QuotaRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, id).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("get quota request", err)
+	}
+	if request.Status != models.QuotaRequestStatusPending {
+		tx.Rollback()
+		return nil, nil
+	}
+	if err := decideQuotaRequest(tx, &request, models.QuotaRequestStatusExpired, quotaRequestSystemActor, ""); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit quota request expiry", err)
+	}
+	return &request, nil
+}
+
+// closeQuotaRequest moves a pending request to status without transferring quota. The actor must be
+// the approver when asApprover is set, the requester otherwise.
+func (s *QuotaService) closeQuotaRequest(id int, actor string, asApprover bool, status, note string) (*models.QuotaRequest, error) {
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	request, err := lockPendingQuotaRequest(tx, id, actor, asApprover)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := decideQuotaRequest(tx, request, status, actor, note); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit quota request", err)
+	}
+
+	logger.Info("Quota request closed",
+		zap.Int("request_id", request.ID),
+		zap.String("status", status),
+		zap.String("actor", actor))
+	return request, nil
+}
+
+// lockPendingQuotaRequest locks a request that actor may decide. Requests of other users are reported
+// as not found, and requests past their expiry as no longer pending.
+func lockPendingQuotaRequest(tx *gorm.DB, id int, actor string, asApprover bool) (*models.QuotaRequest, error) {
+	var request models.QuotaRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get quota request", err)
+	}
+	owner := request.RequesterID
+	if asApprover {
+		owner = request.ApproverID
+	}
+	if owner != actor {
+		return nil, NewResourceNotFoundError("quota request", fmt.Sprintf("%d", id))
+	}
+	if request.Status != models.QuotaRequestStatusPending {
+		return nil, NewConflictError(fmt.Sprintf("quota request is %s", strings.ToLower(request.Status)))
+	}
+	if !time.Now().Before(request.ExpiresAt) {
+		return nil, NewConflictError("quota request has expired")
+	}
+	return &request, nil
+}
+
+// decideQuotaRequest moves a locked pending request to status and records the transition
+func decideQuotaRequest(tx *gorm.DB, request *models.QuotaRequest, status, actor, note string) error {
+	fromStatus := request.Status
+	decidedAt := time.Now().Truncate(time.Second)
+	request.Status = status
+	request.DecisionNote = note
+	request.DecidedAt = &decidedAt
+	if err := tx.Model(request).Updates(map[string]interface{}{
+		"status":        status,
+		"decision_note": note,
+		"decided_at":    decidedAt,
+	}).Error; err != nil {
+		return NewDatabaseError("update quota request", err)
+	}
+	return recordQuotaRequestEvent(tx, request, fromStatus, actor, note)
+}
+
+// recordQuotaRequestEvent records the transition of request from fromStatus to its current status
+func recordQuotaRequestEvent(tx *gorm.DB, request *models.QuotaRequest, fromStatus, actor, note string) error {
+	event := &models.QuotaRequestEvent{
+		RequestID:  request.ID,
+		FromStatus: fromStatus,
+		ToStatus:   request.Status,
+		Actor:      actor,
+		Note:       note,
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return NewDatabaseError("record quota request event", err)
+	}
+	return nil
+}
+
+// planQuotaRequestTransfer picks amount from the approver's transferable quota, earliest expiry first
+func planQuotaRequestTransfer(tx *gorm.DB, approverID string, usedQuota, amount decimal.Amount) ([]TransferQuotaItem, error) {
+	transferable, err := transferableQuota(tx, approverID, usedQuota)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var items []TransferQuotaItem
+	remaining := amount
+	for _, available := range transferable {
+		if !remaining.IsPositive() {
+			break
+		}
+		if !available.Amount.IsPositive() || !available.ExpiryDate.After(now) {
+			continue
+		}
+		take := decimal.Min(available.Amount, remaining)
+		items = append(items, TransferQuotaItem{Amount: take, ExpiryDate: available.ExpiryDate})
+		remaining = remaining.Sub(take)
+	}
+	if remaining.IsPositive() {
+		return nil, NewInsufficientQuotaError(amount.Sub(remaining), amount)
+	}
+	return items, nil
+}
+
+// createQuotaRequestAudit records one side of an approved request's transfer
+func createQuotaRequestAudit(tx *gorm.DB, userID string, request *models.QuotaRequest, amount decimal.Amount, operation, relatedUser string, expiryDate time.Time, items []models.QuotaAuditDetailItem) error {
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: operation,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        request.Amount,
+			TotalItems:         len(items),
+			SuccessfulItems:    len(items),
+			EarliestExpiryDate: expiryDate.Format(time.RFC3339),
+		},
+		Items: items,
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:      userID,
+		Amount:      amount,
+		Operation:   operation,
+		RelatedUser: relatedUser,
+		Reason:      request.Reason,
+		RequestID:   &request.ID,
+		ExpiryDate:  expiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return NewDatabaseError("create audit record", err)
+	}
+	return nil
+}
+
+// departmentApprover finds the approver configured for the requester's department, from the most
+// specific department up. An approver who is the requester is skipped.
+func (s *QuotaService) departmentApprover(requesterID string) (string, string, error) {
+	var user models.UserInfo
+	if err := s.db.AuthDB.Where("id = ?", requesterID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", NewResourceNotFoundError("department approver", requesterID)
+		}
+		return "", "", NewDatabaseError("get user", err)
+	}
+	var employee models.EmployeeDepartment
+	if err := s.db.DB.Where("employee_number = ?", user.EmployeeNumber).First(&employee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", NewResourceNotFoundError("department approver", requesterID)
+		}
+		return "", "", NewDatabaseError("get employee department", err)
+	}
+
+	approvers := s.configManager.GetDirect().QuotaRequest.DepartmentApprovers
+	departments := employee.GetDeptFullLevelNamesAsSlice()
+	for i := len(departments) - 1; i >= 0; i-- {
+		for _, approver := range approvers {
+			if approver.Department == departments[i] && approver.ApproverID != "" && approver.ApproverID != requesterID {
+				return departments[i], approver.ApproverID, nil
+			}
+		}
+	}
+	return "", "", NewResourceNotFoundError("department approver", requesterID)
+}
+
+// notifyQuotaRequest tells userID about a request transition. Failures are only logged.
+func (s *QuotaService) notifyQuotaRequest(event, userID string, request *models.QuotaRequest) {
+	notification := &QuotaRequestNotification{
+		Event:        event,
+		UserID:       userID,
+		RequestID:    request.ID,
+		RequesterID:  request.RequesterID,
+		ApproverID:   request.ApproverID,
+		Amount:       request.Amount,
+		Reason:       request.Reason,
+		DecisionNote: request.DecisionNote,
+		CreateTime:   time.Now(),
+	}
+	if err := s.requestNotifier.NotifyQuotaRequest(notification); err != nil {
+		logger.Error("Failed to send quota request notification",
+			zap.String("event", event),
+			zap.Int("request_id", request.ID),
+			zap.Error(err))
+	}
+}
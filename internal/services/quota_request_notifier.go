@@ -0,0 +1,80 @@
+package services
+
+import (
+	"net/http"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Quota request event types
+const (
+	QuotaRequestCreatedEvent  = "quota_request.created"  // Sent to the approver
+	QuotaRequestApprovedEvent = "quota_request.approved" // Sent to the requester
+	QuotaRequestRejectedEvent = "quota_request.rejected" // Sent to the requester
+	QuotaRequestExpiredEvent  = "quota_request.expired"  // Sent to the requester
+)
+
+// QuotaRequestNotification tells UserID that a quota request they are part of changed state
+type QuotaRequestNotification struct {
+	Event        string         `json:"event"`
+	UserID       string         `json:"user_id"` // Recipient of the notification
+	RequestID    int            `json:"request_id"`
+	RequesterID  string         `json:"requester_id"`
+	ApproverID   string         `json:"approver_id"`
+	Amount       decimal.Amount `json:"amount"`
+	Reason       string         `json:"reason"`
+	DecisionNote string         `json:"decision_note,omitempty"`
+	CreateTime   time.Time      `json:"create_time"`
+}
+
+// QuotaRequestNotifier delivers quota request notifications. Delivery is best effort, a returned
+// error is logged and the notification is not retried.
+type QuotaRequestNotifier interface {
+	NotifyQuotaRequest(notification *QuotaRequestNotification) error
+}
+
+// newQuotaRequestNotifier returns the webhook notifier when a webhook is configured, otherwise one that only logs
+func newQuotaRequestNotifier(cfg *config.QuotaRequestConfig) QuotaRequestNotifier {
+	if cfg.WebhookURL != "" {
+		return NewWebhookQuotaRequestNotifier(cfg)
+	}
+	return logQuotaRequestNotifier{}
+}
+
+// WebhookQuotaRequestNotifier posts quota request notifications as JSON to a configured URL
+type WebhookQuotaRequestNotifier struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewWebhookQuotaRequestNotifier creates a notifier posting to cfg.WebhookURL
+func NewWebhookQuotaRequestNotifier(cfg *config.QuotaRequestConfig) *WebhookQuotaRequestNotifier {
+	return &WebhookQuotaRequestNotifier{
+		url:        cfg.WebhookURL,
+		secret:     cfg.WebhookSecret,
+		httpClient: &http.Client{Timeout: cfg.GetTimeout()},
+	}
+}
+
+// NotifyQuotaRequest posts the notification, signed like expiry warnings
+func (n *WebhookQuotaRequestNotifier) NotifyQuotaRequest(notification *QuotaRequestNotification) error {
+	return postWebhookEvent(n.httpClient, n.url, n.secret, notification.Event, notification, "quota request notification")
+}
+
+// logQuotaRequestNotifier only logs notifications, used when no webhook is configured
+type logQuotaRequestNotifier struct{}
+
+func (logQuotaRequestNotifier) NotifyQuotaRequest(notification *QuotaRequestNotification) error {
+	logger.Info("Quota request notification",
+		zap.String("event", notification.Event),
+		zap.String("user_id", notification.UserID),
+		zap.Int("request_id", notification.RequestID),
+		zap.Stringer("amount", notification.Amount))
+	return nil
+}
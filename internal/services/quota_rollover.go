@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// rolloverPolicy is the expiry policy of one ExpireQuotas run
+type rolloverPolicy struct {
+	percent    int
+	cap        decimal.Amount
+	months     int
+	strategies map[int]models.QuotaStrategy // Strategies overriding the rollover percentage
+}
+
+// loadRolloverPolicy reads the configured policy and the strategies that override it
+func loadRolloverPolicy(db *gorm.DB, cfg *config.ExpiryPolicyConfig) (*rolloverPolicy, error) {
+	policy := &rolloverPolicy{
+		percent:    cfg.GetRolloverPercent(),
+		cap:        cfg.GetRolloverCap(),
+		months:     cfg.GetRolloverMonths(),
+		strategies: make(map[int]models.QuotaStrategy),
+	}
+
+	var strategies []models.QuotaStrategy
+	if err := db.Where("rollover_percent IS NOT NULL").Find(&strategies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get strategy rollover overrides: %w", err)
+	}
+	for _, strategy := range strategies {
+		policy.strategies[strategy.ID] = strategy
+	}
+	return policy, nil
+}
+
+// enabled reports whether any quota can roll over
+func (p *rolloverPolicy) enabled() bool {
+	if p.percent > 0 {
+		return true
+	}
+	for _, strategy := range p.strategies {
+		if *strategy.RolloverPercent > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloverPortion is the part of an expiring bucket that rolls over at one percentage
+type rolloverPortion struct {
+	amount  decimal.Amount
+	percent int
+}
+
+// rolloverQuotas carries part of the user's unused expired quota into new buckets and records a ROLLOVER
+// audit for each of them. expired must hold the buckets the user just lost, ordered by expiry date, and
+// usedQuota the user's used quota before expiry. Used quota is taken from the earliest buckets first,
+// as everywhere else, and within a bucket from the portions with the lowest rollover percentage first.
+// Quota granted by a strategy with an override rolls over at the strategy's percentage, quota that
+// already rolled over once does not roll over again, and everything else uses the policy percentage.
+// It returns the amount carried over.
+func (s *QuotaService) rolloverQuotas(tx *gorm.DB, policy *rolloverPolicy, userID string, expired []models.Quota, usedQuota decimal.Amount, now time.Time) (decimal.Amount, error) {
+	if !policy.enabled() || len(expired) == 0 {
+		return decimal.Zero, nil
+	}
+
+	expiryDates := make([]time.Time, 0, len(expired))
+	for _, quota := range expired {
+		expiryDates = append(expiryDates, quota.ExpiryDate)
+	}
+	attributed, err := attributeRolloverPortions(tx, policy, userID, expiryDates)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	carried := decimal.Zero
+	remaining := remainingAfterUsed(expired, usedQuota)
+	for i, quota := range expired {
+		if !remaining[i].IsPositive() {
+			continue
+		}
+
+		portions := append([]rolloverPortion(nil), attributed[rolloverBucketKey(quota.Model, quota.ExpiryDate)]...)
+		total := decimal.Zero
+		for _, portion := range portions {
+			total = total.Add(portion.amount)
+		}
+		if unattributed := quota.Amount.Sub(total); unattributed.IsPositive() {
+			portions = append(portions, rolloverPortion{amount: unattributed, percent: policy.percent})
+			total = quota.Amount
+		}
+		sort.SliceStable(portions, func(a, b int) bool { return portions[a].percent < portions[b].percent })
+
+		// Attributed grants the bucket no longer holds, such as transferred quota, count as consumed
+		consumed := total.Sub(remaining[i])
+		carry := decimal.Zero
+		for _, portion := range portions {
+			taken := decimal.Min(consumed, portion.amount)
+			consumed = consumed.Sub(taken)
+			carry = carry.Add(portion.amount.Sub(taken).Percent(int64(portion.percent)))
+		}
+		if policy.cap.IsPositive() {
+			carry = decimal.Min(carry, policy.cap.Sub(carried))
+		}
+		if !carry.IsPositive() {
+			continue
+		}
+
+		expiryDate := utils.CalculateRolloverExpiryDate(s.toConfigTimezone(quota.ExpiryDate), policy.months)
+		if !expiryDate.After(now) {
+			expiryDate = utils.CalculateRolloverExpiryDate(s.toConfigTimezone(now), policy.months)
+		}
+		if err := s.recordRollover(tx, userID, &quota, carry, expiryDate); err != nil {
+			return decimal.Zero, err
+		}
+		carried = carried.Add(carry)
+	}
+
+	if carried.IsPositive() {
+		logger.Info("Expired quota rolled over",
+			zap.String("user_id", userID),
+			zap.Stringer("amount", carried))
+	}
+	return carried, nil
+}
+
+// recordRollover adds amount to the user's bucket expiring at expiryDate and records the ROLLOVER audit
+func (s *QuotaService) recordRollover(tx *gorm.DB, userID string, from *models.Quota, amount decimal.Amount, expiryDate time.Time) error {
+	bucket, err := addToQuotaBucket(tx, userID, from.Model, expiryDate, amount)
+	if err != nil {
+		return err
+	}
+
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: models.OperationRollover,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        amount,
+			TotalItems:         1,
+			SuccessfulItems:    1,
+			EarliestExpiryDate: expiryDate.Format(time.RFC3339),
+		},
+		Items: []models.QuotaAuditDetailItem{
+			{
+				Amount:        amount,
+				ExpiryDate:    expiryDate.Format(time.RFC3339),
+				Status:        models.AuditStatusSuccess,
+				OriginalQuota: bucket.Amount.Sub(amount),
+				NewQuota:      bucket.Amount,
+			},
+		},
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:       userID,
+		Amount:       amount,
+		Operation:    models.OperationRollover,
+		StrategyName: "Credit 到期结转",
+		Reason:       "rolled over from quota expiring " + from.ExpiryDate.Format(time.RFC3339),
+		Model:        from.Model,
+		ExpiryDate:   expiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return fmt.Errorf("failed to create rollover audit record for user %s: %w", userID, err)
+	}
+	return nil
+}
+
+// attributeRolloverPortions returns, per bucket, the portions granted by strategies with a rollover override
+// and the portions that already rolled over once
+func attributeRolloverPortions(tx *gorm.DB, policy *rolloverPolicy, userID string, expiryDates []time.Time) (map[string][]rolloverPortion, error) {
+	attributed := make(map[string][]rolloverPortion)
+
+	if len(policy.strategies) > 0 {
+		strategyIDs := make([]int, 0, len(policy.strategies))
+		for id := range policy.strategies {
+			strategyIDs = append(strategyIDs, id)
+		}
+		var executions []models.QuotaExecute
+		if err := tx.Where("strategy_id IN ? AND status = ? AND expiry_date IN ?", strategyIDs, "completed", expiryDates).
+			Where("recipient_id = ? OR (COALESCE(recipient_id, '') = '' AND user_id = ?)", userID, userID).
+			Find(&executions).Error; err != nil {
+			return nil, fmt.Errorf("failed to get strategy executions: %w", err)
+		}
+		for _, execution := range executions {
+			strategy := policy.strategies[execution.StrategyID]
+			// Executions recorded before grants were tracked fall back to the strategy's current amount and model
+			amount, model := execution.Amount, execution.Model
+			if amount.IsZero() {
+				amount, model = strategy.Amount, strategy.Model
+			}
+			key := rolloverBucketKey(model, execution.ExpiryDate)
+			attributed[key] = append(attributed[key], rolloverPortion{amount: amount, percent: *strategy.RolloverPercent})
+		}
+	}
+
+	var rollovers []models.QuotaAudit
+	if err := tx.Where("user_id = ? AND operation = ? AND expiry_date IN ?", userID, models.OperationRollover, expiryDates).
+		Find(&rollovers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get rollover audit records: %w", err)
+	}
+	for _, rollover := range rollovers {
+		key := rolloverBucketKey(rollover.Model, rollover.ExpiryDate)
+		attributed[key] = append(attributed[key], rolloverPortion{amount: rollover.Amount, percent: 0})
+	}
+
+	return attributed, nil
+}
+
+// rolloverBucketKey identifies a bucket of one user by model and expiry date
+func rolloverBucketKey(model string, expiryDate time.Time) string {
+	return fmt.Sprintf("%s/%d", model, expiryDate.Unix())
+}
+
+// toConfigTimezone converts t to the configured timezone
+func (s *QuotaService) toConfigTimezone(t time.Time) time.Time {
+	return utils.ToConfigTimezone(s.configManager.GetDirect(), t)
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+)
+
+// maxBatchTransferReceivers limits how many receivers one batch transfer may have
+const maxBatchTransferReceivers = 100
+
+// BatchTransferOutRequest represents a transfer out to several receivers at once
+type BatchTransferOutRequest struct {
+	Receivers []BatchTransferReceiver `json:"receivers" validate:"required,min=1,dive"`
+}
+
+// BatchTransferReceiver represents one receiver of a batch transfer out
+type BatchTransferReceiver struct {
+	ReceiverID string              `json:"receiver_id" validate:"required,uuid"`
+	QuotaList  []TransferQuotaItem `json:"quota_list" validate:"required,min=1,dive"`
+}
+
+// BatchTransferOutResponse represents the vouchers issued by a batch transfer out
+type BatchTransferOutResponse struct {
+	Operation   string                `json:"operation"`
+	TotalAmount decimal.Amount        `json:"total_amount"`
+	Transfers   []TransferOutResponse `json:"transfers"`
+}
+
+// BatchTransferOut issues one voucher per receiver in a single transaction. Availability is checked once
+// for the combined amounts with the same rules as TransferOut, either every voucher is issued or none, and
+// the giver gets one TRANSFER_OUT audit record with an item per receiver and expiry date.
+func (s *QuotaService) BatchTransferOut(giver *models.AuthUser, req *BatchTransferOutRequest) (*BatchTransferOutResponse, error) {
+	if len(req.Receivers) > maxBatchTransferReceivers {
+		return nil, NewValidationFailedError(fmt.Sprintf("at most %d receivers can be given quota at once", maxBatchTransferReceivers))
+	}
+
+	// Combine the amounts per expiry date so availability is checked for the whole batch
+	seen := make(map[string]bool, len(req.Receivers))
+	var totals []TransferQuotaItem
+	transfers := make([]outgoingTransfer, len(req.Receivers))
+	batchAmount := decimal.Zero
+	for i := range req.Receivers {
+		receiver := &req.Receivers[i]
+		receiver.ReceiverID = strings.TrimSpace(receiver.ReceiverID)
+		if seen[receiver.ReceiverID] {
+			return nil, NewValidationFailedError(fmt.Sprintf("receiver %s is listed more than once", receiver.ReceiverID))
+		}
+		seen[receiver.ReceiverID] = true
+		transfers[i].ReceiverID = receiver.ReceiverID
+		for _, item := range receiver.QuotaList {
+			transfers[i].Amount = transfers[i].Amount.Add(item.Amount)
+			batchAmount = batchAmount.Add(item.Amount)
+			totals = append(totals, item)
+		}
+	}
+	totals = combineTransferItems(totals)
+
+	// Each receiver is checked against the giver's transfer rule, the limits count the whole batch
+	rule, err := s.checkTransferPolicy(giver.ID, transfers)
+	if err != nil {
+		return nil, err
+	}
+
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(giver.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, giver.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.checkTransferLimits(tx, rule, giver.ID, batchAmount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := checkTransferable(tx, giver.ID, usedQuota, totals); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var giverGithubStar string
+	var userInfo models.UserInfo
+	if err := s.db.AuthDB.Where("id = ?", giver.ID).First(&userInfo).Error; err == nil {
+		giverGithubStar = userInfo.GithubStar
+	}
+
+	resp := &BatchTransferOutResponse{
+		Operation: models.OperationTransferOut,
+		Transfers: make([]TransferOutResponse, 0, len(req.Receivers)),
+	}
+	auditDetails := &models.QuotaAuditDetails{Operation: models.OperationTransferOut}
+	for _, receiver := range req.Receivers {
+		voucherQuotaList := make([]VoucherQuotaItem, len(receiver.QuotaList))
+		for i, item := range receiver.QuotaList {
+			voucherQuotaList[i] = VoucherQuotaItem{
+				Amount:     item.Amount,
+				ExpiryDate: item.ExpiryDate,
+			}
+		}
+		voucherCode, err := s.issueVoucher(tx, &VoucherData{
+			GiverID:         giver.ID,
+			GiverName:       giver.Name,
+			GiverPhone:      giver.Phone,
+			GiverGithub:     giver.Github,
+			GiverGithubStar: giverGithubStar,
+			ReceiverID:      receiver.ReceiverID,
+			QuotaList:       voucherQuotaList,
+		})
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to generate voucher for receiver %s: %w", receiver.ReceiverID, err)
+		}
+
+		for _, item := range receiver.QuotaList {
+			resp.TotalAmount = resp.TotalAmount.Add(item.Amount)
+			auditDetails.Items = append(auditDetails.Items, models.QuotaAuditDetailItem{
+				Amount:      item.Amount,
+				ExpiryDate:  item.ExpiryDate.Format(time.RFC3339),
+				Status:      models.AuditStatusSuccess,
+				RelatedUser: receiver.ReceiverID,
+				VoucherCode: voucherCode,
+			})
+		}
+		resp.Transfers = append(resp.Transfers, TransferOutResponse{
+			VoucherCode: voucherCode,
+			RelatedUser: receiver.ReceiverID,
+			Operation:   models.OperationTransferOut,
+			QuotaList:   receiver.QuotaList,
+		})
+	}
+
+	if err := debitTransferQuota(tx, giver.ID, totals); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	earliestExpiryDate := totals[0].ExpiryDate
+	auditDetails.Summary = models.QuotaAuditSummary{
+		TotalAmount:        resp.TotalAmount,
+		TotalItems:         len(auditDetails.Items),
+		SuccessfulItems:    len(auditDetails.Items),
+		EarliestExpiryDate: earliestExpiryDate.Format(time.RFC3339),
+	}
+	// Vouchers and receivers are in the items, the record itself has no single voucher code
+	auditRecord := &models.QuotaAudit{
+		UserID:     giver.ID,
+		Amount:     resp.TotalAmount.Neg(),
+		Operation:  models.OperationTransferOut,
+		Reason:     fmt.Sprintf("batch transfer to %d receivers", len(req.Receivers)),
+		ExpiryDate: earliestExpiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create audit record: %w", err)
+	}
+
+	// One AiGateway update for the whole batch
+	if err := enqueueQuotaDelta(tx, models.OperationTransferOut, giver.ID, "", resp.TotalAmount.Neg()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit batch transfer", err)
+	}
+	s.outbox.DispatchUser(giver.ID)
+
+	return resp, nil
+}
+
+// batchTransferVouchers returns the vouchers issued by batch transfers since the given time, which are
+// recorded in the items of their audit record rather than its voucher_code column
+func (s *QuotaService) batchTransferVouchers(since time.Time) ([]issuedVoucher, error) {
+	var records []models.QuotaAudit
+	if err := s.db.DB.Select("id", "details", "create_time").
+		Where("operation = ? AND voucher_code = '' AND red_packet_id IS NULL AND details <> ''", models.OperationTransferOut).
+		Where("create_time >= ?", since).
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query batch transfers: %w", err)
+	}
+
+	var vouchers []issuedVoucher
+	for i := range records {
+		details, err := records[i].UnmarshalDetails()
+		if err != nil || details == nil {
+			continue
+		}
+		for _, item := range details.Items {
+			if item.VoucherCode != "" && (len(vouchers) == 0 || vouchers[len(vouchers)-1].VoucherCode != item.VoucherCode) {
+				vouchers = append(vouchers, issuedVoucher{VoucherCode: item.VoucherCode, CreateTime: records[i].CreateTime})
+			}
+		}
+	}
+	return vouchers, nil
+}
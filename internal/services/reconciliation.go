@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ReconciliationRequest describes a reconciliation run
+type ReconciliationRequest struct {
+	Mode        string   // models.ReconcileModeDryRun or models.ReconcileModeFix
+	UserIDs     []string // Limits the run to these users, empty for every user with quota or audit records
+	TriggeredBy string
+}
+
+// ReconciliationReportDetail is a report with its mismatches
+type ReconciliationReportDetail struct {
+	models.ReconciliationReport
+	Items []models.ReconciliationItem `json:"items"`
+}
+
+// userLedger holds the values compared for one user
+type userLedger struct {
+	dbQuota      decimal.Amount
+	gatewayQuota decimal.Amount
+	gatewayUsed  decimal.Amount
+	auditSum     decimal.Amount
+	pending      int64
+	gatewayErr   error // AiGateway could not be queried, the gateway values are unknown
+}
+
+// StartReconciliation creates a report and runs it in the background
+func (s *QuotaService) StartReconciliation(req *ReconciliationRequest) (*models.ReconciliationReport, error) {
+	report, err := s.createReconciliationReport(req)
+	if err != nil {
+		return nil, err
+	}
+	go s.executeReconciliation(report, req.UserIDs)
+	return report, nil
+}
+
+// RunReconciliation creates a report and runs it before returning
+func (s *QuotaService) RunReconciliation(req *ReconciliationRequest) (*models.ReconciliationReport, error) {
+	report, err := s.createReconciliationReport(req)
+	if err != nil {
+		return nil, err
+	}
+	s.executeReconciliation(report, req.UserIDs)
+	return report, nil
+}
+
+func (s *QuotaService) createReconciliationReport(req *ReconciliationRequest) (*models.ReconciliationReport, error) {
+	if req.Mode != models.ReconcileModeDryRun && req.Mode != models.ReconcileModeFix {
+		return nil, NewValidationFailedError(fmt.Sprintf("unknown reconciliation mode %s", req.Mode))
+	}
+
+	report := &models.ReconciliationReport{
+		Mode:        req.Mode,
+		Status:      models.ReconcileStatusRunning,
+		TriggeredBy: req.TriggeredBy,
+		UserIDs:     strings.Join(req.UserIDs, ","),
+		StartedAt:   time.Now(),
+	}
+	if err := s.db.DB.Create(report).Error; err != nil {
+		return nil, NewDatabaseError("create reconciliation report", err)
+	}
+	return report, nil
+}
+
+// executeReconciliation compares every user and records the mismatches on report. In FIX mode
+// AiGateway totals are refreshed from the quota table and the ledger gets a balancing audit entry.
+func (s *QuotaService) executeReconciliation(report *models.ReconciliationReport, userIDs []string) {
+	logger.Info("Starting quota reconciliation",
+		zap.Int("report_id", report.ID),
+		zap.String("mode", report.Mode))
+
+	if len(userIDs) == 0 {
+		var err error
+		if userIDs, err = s.reconciliationUsers(); err != nil {
+			s.finishReconciliation(report, err)
+			return
+		}
+	}
+
+	for _, userID := range userIDs {
+		items, err := s.reconcileUser(report.ID, userID)
+		if err != nil {
+			s.finishReconciliation(report, fmt.Errorf("failed to reconcile user %s: %w", userID, err))
+			return
+		}
+		report.TotalUsers++
+		if len(items) == 0 {
+			continue
+		}
+		report.MismatchedUsers++
+		report.Mismatches += len(items)
+
+		if report.Mode == models.ReconcileModeFix {
+			report.Fixed += s.fixReconciliationItems(report, userID, items)
+		}
+		if err := s.db.DB.Create(&items).Error; err != nil {
+			s.finishReconciliation(report, fmt.Errorf("failed to save mismatches of user %s: %w", userID, err))
+			return
+		}
+	}
+
+	s.finishReconciliation(report, nil)
+}
+
+// finishReconciliation stores the final counts and status of report
+func (s *QuotaService) finishReconciliation(report *models.ReconciliationReport, runErr error) {
+	now := time.Now()
+	report.FinishedAt = &now
+	report.Status = models.ReconcileStatusCompleted
+	if runErr != nil {
+		report.Status = models.ReconcileStatusFailed
+		report.Error = runErr.Error()
+		logger.Error("Quota reconciliation failed", zap.Int("report_id", report.ID), zap.Error(runErr))
+	}
+
+	if err := s.db.DB.Save(report).Error; err != nil {
+		logger.Error("Failed to save reconciliation report", zap.Int("report_id", report.ID), zap.Error(err))
+		return
+	}
+
+	logger.Info("Quota reconciliation completed",
+		zap.Int("report_id", report.ID),
+		zap.String("status", report.Status),
+		zap.Int("total_users", report.TotalUsers),
+		zap.Int("mismatches", report.Mismatches),
+		zap.Int("fixed", report.Fixed))
+}
+
+// reconciliationUsers returns every user with quota or audit records
+func (s *QuotaService) reconciliationUsers() ([]string, error) {
+	var userIDs []string
+	if err := s.db.DB.Raw("SELECT user_id FROM quota UNION SELECT user_id FROM quota_audit ORDER BY user_id").
+		Scan(&userIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get users to reconcile: %w", err)
+	}
+	return userIDs, nil
+}
+
+// reconcileUser compares the user's valid quota with AiGateway and the audit ledger and returns the mismatches
+func (s *QuotaService) reconcileUser(reportID int, userID string) ([]models.ReconciliationItem, error) {
+	ledger, err := s.loadUserLedger(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	newItem := func(category string, difference decimal.Amount, message string) models.ReconciliationItem {
+		return models.ReconciliationItem{
+			ReportID:          reportID,
+			UserID:            userID,
+			Category:          category,
+			DBQuota:           ledger.dbQuota,
+			GatewayQuota:      ledger.gatewayQuota,
+			GatewayUsed:       ledger.gatewayUsed,
+			AuditSum:          ledger.auditSum,
+			PendingOperations: ledger.pending,
+			Difference:        difference,
+			Message:           message,
+		}
+	}
+
+	var items []models.ReconciliationItem
+	if ledger.gatewayErr != nil {
+		items = append(items, newItem(models.ReconcileGatewayUnavailable, decimal.Zero, ledger.gatewayErr.Error()))
+	} else {
+		if diff := ledger.dbQuota.Sub(ledger.gatewayQuota); !diff.IsZero() {
+			items = append(items, newItem(models.ReconcileGatewayQuotaMismatch, diff, ""))
+		}
+		if diff := ledger.dbQuota.Sub(ledger.gatewayUsed); diff.IsNegative() {
+			items = append(items, newItem(models.ReconcileUsedExceedsQuota, diff, ""))
+		}
+	}
+	if diff := ledger.dbQuota.Sub(ledger.auditSum); !diff.IsZero() {
+		items = append(items, newItem(models.ReconcileAuditMismatch, diff, ""))
+	}
+	return items, nil
+}
+
+// loadUserLedger reads the compared values of one user. AiGateway values include deltas still
+// queued in the outbox. A failed AiGateway query is kept on the ledger so the audit ledger can still be checked.
+func (s *QuotaService) loadUserLedger(userID string) (*userLedger, error) {
+	ledger := &userLedger{}
+	var err error
+	if ledger.dbQuota, err = sumAmount(s.db.DB.Model(&models.Quota{}).
+		Where("user_id = ? AND status = ?", userID, models.StatusValid), "amount"); err != nil {
+		return nil, fmt.Errorf("failed to calculate valid quota: %w", err)
+	}
+	if ledger.auditSum, err = sumAmount(s.db.DB.Model(&models.QuotaAudit{}).
+		Where("user_id = ?", userID), "amount"); err != nil {
+		return nil, fmt.Errorf("failed to sum audit records: %w", err)
+	}
+	if err := s.db.DB.Model(&models.GatewayOutbox{}).
+		Where("user_id = ? AND status IN ?", userID, []string{models.OutboxStatusPending, models.OutboxStatusDead}).
+		Count(&ledger.pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to count outbox operations: %w", err)
+	}
+	pendingQuota, err := pendingGatewayDelta(s.db.DB, userID, models.OutboxDeltaQuota)
+	if err != nil {
+		return nil, err
+	}
+	pendingUsed, err := pendingGatewayDelta(s.db.DB, userID, models.OutboxDeltaUsedQuota)
+	if err != nil {
+		return nil, err
+	}
+
+	gatewayQuota, err := s.aiGatewayClient.QueryQuotaValue(userID)
+	if err != nil {
+		ledger.gatewayErr = fmt.Errorf("failed to get quota from AiGateway: %w", err)
+		return ledger, nil
+	}
+	gatewayUsed, err := s.aiGatewayClient.QueryUsedQuotaValue(userID)
+	if err != nil {
+		ledger.gatewayErr = fmt.Errorf("failed to get used quota from AiGateway: %w", err)
+		return ledger, nil
+	}
+	ledger.gatewayQuota = gatewayQuota.Add(pendingQuota)
+	ledger.gatewayUsed = gatewayUsed.Add(pendingUsed)
+	return ledger, nil
+}
+
+// fixReconciliationItems corrects the fixable mismatches of one user in a single transaction and
+// marks them fixed. It returns how many were fixed. The quota table is treated as the source of truth.
+func (s *QuotaService) fixReconciliationItems(report *models.ReconciliationReport, userID string, items []models.ReconciliationItem) int {
+	fixable := make([]*models.ReconciliationItem, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		switch item.Category {
+		case models.ReconcileGatewayQuotaMismatch:
+			if item.PendingOperations > 0 {
+				// A refresh would be undone by a later replay of these operations
+				item.Message = "not fixed, resolve the user's pending or dead outbox operations first"
+				continue
+			}
+			fixable = append(fixable, item)
+		case models.ReconcileAuditMismatch:
+			fixable = append(fixable, item)
+		default:
+			item.Message = "not fixed automatically, needs manual review"
+		}
+	}
+	if len(fixable) == 0 {
+		return 0
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, userID); err != nil {
+		tx.Rollback()
+		return 0
+	}
+
+	for _, item := range fixable {
+		if err := s.applyReconciliationFix(tx, report, item); err != nil {
+			tx.Rollback()
+			for _, failed := range fixable {
+				failed.Message = "fix failed: " + err.Error()
+			}
+			return 0
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		for _, failed := range fixable {
+			failed.Message = "fix failed: " + NewDatabaseError("commit reconciliation fix", err).Error()
+		}
+		return 0
+	}
+	s.outbox.DispatchUser(userID)
+
+	for _, item := range fixable {
+		item.Fixed = true
+	}
+	return len(fixable)
+}
+
+// applyReconciliationFix writes the correction and its RECONCILE audit record for one mismatch inside tx.
+// AiGateway totals are refreshed to the valid quota, the ledger gets an entry for the missing amount.
+func (s *QuotaService) applyReconciliationFix(tx *gorm.DB, report *models.ReconciliationReport, item *models.ReconciliationItem) error {
+	now := time.Now().Truncate(time.Second)
+	var amount, original, updated decimal.Amount
+	switch item.Category {
+	case models.ReconcileGatewayQuotaMismatch:
+		if err := enqueueGatewayOp(tx, models.OperationReconcile, item.UserID, models.OutboxRefreshQuota, "", item.DBQuota); err != nil {
+			return err
+		}
+		original, updated = item.GatewayQuota, item.DBQuota
+	case models.ReconcileAuditMismatch:
+		amount = item.Difference
+		original, updated = item.AuditSum, item.DBQuota
+	default:
+		return errors.New("mismatch category cannot be fixed")
+	}
+
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: models.OperationReconcile,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        amount,
+			TotalItems:         1,
+			SuccessfulItems:    1,
+			EarliestExpiryDate: now.Format(time.RFC3339),
+		},
+		Items: []models.QuotaAuditDetailItem{
+			{
+				Amount:        item.Difference,
+				ExpiryDate:    now.Format(time.RFC3339),
+				Status:        models.AuditStatusSuccess,
+				OriginalQuota: original,
+				NewQuota:      updated,
+			},
+		},
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:      item.UserID,
+		Amount:      amount,
+		Operation:   models.OperationReconcile,
+		Reason:      item.Category,
+		ReferenceID: strconv.Itoa(report.ID),
+		Operator:    report.TriggeredBy,
+		ExpiryDate:  now,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return NewDatabaseError("create audit record", err)
+	}
+	return nil
+}
+
+// GetReconciliationReports returns reconciliation reports, newest first
+func (s *QuotaService) GetReconciliationReports(page, pageSize int) ([]models.ReconciliationReport, int64, error) {
+	var total int64
+	if err := s.db.DB.Model(&models.ReconciliationReport{}).Count(&total).Error; err != nil {
+		return nil, 0, NewDatabaseError("count reconciliation reports", err)
+	}
+
+	reports := make([]models.ReconciliationReport, 0)
+	if err := s.db.DB.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).
+		Find(&reports).Error; err != nil {
+		return nil, 0, NewDatabaseError("list reconciliation reports", err)
+	}
+	return reports, total, nil
+}
+
+// GetReconciliationReport returns one report with all of its mismatches
+func (s *QuotaService) GetReconciliationReport(id int) (*ReconciliationReportDetail, error) {
+	var detail ReconciliationReportDetail
+	if err := s.db.DB.First(&detail.ReconciliationReport, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("reconciliation report", strconv.Itoa(id))
+		}
+		return nil, NewDatabaseError("get reconciliation report", err)
+	}
+
+	detail.Items = make([]models.ReconciliationItem, 0)
+	if err := s.db.DB.Where("report_id = ?", id).Order("user_id ASC, id ASC").
+		Find(&detail.Items).Error; err != nil {
+		return nil, NewDatabaseError("get reconciliation items", err)
+	}
+	return &detail, nil
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// minRedPacketShare is the smallest share of a red packet, random shares are multiples of it
+var minRedPacketShare = decimal.MustParse("0.01")
+
+// CreateRedPacketRequest represents a request to fund a red packet
+type CreateRedPacketRequest struct {
+	TotalAmount decimal.Amount `json:"total_amount" validate:"required,gt=0"`
+	MaxClaims   int            `json:"max_claims" validate:"required,min=1,max=1000"`
+	SplitMode   string         `json:"split_mode" validate:"required,oneof=equal random"`
+	ExpiryDate  time.Time      `json:"expiry_date" validate:"required"` // Expiry date of the giver's quota funding the pot
+}
+
+// ClaimRedPacketRequest represents a request to claim a share of a red packet
+type ClaimRedPacketRequest struct {
+	Code string `json:"code" validate:"required,min=10,max=30"`
+}
+
+// ClaimRedPacketResponse represents a claimed share of a red packet
+type ClaimRedPacketResponse struct {
+	RedPacketID     int            `json:"red_packet_id"`
+	GiverID         string         `json:"giver_id"`
+	Amount          decimal.Amount `json:"amount"`
+	ExpiryDate      time.Time      `json:"expiry_date"`
+	RemainingClaims int            `json:"remaining_claims"`
+	Operation       string         `json:"operation"`
+}
+
+// CreateRedPacket moves quota from the giver's bucket expiring at req.ExpiryDate into a new red packet.
+// Availability is checked with the same rules as TransferOut. The pot stays claimable for the voucher
+// TTL, but never past the expiry of its quota.
+func (s *QuotaService) CreateRedPacket(giver *models.AuthUser, req *CreateRedPacketRequest) (*models.RedPacket, error) {
+	if req.TotalAmount.LessThan(minRedPacketShare.Mul(int64(req.MaxClaims))) {
+		return nil, NewValidationFailedError(fmt.Sprintf("total_amount must allow at least %s per claim", minRedPacketShare))
+	}
+	now := time.Now().Truncate(time.Second)
+	if !req.ExpiryDate.After(now) {
+		return nil, NewValidationFailedError("expiry_date must be in the future")
+	}
+
+	// Claimants are only known at claim time, where they are checked against the giver's rule
+	rule, err := s.checkTransferPolicy(giver.ID, []outgoingTransfer{{Amount: req.TotalAmount}})
+	if err != nil {
+		return nil, err
+	}
+
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(giver.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, giver.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.checkTransferLimits(tx, rule, giver.ID, req.TotalAmount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	funding := []TransferQuotaItem{{Amount: req.TotalAmount, ExpiryDate: req.ExpiryDate}}
+	if err := checkTransferable(tx, giver.ID, usedQuota, funding); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := debitTransferQuota(tx, giver.ID, funding); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	code, err := newRedPacketCode(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	expiresAt := now.Add(s.configManager.GetDirect().Voucher.GetTTL())
+	if req.ExpiryDate.Before(expiresAt) {
+		expiresAt = req.ExpiryDate
+	}
+	packet := &models.RedPacket{
+		Code:            code,
+		GiverID:         giver.ID,
+		TotalAmount:     req.TotalAmount,
+		RemainingAmount: req.TotalAmount,
+		MaxClaims:       req.MaxClaims,
+		SplitMode:       req.SplitMode,
+		QuotaExpiryDate: req.ExpiryDate,
+		Status:          models.RedPacketStatusOpen,
+		ExpiresAt:       expiresAt,
+	}
+	if err := tx.Create(packet).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create red packet", err)
+	}
+
+	if err := createRedPacketAudit(tx, giver.ID, packet, req.TotalAmount.Neg(), models.OperationTransferOut, "", nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := enqueueQuotaDelta(tx, models.OperationTransferOut, giver.ID, "", req.TotalAmount.Neg()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit red packet", err)
+	}
+	s.outbox.DispatchUser(giver.ID)
+
+	logger.Info("Red packet created",
+		zap.Int("red_packet_id", packet.ID),
+		zap.String("giver_id", giver.ID),
+		zap.Stringer("amount", packet.TotalAmount),
+		zap.Int("max_claims", packet.MaxClaims))
+	return packet, nil
+}
+
+// ClaimRedPacket gives the user one share of the red packet. The claimant's quota lock is taken before
+// the pot row, in the same order as transfers, and the pot row is then locked for the rest of the claim,
+// so concurrent claims are applied one after another. The unique claim index keeps a user from claiming twice.
+func (s *QuotaService) ClaimRedPacket(user *models.AuthUser, req *ClaimRedPacketRequest) (*ClaimRedPacketResponse, error) {
+	code, ok := NormalizeShortVoucherCode(req.Code)
+	if !ok {
+		return nil, NewValidationFailedError("invalid red packet code")
+	}
+
+	// Look up the giver without locking, the giver of a packet never changes
+	var giverID string
+	if err := s.db.DB.Model(&models.RedPacket{}).Where("code = ?", code).Pluck("giver_id", &giverID).Error; err != nil {
+		return nil, NewDatabaseError("get red packet", err)
+	}
+	if giverID == "" {
+		return nil, NewResourceNotFoundError("red packet", code)
+	}
+	if giverID == user.ID {
+		return nil, NewValidationFailedError("the giver cannot claim their own red packet")
+	}
+
+	// Claimants are checked against the transfer rule applying to the giver now
+	rule, err := s.matchTransferRule(giverID)
+	if err != nil {
+		return nil, err
+	}
+	if rule != nil {
+		if err := s.checkTransferReceiver(rule, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, user.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var packet models.RedPacket
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&packet).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("red packet", code)
+		}
+		return nil, NewDatabaseError("get red packet", err)
+	}
+	if packet.Status != models.RedPacketStatusOpen {
+		tx.Rollback()
+		if packet.Status == models.RedPacketStatusExhausted {
+			return nil, NewConflictError("red packet has been fully claimed")
+		}
+		return nil, NewConflictError("red packet has expired")
+	}
+	if !time.Now().Before(packet.ExpiresAt) {
+		tx.Rollback()
+		return nil, NewConflictError("red packet has expired")
+	}
+
+	var claimed int64
+	if err := tx.Model(&models.RedPacketClaim{}).Where("red_packet_id = ? AND user_id = ?", packet.ID, user.ID).Count(&claimed).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("check red packet claim", err)
+	}
+	if claimed > 0 {
+		tx.Rollback()
+		return nil, NewConflictError("red packet has already been claimed by this user")
+	}
+
+	share := nextRedPacketShare(&packet)
+	if err := tx.Create(&models.RedPacketClaim{RedPacketID: packet.ID, UserID: user.ID, Amount: share}).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("record red packet claim", err)
+	}
+	packet.RemainingAmount = packet.RemainingAmount.Sub(share)
+	packet.ClaimCount++
+	if packet.ClaimCount >= packet.MaxClaims || !packet.RemainingAmount.IsPositive() {
+		packet.Status = models.RedPacketStatusExhausted
+	}
+	if err := tx.Model(&packet).Updates(map[string]interface{}{
+		"remaining_amount": packet.RemainingAmount,
+		"claim_count":      packet.ClaimCount,
+		"status":           packet.Status,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update red packet", err)
+	}
+
+	bucket, err := addToQuotaBucket(tx, user.ID, "", packet.QuotaExpiryDate, share)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := createRedPacketAudit(tx, user.ID, &packet, share, models.OperationTransferIn, packet.GiverID, bucket); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := enqueueQuotaDelta(tx, models.OperationTransferIn, user.ID, "", share); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit red packet claim", err)
+	}
+	s.outbox.DispatchUser(user.ID)
+
+	return &ClaimRedPacketResponse{
+		RedPacketID:     packet.ID,
+		GiverID:         packet.GiverID,
+		Amount:          share,
+		ExpiryDate:      packet.QuotaExpiryDate,
+		RemainingClaims: packet.MaxClaims - packet.ClaimCount,
+		Operation:       models.OperationTransferIn,
+	}, nil
+}
+
+// RefundExpiredRedPackets closes every open red packet past its expiry and refunds the unclaimed
+// remainder to the giver, unless the quota in the pot has expired as well
+func (s *QuotaService) RefundExpiredRedPackets() error {
+	var packetIDs []int
+	if err := s.db.DB.Model(&models.RedPacket{}).
+		Where("status = ? AND expires_at <= ?", models.RedPacketStatusOpen, time.Now()).
+		Pluck("id", &packetIDs).Error; err != nil {
+		return fmt.Errorf("failed to query expired red packets: %w", err)
+	}
+
+	refunded := 0
+	for _, packetID := range packetIDs {
+		packet, err := s.refundRedPacket(packetID)
+		if err != nil {
+			logger.Error("Failed to refund expired red packet",
+				zap.Int("red_packet_id", packetID),
+				zap.Error(err))
+			continue
+		}
+		if packet != nil && packet.Status == models.RedPacketStatusRefunded {
+			refunded++
+			logger.Info("Refunded expired red packet",
+				zap.Int("red_packet_id", packet.ID),
+				zap.String("giver_id", packet.GiverID),
+				zap.Stringer("amount", packet.RemainingAmount))
+		}
+	}
+
+	logger.Info("Expired red packet refund completed",
+		zap.Int("expired", len(packetIDs)),
+		zap.Int("refunded", refunded))
+	return nil
+}
+
+// refundRedPacket closes one expired red packet. It returns nil when the packet was closed concurrently.
+// The giver's quota lock is taken before the pot row, in the same order as claims and transfers.
+func (s *QuotaService) refundRedPacket(packetID int) (*models.RedPacket, error) {
+	var giverID string
+	if err := s.db.DB.Model(&models.RedPacket{}).Where("id = ?", packetID).Pluck("giver_id", &giverID).Error; err != nil {
+		return nil, NewDatabaseError("get red packet", err)
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, giverID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var packet models.RedPacket
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&packet, packetID).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("get red packet", err)
+	}
+	if packet.Status != models.RedPacketStatusOpen {
+		tx.Rollback()
+		return nil, nil
+	}
+
+	// Quota that expired in the pot would have expired in the giver's account as well
+	packet.Status = models.RedPacketStatusExpired
+	if packet.RemainingAmount.IsPositive() && time.Now().Before(packet.QuotaExpiryDate) {
+		bucket, err := addToQuotaBucket(tx, packet.GiverID, "", packet.QuotaExpiryDate, packet.RemainingAmount)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := createRedPacketAudit(tx, packet.GiverID, &packet, packet.RemainingAmount, models.OperationTransferRefund, "", bucket); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := enqueueQuotaDelta(tx, models.OperationTransferRefund, packet.GiverID, "", packet.RemainingAmount); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		packet.Status = models.RedPacketStatusRefunded
+	}
+	if err := tx.Model(&packet).Update("status", packet.Status).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update red packet", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit red packet refund", err)
+	}
+	if packet.Status == models.RedPacketStatusRefunded {
+		s.outbox.DispatchUser(packet.GiverID)
+	}
+	return &packet, nil
+}
+
+// nextRedPacketShare returns the amount of the next claim. The last claim takes the remainder. Equal
+// packets split the remainder evenly, random packets draw between the minimum share and twice the
+// average of what is left, in steps of the minimum share, leaving enough for the claims after it.
+func nextRedPacketShare(packet *models.RedPacket) decimal.Amount {
+	left := int64(packet.MaxClaims - packet.ClaimCount)
+	remaining := packet.RemainingAmount.Micros()
+	if left <= 1 {
+		return packet.RemainingAmount
+	}
+	if packet.SplitMode == models.RedPacketSplitEqual {
+		return decimal.FromMicros(remaining / left)
+	}
+
+	unit := minRedPacketShare.Micros()
+	maxUnits := min(2*remaining/left, remaining-(left-1)*unit) / unit
+	if maxUnits <= 1 {
+		return minRedPacketShare
+	}
+	return decimal.FromMicros((1 + rand.Int64N(maxUnits)) * unit)
+}
+
+// newRedPacketCode allocates an unused short code for a red packet
+func newRedPacketCode(tx *gorm.DB) (string, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		code, err := GenerateShortVoucherCode()
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		if err := tx.Model(&models.RedPacket{}).Where("code = ?", code).Count(&count).Error; err != nil {
+			return "", NewDatabaseError("check red packet code", err)
+		}
+		if count == 0 {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("failed to allocate a unique red packet code")
+}
+
+// createRedPacketAudit records a quota change of userID caused by the red packet. bucket is the
+// bucket the amount went into, nil when quota left the user.
+func createRedPacketAudit(tx *gorm.DB, userID string, packet *models.RedPacket, amount decimal.Amount, operation, relatedUser string, bucket *models.Quota) error {
+	item := models.QuotaAuditDetailItem{
+		Amount:     amount.Abs(),
+		ExpiryDate: packet.QuotaExpiryDate.Format(time.RFC3339),
+		Status:     models.AuditStatusSuccess,
+	}
+	if bucket != nil {
+		item.OriginalQuota = bucket.Amount.Sub(amount)
+		item.NewQuota = bucket.Amount
+	}
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: operation,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        amount.Abs(),
+			TotalItems:         1,
+			SuccessfulItems:    1,
+			EarliestExpiryDate: packet.QuotaExpiryDate.Format(time.RFC3339),
+		},
+		Items: []models.QuotaAuditDetailItem{item},
+	}
+	auditRecord := &models.QuotaAudit{
+		UserID:      userID,
+		Amount:      amount,
+		Operation:   operation,
+		RelatedUser: relatedUser,
+		RedPacketID: &packet.ID,
+		ExpiryDate:  packet.QuotaExpiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return NewDatabaseError("create red packet audit record", err)
+	}
+	return nil
+}
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// CreateReservationRequest represents a request to hold quota ahead of a deduction
+type CreateReservationRequest struct {
+	UserID      string         `json:"user_id" validate:"required,max=255"`
+	Amount      decimal.Amount `json:"amount" validate:"required,gt=0"`
+	TTLSeconds  int            `json:"ttl_seconds,omitempty" validate:"omitempty,min=1"` // Defaults to reservation.default_ttl_minutes
+	Reason      string         `json:"reason,omitempty" validate:"max=255"`
+	ReferenceID string         `json:"reference_id,omitempty" validate:"max=255"`
+}
+
+// CaptureReservationRequest represents a request to settle a hold as a deduction
+type CaptureReservationRequest struct {
+	Amount *decimal.Amount `json:"amount,omitempty" validate:"omitempty,gt=0"` // Defaults to the full held amount
+}
+
+// ReservationInfo represents a reservation with its per-bucket holds
+type ReservationInfo struct {
+	ID             int                      `json:"id"`
+	UserID         string                   `json:"user_id"`
+	Amount         decimal.Amount           `json:"amount"`
+	CapturedAmount decimal.Amount           `json:"captured_amount"`
+	Status         string                   `json:"status"`
+	Items          []models.ReservationItem `json:"items"`
+	Reason         string                   `json:"reason,omitempty"`
+	ReferenceID    string                   `json:"reference_id,omitempty"`
+	CreatedBy      string                   `json:"created_by"`
+	ExpiresAt      time.Time                `json:"expires_at"`
+	SettledAt      *time.Time               `json:"settled_at,omitempty"`
+	CreateTime     time.Time                `json:"create_time"`
+}
+
+// newReservationInfo converts a stored reservation for API responses
+func newReservationInfo(r *models.QuotaReservation) (*ReservationInfo, error) {
+	items, err := r.UnmarshalItems()
+	if err != nil {
+		return nil, err
+	}
+	return &ReservationInfo{
+		ID:             r.ID,
+		UserID:         r.UserID,
+		Amount:         r.Amount,
+		CapturedAmount: r.CapturedAmount,
+		Status:         r.Status,
+		Items:          items,
+		Reason:         r.Reason,
+		ReferenceID:    r.ReferenceID,
+		CreatedBy:      r.CreatedBy,
+		ExpiresAt:      r.ExpiresAt,
+		SettledAt:      r.SettledAt,
+		CreateTime:     r.CreateTime,
+	}, nil
+}
+
+// heldQuotaByExpiry sums the active holds of a user per general-pool bucket expiry date (unix seconds).
+// Holds past their TTL no longer count even before the release job settles them.
+func heldQuotaByExpiry(db *gorm.DB, userID string, now time.Time, excludeID int) (map[int64]decimal.Amount, decimal.Amount, error) {
+	var reservations []models.QuotaReservation
+	if err := db.Where("user_id = ? AND status = ? AND expires_at > ? AND id <> ?",
+		userID, models.ReservationStatusHeld, now, excludeID).Find(&reservations).Error; err != nil {
+		return nil, decimal.Zero, fmt.Errorf("failed to get active reservations: %w", err)
+	}
+
+	held := make(map[int64]decimal.Amount)
+	total := decimal.Zero
+	for i := range reservations {
+		items, err := reservations[i].UnmarshalItems()
+		if err != nil {
+			return nil, decimal.Zero, err
+		}
+		for _, item := range items {
+			held[item.ExpiryDate.Unix()] = held[item.ExpiryDate.Unix()].Add(item.Amount)
+			total = total.Add(item.Amount)
+		}
+	}
+	return held, total, nil
+}
+
+// CreateReservation holds quota against the earliest-expiring buckets of the user's general pool
+func (s *QuotaService) CreateReservation(caller string, req *CreateReservationRequest) (*ReservationInfo, error) {
+	reservationConfig := &s.configManager.GetDirect().Reservation
+	ttl := reservationConfig.GetDefaultTTL()
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > reservationConfig.GetMaxTTL() {
+		return nil, NewValidationFailedError(fmt.Sprintf("ttl_seconds must not exceed %d", int(reservationConfig.GetMaxTTL().Seconds())))
+	}
+
+	// Get used quota from AiGateway, it consumes the earliest buckets first
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	now := time.Now()
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Holds are allocated under the user's lock so they cannot overlap a concurrent deduction
+	if err := lockUserQuota(tx, req.UserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	var quotas []models.Quota
+	if err := tx.Where("user_id = ? AND status = ?", req.UserID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
+	}
+
+	held, _, err := heldQuotaByExpiry(tx, req.UserID, now, 0)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Allocate the hold from the earliest general buckets, after used quota and existing holds
+	items := make([]models.ReservationItem, 0)
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	remainingHold := req.Amount
+	totalAvailable := decimal.Zero
+	for i, quota := range quotas {
+		if quota.Model != "" {
+			continue
+		}
+		available := remaining[i].Sub(held[quota.ExpiryDate.Unix()])
+		if !available.IsPositive() {
+			continue
+		}
+		totalAvailable = totalAvailable.Add(available)
+
+		if remainingHold.IsPositive() {
+			holdFromThis := decimal.Min(remainingHold, available)
+			items = append(items, models.ReservationItem{Amount: holdFromThis, ExpiryDate: quota.ExpiryDate})
+			remainingHold = remainingHold.Sub(holdFromThis)
+		}
+	}
+	if remainingHold.IsPositive() {
+		tx.Rollback()
+		return nil, NewInsufficientQuotaError(totalAvailable, req.Amount)
+	}
+
+	reservation := &models.QuotaReservation{
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Status:      models.ReservationStatusHeld,
+		Reason:      req.Reason,
+		ReferenceID: req.ReferenceID,
+		CreatedBy:   caller,
+		ExpiresAt:   now.Add(ttl).Truncate(time.Second),
+	}
+	if err := reservation.MarshalItems(items); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(reservation).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create reservation", err)
+	}
+
+	// Holds do not change the balance, so the audit amount is zero and the held amount goes in the details
+	if err := s.createReservationAudit(tx, reservation, models.OperationReservationHold, decimal.Zero, items); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit reservation", err)
+	}
+
+	return newReservationInfo(reservation)
+}
+
+// GetReservation retrieves a reservation by ID
+func (s *QuotaService) GetReservation(id int) (*ReservationInfo, error) {
+	var reservation models.QuotaReservation
+	if err := s.db.DB.First(&reservation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("reservation", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get reservation", err)
+	}
+	return newReservationInfo(&reservation)
+}
+
+// CaptureReservation converts part or all of a hold into a deduction and releases the rest.
+// Held buckets are charged first, then the earliest remaining buckets.
+func (s *QuotaService) CaptureReservation(id int, req *CaptureReservationRequest) (*ReservationInfo, error) {
+	var reservation models.QuotaReservation
+	if err := s.db.DB.First(&reservation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("reservation", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get reservation", err)
+	}
+	if err := checkReservationHeld(&reservation, time.Now()); err != nil {
+		return nil, err
+	}
+
+	amount := reservation.Amount
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+	if amount.GreaterThan(reservation.Amount) {
+		return nil, NewValidationFailedError(fmt.Sprintf("capture amount %s exceeds held amount %s", amount, reservation.Amount))
+	}
+
+	items, err := reservation.UnmarshalItems()
+	if err != nil {
+		return nil, err
+	}
+
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(reservation.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get used quota: %w", err)
+	}
+
+	now := time.Now()
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, reservation.UserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Settle the hold first so a concurrent capture, release or expiry cannot settle it twice
+	settledAt := now.Truncate(time.Second)
+	result := tx.Model(&models.QuotaReservation{}).
+		Where("id = ? AND status = ?", id, models.ReservationStatusHeld).
+		Updates(map[string]interface{}{
+			"status":          models.ReservationStatusCaptured,
+			"captured_amount": amount,
+			"settled_at":      settledAt,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update reservation", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, NewConflictError("reservation is no longer held")
+	}
+
+	var quotas []models.Quota
+	if err := tx.Where("user_id = ? AND status = ?", reservation.UserID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get quota list: %w", err)
+	}
+
+	// Other holds keep their claim on the balance
+	otherHeld, _, err := heldQuotaByExpiry(tx, reservation.UserID, now, reservation.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	available := decimal.Zero
+	for i, quota := range quotas {
+		if quota.Model != "" {
+			continue
+		}
+		remaining[i] = decimal.Max(remaining[i].Sub(otherHeld[quota.ExpiryDate.Unix()]), decimal.Zero)
+		available = available.Add(remaining[i])
+	}
+	if available.LessThan(amount) {
+		tx.Rollback()
+		return nil, NewInsufficientQuotaError(available, amount)
+	}
+
+	heldOnBucket := make(map[int64]decimal.Amount, len(items))
+	for _, item := range items {
+		heldOnBucket[item.ExpiryDate.Unix()] = heldOnBucket[item.ExpiryDate.Unix()].Add(item.Amount)
+	}
+
+	// Charge held buckets first, then any general bucket from the earliest expiry
+	charged := make([]decimal.Amount, len(quotas))
+	remainingCharge := amount
+	for pass := 0; pass < 2 && remainingCharge.IsPositive(); pass++ {
+		for i, quota := range quotas {
+			if !remainingCharge.IsPositive() {
+				break
+			}
+			if quota.Model != "" {
+				continue
+			}
+			limit := remaining[i].Sub(charged[i])
+			if pass == 0 {
+				limit = decimal.Min(limit, heldOnBucket[quota.ExpiryDate.Unix()])
+			}
+			if !limit.IsPositive() {
+				continue
+			}
+			chargeFromThis := decimal.Min(remainingCharge, limit)
+			charged[i] = charged[i].Add(chargeFromThis)
+			remainingCharge = remainingCharge.Sub(chargeFromThis)
+		}
+	}
+
+	capturedItems := make([]models.ReservationItem, 0)
+	for i, quota := range quotas {
+		if !charged[i].IsPositive() {
+			continue
+		}
+		capturedItems = append(capturedItems, models.ReservationItem{Amount: charged[i], ExpiryDate: quota.ExpiryDate})
+		if left := quota.Amount.Sub(charged[i]); left.IsPositive() {
+			if err := tx.Model(&models.Quota{}).Where("id = ?", quota.ID).
+				Update("amount", left).Error; err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("failed to update quota: %w", err)
+			}
+		} else if err := tx.Delete(&models.Quota{}, quota.ID).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to delete zero quota records: %w", err)
+		}
+	}
+
+	if err := s.createReservationAudit(tx, &reservation, models.OperationReservationCapture, amount.Neg(), capturedItems); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := enqueueQuotaDelta(tx, models.OperationReservationCapture, reservation.UserID, "", amount.Neg()); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit reservation capture", err)
+	}
+	s.outbox.DispatchUser(reservation.UserID)
+
+	reservation.Status = models.ReservationStatusCaptured
+	reservation.CapturedAmount = amount
+	reservation.SettledAt = &settledAt
+	return newReservationInfo(&reservation)
+}
+
+// ReleaseReservation returns a hold to the available balance
+func (s *QuotaService) ReleaseReservation(id int) (*ReservationInfo, error) {
+	return s.settleReservation(id, models.ReservationStatusReleased, models.OperationReservationRelease)
+}
+
+// ReleaseExpiredReservations releases every hold that outlived its TTL
+func (s *QuotaService) ReleaseExpiredReservations() error {
+	var ids []int
+	if err := s.db.DB.Model(&models.QuotaReservation{}).
+		Where("status = ? AND expires_at <= ?", models.ReservationStatusHeld, time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to query expired reservations: %w", err)
+	}
+
+	released := 0
+	for _, id := range ids {
+		if _, err := s.settleReservation(id, models.ReservationStatusExpired, models.OperationReservationExpire); err != nil {
+			if serviceErr, ok := err.(*ServiceError); ok && serviceErr.Code == ErrorConflict {
+				// Captured or released between the query and the update
+				continue
+			}
+			logger.Error("Failed to release expired reservation", zap.Int("reservation_id", id), zap.Error(err))
+			continue
+		}
+		released++
+	}
+
+	logger.Info("Expired reservation release completed",
+		zap.Int("expired", len(ids)),
+		zap.Int("released", released))
+	return nil
+}
+
+// settleReservation moves a held reservation to status without charging it
+func (s *QuotaService) settleReservation(id int, status, operation string) (*ReservationInfo, error) {
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var reservation models.QuotaReservation
+	if err := tx.First(&reservation, id).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("reservation", fmt.Sprintf("%d", id))
+		}
+		return nil, NewDatabaseError("get reservation", err)
+	}
+
+	if reservation.Status != models.ReservationStatusHeld {
+		tx.Rollback()
+		return nil, NewConflictError(fmt.Sprintf("reservation is already %s", reservation.Status))
+	}
+
+	settledAt := time.Now().Truncate(time.Second)
+	result := tx.Model(&models.QuotaReservation{}).
+		Where("id = ? AND status = ?", id, models.ReservationStatusHeld).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"settled_at": settledAt,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update reservation", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, NewConflictError("reservation is no longer held")
+	}
+
+	items, err := reservation.UnmarshalItems()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.createReservationAudit(tx, &reservation, operation, decimal.Zero, items); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit reservation release", err)
+	}
+
+	reservation.Status = status
+	reservation.SettledAt = &settledAt
+	return newReservationInfo(&reservation)
+}
+
+// checkReservationHeld rejects reservations that can no longer be captured
+func checkReservationHeld(reservation *models.QuotaReservation, now time.Time) error {
+	if reservation.Status != models.ReservationStatusHeld {
+		return NewConflictError(fmt.Sprintf("reservation is already %s", reservation.Status))
+	}
+	if !now.Before(reservation.ExpiresAt) {
+		return NewConflictError(fmt.Sprintf("reservation expired at %s", reservation.ExpiresAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// createReservationAudit writes the audit record of a reservation state change.
+// amount is the balance change, the per-bucket amounts are recorded in the details.
+func (s *QuotaService) createReservationAudit(tx *gorm.DB, reservation *models.QuotaReservation, operation string, amount decimal.Amount, items []models.ReservationItem) error {
+	var earliestExpiryDate time.Time
+	itemsTotal := decimal.Zero
+	auditItems := make([]models.QuotaAuditDetailItem, len(items))
+	for i, item := range items {
+		if i == 0 || item.ExpiryDate.Before(earliestExpiryDate) {
+			earliestExpiryDate = item.ExpiryDate
+		}
+		itemsTotal = itemsTotal.Add(item.Amount)
+		auditItems[i] = models.QuotaAuditDetailItem{
+			Amount:     item.Amount,
+			ExpiryDate: item.ExpiryDate.Format(time.RFC3339),
+			Status:     models.AuditStatusSuccess,
+		}
+	}
+	if len(items) == 0 {
+		earliestExpiryDate = reservation.ExpiresAt
+	}
+
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: operation,
+		Summary: models.QuotaAuditSummary{
+			TotalAmount:        itemsTotal,
+			TotalItems:         len(items),
+			SuccessfulItems:    len(items),
+			EarliestExpiryDate: earliestExpiryDate.Format(time.RFC3339),
+		},
+		Items: auditItems,
+	}
+
+	reservationID := reservation.ID
+	auditRecord := &models.QuotaAudit{
+		UserID:        reservation.UserID,
+		Amount:        amount,
+		Operation:     operation,
+		Reason:        reservation.Reason,
+		ReferenceID:   reservation.ReferenceID,
+		ReservationID: &reservationID,
+		ExpiryDate:    earliestExpiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return NewDatabaseError("create audit record", err)
+	}
+	return nil
+}
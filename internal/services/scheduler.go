@@ -82,7 +82,48 @@ func (s *SchedulerService) Start() error {
 		return err
 	}
 
+	// Add expired voucher refund task - run at minute 30 of every hour
+	_, err = s.cron.AddFunc("0 30 * * * *", s.refundExpiredVouchersTask)
+	if err != nil {
+		logger.Error("Failed to add voucher refund task", zap.Error(err))
+		return err
+	}
+
+	// Add quota request expiry task - run at minute 15 of every hour
+	_, err = s.cron.AddFunc("0 15 * * * *", s.expireQuotaRequestsTask)
+	if err != nil {
+		logger.Error("Failed to add quota request expiry task", zap.Error(err))
+		return err
+	}
+
+	// Add expired reservation release task - run every minute
+	_, err = s.cron.AddFunc("0 * * * * *", s.releaseExpiredReservationsTask)
+	if err != nil {
+		logger.Error("Failed to add reservation release task", zap.Error(err))
+		return err
+	}
+
+	// Add balance snapshot task - run at 00:10 every day, after the day's operations have committed
+	_, err = s.cron.AddFunc("0 10 0 * * *", s.snapshotBalancesTask)
+	if err != nil {
+		logger.Error("Failed to add balance snapshot task", zap.Error(err))
+		return err
+	}
+
+	// Add expiry warning task when enabled
+	if s.config.ExpiryNotify.Enabled {
+		_, err = s.cron.AddFunc(s.config.ExpiryNotify.GetSchedule(), s.sendExpiryWarningsTask)
+		if err != nil {
+			logger.Error("Failed to add expiry warning task", zap.String("schedule", s.config.ExpiryNotify.GetSchedule()), zap.Error(err))
+			return err
+		}
+	}
+
 	s.cron.Start()
+
+	// Apply queued AiGateway operations in the background, retrying failed ones
+	s.quotaService.Outbox().Start()
+
 	logger.Info("Scheduler service started",
 		zap.String("single_strategy_scan_interval", scanInterval),
 		zap.String("mode", s.config.Server.Mode))
@@ -92,6 +133,7 @@ func (s *SchedulerService) Start() error {
 // Stop stops the scheduler service
 func (s *SchedulerService) Stop() {
 	s.cron.Stop()
+	s.quotaService.Outbox().Stop()
 	s.strategyService.StopCron()
 	s.employeeSyncService.StopCron()
 	logger.Info("Scheduler service stopped")
@@ -113,3 +155,87 @@ func (s *SchedulerService) expireQuotasTask() {
 func (s *SchedulerService) ExpireQuotasTask() {
 	s.expireQuotasTask()
 }
+
+// refundExpiredVouchersTask refunds vouchers and red packets that expired without being fully claimed
+func (s *SchedulerService) refundExpiredVouchersTask() {
+	logger.Info("Starting expired voucher refund task")
+
+	// Red packets are refunded even when the voucher refund fails
+	failed := false
+	if err := s.quotaService.RefundExpiredVouchers(); err != nil {
+		logger.Error("Failed to refund expired vouchers", zap.Error(err))
+		failed = true
+	}
+	if err := s.quotaService.RefundExpiredRedPackets(); err != nil {
+		logger.Error("Failed to refund expired red packets", zap.Error(err))
+		failed = true
+	}
+	if failed {
+		return
+	}
+
+	logger.Info("Expired voucher refund task completed")
+}
+
+// expireQuotaRequestsTask expires quota requests nobody decided on in time
+func (s *SchedulerService) expireQuotaRequestsTask() {
+	logger.Info("Starting quota request expiry task")
+
+	if err := s.quotaService.ExpireQuotaRequests(); err != nil {
+		logger.Error("Failed to expire quota requests", zap.Error(err))
+		return
+	}
+
+	logger.Info("Quota request expiry task completed")
+}
+
+// ExpireQuotaRequestsTask is a public wrapper for expireQuotaRequestsTask to allow external triggering
+func (s *SchedulerService) ExpireQuotaRequestsTask() {
+	s.expireQuotaRequestsTask()
+}
+
+// releaseExpiredReservationsTask releases quota holds that outlived their TTL
+func (s *SchedulerService) releaseExpiredReservationsTask() {
+	logger.Info("Starting expired reservation release task")
+
+	if err := s.quotaService.ReleaseExpiredReservations(); err != nil {
+		logger.Error("Failed to release expired reservations", zap.Error(err))
+		return
+	}
+
+	logger.Info("Expired reservation release task completed")
+}
+
+// sendExpiryWarningsTask warns users whose quota expires within the configured lead times
+func (s *SchedulerService) sendExpiryWarningsTask() {
+	logger.Info("Starting expiry warning task")
+
+	if _, err := s.quotaService.SendExpiryWarnings(); err != nil {
+		logger.Error("Failed to send expiry warnings", zap.Error(err))
+		return
+	}
+
+	logger.Info("Expiry warning task completed")
+}
+
+// SendExpiryWarningsTask is a public wrapper for sendExpiryWarningsTask to allow external triggering
+func (s *SchedulerService) SendExpiryWarningsTask() {
+	s.sendExpiryWarningsTask()
+}
+
+// snapshotBalancesTask records daily balance snapshots for balance history queries
+func (s *SchedulerService) snapshotBalancesTask() {
+	logger.Info("Starting balance snapshot task")
+
+	if _, err := s.quotaService.SnapshotBalances(); err != nil {
+		logger.Error("Failed to snapshot balances", zap.Error(err))
+		return
+	}
+
+	logger.Info("Balance snapshot task completed")
+}
+
+// SnapshotBalancesTask is a public wrapper for snapshotBalancesTask to allow external triggering
+func (s *SchedulerService) SnapshotBalancesTask() {
+	s.snapshotBalancesTask()
+}
@@ -15,6 +15,7 @@ import (
 
 	"database/sql"
 	"errors"
+	"net"
 
 	"github.com/robfig/cron/v3"
 	"go.uber.org/zap"
@@ -343,7 +344,7 @@ func isNetworkError(err error) bool {
 	}
 
 	// Check if it's a network connection related error
-	var netErr error
+	var netErr net.Error
 	if errors.As(err, &netErr) {
 		return true
 	}
@@ -512,20 +513,7 @@ func (s *StrategyService) executeRecharge(strategy *models.QuotaStrategy, user *
 	now := utils.NowInConfigTimezone(s.quotaService.GetConfigManager().GetDirect()).Truncate(time.Second)
 	expiryDate := utils.CalculateExpiryDate(now, strategy.ExpiryDays)
 
-	// 1. Record execution status as processing
-	execute := &models.QuotaExecute{
-		StrategyID:  strategy.ID,
-		User:        user.ID,
-		BatchNumber: batchNumber,
-		Status:      "processing",
-		ExpiryDate:  expiryDate,
-	}
-
-	if err := s.db.Create(execute).Error; err != nil {
-		return fmt.Errorf("failed to create execute record: %w", err)
-	}
-
-	// 2. Determine quota recipient
+	// 1. Determine quota recipient
 	var recipientUserID string // Quota recipient user ID
 	var relatedUserID string   // Related user for invitation strategies audit trail
 
@@ -543,6 +531,22 @@ func (s *StrategyService) executeRecharge(strategy *models.QuotaStrategy, user *
 		recipientUserID = user.ID
 	}
 
+	// 2. Record execution status as processing, with the grant so it can be reverted later
+	execute := &models.QuotaExecute{
+		StrategyID:  strategy.ID,
+		User:        user.ID,
+		BatchNumber: batchNumber,
+		Status:      "processing",
+		RecipientID: recipientUserID,
+		Amount:      strategy.Amount,
+		Model:       strategy.Model,
+		ExpiryDate:  expiryDate,
+	}
+
+	if err := s.db.Create(execute).Error; err != nil {
+		return fmt.Errorf("failed to create execute record: %w", err)
+	}
+
 	// 3. Add quota using QuotaService
 	// err := s.quotaService.AddQuotaForStrategy(recipientUserID, strategy.Amount, strategy.ID, strategy.Name)
 	err := s.quotaService.AddQuotaForStrategy(recipientUserID, strategy.Amount, strategy.ID, strategy.Name, &relatedUserID)
@@ -561,7 +565,7 @@ func (s *StrategyService) executeRecharge(strategy *models.QuotaStrategy, user *
 		zap.String("user", user.ID),
 		zap.String("recipient_user", recipientUserID),
 		zap.String("strategy", strategy.Name),
-		zap.Float64("amount", strategy.Amount),
+		zap.Stringer("amount", strategy.Amount),
 		zap.String("model", strategy.Model),
 		zap.Time("expiry_date", expiryDate))
 
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RevertStrategyRequest selects the executions of a strategy to revert, by batch number, time range or both
+type RevertStrategyRequest struct {
+	BatchNumber string     `json:"batch_number,omitempty" validate:"omitempty,max=20"`
+	From        *time.Time `json:"from,omitempty"` // Executions created at or after this time
+	To          *time.Time `json:"to,omitempty"`   // Executions created before this time
+	Reason      string     `json:"reason,omitempty" validate:"max=255"`
+	Preview     bool       `json:"preview"` // Report the clawback without changing anything
+}
+
+// StrategyRevertBucket represents what a revert takes from one quota bucket of a recipient
+type StrategyRevertBucket struct {
+	Model      string         `json:"model,omitempty"`
+	ExpiryDate time.Time      `json:"expiry_date"`
+	Granted    decimal.Amount `json:"granted"`  // Amount the reverted executions granted into the bucket
+	Clawback   decimal.Amount `json:"clawback"` // Part of the grant that is still unconsumed
+}
+
+// StrategyRevertUserResult represents the revert outcome for one recipient
+type StrategyRevertUserResult struct {
+	UserID     string                 `json:"user_id"`
+	Executions int                    `json:"executions"`
+	Granted    decimal.Amount         `json:"granted"`
+	Clawback   decimal.Amount         `json:"clawback"`
+	Buckets    []StrategyRevertBucket `json:"buckets"`
+	Success    bool                   `json:"success"`
+	AuditID    int                    `json:"audit_id,omitempty"`
+	Message    string                 `json:"message,omitempty"`
+}
+
+// RevertStrategyResponse represents the result or preview of a strategy revert
+type RevertStrategyResponse struct {
+	StrategyID    int                        `json:"strategy_id"`
+	StrategyName  string                     `json:"strategy_name"`
+	Preview       bool                       `json:"preview"`
+	Executions    int                        `json:"executions"`
+	TotalGranted  decimal.Amount             `json:"total_granted"`
+	TotalClawback decimal.Amount             `json:"total_clawback"`
+	Succeeded     int                        `json:"succeeded"`
+	Failed        int                        `json:"failed"`
+	Results       []StrategyRevertUserResult `json:"results"`
+}
+
+// strategyRevertTarget holds the completed executions of one recipient being reverted
+type strategyRevertTarget struct {
+	userID       string
+	executionIDs []int
+	buckets      []StrategyRevertBucket
+}
+
+// RevertStrategy claws back what the selected completed executions of a strategy granted and
+// recipients have not consumed yet, and marks those executions as reverted. Each recipient is
+// reverted in its own transaction. With Preview set, only the per-user clawback is reported.
+func (s *StrategyService) RevertStrategy(operator string, strategyID int, req *RevertStrategyRequest) (*RevertStrategyResponse, error) {
+	if req.BatchNumber == "" && req.From == nil && req.To == nil {
+		return nil, NewValidationFailedError("batch_number or a from/to time range is required")
+	}
+	if req.From != nil && req.To != nil && !req.To.After(*req.From) {
+		return nil, NewValidationFailedError("to must be after from")
+	}
+
+	var strategy models.QuotaStrategy
+	if err := s.db.First(&strategy, strategyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewResourceNotFoundError("strategy", strconv.Itoa(strategyID))
+		}
+		return nil, NewDatabaseError("get strategy", err)
+	}
+
+	query := s.db.Where("strategy_id = ? AND status = ?", strategyID, "completed")
+	if req.BatchNumber != "" {
+		query = query.Where("batch_number = ?", req.BatchNumber)
+	}
+	if req.From != nil {
+		query = query.Where("create_time >= ?", *req.From)
+	}
+	if req.To != nil {
+		query = query.Where("create_time < ?", *req.To)
+	}
+	var executions []models.QuotaExecute
+	if err := query.Order("id ASC").Find(&executions).Error; err != nil {
+		return nil, NewDatabaseError("query strategy executions", err)
+	}
+
+	targets := groupRevertTargets(&strategy, executions)
+	resp := &RevertStrategyResponse{
+		StrategyID:   strategy.ID,
+		StrategyName: strategy.Name,
+		Preview:      req.Preview,
+		Executions:   len(executions),
+		Results:      make([]StrategyRevertUserResult, 0, len(targets)),
+	}
+	for _, target := range targets {
+		result := s.quotaService.revertStrategyGrants(operator, &strategy, target, req.Reason, req.Preview)
+		resp.TotalGranted = resp.TotalGranted.Add(result.Granted)
+		if result.Success {
+			resp.Succeeded++
+			resp.TotalClawback = resp.TotalClawback.Add(result.Clawback)
+		} else {
+			resp.Failed++
+		}
+		resp.Results = append(resp.Results, *result)
+	}
+
+	if !req.Preview {
+		logger.Info("Strategy revert completed",
+			zap.Int("strategy_id", strategy.ID),
+			zap.String("strategy", strategy.Name),
+			zap.String("operator", operator),
+			zap.Int("executions", resp.Executions),
+			zap.Stringer("clawback", resp.TotalClawback),
+			zap.Int("failed", resp.Failed))
+	}
+
+	return resp, nil
+}
+
+// groupRevertTargets groups executions by recipient and the bucket they granted into.
+// Executions recorded before grants were tracked fall back to the trigger user and the strategy's current amount and model.
+func groupRevertTargets(strategy *models.QuotaStrategy, executions []models.QuotaExecute) []*strategyRevertTarget {
+	targets := make([]*strategyRevertTarget, 0)
+	byUser := make(map[string]*strategyRevertTarget)
+	for _, execution := range executions {
+		recipientID, amount, model := execution.RecipientID, execution.Amount, execution.Model
+		if amount.IsZero() {
+			amount, model = strategy.Amount, strategy.Model
+		}
+		if recipientID == "" {
+			recipientID = execution.User
+		}
+
+		target, ok := byUser[recipientID]
+		if !ok {
+			target = &strategyRevertTarget{userID: recipientID}
+			byUser[recipientID] = target
+			targets = append(targets, target)
+		}
+		target.executionIDs = append(target.executionIDs, execution.ID)
+
+		merged := false
+		for i := range target.buckets {
+			if target.buckets[i].Model == model && target.buckets[i].ExpiryDate.Equal(execution.ExpiryDate) {
+				target.buckets[i].Granted = target.buckets[i].Granted.Add(amount)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			target.buckets = append(target.buckets, StrategyRevertBucket{Model: model, ExpiryDate: execution.ExpiryDate, Granted: amount})
+		}
+	}
+	return targets
+}
+
+// revertStrategyGrants claws back one recipient's unconsumed strategy grants. Failures are reported in the result.
+func (s *QuotaService) revertStrategyGrants(operator string, strategy *models.QuotaStrategy, target *strategyRevertTarget, reason string, preview bool) *StrategyRevertUserResult {
+	result := &StrategyRevertUserResult{
+		UserID:     target.userID,
+		Executions: len(target.executionIDs),
+		Buckets:    target.buckets,
+	}
+	for _, bucket := range target.buckets {
+		result.Granted = result.Granted.Add(bucket.Granted)
+	}
+	fail := func(message string) *StrategyRevertUserResult {
+		for i := range result.Buckets {
+			result.Buckets[i].Clawback = decimal.Zero
+		}
+		result.Message = message
+		return result
+	}
+
+	usedQuota, err := s.aiGatewayClient.QueryUsedQuotaValue(target.userID)
+	if err != nil {
+		return fail(fmt.Sprintf("failed to get used quota: %v", err))
+	}
+
+	if preview {
+		if _, err := s.planStrategyClawback(s.db.DB, target, usedQuota); err != nil {
+			return fail(err.Error())
+		}
+		result.Clawback = sumClawback(target.buckets)
+		result.Success = true
+		return result
+	}
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, target.userID); err != nil {
+		tx.Rollback()
+		return fail(err.Error())
+	}
+
+	auditID, err := s.applyStrategyClawback(tx, operator, strategy, target, reason, usedQuota)
+	if err != nil {
+		tx.Rollback()
+		return fail(err.Error())
+	}
+	if err := tx.Commit().Error; err != nil {
+		return fail(NewDatabaseError("commit strategy revert", err).Error())
+	}
+	s.outbox.DispatchUser(target.userID)
+
+	result.Clawback = sumClawback(target.buckets)
+	result.AuditID = auditID
+	result.Success = true
+	return result
+}
+
+// planStrategyClawback sets each bucket's clawback to the part of its grant that is neither used nor held,
+// and returns the user's valid quota records matched to the buckets (nil where the bucket is gone or expired).
+func (s *QuotaService) planStrategyClawback(db *gorm.DB, target *strategyRevertTarget, usedQuota decimal.Amount) ([]*models.Quota, error) {
+	var quotas []models.Quota
+	if err := db.Where("user_id = ? AND status = ?", target.userID, models.StatusValid).
+		Order("expiry_date ASC").Find(&quotas).Error; err != nil {
+		return nil, NewDatabaseError("get quota list", err)
+	}
+	held, _, err := heldQuotaByExpiry(db, target.userID, time.Now(), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := remainingAfterUsed(quotas, usedQuota)
+	matched := make([]*models.Quota, len(target.buckets))
+	for i := range target.buckets {
+		bucket := &target.buckets[i]
+		bucket.Clawback = decimal.Zero
+		for j := range quotas {
+			if quotas[j].Model != bucket.Model || !quotas[j].ExpiryDate.Equal(bucket.ExpiryDate) {
+				continue
+			}
+			available := remaining[j]
+			if bucket.Model == "" {
+				available = available.Sub(held[quotas[j].ExpiryDate.Unix()])
+			}
+			bucket.Clawback = decimal.Max(decimal.Min(bucket.Granted, available), decimal.Zero)
+			matched[i] = &quotas[j]
+			break
+		}
+	}
+	return matched, nil
+}
+
+// applyStrategyClawback removes the planned clawback inside tx, marks the executions reverted,
+// writes the audit record and queues the change for AiGateway. It returns the audit record ID.
+func (s *QuotaService) applyStrategyClawback(tx *gorm.DB, operator string, strategy *models.QuotaStrategy, target *strategyRevertTarget, reason string, usedQuota decimal.Amount) (int, error) {
+	matched, err := s.planStrategyClawback(tx, target, usedQuota)
+	if err != nil {
+		return 0, err
+	}
+
+	// Guards against a concurrent revert of the same executions
+	update := tx.Model(&models.QuotaExecute{}).
+		Where("id IN ? AND status = ?", target.executionIDs, "completed").
+		Update("status", "reverted")
+	if update.Error != nil {
+		return 0, NewDatabaseError("update execution status", update.Error)
+	}
+	if update.RowsAffected != int64(len(target.executionIDs)) {
+		return 0, NewConflictError("executions were reverted concurrently")
+	}
+
+	totalClawback := decimal.Zero
+	modelDeltas := make(map[string]decimal.Amount)
+	auditModel := target.buckets[0].Model
+	earliestExpiryDate := target.buckets[0].ExpiryDate
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: models.OperationStrategyRevert,
+		Items:     make([]models.QuotaAuditDetailItem, len(target.buckets)),
+	}
+	for i, bucket := range target.buckets {
+		if bucket.Model != auditModel {
+			auditModel = ""
+		}
+		if bucket.ExpiryDate.Before(earliestExpiryDate) {
+			earliestExpiryDate = bucket.ExpiryDate
+		}
+
+		item := models.QuotaAuditDetailItem{
+			Amount:     bucket.Clawback.Neg(),
+			ExpiryDate: bucket.ExpiryDate.Format(time.RFC3339),
+			Status:     models.AuditStatusSuccess,
+		}
+		if quota := matched[i]; quota != nil && bucket.Clawback.IsPositive() {
+			item.OriginalQuota = quota.Amount
+			item.NewQuota = quota.Amount.Sub(bucket.Clawback)
+			if item.NewQuota.IsPositive() {
+				if err := tx.Model(&models.Quota{}).Where("id = ?", quota.ID).
+					Update("amount", item.NewQuota).Error; err != nil {
+					return 0, NewDatabaseError("update quota", err)
+				}
+			} else if err := tx.Delete(&models.Quota{}, quota.ID).Error; err != nil {
+				return 0, NewDatabaseError("delete zero quota records", err)
+			}
+			totalClawback = totalClawback.Add(bucket.Clawback)
+			if bucket.Model != "" {
+				modelDeltas[bucket.Model] = modelDeltas[bucket.Model].Sub(bucket.Clawback)
+			}
+		} else {
+			item.FailureReason = "Grant already consumed or expired"
+		}
+		auditDetails.Items[i] = item
+	}
+	auditDetails.Summary = models.QuotaAuditSummary{
+		TotalAmount:        totalClawback.Neg(),
+		TotalItems:         len(target.buckets),
+		SuccessfulItems:    len(target.buckets),
+		EarliestExpiryDate: earliestExpiryDate.Format(time.RFC3339),
+	}
+
+	strategyID := strategy.ID
+	auditRecord := &models.QuotaAudit{
+		UserID:       target.userID,
+		Amount:       totalClawback.Neg(),
+		Operation:    models.OperationStrategyRevert,
+		StrategyID:   &strategyID,
+		StrategyName: strategy.Name,
+		Reason:       reason,
+		Model:        auditModel,
+		Operator:     operator,
+		ExpiryDate:   earliestExpiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		return 0, fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		return 0, NewDatabaseError("create audit record", err)
+	}
+
+	if totalClawback.IsPositive() {
+		if err := enqueueGatewayOp(tx, models.OperationStrategyRevert, target.userID, models.OutboxDeltaQuota, "", totalClawback.Neg()); err != nil {
+			return 0, err
+		}
+		modelNames := make([]string, 0, len(modelDeltas))
+		for model := range modelDeltas {
+			modelNames = append(modelNames, model)
+		}
+		sort.Strings(modelNames)
+		for _, model := range modelNames {
+			if err := enqueueGatewayOp(tx, models.OperationStrategyRevert, target.userID, models.OutboxDeltaModelQuota, model, modelDeltas[model]); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return auditRecord.ID, nil
+}
+
+// sumClawback returns the total planned clawback of the buckets
+func sumClawback(buckets []StrategyRevertBucket) decimal.Amount {
+	total := decimal.Zero
+	for _, bucket := range buckets {
+		total = total.Add(bucket.Clawback)
+	}
+	return total
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+
+	"gorm.io/gorm"
+)
+
+// Transfer rule checks, reported in violations by their config keys
+const (
+	transferCheckDailyLimit        = "daily_limit"
+	transferCheckMonthlyLimit      = "monthly_limit"
+	transferCheckMaxSingleTransfer = "max_single_transfer"
+	transferCheckMinAccountAge     = "min_account_age_days"
+	transferCheckReceiverScope     = "receiver_scope"
+	transferCheckReceiverCondition = "receiver_condition"
+)
+
+// outgoingTransfer is the part of a transfer going to one receiver. ReceiverID is empty when the
+// receiver is not known yet, as for red packets.
+type outgoingTransfer struct {
+	ReceiverID string
+	Amount     decimal.Amount
+}
+
+// transferRule is the configured transfer rule applying to a giver
+type transferRule struct {
+	config.TransferRuleConfig
+	name  string
+	giver *models.UserInfo // nil when the giver is not a known user
+}
+
+// checkTransferPolicy checks transfers against the giver's transfer rule, except for the daily and monthly
+// limits, which checkTransferLimits checks under the giver's quota lock. It returns the applied rule, nil
+// when no rule applies to the giver.
+func (s *QuotaService) checkTransferPolicy(giverID string, transfers []outgoingTransfer) (*transferRule, error) {
+	rule, err := s.matchTransferRule(giverID)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+
+	if rule.MinAccountAgeDays > 0 {
+		minAge := time.Duration(rule.MinAccountAgeDays) * 24 * time.Hour
+		if rule.giver == nil || time.Since(rule.giver.CreatedAt) < minAge {
+			return nil, NewTransferPolicyError(rule.name, transferCheckMinAccountAge,
+				fmt.Sprintf("accounts must be at least %d days old to send quota", rule.MinAccountAgeDays))
+		}
+	}
+
+	maxSingle := rule.GetMaxSingleTransfer()
+	for _, transfer := range transfers {
+		if maxSingle.IsPositive() && transfer.Amount.GreaterThan(maxSingle) {
+			return nil, NewTransferPolicyError(rule.name, transferCheckMaxSingleTransfer,
+				fmt.Sprintf("at most %s can be sent to a receiver at once, got %s", maxSingle, transfer.Amount))
+		}
+		if transfer.ReceiverID != "" {
+			if err := s.checkTransferReceiver(rule, transfer.ReceiverID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rule, nil
+}
+
+// matchTransferRule returns the first transfer rule whose giver condition matches the giver, nil when none
+// does. Rules with a giver condition never match givers who are not known users.
+func (s *QuotaService) matchTransferRule(giverID string) (*transferRule, error) {
+	rules := s.configManager.GetDirect().TransferPolicy.Rules
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	giver, err := s.findUserInfo(giverID)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.GiverCondition != "" {
+			if giver == nil {
+				continue
+			}
+			match, err := s.calcUserCondition(giver, rule.GiverCondition)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate giver condition of transfer rule %q: %w", name, err)
+			}
+			if !match {
+				continue
+			}
+		}
+		return &transferRule{TransferRuleConfig: rule, name: name, giver: giver}, nil
+	}
+	return nil, nil
+}
+
+// checkTransferReceiver checks the receiver scope and condition of rule for one receiver
+func (s *QuotaService) checkTransferReceiver(rule *transferRule, receiverID string) error {
+	if rule.ReceiverScope == config.TransferScopeAny && rule.ReceiverCondition == "" {
+		return nil
+	}
+
+	check := transferCheckReceiverScope
+	if rule.ReceiverScope == config.TransferScopeAny {
+		check = transferCheckReceiverCondition
+	}
+	receiver, err := s.findUserInfo(receiverID)
+	if err != nil {
+		return err
+	}
+	if receiver == nil {
+		return NewTransferPolicyError(rule.name, check, fmt.Sprintf("receiver %s is not a known user", receiverID))
+	}
+
+	switch rule.ReceiverScope {
+	case config.TransferScopeAny:
+	case config.TransferScopeSameCompany:
+		if rule.giver == nil || receiver.Company == "" || receiver.Company != rule.giver.Company {
+			return NewTransferPolicyError(rule.name, transferCheckReceiverScope,
+				fmt.Sprintf("receiver %s is not in the giver's company", receiverID))
+		}
+	case config.TransferScopeSameDepartment:
+		same, err := s.sameDepartment(rule.giver, receiver)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return NewTransferPolicyError(rule.name, transferCheckReceiverScope,
+				fmt.Sprintf("receiver %s is not in the giver's department", receiverID))
+		}
+	default:
+		return fmt.Errorf("transfer rule %q has unknown receiver scope %q", rule.name, rule.ReceiverScope)
+	}
+
+	if rule.ReceiverCondition != "" {
+		match, err := s.calcUserCondition(receiver, rule.ReceiverCondition)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate receiver condition of transfer rule %q: %w", rule.name, err)
+		}
+		if !match {
+			return NewTransferPolicyError(rule.name, transferCheckReceiverCondition,
+				fmt.Sprintf("receiver %s does not match the receiver condition", receiverID))
+		}
+	}
+	return nil
+}
+
+// sameDepartment reports whether both users are synced employees of the same department
+func (s *QuotaService) sameDepartment(giver, receiver *models.UserInfo) (bool, error) {
+	if giver == nil || giver.EmployeeNumber == "" || receiver.EmployeeNumber == "" {
+		return false, nil
+	}
+	var employees []models.EmployeeDepartment
+	if err := s.db.DB.Where("employee_number IN ?", []string{giver.EmployeeNumber, receiver.EmployeeNumber}).
+		Find(&employees).Error; err != nil {
+		return false, NewDatabaseError("get employee departments", err)
+	}
+	departments := make(map[string]string, len(employees))
+	for _, employee := range employees {
+		departments[employee.EmployeeNumber] = employee.DeptFullLevelNames
+	}
+	giverDept, ok := departments[giver.EmployeeNumber]
+	return ok && giverDept != "" && giverDept == departments[receiver.EmployeeNumber], nil
+}
+
+// checkTransferLimits checks that sending amount more keeps the giver within the daily and monthly limits
+// of rule. Every TRANSFER_OUT counts, including vouchers later cancelled or refunded. Must be called under
+// the giver's quota lock so concurrent transfers are counted.
+func (s *QuotaService) checkTransferLimits(tx *gorm.DB, rule *transferRule, giverID string, amount decimal.Amount) error {
+	if rule == nil {
+		return nil
+	}
+
+	now := utils.NowInConfigTimezone(s.configManager.GetDirect())
+	limits := []struct {
+		check  string
+		period string
+		limit  decimal.Amount
+		since  time.Time
+	}{
+		{transferCheckDailyLimit, "today", rule.GetDailyLimit(), time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
+		{transferCheckMonthlyLimit, "this month", rule.GetMonthlyLimit(), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())},
+	}
+	for _, limit := range limits {
+		if !limit.limit.IsPositive() {
+			continue
+		}
+		sent, err := sumAmount(tx.Model(&models.QuotaAudit{}).
+			Where("user_id = ? AND operation = ? AND create_time >= ?", giverID, models.OperationTransferOut, limit.since), "amount")
+		if err != nil {
+			return NewDatabaseError("sum outgoing transfers", err)
+		}
+		if sent = sent.Neg(); sent.Add(amount).GreaterThan(limit.limit) {
+			return NewTransferPolicyError(rule.name, limit.check,
+				fmt.Sprintf("at most %s can be sent %s, %s already sent and %s requested", limit.limit, limit.period, sent, amount))
+		}
+	}
+	return nil
+}
+
+// findUserInfo returns the user from the auth database, nil when there is no such user
+func (s *QuotaService) findUserInfo(userID string) (*models.UserInfo, error) {
+	var user models.UserInfo
+	if err := s.db.AuthDB.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, NewDatabaseError("get user", err)
+	}
+	return &user, nil
+}
@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/pkg/decimal"
 )
 
 // VoucherData represents the data structure in voucher code
@@ -21,30 +24,119 @@ type VoucherData struct {
 	ReceiverID      string             `json:"receiver_id"`
 	QuotaList       []VoucherQuotaItem `json:"quota_list"`
 	Timestamp       int64              `json:"timestamp"`
+	ExpiresAt       int64              `json:"expires_at,omitempty"` // Unix time after which the voucher can no longer be redeemed
 }
 
 // VoucherQuotaItem represents quota item in voucher
 type VoucherQuotaItem struct {
-	Amount     float64   `json:"amount"`
-	ExpiryDate time.Time `json:"expiry_date"`
+	Amount     decimal.Amount `json:"amount"`
+	ExpiryDate time.Time      `json:"expiry_date"`
+}
+
+// minVoucherKeyLength is the minimum secret length for keyring signing keys
+const minVoucherKeyLength = 32
+
+// VoucherKeyring holds the keys used to sign and verify vouchers.
+// New vouchers are signed with the active key and carry its ID; vouchers without a key ID verify against the legacy key.
+type VoucherKeyring struct {
+	activeKeyID string
+	keys        map[string][]byte
+	legacyKey   []byte
+}
+
+// NewVoucherKeyring builds a keyring from voucher configuration
+func NewVoucherKeyring(cfg *config.VoucherConfig) (*VoucherKeyring, error) {
+	keyring := &VoucherKeyring{
+		activeKeyID: cfg.ActiveKeyID,
+		keys:        make(map[string][]byte, len(cfg.Keys)),
+	}
+	if cfg.SigningKey != "" {
+		keyring.legacyKey = []byte(cfg.SigningKey)
+	}
+
+	for _, key := range cfg.Keys {
+		if !isValidVoucherKeyID(key.ID) {
+			return nil, fmt.Errorf("invalid voucher key id %q: use letters, digits, '-', '_' or '.'", key.ID)
+		}
+		if _, exists := keyring.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate voucher key id: %s", key.ID)
+		}
+		if len(key.Secret) < minVoucherKeyLength {
+			return nil, fmt.Errorf("voucher key %s: secret must be at least %d bytes", key.ID, minVoucherKeyLength)
+		}
+		keyring.keys[key.ID] = []byte(key.Secret)
+	}
+
+	if keyring.activeKeyID != "" {
+		if _, ok := keyring.keys[keyring.activeKeyID]; !ok {
+			return nil, fmt.Errorf("active voucher key %s is not in the keyring", keyring.activeKeyID)
+		}
+	} else if keyring.legacyKey == nil {
+		return nil, fmt.Errorf("no voucher signing key configured")
+	}
+
+	return keyring, nil
+}
+
+// signingKey returns the key ID and secret for new vouchers, the ID is empty for the legacy key
+func (k *VoucherKeyring) signingKey() (string, []byte) {
+	if k.activeKeyID != "" {
+		return k.activeKeyID, k.keys[k.activeKeyID]
+	}
+	return "", k.legacyKey
+}
+
+// verificationKey looks up the secret for a key ID, an empty ID selects the legacy key
+func (k *VoucherKeyring) verificationKey(keyID string) ([]byte, error) {
+	if keyID == "" {
+		if k.legacyKey == nil {
+			return nil, fmt.Errorf("legacy vouchers are not accepted")
+		}
+		return k.legacyKey, nil
+	}
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown voucher key id: %s", keyID)
+	}
+	return key, nil
+}
+
+// isValidVoucherKeyID checks that a key ID cannot be confused with the voucher envelope separators
+func isValidVoucherKeyID(keyID string) bool {
+	if keyID == "" || len(keyID) > 64 {
+		return false
+	}
+	for _, r := range keyID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
 }
 
 // VoucherService handles voucher code generation and validation
 type VoucherService struct {
-	signingKey []byte
+	keyring *VoucherKeyring
+	ttl     time.Duration
+}
+
+// NewVoucherService creates a voucher service signing with a single legacy key
+func NewVoucherService(signingKey string, ttl time.Duration) *VoucherService {
+	return NewVoucherServiceWithKeyring(&VoucherKeyring{legacyKey: []byte(signingKey)}, ttl)
 }
 
-// NewVoucherService creates a new voucher service
-func NewVoucherService(signingKey string) *VoucherService {
+// NewVoucherServiceWithKeyring creates a voucher service backed by a keyring
+func NewVoucherServiceWithKeyring(keyring *VoucherKeyring, ttl time.Duration) *VoucherService {
 	return &VoucherService{
-		signingKey: []byte(signingKey),
+		keyring: keyring,
+		ttl:     ttl,
 	}
 }
 
-// GenerateVoucher generates a voucher code
+// GenerateVoucher generates a voucher code.
+// The signed envelope is "json|keyID|signature", or "json|signature" when signing with the legacy key.
 func (s *VoucherService) GenerateVoucher(data *VoucherData) (string, error) {
-	// Set timestamp
-	data.Timestamp = time.Now().Unix()
+	s.stamp(data)
 
 	// Serialize to JSON
 	jsonData, err := json.Marshal(data)
@@ -52,11 +144,16 @@ func (s *VoucherService) GenerateVoucher(data *VoucherData) (string, error) {
 		return "", fmt.Errorf("failed to marshal voucher data: %w", err)
 	}
 
-	// Generate HMAC signature
-	signature := s.generateSignature(jsonData)
+	// Sign the payload together with the key ID
+	keyID, key := s.keyring.signingKey()
+	payload := string(jsonData)
+	if keyID != "" {
+		payload += "|" + keyID
+	}
+	signature := generateSignature(key, []byte(payload))
 
-	// Combine JSON and signature with "|" separator
-	combined := string(jsonData) + "|" + hex.EncodeToString(signature)
+	// Combine payload and signature with "|" separator
+	combined := payload + "|" + hex.EncodeToString(signature)
 
 	// Base64URL encode
 	voucherCode := base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString([]byte(combined))
@@ -72,14 +169,28 @@ func (s *VoucherService) ValidateAndDecodeVoucher(voucherCode string) (*VoucherD
 		return nil, fmt.Errorf("failed to decode voucher code: %w", err)
 	}
 
-	// Split by "|"
-	parts := strings.Split(string(decoded), "|")
-	if len(parts) != 2 {
+	// The signature follows the last "|"
+	sep := strings.LastIndex(string(decoded), "|")
+	if sep < 0 {
 		return nil, fmt.Errorf("invalid voucher code format")
 	}
-
-	jsonData := []byte(parts[0])
-	signatureHex := parts[1]
+	payload := string(decoded[:sep])
+	signatureHex := string(decoded[sep+1:])
+
+	// JSON always ends with "}", anything after its last "|" is the key ID
+	jsonData := payload
+	keyID := ""
+	if !strings.HasSuffix(payload, "}") {
+		idSep := strings.LastIndex(payload, "|")
+		if idSep < 0 {
+			return nil, fmt.Errorf("invalid voucher code format")
+		}
+		jsonData = payload[:idSep]
+		keyID = payload[idSep+1:]
+		if !isValidVoucherKeyID(keyID) {
+			return nil, fmt.Errorf("invalid voucher key id")
+		}
+	}
 
 	// Decode signature
 	signature, err := hex.DecodeString(signatureHex)
@@ -87,24 +198,51 @@ func (s *VoucherService) ValidateAndDecodeVoucher(voucherCode string) (*VoucherD
 		return nil, fmt.Errorf("failed to decode signature: %w", err)
 	}
 
-	// Verify signature
-	expectedSignature := s.generateSignature(jsonData)
+	// Verify signature with the key the voucher was signed with
+	key, err := s.keyring.verificationKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	expectedSignature := generateSignature(key, []byte(payload))
 	if !hmac.Equal(signature, expectedSignature) {
 		return nil, fmt.Errorf("invalid voucher signature")
 	}
 
 	// Unmarshal JSON data
 	var data VoucherData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
+	if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal voucher data: %w", err)
 	}
 
 	return &data, nil
 }
 
+// stamp sets the issue timestamp and expiry, keeping an explicitly provided expiry
+func (s *VoucherService) stamp(data *VoucherData) {
+	now := time.Now()
+	data.Timestamp = now.Unix()
+	if data.ExpiresAt == 0 {
+		data.ExpiresAt = now.Add(s.ttl).Unix()
+	}
+}
+
+// ExpiryTime returns when the voucher stops being redeemable.
+// Vouchers issued before expiry was introduced expire one TTL after their timestamp.
+func (s *VoucherService) ExpiryTime(data *VoucherData) time.Time {
+	if data.ExpiresAt > 0 {
+		return time.Unix(data.ExpiresAt, 0)
+	}
+	return time.Unix(data.Timestamp, 0).Add(s.ttl)
+}
+
+// IsExpired checks if the voucher can no longer be redeemed at now
+func (s *VoucherService) IsExpired(data *VoucherData, now time.Time) bool {
+	return !now.Before(s.ExpiryTime(data))
+}
+
 // generateSignature generates HMAC-SHA256 signature
-func (s *VoucherService) generateSignature(data []byte) []byte {
-	h := hmac.New(sha256.New, s.signingKey)
+func generateSignature(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
 	h.Write(data)
 	return h.Sum(nil)
 }
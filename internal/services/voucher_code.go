@@ -0,0 +1,117 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/models"
+)
+
+const (
+	// shortVoucherCodeLength is the length of a short voucher code including its check character
+	shortVoucherCodeLength = 12
+
+	// shortVoucherAlphabet is Crockford's base32 alphabet, which leaves out I, L, O and U
+	shortVoucherAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// GenerateShortVoucherCode returns a random short voucher code: 11 base32 characters and a Luhn mod 32 check character
+func GenerateShortVoucherCode() (string, error) {
+	random := make([]byte, shortVoucherCodeLength-1)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate voucher code: %w", err)
+	}
+
+	code := make([]byte, 0, shortVoucherCodeLength)
+	for _, b := range random {
+		code = append(code, shortVoucherAlphabet[b%32])
+	}
+	code = append(code, shortVoucherCheckChar(string(code)))
+	return string(code), nil
+}
+
+// NormalizeShortVoucherCode canonicalizes user input into a short voucher code.
+// Case, spaces and dashes are ignored and I/L/O are read as 1/1/0. The check character must match.
+func NormalizeShortVoucherCode(input string) (string, bool) {
+	if len(input) > 2*shortVoucherCodeLength {
+		return "", false
+	}
+
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		switch r {
+		case '-', ' ':
+			continue
+		case 'I', 'L':
+			r = '1'
+		case 'O':
+			r = '0'
+		}
+		if !strings.ContainsRune(shortVoucherAlphabet, r) {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+
+	code := sb.String()
+	if len(code) != shortVoucherCodeLength {
+		return "", false
+	}
+	if shortVoucherCheckChar(code[:shortVoucherCodeLength-1]) != code[shortVoucherCodeLength-1] {
+		return "", false
+	}
+	return code, true
+}
+
+// shortVoucherCheckChar computes the Luhn mod 32 check character, which catches single typos and most swaps
+func shortVoucherCheckChar(payload string) byte {
+	const n = len(shortVoucherAlphabet)
+	factor := 2
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(shortVoucherAlphabet, payload[i])
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+	return shortVoucherAlphabet[(n-sum%n)%n]
+}
+
+// NewStoredVoucher builds a server-side voucher record under a fresh short code
+func (s *VoucherService) NewStoredVoucher(data *VoucherData) (*models.Voucher, error) {
+	s.stamp(data)
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal voucher data: %w", err)
+	}
+
+	code, err := GenerateShortVoucherCode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Voucher{
+		Code:       code,
+		GiverID:    data.GiverID,
+		ReceiverID: data.ReceiverID,
+		Payload:    string(payload),
+		Status:     models.VoucherStatusIssued,
+		ExpiresAt:  time.Unix(data.ExpiresAt, 0),
+	}, nil
+}
+
+// DecodeStoredVoucher decodes the payload of a server-side voucher record
+func (s *VoucherService) DecodeStoredVoucher(voucher *models.Voucher) (*VoucherData, error) {
+	var data VoucherData
+	if err := json.Unmarshal([]byte(voucher.Payload), &data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal voucher data: %w", err)
+	}
+	return &data, nil
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+	"quota-manager/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// TransferCancelRequest represents a giver-side voucher cancellation request
+type TransferCancelRequest struct {
+	VoucherCode string `json:"voucher_code" validate:"required,min=10,max=2000"`
+}
+
+// TransferCancelResponse represents the result of a cancellation or expiry refund
+type TransferCancelResponse struct {
+	VoucherCode string                `json:"voucher_code"`
+	RelatedUser string                `json:"related_user"`
+	Operation   string                `json:"operation"`
+	Amount      decimal.Amount        `json:"amount"`
+	QuotaList   []TransferQuotaResult `json:"quota_list"`
+	Status      TransferStatus        `json:"status"`
+	Message     string                `json:"message,omitempty"`
+}
+
+// CancelTransfer revokes an unredeemed voucher issued by giver and refunds its unexpired quota
+func (s *QuotaService) CancelTransfer(giver *models.AuthUser, req *TransferCancelRequest) (*TransferCancelResponse, error) {
+	voucherCode, voucherData, err := s.resolveVoucher(req.VoucherCode)
+	if err != nil {
+		return nil, NewValidationFailedError("invalid voucher code")
+	}
+
+	if voucherData.GiverID != giver.ID {
+		return nil, NewValidationFailedError("voucher was not issued by this user")
+	}
+
+	return s.refundVoucher(voucherCode, voucherData, models.VoucherStatusCancelled, models.OperationTransferCancel)
+}
+
+const (
+	// voucherRefundJob names the watermark of the voucher refund job
+	voucherRefundJob = "voucher_refund"
+	// voucherRefundOverlap is scanned again on every run, covering transfers that committed after the
+	// previous run started
+	voucherRefundOverlap = 10 * time.Minute
+)
+
+// issuedVoucher is a voucher code with the time its transfer was recorded
+type issuedVoucher struct {
+	VoucherCode string
+	CreateTime  time.Time
+}
+
+// RefundExpiredVouchers refunds every voucher that expired without being redeemed or cancelled. Only vouchers
+// issued since the job's watermark are scanned. The watermark then moves up to the oldest voucher still open,
+// so each run covers about one voucher TTL of transfers instead of the whole history.
+func (s *QuotaService) RefundExpiredVouchers() error {
+	since, err := s.jobWatermark(voucherRefundJob)
+	if err != nil {
+		return err
+	}
+	scanStart := time.Now()
+
+	var vouchers []issuedVoucher
+	if err := s.db.DB.Model(&models.QuotaAudit{}).
+		Select("voucher_code", "create_time").
+		Where("operation = ? AND voucher_code <> '' AND create_time >= ?", models.OperationTransferOut, since).
+		Where("NOT EXISTS (SELECT 1 FROM voucher_redemption r WHERE r.voucher_code = quota_audit.voucher_code)").
+		Scan(&vouchers).Error; err != nil {
+		return fmt.Errorf("failed to query unclaimed vouchers: %w", err)
+	}
+	batchVouchers, err := s.batchTransferVouchers(since)
+	if err != nil {
+		return err
+	}
+	if len(batchVouchers) > 0 {
+		batchVoucherCodes := make([]string, len(batchVouchers))
+		for i, voucher := range batchVouchers {
+			batchVoucherCodes[i] = voucher.VoucherCode
+		}
+		var claimed []string
+		if err := s.db.DB.Model(&models.VoucherRedemption{}).
+			Where("voucher_code IN ?", batchVoucherCodes).
+			Pluck("voucher_code", &claimed).Error; err != nil {
+			return fmt.Errorf("failed to query claimed batch vouchers: %w", err)
+		}
+		claimedSet := make(map[string]bool, len(claimed))
+		for _, code := range claimed {
+			claimedSet[code] = true
+		}
+		for _, voucher := range batchVouchers {
+			if !claimedSet[voucher.VoucherCode] {
+				vouchers = append(vouchers, voucher)
+			}
+		}
+	}
+
+	// Vouchers that are not expired yet, or failed to refund, are scanned again by the next run
+	processedUntil := scanStart.Add(-voucherRefundOverlap)
+	keepOpen := func(voucher issuedVoucher) {
+		if voucher.CreateTime.Before(processedUntil) {
+			processedUntil = voucher.CreateTime
+		}
+	}
+
+	now := time.Now()
+	refunded := 0
+	for _, voucher := range vouchers {
+		voucherCode := voucher.VoucherCode
+		_, voucherData, err := s.resolveVoucher(voucherCode)
+		if err != nil {
+			logger.Warn("Skipping undecodable voucher in refund job", zap.Error(err))
+			continue
+		}
+		if !s.voucherSvc.IsExpired(voucherData, now) {
+			keepOpen(voucher)
+			continue
+		}
+
+		resp, err := s.refundVoucher(voucherCode, voucherData, models.VoucherStatusRefunded, models.OperationTransferRefund)
+		if err != nil {
+			if serviceErr, ok := err.(*ServiceError); ok && serviceErr.Code == ErrorConflict {
+				// Redeemed or cancelled between the query and the refund
+				continue
+			}
+			logger.Error("Failed to refund expired voucher",
+				zap.String("giver_id", voucherData.GiverID),
+				zap.Error(err))
+			keepOpen(voucher)
+			continue
+		}
+
+		refunded++
+		logger.Info("Refunded expired voucher",
+			zap.String("giver_id", voucherData.GiverID),
+			zap.String("receiver_id", voucherData.ReceiverID),
+			zap.Stringer("amount", resp.Amount))
+	}
+
+	if processedUntil.After(since) {
+		if err := s.saveJobWatermark(voucherRefundJob, processedUntil); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Expired voucher refund completed",
+		zap.Int("unclaimed", len(vouchers)),
+		zap.Int("refunded", refunded))
+	return nil
+}
+
+// refundVoucher claims the voucher for its giver with claimStatus and returns the unexpired quota to the giver.
+// The unique voucher_code in voucher_redemption guarantees a voucher is either redeemed or refunded, never both.
+func (s *QuotaService) refundVoucher(voucherCode string, voucherData *VoucherData, claimStatus, operation string) (*TransferCancelResponse, error) {
+	giverID := voucherData.GiverID
+
+	tx := s.db.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := lockUserQuota(tx, giverID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	claim := &models.VoucherRedemption{
+		VoucherCode: voucherCode,
+		ReceiverID:  giverID,
+		Status:      claimStatus,
+	}
+	if err := tx.Create(claim).Error; err != nil {
+		tx.Rollback()
+		var existing models.VoucherRedemption
+		if lookupErr := s.db.DB.Where("voucher_code = ?", voucherCode).First(&existing).Error; lookupErr == nil {
+			return nil, NewConflictError(fmt.Sprintf("voucher has already been %s", voucherClaimDescription(existing.Status)))
+		}
+		return nil, NewDatabaseError("claim voucher", err)
+	}
+	storedStatus := models.VoucherStatusCancelled
+	if claimStatus == models.VoucherStatusRefunded {
+		storedStatus = models.VoucherStatusExpired
+	}
+	if err := markStoredVoucher(tx, voucherCode, storedStatus); err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("update voucher status", err)
+	}
+
+	now := utils.NowInConfigTimezone(s.configManager.GetDirect()).Truncate(time.Second)
+	totalAmount := decimal.Zero
+	refundedCount := 0
+	expiredCount := 0
+	quotaResults := make([]TransferQuotaResult, len(voucherData.QuotaList))
+	auditDetails := &models.QuotaAuditDetails{
+		Operation: operation,
+		Items:     make([]models.QuotaAuditDetailItem, len(voucherData.QuotaList)),
+	}
+	var earliestExpiryDate time.Time
+
+	for i, quotaItem := range voucherData.QuotaList {
+		if i == 0 || quotaItem.ExpiryDate.Before(earliestExpiryDate) {
+			earliestExpiryDate = quotaItem.ExpiryDate
+		}
+
+		isExpired := now.After(quotaItem.ExpiryDate.Truncate(time.Second))
+		quotaResults[i] = TransferQuotaResult{
+			Amount:     quotaItem.Amount,
+			ExpiryDate: quotaItem.ExpiryDate,
+			IsExpired:  isExpired,
+		}
+		auditDetails.Items[i] = models.QuotaAuditDetailItem{
+			Amount:     quotaItem.Amount,
+			ExpiryDate: quotaItem.ExpiryDate.Format(time.RFC3339),
+		}
+
+		if isExpired {
+			// Expired portions would have expired in the giver's account as well
+			reason := TransferFailureReasonExpired
+			quotaResults[i].FailureReason = &reason
+			auditDetails.Items[i].Status = models.AuditStatusExpired
+			auditDetails.Items[i].FailureReason = "Quota expired"
+			expiredCount++
+			continue
+		}
+
+		var existingQuota models.Quota
+		if err := tx.Where("user_id = ? AND model = '' AND expiry_date = ? AND status = ?",
+			giverID, quotaItem.ExpiryDate, models.StatusValid).First(&existingQuota).Error; err != nil {
+			newQuota := &models.Quota{
+				UserID:     giverID,
+				Amount:     quotaItem.Amount,
+				ExpiryDate: quotaItem.ExpiryDate,
+				Status:     models.StatusValid,
+			}
+			if err := tx.Create(newQuota).Error; err != nil {
+				tx.Rollback()
+				return nil, NewDatabaseError("refund quota", err)
+			}
+		} else {
+			if err := tx.Model(&existingQuota).Update("amount", existingQuota.Amount.Add(quotaItem.Amount)).Error; err != nil {
+				tx.Rollback()
+				return nil, NewDatabaseError("refund quota", err)
+			}
+		}
+
+		quotaResults[i].Success = true
+		auditDetails.Items[i].Status = models.AuditStatusSuccess
+		totalAmount = totalAmount.Add(quotaItem.Amount)
+		refundedCount++
+	}
+
+	auditDetails.Summary = models.QuotaAuditSummary{
+		TotalAmount:        totalAmount,
+		TotalItems:         len(voucherData.QuotaList),
+		SuccessfulItems:    refundedCount,
+		ExpiredItems:       expiredCount,
+		EarliestExpiryDate: earliestExpiryDate.Format(time.RFC3339),
+	}
+
+	auditRecord := &models.QuotaAudit{
+		UserID:      giverID,
+		Amount:      totalAmount,
+		Operation:   operation,
+		VoucherCode: voucherCode,
+		RelatedUser: voucherData.ReceiverID,
+		ExpiryDate:  earliestExpiryDate,
+	}
+	if err := auditRecord.MarshalDetails(auditDetails); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to marshal audit details: %w", err)
+	}
+	if err := tx.Create(auditRecord).Error; err != nil {
+		tx.Rollback()
+		return nil, NewDatabaseError("create audit record", err)
+	}
+
+	if err := enqueueQuotaDelta(tx, operation, giverID, "", totalAmount); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, NewDatabaseError("commit voucher refund", err)
+	}
+	s.outbox.DispatchUser(giverID)
+
+	status := TransferStatusSuccess
+	message := "All quota refunded to the giver"
+	if expiredCount > 0 {
+		status = TransferStatusPartialSuccess
+		message = fmt.Sprintf("%d of %d quota items refunded, %d expired", refundedCount, len(voucherData.QuotaList), expiredCount)
+	}
+
+	return &TransferCancelResponse{
+		VoucherCode: voucherCode,
+		RelatedUser: voucherData.ReceiverID,
+		Operation:   operation,
+		Amount:      totalAmount,
+		QuotaList:   quotaResults,
+		Status:      status,
+		Message:     message,
+	}, nil
+}
+
+// voucherClaimDescription describes a voucher claim status for error messages
+func voucherClaimDescription(status string) string {
+	switch status {
+	case models.VoucherStatusCancelled:
+		return "cancelled"
+	case models.VoucherStatusRefunded:
+		return "refunded"
+	default:
+		return "redeemed"
+	}
+}
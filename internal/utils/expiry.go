@@ -21,3 +21,9 @@ func CalculateExpiryDate(now time.Time, expiryDays *int) time.Time {
 		return time.Date(now.Year(), now.Month()+1, 0, 23, 59, 59, 0, now.Location())
 	}
 }
+
+// CalculateRolloverExpiryDate returns the expiry date of quota carried over from quota expiring at expiry:
+// the end of the month that is months after expiry's month, with time part fixed to 23:59:59
+func CalculateRolloverExpiryDate(expiry time.Time, months int) time.Time {
+	return time.Date(expiry.Year(), expiry.Month()+time.Month(months)+1, 0, 23, 59, 59, 0, expiry.Location())
+}
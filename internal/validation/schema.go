@@ -2,8 +2,11 @@ package validation
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
+	"quota-manager/pkg/decimal"
+
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
 )
@@ -43,6 +46,11 @@ func registerCustomValidators() {
 	// Register custom validators for permission management
 	schemaValidator.RegisterValidation("employee_number", validateEmployeeNumber)
 	schemaValidator.RegisterValidation("department_name", validateDepartmentName)
+
+	// Validate amounts by their micro-units so required and gt=0 behave as for numbers
+	schemaValidator.RegisterCustomTypeFunc(func(v reflect.Value) interface{} {
+		return v.Interface().(decimal.Amount).Micros()
+	}, decimal.Amount{})
 }
 
 // validateCron validates cron expression using our existing function
@@ -7,11 +7,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"time"
 
 	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
 )
 
 type Client struct {
@@ -31,8 +31,9 @@ type ResponseData struct {
 }
 
 type QuotaResponse struct {
-	Quota  float64 `json:"quota"`
-	UserID string  `json:"user_id"`
+	Quota  decimal.Amount `json:"quota"`
+	UserID string         `json:"user_id"`
+	Model  string         `json:"model,omitempty"`
 }
 
 type StarProjectsResponse struct {
@@ -71,20 +72,32 @@ func NewClient(baseURL, adminPath, authHeader, authValue string) *Client {
 }
 
 // RefreshQuota refreshes user quota with retry mechanism
-func (c *Client) RefreshQuota(userID string, quota float64) error {
+func (c *Client) RefreshQuota(userID string, quota decimal.Amount) error {
 	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
-		return struct{}{}, c.refreshQuotaImpl(userID, quota)
+		return struct{}{}, c.refreshQuotaImpl(userID, "", quota)
 	})
 	return err
 }
 
-// refreshQuotaImpl implements the actual RefreshQuota logic
-func (c *Client) refreshQuotaImpl(userID string, quota float64) error {
+// RefreshModelQuota sets the part of a user's quota restricted to a model with retry mechanism.
+// The total quota is not changed.
+func (c *Client) RefreshModelQuota(userID, model string, quota decimal.Amount) error {
+	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
+		return struct{}{}, c.refreshQuotaImpl(userID, model, quota)
+	})
+	return err
+}
+
+// refreshQuotaImpl implements the actual RefreshQuota logic, scoped to model when it is set
+func (c *Client) refreshQuotaImpl(userID, model string, quota decimal.Amount) error {
 	apiUrl := fmt.Sprintf("%s%s/refresh", c.BaseURL, c.AdminPath)
 
 	data := url.Values{}
 	data.Set("user_id", userID)
-	data.Set("quota", strconv.FormatFloat(quota, 'f', -1, 64))
+	data.Set("quota", quota.String())
+	if model != "" {
+		data.Set("model", model)
+	}
 
 	req, err := http.NewRequest("POST", apiUrl, strings.NewReader(data.Encode()))
 	if err != nil {
@@ -129,13 +142,23 @@ func (c *Client) refreshQuotaImpl(userID string, quota float64) error {
 // QueryQuota queries user quota with retry mechanism
 func (c *Client) QueryQuota(userID string) (*QuotaResponse, error) {
 	return utils.WithRetry(context.Background(), func() (*QuotaResponse, error) {
-		return c.queryQuotaImpl(userID)
+		return c.queryQuotaImpl(userID, "")
 	})
 }
 
-// queryQuotaImpl implements the actual QueryQuota logic
-func (c *Client) queryQuotaImpl(userID string) (*QuotaResponse, error) {
+// QueryModelQuota queries the part of a user's quota restricted to a model with retry mechanism
+func (c *Client) QueryModelQuota(userID, model string) (*QuotaResponse, error) {
+	return utils.WithRetry(context.Background(), func() (*QuotaResponse, error) {
+		return c.queryQuotaImpl(userID, model)
+	})
+}
+
+// queryQuotaImpl implements the actual QueryQuota logic, scoped to model when it is set
+func (c *Client) queryQuotaImpl(userID, model string) (*QuotaResponse, error) {
 	apiUrl := fmt.Sprintf("%s%s?user_id=%s", c.BaseURL, c.AdminPath, userID)
+	if model != "" {
+		apiUrl += "&model=" + url.QueryEscape(model)
+	}
 
 	req, err := http.NewRequest("GET", apiUrl, nil)
 	if err != nil {
@@ -182,26 +205,39 @@ func (c *Client) queryQuotaImpl(userID string) (*QuotaResponse, error) {
 	}
 
 	return &QuotaResponse{
-		Quota:  quota,
+		Quota:  decimal.FromFloat(quota),
 		UserID: userID,
+		Model:  model,
 	}, nil
 }
 
 // DeltaQuota increases or decreases user quota with retry mechanism
-func (c *Client) DeltaQuota(userID string, value float64) error {
+func (c *Client) DeltaQuota(userID string, value decimal.Amount) error {
+	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
+		return struct{}{}, c.deltaQuotaImpl(userID, "", value)
+	})
+	return err
+}
+
+// DeltaModelQuota increases or decreases the part of a user's quota restricted to a model with retry mechanism.
+// The total quota is not changed, callers push the same change with DeltaQuota.
+func (c *Client) DeltaModelQuota(userID, model string, value decimal.Amount) error {
 	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
-		return struct{}{}, c.deltaQuotaImpl(userID, value)
+		return struct{}{}, c.deltaQuotaImpl(userID, model, value)
 	})
 	return err
 }
 
-// deltaQuotaImpl implements the actual DeltaQuota logic
-func (c *Client) deltaQuotaImpl(userID string, value float64) error {
+// deltaQuotaImpl implements the actual DeltaQuota logic, scoped to model when it is set
+func (c *Client) deltaQuotaImpl(userID, model string, value decimal.Amount) error {
 	apiUrl := fmt.Sprintf("%s%s/delta", c.BaseURL, c.AdminPath)
 
 	data := url.Values{}
 	data.Set("user_id", userID)
-	data.Set("value", strconv.FormatFloat(value, 'f', -1, 64))
+	data.Set("value", value.String())
+	if model != "" {
+		data.Set("model", model)
+	}
 
 	req, err := http.NewRequest("POST", apiUrl, strings.NewReader(data.Encode()))
 	if err != nil {
@@ -243,18 +279,18 @@ func (c *Client) deltaQuotaImpl(userID string, value float64) error {
 }
 
 // QueryQuotaValue implements the QuotaQuerier interface with retry mechanism
-// Returns only the quota value as a float64
-func (c *Client) QueryQuotaValue(userID string) (float64, error) {
-	return utils.WithRetry(context.Background(), func() (float64, error) {
+// Returns only the quota value
+func (c *Client) QueryQuotaValue(userID string) (decimal.Amount, error) {
+	return utils.WithRetry(context.Background(), func() (decimal.Amount, error) {
 		return c.queryQuotaValueImpl(userID)
 	})
 }
 
 // queryQuotaValueImpl implements the actual QueryQuotaValue logic
-func (c *Client) queryQuotaValueImpl(userID string) (float64, error) {
+func (c *Client) queryQuotaValueImpl(userID string) (decimal.Amount, error) {
 	resp, err := c.QueryQuota(userID)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	return resp.Quota, nil
 }
@@ -589,20 +625,20 @@ func (c *Client) setUserQuotaCheckPermissionImpl(employeeNumber string, enabled
 }
 
 // QueryUsedQuotaValue queries user used quota value with retry mechanism
-// Returns only the used quota value as a float64
-func (c *Client) QueryUsedQuotaValue(userID string) (float64, error) {
-	return utils.WithRetry(context.Background(), func() (float64, error) {
+// Returns only the used quota value
+func (c *Client) QueryUsedQuotaValue(userID string) (decimal.Amount, error) {
+	return utils.WithRetry(context.Background(), func() (decimal.Amount, error) {
 		return c.queryUsedQuotaValueImpl(userID)
 	})
 }
 
 // queryUsedQuotaValueImpl implements the actual QueryUsedQuotaValue logic
-func (c *Client) queryUsedQuotaValueImpl(userID string) (float64, error) {
+func (c *Client) queryUsedQuotaValueImpl(userID string) (decimal.Amount, error) {
 	apiUrl := fmt.Sprintf("%s%s/used?user_id=%s", c.BaseURL, c.AdminPath, userID)
 
 	req, err := http.NewRequest("GET", apiUrl, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
+		return decimal.Zero, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set admin key header if configured
@@ -612,22 +648,22 @@ func (c *Client) queryUsedQuotaValueImpl(userID string) (float64, error) {
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute request: %w", err)
+		return decimal.Zero, fmt.Errorf("failed to execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %w", err)
+		return decimal.Zero, fmt.Errorf("failed to read response: %w", err)
 	}
 
 	var respData ResponseData
 	if err := json.Unmarshal(body, &respData); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal response: %w", err)
+		return decimal.Zero, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
 	if !respData.Success {
-		return 0, &utils.HTTPError{
+		return decimal.Zero, &utils.HTTPError{
 			StatusCode: resp.StatusCode,
 			Message:    fmt.Sprintf("AI Gateway error: %s - %s", respData.Code, respData.Message),
 		}
@@ -636,19 +672,19 @@ func (c *Client) queryUsedQuotaValueImpl(userID string) (float64, error) {
 	// Parse the data field
 	dataMap, ok := respData.Data.(map[string]interface{})
 	if !ok {
-		return 0, fmt.Errorf("invalid response data format")
+		return decimal.Zero, fmt.Errorf("invalid response data format")
 	}
 
 	quota, ok := dataMap["quota"].(float64)
 	if !ok {
-		return 0, fmt.Errorf("invalid quota format in response")
+		return decimal.Zero, fmt.Errorf("invalid quota format in response")
 	}
 
-	return quota, nil
+	return decimal.FromFloat(quota), nil
 }
 
 // DeltaUsedQuota increases or decreases user used quota with retry mechanism
-func (c *Client) DeltaUsedQuota(userID string, value float64) error {
+func (c *Client) DeltaUsedQuota(userID string, value decimal.Amount) error {
 	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
 		return struct{}{}, c.deltaUsedQuotaImpl(userID, value)
 	})
@@ -656,12 +692,12 @@ func (c *Client) DeltaUsedQuota(userID string, value float64) error {
 }
 
 // deltaUsedQuotaImpl implements the actual DeltaUsedQuota logic
-func (c *Client) deltaUsedQuotaImpl(userID string, value float64) error {
+func (c *Client) deltaUsedQuotaImpl(userID string, value decimal.Amount) error {
 	apiUrl := fmt.Sprintf("%s%s/used/delta", c.BaseURL, c.AdminPath)
 
 	data := url.Values{}
 	data.Set("user_id", userID)
-	data.Set("value", strconv.FormatFloat(value, 'f', -1, 64))
+	data.Set("value", value.String())
 
 	req, err := http.NewRequest("POST", apiUrl, strings.NewReader(data.Encode()))
 	if err != nil {
@@ -703,7 +739,7 @@ func (c *Client) deltaUsedQuotaImpl(userID string, value float64) error {
 }
 
 // RefreshUsedQuota refreshes user's used quota (sets an absolute value) with retry mechanism
-func (c *Client) RefreshUsedQuota(userID string, quota float64) error {
+func (c *Client) RefreshUsedQuota(userID string, quota decimal.Amount) error {
 	_, err := utils.WithRetry(context.Background(), func() (struct{}, error) {
 		return struct{}{}, c.refreshUsedQuotaImpl(userID, quota)
 	})
@@ -711,12 +747,12 @@ func (c *Client) RefreshUsedQuota(userID string, quota float64) error {
 }
 
 // refreshUsedQuotaImpl implements the actual RefreshUsedQuota logic
-func (c *Client) refreshUsedQuotaImpl(userID string, quota float64) error {
+func (c *Client) refreshUsedQuotaImpl(userID string, quota decimal.Amount) error {
 	apiUrl := fmt.Sprintf("%s%s/used/refresh", c.BaseURL, c.AdminPath)
 
 	data := url.Values{}
 	data.Set("user_id", userID)
-	data.Set("quota", strconv.FormatFloat(quota, 'f', -1, 64))
+	data.Set("quota", quota.String())
 
 	req, err := http.NewRequest("POST", apiUrl, strings.NewReader(data.Encode()))
 	if err != nil {
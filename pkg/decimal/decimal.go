@@ -0,0 +1,300 @@
+// Package decimal provides the fixed-point amount type used for quota values.
+//
+// An Amount is stored as an integer number of micro-units (1e-6), so sums and
+// comparisons are exact. It is written to the database as BIGINT micro-units and
+// to JSON as a decimal string such as "12.5".
+package decimal
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of micro-units in one unit
+const Scale = 1_000_000
+
+// scaleDigits is the number of fractional digits an Amount can hold
+const scaleDigits = 6
+
+// Amount is a fixed-point quota amount with six fractional digits
+type Amount struct {
+	micros int64
+}
+
+// Zero is the zero amount
+var Zero = Amount{}
+
+// New returns an amount of whole units
+func New(units int64) Amount {
+	return Amount{micros: units * Scale}
+}
+
+// FromMicros returns an amount of the given number of micro-units
+func FromMicros(micros int64) Amount {
+	return Amount{micros: micros}
+}
+
+// FromFloat converts a float to the nearest micro-unit.
+// It is meant for values that arrive as floats, such as AiGateway responses.
+func FromFloat(f float64) Amount {
+	return Amount{micros: int64(math.Round(f * Scale))}
+}
+
+// Parse parses a decimal string such as "-12.345" exactly.
+// More than six fractional digits are rejected instead of rounded.
+func Parse(s string) (Amount, error) {
+	text := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		negative = text[0] == '-'
+		text = text[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(text, ".")
+	if intPart == "" && fracPart == "" {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fracPart) > scaleDigits {
+		return Zero, fmt.Errorf("invalid amount %q: at most %d decimal places are supported", s, scaleDigits)
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Zero, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var units, frac int64
+	var err error
+	if intPart != "" {
+		if units, err = strconv.ParseInt(intPart, 10, 64); err != nil || units > math.MaxInt64/Scale {
+			return Zero, fmt.Errorf("amount %q is out of range", s)
+		}
+	}
+	if fracPart != "" {
+		frac, _ = strconv.ParseInt(fracPart+strings.Repeat("0", scaleDigits-len(fracPart)), 10, 64)
+	}
+
+	micros := units*Scale + frac
+	if negative {
+		micros = -micros
+	}
+	return Amount{micros: micros}, nil
+}
+
+// MustParse is like Parse but panics on invalid input
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Micros returns the amount in micro-units
+func (a Amount) Micros() int64 {
+	return a.micros
+}
+
+// Float64 returns the amount as a float, for logging and metrics only
+func (a Amount) Float64() float64 {
+	return float64(a.micros) / Scale
+}
+
+// String formats the amount as a decimal without trailing zeros
+func (a Amount) String() string {
+	micros := a.micros
+	sign := ""
+	if micros < 0 {
+		sign = "-"
+	}
+	// Work on the unsigned value so math.MinInt64 does not overflow
+	abs := uint64(micros)
+	if micros < 0 {
+		abs = uint64(-(micros + 1)) + 1
+	}
+
+	units := abs / Scale
+	frac := abs % Scale
+	if frac == 0 {
+		return sign + strconv.FormatUint(units, 10)
+	}
+	fracText := strings.TrimRight(fmt.Sprintf("%06d", frac), "0")
+	return sign + strconv.FormatUint(units, 10) + "." + fracText
+}
+
+// Add returns a + b
+func (a Amount) Add(b Amount) Amount {
+	return Amount{micros: a.micros + b.micros}
+}
+
+// Sub returns a - b
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{micros: a.micros - b.micros}
+}
+
+// Mul returns a multiplied by n
+func (a Amount) Mul(n int64) Amount {
+	return Amount{micros: a.micros * n}
+}
+
+// Percent returns percent hundredths of a, truncated to whole micro-units
+func (a Amount) Percent(percent int64) Amount {
+	return Amount{micros: a.micros * percent / 100}
+}
+
+// Neg returns -a
+func (a Amount) Neg() Amount {
+	return Amount{micros: -a.micros}
+}
+
+// Abs returns the absolute value of a
+func (a Amount) Abs() Amount {
+	if a.micros < 0 {
+		return a.Neg()
+	}
+	return a
+}
+
+// Cmp returns -1, 0 or 1 when a is less than, equal to or greater than b
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a.micros < b.micros:
+		return -1
+	case a.micros > b.micros:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// LessThan reports whether a < b
+func (a Amount) LessThan(b Amount) bool {
+	return a.micros < b.micros
+}
+
+// GreaterThan reports whether a > b
+func (a Amount) GreaterThan(b Amount) bool {
+	return a.micros > b.micros
+}
+
+// IsZero reports whether a is zero
+func (a Amount) IsZero() bool {
+	return a.micros == 0
+}
+
+// IsPositive reports whether a > 0
+func (a Amount) IsPositive() bool {
+	return a.micros > 0
+}
+
+// IsNegative reports whether a < 0
+func (a Amount) IsNegative() bool {
+	return a.micros < 0
+}
+
+// Min returns the smaller of a and b
+func Min(a, b Amount) Amount {
+	if b.micros < a.micros {
+		return b
+	}
+	return a
+}
+
+// Max returns the larger of a and b
+func Max(a, b Amount) Amount {
+	if b.micros > a.micros {
+		return b
+	}
+	return a
+}
+
+// MarshalJSON writes the amount as a decimal string
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts a decimal string or a JSON number.
+// Numbers are accepted for clients and stored payloads that predate string amounts.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	text := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else if strings.ContainsAny(text, "eE") {
+		// Exponent notation from float encoders, round to the nearest micro-unit
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("invalid amount %s", text)
+		}
+		*a = FromFloat(f)
+		return nil
+	}
+
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// GormDataType stores amounts as BIGINT micro-units
+func (Amount) GormDataType() string {
+	return "bigint"
+}
+
+// Value implements driver.Valuer, writing micro-units
+func (a Amount) Value() (driver.Value, error) {
+	return a.micros, nil
+}
+
+// Scan implements sql.Scanner, reading micro-units.
+// Aggregates such as SUM come back as NUMERIC text and are rounded to a whole micro-unit.
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*a = Zero
+	case int64:
+		*a = Amount{micros: v}
+	case float64:
+		*a = Amount{micros: int64(math.Round(v))}
+	case []byte:
+		return a.scanText(string(v))
+	case string:
+		return a.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into decimal.Amount", src)
+	}
+	return nil
+}
+
+func (a *Amount) scanText(text string) error {
+	if micros, err := strconv.ParseInt(text, 10, 64); err == nil {
+		*a = Amount{micros: micros}
+		return nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into decimal.Amount", text)
+	}
+	*a = Amount{micros: int64(math.Round(f))}
+	return nil
+}
@@ -39,7 +39,7 @@ func NewErrorResponse(code, message string) ResponseData {
 
 // In-memory storage, simulating Redis
 type MemoryStore struct {
-	quotaData map[string]int  // Total quota
+	quotaData map[string]int  // Total quota, and the part of it restricted to each model
 	usedData  map[string]int  // Used quota
 	starData  map[string]bool // GitHub star status
 	mu        sync.RWMutex
@@ -109,6 +109,14 @@ func (m *MemoryStore) SetStar(key string, value bool) {
 
 var store = NewMemoryStore()
 
+// quotaKey returns the storage key of a user's total quota, or of the part restricted to model when it is set
+func quotaKey(userID, model string) string {
+	if model != "" {
+		return fmt.Sprintf("chat_quota:%s:model:%s", userID, model)
+	}
+	return fmt.Sprintf("chat_quota:%s", userID)
+}
+
 func main() {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
@@ -164,7 +172,7 @@ func main() {
 	}
 }
 
-// refreshQuota refreshes the quota
+// refreshQuota refreshes the quota, or the part restricted to a model when model is set
 func refreshQuota(c *gin.Context) {
 	userID := c.PostForm("user_id")
 	quotaStr := c.PostForm("quota")
@@ -180,13 +188,13 @@ func refreshQuota(c *gin.Context) {
 		return
 	}
 
-	key := fmt.Sprintf("chat_quota:%s", userID)
-	store.SetQuota(key, quota)
+	// With model set, only the part of the quota restricted to that model is refreshed
+	store.SetQuota(quotaKey(userID, c.PostForm("model")), quota)
 
 	c.JSON(http.StatusOK, NewSuccessResponse("ai-gateway.refreshquota", "refresh quota successful", nil))
 }
 
-// queryQuota queries the quota
+// queryQuota queries the quota, or the part restricted to a model when model is set
 func queryQuota(c *gin.Context) {
 	userID := c.Query("user_id")
 	if userID == "" {
@@ -194,8 +202,8 @@ func queryQuota(c *gin.Context) {
 		return
 	}
 
-	key := fmt.Sprintf("chat_quota:%s", userID)
-	quota, exists := store.GetQuota(key)
+	model := c.Query("model")
+	quota, exists := store.GetQuota(quotaKey(userID, model))
 	if !exists {
 		quota = 0 // Default quota is 0
 	}
@@ -205,11 +213,15 @@ func queryQuota(c *gin.Context) {
 		"quota":   quota,
 		"type":    "total_quota",
 	}
+	if model != "" {
+		data["model"] = model
+		data["type"] = "model_quota"
+	}
 
 	c.JSON(http.StatusOK, NewSuccessResponse("ai-gateway.queryquota", "query quota successful", data))
 }
 
-// deltaQuota increases or decreases the quota
+// deltaQuota increases or decreases the quota, or the part restricted to a model when model is set
 func deltaQuota(c *gin.Context) {
 	userID := c.PostForm("user_id")
 	valueStr := c.PostForm("value")
@@ -225,8 +237,8 @@ func deltaQuota(c *gin.Context) {
 		return
 	}
 
-	key := fmt.Sprintf("chat_quota:%s", userID)
-	store.IncrQuota(key, value)
+	// With model set, only the part of the quota restricted to that model changes
+	store.IncrQuota(quotaKey(userID, c.PostForm("model")), value)
 
 	c.JSON(http.StatusOK, NewSuccessResponse("ai-gateway.deltaquota", "delta quota successful", nil))
 }
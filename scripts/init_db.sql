@@ -63,35 +63,48 @@ CREATE TABLE IF NOT EXISTS quota_strategy (
     name VARCHAR(255) NOT NULL,
     title VARCHAR(255) NOT NULL,
     type VARCHAR(50) NOT NULL,
-    amount DECIMAL(10,2) NOT NULL,
+    amount BIGINT NOT NULL,
     model VARCHAR(255),
     periodic_expr VARCHAR(255),
     condition TEXT,
     max_exec_per_user INTEGER NOT NULL DEFAULT 0,
     expiry_days INTEGER,  -- 有效天数，可为空
+    rollover_percent INTEGER,  -- overrides the expiry policy rollover percentage, NULL uses the policy
     status BOOLEAN DEFAULT true NOT NULL,  -- Status field: true=enabled, false=disabled
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
     update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Rollover override, added after the table was first created
+ALTER TABLE quota_strategy ADD COLUMN IF NOT EXISTS rollover_percent INTEGER;
+
 -- Quota execution status table
 CREATE TABLE IF NOT EXISTS quota_execute (
     id SERIAL PRIMARY KEY,
     strategy_id INTEGER NOT NULL,
     user_id VARCHAR(255) NOT NULL,
     batch_number VARCHAR(20) NOT NULL,
-    status VARCHAR(50) NOT NULL,
+    status VARCHAR(50) NOT NULL,  -- processing, completed, failed or reverted
+    recipient_id VARCHAR(255),  -- user the quota was granted to
+    amount BIGINT NOT NULL DEFAULT 0,  -- amount granted, 0 for executions recorded before it was tracked
+    model VARCHAR(100) NOT NULL DEFAULT '',  -- model bucket the quota was granted into
     expiry_date TIMESTAMPTZ(0) NOT NULL,
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
     update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (strategy_id) REFERENCES quota_strategy(id)
 );
 
+-- Grant details for strategy revert, added after the table was first created
+ALTER TABLE quota_execute ADD COLUMN IF NOT EXISTS recipient_id VARCHAR(255);
+ALTER TABLE quota_execute ADD COLUMN IF NOT EXISTS amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE quota_execute ADD COLUMN IF NOT EXISTS model VARCHAR(100) NOT NULL DEFAULT '';
+
 -- Create indexes for quota_execute table
 CREATE INDEX IF NOT EXISTS idx_quota_execute_strategy_id ON quota_execute(strategy_id);
 CREATE INDEX IF NOT EXISTS idx_quota_execute_user_id ON quota_execute(user_id);
 CREATE INDEX IF NOT EXISTS idx_quota_execute_batch_number ON quota_execute(batch_number);
 CREATE INDEX IF NOT EXISTS idx_quota_execute_sid_uid_status ON quota_execute(strategy_id, user_id, status);
+CREATE INDEX IF NOT EXISTS idx_quota_execute_recipient_id ON quota_execute(recipient_id);
 
 -- Add index for strategy status field to improve query performance
 CREATE INDEX IF NOT EXISTS idx_quota_strategy_status ON quota_strategy(status);
@@ -100,7 +113,8 @@ CREATE INDEX IF NOT EXISTS idx_quota_strategy_status ON quota_strategy(status);
 CREATE TABLE IF NOT EXISTS quota (
     id SERIAL PRIMARY KEY,
     user_id VARCHAR(255) NOT NULL,
-    amount DECIMAL(10,2) NOT NULL,
+    amount BIGINT NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',  -- model or model group the quota is restricted to, empty for the general pool
     expiry_date TIMESTAMPTZ(0) NOT NULL,
     status VARCHAR(20) DEFAULT 'VALID' NOT NULL,
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
@@ -111,16 +125,29 @@ CREATE INDEX IF NOT EXISTS idx_quota_user_id ON quota(user_id);
 CREATE INDEX IF NOT EXISTS idx_quota_expiry_date ON quota(expiry_date);
 CREATE INDEX IF NOT EXISTS idx_quota_status ON quota(status);
 
+-- Upgrade existing installations
+ALTER TABLE quota ADD COLUMN IF NOT EXISTS model VARCHAR(100) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_quota_model ON quota(model);
+
 -- Quota audit table
 CREATE TABLE IF NOT EXISTS quota_audit (
     id SERIAL PRIMARY KEY,
     user_id VARCHAR(255) NOT NULL,
-    amount DECIMAL(10,2) NOT NULL,
+    amount BIGINT NOT NULL,
     operation VARCHAR(50) NOT NULL,
     voucher_code VARCHAR(1000),
     related_user VARCHAR(255),
     strategy_id INTEGER,
     strategy_name VARCHAR(100),
+    reason VARCHAR(255),  -- caller-supplied reason for DEDUCT and ADMIN_ADJUST operations
+    reference_id VARCHAR(255),  -- caller-side reference for DEDUCT, ticket for ADMIN_ADJUST operations
+    model VARCHAR(255),  -- model bucket for RECHARGE, model charged for DEDUCT operations
+    reservation_id INTEGER,  -- reservation for RESERVATION_* operations
+    operator VARCHAR(255),  -- acting admin for ADMIN_ADJUST operations
+    red_packet_id INTEGER,  -- red packet funded, claimed or refunded by TRANSFER_* operations
+    promo_code VARCHAR(50),  -- code redeemed by PROMO_REDEEM operations
+    request_id INTEGER,  -- approved quota request behind TRANSFER_* operations
+    merge_id INTEGER,  -- merge behind MERGE_* operations
     expiry_date TIMESTAMPTZ(0) NOT NULL,
     details TEXT,
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
@@ -128,19 +155,316 @@ CREATE TABLE IF NOT EXISTS quota_audit (
 
 CREATE INDEX IF NOT EXISTS idx_quota_audit_user_id ON quota_audit(user_id);
 CREATE INDEX IF NOT EXISTS idx_quota_audit_operation ON quota_audit(operation);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_operation_create_time ON quota_audit(operation, create_time);  -- voucher refund scans
 CREATE INDEX IF NOT EXISTS idx_quota_audit_strategy_name ON quota_audit(strategy_name);
 CREATE INDEX IF NOT EXISTS idx_quota_audit_create_time ON quota_audit(create_time);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_user_create_time ON quota_audit(user_id, create_time, id);  -- audit search pages
+
+-- Upgrade existing installations
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS reason VARCHAR(255);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS reference_id VARCHAR(255);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS model VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_reference_id ON quota_audit(reference_id);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS reservation_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_quota_audit_reservation_id ON quota_audit(reservation_id);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS operator VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_operator ON quota_audit(operator);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS red_packet_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_quota_audit_red_packet_id ON quota_audit(red_packet_id);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS promo_code VARCHAR(50);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_promo_code ON quota_audit(promo_code);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS request_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_quota_audit_request_id ON quota_audit(request_id);
+ALTER TABLE quota_audit ADD COLUMN IF NOT EXISTS merge_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_quota_audit_merge_id ON quota_audit(merge_id);
 
 -- Voucher redemption table
 CREATE TABLE IF NOT EXISTS voucher_redemption (
     id SERIAL PRIMARY KEY,
     voucher_code VARCHAR(1000) UNIQUE NOT NULL,
-    receiver_id VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,  -- user who claimed the voucher, the giver for cancellations and refunds
+    status VARCHAR(20) NOT NULL DEFAULT 'REDEEMED',  -- REDEEMED/CANCELLED/REFUNDED
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
 );
 
--- Create unique index to enforce one record per user per expiry date per status
-CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_user_expiry_status ON quota(user_id, expiry_date, status);
+-- Upgrade existing installations
+ALTER TABLE voucher_redemption ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'REDEEMED';
+
+-- Create unique index to enforce one record per user per model per expiry date per status
+DROP INDEX IF EXISTS idx_quota_user_expiry_status;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_user_model_expiry_status ON quota(user_id, model, expiry_date, status);
+
+-- Quota holds placed ahead of a deduction, settled by capture, release or TTL expiry
+CREATE TABLE IF NOT EXISTS quota_reservations (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,  -- amount held, in micro-units
+    captured_amount BIGINT NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'HELD',  -- HELD/CAPTURED/RELEASED/EXPIRED
+    items TEXT NOT NULL,  -- JSON per-bucket holds: [{"amount": "10", "expiry_date": "..."}]
+    reason VARCHAR(255),
+    reference_id VARCHAR(255),
+    created_by VARCHAR(255),
+    expires_at TIMESTAMPTZ(0) NOT NULL,
+    settled_at TIMESTAMPTZ(0),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_user_id ON quota_reservations(user_id);
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_status ON quota_reservations(status);
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_expires_at ON quota_reservations(expires_at);
+CREATE INDEX IF NOT EXISTS idx_quota_reservations_reference_id ON quota_reservations(reference_id);
+
+-- Processed idempotent requests with their responses, replayed on retry
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    caller VARCHAR(255) NOT NULL,  -- principal that sent the request
+    operation VARCHAR(50) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,  -- SHA-256 of the request body
+    response TEXT,  -- JSON-encoded response of the original request
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_caller_op_key ON idempotency_keys(caller, operation, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_create_time ON idempotency_keys(create_time);
+
+-- AiGateway quota operations written with the quota change and applied by the outbox dispatcher
+CREATE TABLE IF NOT EXISTS gateway_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    operation VARCHAR(50) NOT NULL,  -- DELTA_QUOTA/DELTA_MODEL_QUOTA/REFRESH_MODEL_QUOTA/DELTA_USED_QUOTA/REFRESH_QUOTA
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    value BIGINT NOT NULL,
+    source VARCHAR(50),  -- quota operation that queued it, e.g. TRANSFER_OUT
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',  -- PENDING/DISPATCHED/DEAD
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ(0) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMPTZ(0),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gateway_outbox_user_status ON gateway_outbox(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_gateway_outbox_next_attempt_at ON gateway_outbox(next_attempt_at);
+
+-- Reconciliation runs comparing the quota table, AiGateway and the audit ledger
+CREATE TABLE IF NOT EXISTS reconciliation_reports (
+    id SERIAL PRIMARY KEY,
+    mode VARCHAR(20) NOT NULL,  -- DRY_RUN/FIX
+    status VARCHAR(20) NOT NULL DEFAULT 'RUNNING',  -- RUNNING/COMPLETED/FAILED
+    triggered_by VARCHAR(255),
+    user_ids TEXT,  -- comma-separated users the run was limited to, empty for all
+    total_users INTEGER NOT NULL DEFAULT 0,
+    mismatched_users INTEGER NOT NULL DEFAULT 0,
+    mismatches INTEGER NOT NULL DEFAULT 0,
+    fixed INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ(0) NOT NULL,
+    finished_at TIMESTAMPTZ(0),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_reports_create_time ON reconciliation_reports(create_time);
+
+-- Mismatches found by a reconciliation run
+CREATE TABLE IF NOT EXISTS reconciliation_items (
+    id SERIAL PRIMARY KEY,
+    report_id INTEGER NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    category VARCHAR(50) NOT NULL,  -- GATEWAY_QUOTA_MISMATCH/USED_EXCEEDS_QUOTA/AUDIT_MISMATCH/GATEWAY_UNAVAILABLE
+    db_quota BIGINT NOT NULL DEFAULT 0,
+    gateway_quota BIGINT NOT NULL DEFAULT 0,
+    gateway_used BIGINT NOT NULL DEFAULT 0,
+    audit_sum BIGINT NOT NULL DEFAULT 0,
+    pending_operations INTEGER NOT NULL DEFAULT 0,
+    difference BIGINT NOT NULL DEFAULT 0,
+    fixed BOOLEAN NOT NULL DEFAULT false,
+    message TEXT,
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reconciliation_items_report_id ON reconciliation_items(report_id);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_items_user_id ON reconciliation_items(user_id);
+
+-- Expiry warnings already sent, one per user, expiry date and lead time
+CREATE TABLE IF NOT EXISTS expiry_notifications (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    expiry_date TIMESTAMPTZ(0) NOT NULL,
+    lead_days INTEGER NOT NULL,
+    amount BIGINT NOT NULL,  -- amount announced as expiring, in micro-units
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expiry_notifications_user_expiry_lead ON expiry_notifications(user_id, expiry_date, lead_days);
+
+-- Cumulative balance totals per user, so balance history queries only replay recent audit records
+CREATE TABLE IF NOT EXISTS quota_balance_snapshots (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(255) NOT NULL,
+    snapshot_time TIMESTAMPTZ(0) NOT NULL,  -- covers audit records created before this time
+    valid_quota BIGINT NOT NULL,
+    expired_quota BIGINT NOT NULL,
+    used_quota BIGINT NOT NULL,  -- AiGateway used quota when the snapshot was created
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_balance_snapshots_user_time ON quota_balance_snapshots(user_id, snapshot_time);
+CREATE INDEX IF NOT EXISTS idx_quota_audit_user_create_time ON quota_audit(user_id, create_time);
+
+-- Open vouchers: pots of quota any user can claim one share of
+CREATE TABLE IF NOT EXISTS red_packets (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    giver_id VARCHAR(255) NOT NULL,
+    total_amount BIGINT NOT NULL,
+    remaining_amount BIGINT NOT NULL,
+    max_claims INTEGER NOT NULL,
+    claim_count INTEGER NOT NULL DEFAULT 0,
+    split_mode VARCHAR(10) NOT NULL,  -- equal/random
+    quota_expiry_date TIMESTAMPTZ(0) NOT NULL,  -- expiry of the quota in the pot
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN',  -- OPEN/EXHAUSTED/REFUNDED/EXPIRED
+    expires_at TIMESTAMPTZ(0) NOT NULL,
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_red_packets_giver_id ON red_packets(giver_id);
+CREATE INDEX IF NOT EXISTS idx_red_packets_status_expires_at ON red_packets(status, expires_at);
+
+CREATE TABLE IF NOT EXISTS red_packet_claims (
+    id SERIAL PRIMARY KEY,
+    red_packet_id INTEGER NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_red_packet_claims_packet_user ON red_packet_claims(red_packet_id, user_id);
+
+-- Admin-issued promo codes redeemable by eligible users
+CREATE TABLE IF NOT EXISTS promo_codes (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,  -- stored upper case
+    amount BIGINT NOT NULL,
+    model VARCHAR(100) NOT NULL DEFAULT '',
+    expiry_days INTEGER,  -- granted quota expires after this many days, end of month when NULL
+    max_redemptions INTEGER NOT NULL DEFAULT 0,  -- total cap, 0 for no cap
+    per_user_limit INTEGER NOT NULL DEFAULT 1,
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    starts_at TIMESTAMPTZ(0),
+    ends_at TIMESTAMPTZ(0),
+    condition TEXT,  -- eligibility condition in the strategy condition language
+    status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE',  -- ACTIVE/DISABLED
+    created_by VARCHAR(255),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS promo_redemptions (
+    id SERIAL PRIMARY KEY,
+    promo_code_id INTEGER NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,
+    expiry_date TIMESTAMPTZ(0) NOT NULL,
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_promo_redemptions_code_user ON promo_redemptions(promo_code_id, user_id);
+
+-- Quota requests users file to a colleague or their department approver
+CREATE TABLE IF NOT EXISTS quota_requests (
+    id SERIAL PRIMARY KEY,
+    requester_id VARCHAR(255) NOT NULL,
+    approver_id VARCHAR(255) NOT NULL,
+    department VARCHAR(255),  -- department whose approver was asked, empty for requests to a colleague
+    amount BIGINT NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',  -- PENDING/APPROVED/REJECTED/CANCELLED/EXPIRED
+    decision_note VARCHAR(255),
+    expires_at TIMESTAMPTZ(0) NOT NULL,
+    decided_at TIMESTAMPTZ(0),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_requests_requester_id ON quota_requests(requester_id);
+CREATE INDEX IF NOT EXISTS idx_quota_requests_approver_status ON quota_requests(approver_id, status);
+CREATE INDEX IF NOT EXISTS idx_quota_requests_status_expires_at ON quota_requests(status, expires_at);
+
+-- State transitions of quota requests
+CREATE TABLE IF NOT EXISTS quota_request_events (
+    id SERIAL PRIMARY KEY,
+    request_id INTEGER NOT NULL,
+    from_status VARCHAR(20),  -- empty for the creation event
+    to_status VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,  -- user ID, or 'system' for expiry
+    note VARCHAR(255),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_request_events_request_id ON quota_request_events(request_id);
+
+-- User quota merges, with a snapshot of what moved so they can be undone
+CREATE TABLE IF NOT EXISTS quota_merges (
+    id SERIAL PRIMARY KEY,
+    main_user_id VARCHAR(255) NOT NULL,
+    other_user_id VARCHAR(255) NOT NULL,
+    amount BIGINT NOT NULL,
+    snapshot TEXT NOT NULL,  -- JSON: buckets, used quota, strategy executions and carried settings
+    status VARCHAR(20) NOT NULL DEFAULT 'MERGED',  -- MERGED/UNDONE
+    operator VARCHAR(255),
+    undoable_until TIMESTAMPTZ(0) NOT NULL,
+    undone_at TIMESTAMPTZ(0),
+    undone_by VARCHAR(255),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_quota_merges_main_user_id ON quota_merges(main_user_id);
+CREATE INDEX IF NOT EXISTS idx_quota_merges_other_user_id ON quota_merges(other_user_id);
+
+-- Server-side payloads of short-code vouchers
+CREATE TABLE IF NOT EXISTS vouchers (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    giver_id VARCHAR(255) NOT NULL,
+    receiver_id VARCHAR(255) NOT NULL,
+    payload TEXT NOT NULL,  -- JSON-encoded voucher data
+    status VARCHAR(20) NOT NULL DEFAULT 'ISSUED',  -- ISSUED/REDEEMED/CANCELLED/EXPIRED
+    expires_at TIMESTAMPTZ(0) NOT NULL,
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_vouchers_giver_id ON vouchers(giver_id);
+CREATE INDEX IF NOT EXISTS idx_vouchers_receiver_id ON vouchers(receiver_id);
+CREATE INDEX IF NOT EXISTS idx_vouchers_status ON vouchers(status);
+
+-- How far scheduled jobs have processed, so later runs skip what they already covered
+CREATE TABLE IF NOT EXISTS job_watermarks (
+    job VARCHAR(100) PRIMARY KEY,
+    processed_until TIMESTAMPTZ NOT NULL,  -- records before this time need no more processing
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+-- API keys for machine-to-machine callers (only the key hash is stored)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    key_prefix VARCHAR(20) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,  -- comma-separated scopes, e.g. quota:read,model-permissions:write
+    created_by VARCHAR(255),
+    expires_at TIMESTAMPTZ(0),
+    last_used_at TIMESTAMPTZ(0),
+    revoked_at TIMESTAMPTZ(0),
+    create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
+    update_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP
+);
 
 -- Employee department mapping table
 CREATE TABLE IF NOT EXISTS employee_department (
@@ -276,7 +600,7 @@ CREATE TABLE IF NOT EXISTS monthly_quota_usage (
     id SERIAL PRIMARY KEY,
     user_id VARCHAR(255) NOT NULL,
     year_month VARCHAR(7) NOT NULL,  -- Format: YYYY-MM
-    used_quota DECIMAL(10,2) NOT NULL,
+    used_quota BIGINT NOT NULL,
     record_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
     create_time TIMESTAMPTZ(0) DEFAULT CURRENT_TIMESTAMP,
     UNIQUE(user_id, year_month)
@@ -291,6 +615,39 @@ CREATE INDEX IF NOT EXISTS idx_monthly_quota_usage_user_month ON monthly_quota_u
 COMMENT ON TABLE monthly_quota_usage IS 'Monthly quota usage record table';
 COMMENT ON COLUMN monthly_quota_usage.user_id IS 'User ID';
 COMMENT ON COLUMN monthly_quota_usage.year_month IS 'Year and month identifier, format: YYYY-MM';
-COMMENT ON COLUMN monthly_quota_usage.used_quota IS 'Used quota amount';
+COMMENT ON COLUMN monthly_quota_usage.used_quota IS 'Used quota amount in micro-units (1e-6)';
 COMMENT ON COLUMN monthly_quota_usage.record_time IS 'Record time';
 COMMENT ON COLUMN monthly_quota_usage.create_time IS 'Create time';
+
+-- Quota amounts are stored as BIGINT micro-units (1 unit = 1000000).
+-- Convert columns of installations created when amounts were DECIMAL(10,2).
+DO $$
+DECLARE
+    col RECORD;
+BEGIN
+    FOR col IN
+        SELECT table_name, column_name, column_default FROM information_schema.columns
+        WHERE table_schema = 'public' AND data_type = 'numeric' AND (table_name, column_name) IN (
+            ('quota_strategy', 'amount'),
+            ('quota_execute', 'amount'),
+            ('quota', 'amount'),
+            ('quota_audit', 'amount'),
+            ('quota_reservations', 'amount'),
+            ('quota_reservations', 'captured_amount'),
+            ('gateway_outbox', 'value'),
+            ('reconciliation_items', 'db_quota'),
+            ('reconciliation_items', 'gateway_quota'),
+            ('reconciliation_items', 'gateway_used'),
+            ('reconciliation_items', 'audit_sum'),
+            ('reconciliation_items', 'difference'),
+            ('monthly_quota_usage', 'used_quota')
+        )
+    LOOP
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I DROP DEFAULT', col.table_name, col.column_name);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE BIGINT USING ROUND(%I * 1000000)',
+            col.table_name, col.column_name, col.column_name);
+        IF col.column_default IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN %I SET DEFAULT 0', col.table_name, col.column_name);
+        END IF;
+    END LOOP;
+END $$;
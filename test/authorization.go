@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/config"
+	"quota-manager/internal/handlers"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testAdminUserID           = "00000000-0000-0000-0000-0000000000a1"
+	testServiceAccountToken   = "test-service-account-token-0123456789"
+	testAuthzTargetUserUUID   = "123e4567-e89b-12d3-a456-426614174000"
+	testAuthzRegularUserID    = "authz-regular-user"
+	testAuthzOperatorClaimsID = "authz-operator-user"
+)
+
+// setupAuthorizedRouter creates a router with the authorization middleware in front of quota and strategy routes
+func setupAuthorizedRouter(ctx *TestContext) (*gin.Engine, error) {
+	gin.SetMode(gin.TestMode)
+
+	serverConfig := &config.ServerConfig{
+		TokenHeader: "authorization",
+		JWT:         config.JWTConfig{HMACSecret: testJWTSecret},
+		Authz: config.AuthzConfig{
+			Admins: []string{testAdminUserID},
+			ServiceAccounts: []config.ServiceAccountConfig{
+				{Name: "test-automation", Token: testServiceAccountToken, Roles: []string{"admin"}},
+			},
+		},
+	}
+
+	tokenVerifier, err := auth.NewTokenVerifier(&serverConfig.JWT)
+	if err != nil {
+		return nil, err
+	}
+	apiKeyService := services.NewAPIKeyService(ctx.DB)
+	authorizer, err := auth.NewAuthorizer(serverConfig, tokenVerifier, apiKeyService, auth.DefaultRoutePolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	strategyHandler := handlers.NewStrategyHandler(ctx.StrategyService)
+	quotaHandler := handlers.NewQuotaHandler(ctx.QuotaService, serverConfig, tokenVerifier)
+
+	router := gin.New()
+	v1 := router.Group(auth.APIPrefix)
+	v1.Use(authorizer.Middleware())
+	{
+		strategies := v1.Group("/strategies")
+		{
+			strategies.GET("", strategyHandler.GetStrategies)
+			strategies.POST("", strategyHandler.CreateStrategy)
+			strategies.POST("/:id/revert", strategyHandler.RevertStrategy)
+		}
+		handlers.RegisterQuotaRoutes(v1, quotaHandler)
+		handlers.RegisterAPIKeyRoutes(v1, handlers.NewAPIKeyHandler(apiKeyService))
+		handlers.RegisterOutboxRoutes(v1, handlers.NewOutboxHandler(ctx.QuotaService.Outbox()))
+		// Registered without a policy entry, must fall back to admin
+		v1.GET("/unlisted", func(c *gin.Context) {
+			c.JSON(http.StatusOK, response.NewSuccessResponse(nil, ""))
+		})
+	}
+
+	return router, nil
+}
+
+// createTestJWTTokenWithRoles creates a signed test token carrying a roles claim
+func createTestJWTTokenWithRoles(userID string, roles []string) string {
+	claims := jwt.MapClaims{
+		"universal_id": userID,
+		"name":         "Test User",
+		"roles":        roles,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		panic(fmt.Sprintf("failed to sign test token: %v", err))
+	}
+	return token
+}
+
+// testAPIRoleBasedAuthorization tests that the route policy table is enforced per role
+func testAPIRoleBasedAuthorization(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	userToken := "Bearer " + createTestJWTToken(testAuthzRegularUserID)
+	operatorToken := "Bearer " + createTestJWTTokenWithRoles(testAuthzOperatorClaimsID, []string{"operator"})
+	adminToken := "Bearer " + createTestJWTToken(testAdminUserID)
+	serviceToken := "Bearer " + testServiceAccountToken
+	auditPath := auth.APIPrefix + "/quota/audit/" + testAuthzTargetUserUUID
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"anonymous admin route", "GET", auth.APIPrefix + "/strategies", "", "", http.StatusUnauthorized, response.TokenInvalidCode},
+		{"user reads own quota", "GET", auth.APIPrefix + "/quota", userToken, "", http.StatusOK, response.SuccessCode},
+		{"user lists strategies", "GET", auth.APIPrefix + "/strategies", userToken, "", http.StatusForbidden, response.UnauthorizedCode},
+		{"user reads other audit", "GET", auditPath, userToken, "", http.StatusForbidden, response.UnauthorizedCode},
+		{"user merges quota", "POST", auth.APIPrefix + "/quota/merge", userToken, "{}", http.StatusForbidden, response.UnauthorizedCode},
+		{"operator reads other audit", "GET", auditPath, operatorToken, "", http.StatusOK, response.SuccessCode},
+		{"operator creates strategy", "POST", auth.APIPrefix + "/strategies", operatorToken, "{}", http.StatusForbidden, response.UnauthorizedCode},
+		{"operator on unlisted route", "GET", auth.APIPrefix + "/unlisted", operatorToken, "", http.StatusForbidden, response.UnauthorizedCode},
+		{"configured admin lists strategies", "GET", auth.APIPrefix + "/strategies", adminToken, "", http.StatusOK, response.SuccessCode},
+		{"configured admin on unlisted route", "GET", auth.APIPrefix + "/unlisted", adminToken, "", http.StatusOK, response.SuccessCode},
+		{"service account merges quota", "POST", auth.APIPrefix + "/quota/merge", serviceToken, "{}", http.StatusBadRequest, response.BadRequestCode},
+		{"service account reads own quota", "GET", auth.APIPrefix + "/quota", serviceToken, "", http.StatusUnauthorized, response.TokenInvalidCode},
+	}
+
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, tc.path, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.token != "" {
+			req.Header.Set("Authorization", tc.token)
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.expectedStatus {
+			return TestResult{Passed: false, Message: fmt.Sprintf("%s: expected status %d, got %d: %s", tc.name, tc.expectedStatus, w.Code, w.Body.String())}
+		}
+
+		var resp response.ResponseData
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("%s: failed to parse response: %v", tc.name, err)}
+		}
+		if resp.Code != tc.expectedCode {
+			return TestResult{Passed: false, Message: fmt.Sprintf("%s: expected code %s, got %s", tc.name, tc.expectedCode, resp.Code)}
+		}
+	}
+
+	return TestResult{Passed: true, Message: "API Role Based Authorization Test Succeeded"}
+}
+
+// doAuthorizedRequest sends a request through router with the given header and returns status and parsed body
+func doAuthorizedRequest(router *gin.Engine, method, path, header, value, body string) (int, response.ResponseData) {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp response.ResponseData
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// testAPIKeyLifecycle tests API key creation, scope checks, rotation and revocation
+func testAPIKeyLifecycle(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	adminToken := "Bearer " + createTestJWTToken(testAdminUserID)
+	auditPath := auth.APIPrefix + "/quota/audit/" + testAuthzTargetUserUUID
+	keysPath := auth.APIPrefix + "/api-keys"
+
+	// Unknown scopes are rejected
+	status, _ := doAuthorizedRequest(router, "POST", keysPath, "Authorization", adminToken, `{"name":"bad","scopes":["everything"]}`)
+	if status != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for unknown scope, got %d", status)}
+	}
+
+	// Create a read-only quota key
+	status, resp := doAuthorizedRequest(router, "POST", keysPath, "Authorization", adminToken, `{"name":"billing-backend","scopes":["quota:read"]}`)
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create API key failed with status %d: %s", status, resp.Message)}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	rawKey, _ := data["key"].(string)
+	keyID, _ := data["id"].(float64)
+	if rawKey == "" || keyID == 0 {
+		return TestResult{Passed: false, Message: "Expected created API key to include key and id"}
+	}
+
+	// The stored record must not contain the plaintext key
+	var stored models.APIKey
+	if err := ctx.DB.DB.First(&stored, int(keyID)).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to load stored API key: %v", err)}
+	}
+	if stored.KeyHash == rawKey || stored.KeyHash == "" {
+		return TestResult{Passed: false, Message: "Expected API key to be stored hashed"}
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"read scope allows admin audit read", "GET", auditPath, http.StatusOK},
+		{"read scope denies merge", "POST", auth.APIPrefix + "/quota/merge", http.StatusForbidden},
+		{"no scope for strategies", "GET", auth.APIPrefix + "/strategies", http.StatusForbidden},
+		{"api keys cannot manage api keys", "GET", keysPath, http.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		status, resp := doAuthorizedRequest(router, tc.method, tc.path, "X-API-Key", rawKey, "{}")
+		if status != tc.expectedStatus {
+			return TestResult{Passed: false, Message: fmt.Sprintf("%s: expected status %d, got %d: %s", tc.name, tc.expectedStatus, status, resp.Message)}
+		}
+	}
+
+	// Quota admin routes need the quota-admin group, quota:write is not enough
+	status, resp = doAuthorizedRequest(router, "POST", keysPath, "Authorization", adminToken, `{"name":"portal-backend","scopes":["quota:write"]}`)
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create API key failed with status %d: %s", status, resp.Message)}
+	}
+	data, _ = resp.Data.(map[string]interface{})
+	writeKey, _ := data["key"].(string)
+	for _, path := range []string{"/quota/merge", "/quota/adjust", "/quota/deduct", "/quota/promo-codes", "/quota/reservations"} {
+		if status, resp := doAuthorizedRequest(router, "POST", auth.APIPrefix+path, "X-API-Key", writeKey, "{}"); status != http.StatusForbidden {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota:write to be denied %s, got %d: %s", path, status, resp.Message)}
+		}
+	}
+	status, resp = doAuthorizedRequest(router, "POST", keysPath, "Authorization", adminToken, `{"name":"billing-admin","scopes":["quota-admin:write"]}`)
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create API key failed with status %d: %s", status, resp.Message)}
+	}
+	data, _ = resp.Data.(map[string]interface{})
+	adminKey, _ := data["key"].(string)
+	if status, resp := doAuthorizedRequest(router, "POST", auth.APIPrefix+"/quota/merge", "X-API-Key", adminKey, "{}"); status == http.StatusForbidden || status == http.StatusUnauthorized {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota-admin:write to reach merge, got %d: %s", status, resp.Message)}
+	}
+
+	// last_used_at is recorded
+	if err := ctx.DB.DB.First(&stored, int(keyID)).Error; err != nil || stored.LastUsedAt == nil {
+		return TestResult{Passed: false, Message: "Expected last_used_at to be recorded"}
+	}
+
+	// Rotation invalidates the old key
+	status, resp = doAuthorizedRequest(router, "POST", fmt.Sprintf("%s/%d/rotate", keysPath, int(keyID)), "Authorization", adminToken, "")
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Rotate API key failed with status %d: %s", status, resp.Message)}
+	}
+	data, _ = resp.Data.(map[string]interface{})
+	rotatedKey, _ := data["key"].(string)
+	if rotatedKey == "" || rotatedKey == rawKey {
+		return TestResult{Passed: false, Message: "Expected rotation to return a new key"}
+	}
+	if status, _ := doAuthorizedRequest(router, "GET", auditPath, "X-API-Key", rawKey, ""); status != http.StatusUnauthorized {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected old key to be rejected after rotation, got %d", status)}
+	}
+	if status, _ := doAuthorizedRequest(router, "GET", auditPath, "X-API-Key", rotatedKey, ""); status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected rotated key to be accepted, got %d", status)}
+	}
+
+	// Revocation disables the key
+	status, _ = doAuthorizedRequest(router, "POST", fmt.Sprintf("%s/%d/revoke", keysPath, int(keyID)), "Authorization", adminToken, "")
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Revoke API key failed with status %d", status)}
+	}
+	status, resp = doAuthorizedRequest(router, "GET", auditPath, "X-API-Key", rotatedKey, "")
+	if status != http.StatusUnauthorized || resp.Code != response.TokenInvalidCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected revoked key to be rejected, got %d %s", status, resp.Code)}
+	}
+
+	// Listing never exposes secrets
+	status, resp = doAuthorizedRequest(router, "GET", keysPath, "Authorization", adminToken, "")
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("List API keys failed with status %d", status)}
+	}
+	listBody, _ := json.Marshal(resp.Data)
+	if bytes.Contains(listBody, []byte(rotatedKey)) || bytes.Contains(listBody, []byte(stored.KeyHash)) {
+		return TestResult{Passed: false, Message: "Expected API key list to omit keys and hashes"}
+	}
+
+	return TestResult{Passed: true, Message: "API Key Lifecycle Test Succeeded"}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+)
+
+// testBalanceHistory tests point-in-time balances and daily series, with and without snapshots
+func testBalanceHistory(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	cfg := ctx.QuotaService.GetConfigManager().GetDirect()
+	today := utils.NowInConfigTimezone(cfg)
+	noon := func(daysAgo int) time.Time {
+		return time.Date(today.Year(), today.Month(), today.Day()-daysAgo, 12, 0, 0, 0, today.Location())
+	}
+	date := func(daysAgo int) string { return noon(daysAgo).Format("2006-01-02") }
+
+	userID := createTestUser("balance_history", "Balance History", 0).ID
+	audits := []models.QuotaAudit{
+		{UserID: userID, Amount: decimal.New(100), Operation: models.OperationRecharge, ExpiryDate: noon(-30), CreateTime: noon(10)},
+		{UserID: userID, Amount: decimal.New(-30), Operation: models.OperationDeduct, ExpiryDate: noon(-30), CreateTime: noon(5)},
+		{UserID: userID, Amount: decimal.New(-20), Operation: models.OperationExpire, ExpiryDate: noon(3), CreateTime: noon(3)},
+		{UserID: userID, Amount: decimal.New(10), Operation: models.OperationAdminAdjust, ExpiryDate: noon(-30), CreateTime: noon(1)},
+	}
+	if err := ctx.DB.Create(&audits).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create audit records: %v", err)}
+	}
+	if err := ctx.DB.Create(&models.MonthlyQuotaUsage{
+		UserID: userID, YearMonth: noon(4).Format("2006-01"), UsedQuota: decimal.New(25), RecordTime: noon(4),
+	}).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create monthly usage: %v", err)}
+	}
+
+	point, err := ctx.QuotaService.GetBalanceAt(userID, noon(6))
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get balance failed: %v", err)}
+	}
+	if point.ValidQuota != decimal.New(100) || !point.ExpiredQuota.IsZero() || !point.UsedQuota.IsZero() || point.UsedAsOf != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected balance 6 days ago: %+v", point)}
+	}
+	point, err = ctx.QuotaService.GetBalanceAt(userID, noon(3))
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get balance failed: %v", err)}
+	}
+	if point.ValidQuota != decimal.New(50) || point.ExpiredQuota != decimal.New(20) || point.UsedQuota != decimal.New(25) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected balance 3 days ago: %+v", point)}
+	}
+
+	history, err := ctx.QuotaService.GetBalanceHistory(userID, date(10), date(0))
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get balance history failed: %v", err)}
+	}
+	expectedValid := map[int]decimal.Amount{0: decimal.New(100), 5: decimal.New(70), 7: decimal.New(50), 10: decimal.New(60)}
+	if len(history.Points) != 11 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 11 daily points, got %d", len(history.Points))}
+	}
+	for i, valid := range expectedValid {
+		if history.Points[i].ValidQuota != valid {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected valid %s on %s, got %+v", valid, history.Points[i].Date, history.Points[i])}
+		}
+	}
+	if last := history.Points[10]; last.ExpiredQuota != decimal.New(20) || last.UsedQuota != decimal.New(25) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected balance today: %+v", last)}
+	}
+
+	// A snapshot covers everything before today and gives the same answers
+	mockStore.SetUsed(userID, 40)
+	if _, err := ctx.QuotaService.SnapshotBalances(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Snapshot balances failed: %v", err)}
+	}
+	var snapshot models.QuotaBalanceSnapshot
+	if err := ctx.DB.Where("user_id = ?", userID).First(&snapshot).Error; err != nil ||
+		snapshot.ValidQuota != decimal.New(60) || snapshot.ExpiredQuota != decimal.New(20) || snapshot.UsedQuota != decimal.New(40) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected balance snapshot: %+v (%v)", snapshot, err)}
+	}
+	snapshotHistory, err := ctx.QuotaService.GetBalanceHistory(userID, date(10), date(0))
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get balance history failed: %v", err)}
+	}
+	if !reflect.DeepEqual(snapshotHistory.Points[:10], history.Points[:10]) {
+		return TestResult{Passed: false, Message: "Expected the same history before today with a snapshot"}
+	}
+	if last := snapshotHistory.Points[10]; last.ValidQuota != decimal.New(60) || last.UsedQuota != decimal.New(40) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected today's used quota from the snapshot, got %+v", last)}
+	}
+
+	// Users read their own history, operators anyone's
+	userToken := "Bearer " + createTestJWTToken(userID)
+	path := auth.APIPrefix + "/quota/balance-history"
+	code, resp := doAuthorizedRequest(router, http.MethodGet, path+"?from="+date(2), "Authorization", userToken, "")
+	if data, _ := resp.Data.(map[string]interface{}); code != http.StatusOK || len(data["points"].([]interface{})) != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 daily points, got %d: %v", code, resp.Data)}
+	}
+	for _, query := range []string{"?at=yesterday", "?from=" + date(2) + "&at=" + noon(1).Format(time.RFC3339), "?from=" + date(0) + "&to=" + date(1)} {
+		if code, _ := doAuthorizedRequest(router, http.MethodGet, path+query, "Authorization", userToken, ""); code != http.StatusBadRequest {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for %s, got %d", query, code)}
+		}
+	}
+	if code, _ := doAuthorizedRequest(router, http.MethodGet, path+"/"+testAuthzTargetUserUUID, "Authorization", userToken, ""); code != http.StatusForbidden {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 for a user reading another user's history, got %d", code)}
+	}
+	code, resp = doAuthorizedRequest(router, http.MethodGet, path+"/"+userID+"?at="+noon(5).Format(time.RFC3339), "Authorization", "Bearer "+testServiceAccountToken, "")
+	if data, _ := resp.Data.(map[string]interface{}); code != http.StatusOK || data["valid_quota"] != "70" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected valid quota 70 five days ago, got %d: %v", code, resp.Data)}
+	}
+
+	return TestResult{Passed: true, Message: "Balance History Test Succeeded"}
+}
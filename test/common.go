@@ -22,7 +22,7 @@ import (
 // testClearData test clear data - unified data clearing for all test modules
 func testClearData(ctx *TestContext) TestResult {
 	// Clear quota-related tables from main database
-	quotaTables := []string{"voucher_redemption", "quota_audit", "quota", "quota_execute", "quota_strategy"}
+	quotaTables := []string{"job_watermarks", "quota_merges", "quota_request_events", "quota_requests", "promo_redemptions", "promo_codes", "red_packet_claims", "red_packets", "quota_balance_snapshots", "expiry_notifications", "reconciliation_items", "reconciliation_reports", "gateway_outbox", "api_keys", "idempotency_keys", "quota_reservations", "vouchers", "voucher_redemption", "quota_audit", "quota", "quota_execute", "quota_strategy"}
 	for _, table := range quotaTables {
 		if err := ctx.DB.DB.Exec("DELETE FROM " + table).Error; err != nil {
 			return TestResult{Passed: false, Message: fmt.Sprintf("Clear table %s failed: %v", table, err)}
@@ -133,7 +133,7 @@ func setupTestEnvironment() (*TestContext, error) {
 	}
 
 	// Auto migrate - ensure all tables exist in test environment
-	if err := db.DB.AutoMigrate(&models.QuotaStrategy{}, &models.QuotaExecute{}, &models.Quota{}, &models.QuotaAudit{}, &models.VoucherRedemption{}, &models.MonthlyQuotaUsage{}); err != nil {
+	if err := db.DB.AutoMigrate(&models.QuotaStrategy{}, &models.QuotaExecute{}, &models.Quota{}, &models.QuotaAudit{}, &models.VoucherRedemption{}, &models.MonthlyQuotaUsage{}, &models.APIKey{}, &models.Voucher{}, &models.IdempotencyKey{}, &models.QuotaReservation{}, &models.GatewayOutbox{}, &models.ReconciliationReport{}, &models.ReconciliationItem{}, &models.ExpiryNotification{}, &models.QuotaBalanceSnapshot{}, &models.RedPacket{}, &models.RedPacketClaim{}, &models.PromoCode{}, &models.PromoRedemption{}, &models.QuotaRequest{}, &models.QuotaRequestEvent{}, &models.QuotaMerge{}, &models.JobWatermark{}); err != nil {
 		return nil, fmt.Errorf("failed to migrate main tables: %w", err)
 	}
 
@@ -192,7 +192,7 @@ func setupTestEnvironment() (*TestContext, error) {
 	}
 
 	// Create services
-	voucherService := services.NewVoucherService("test-signing-key-at-least-32-bytes-long")
+	voucherService := services.NewVoucherService("test-signing-key-at-least-32-bytes-long", cfg.Voucher.GetTTL())
 	cfg.AiGateway = *mockAiGatewayConfig
 	// Create a config manager for the quota service
 	configManager := config.NewManager(cfg)
@@ -6,6 +6,7 @@ import (
 
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 func testConcurrentOperations(ctx *TestContext) TestResult {
@@ -25,7 +26,7 @@ func testConcurrentOperations(ctx *TestContext) TestResult {
 	}
 
 	// Add initial quota for user1 (no need to set mock quota since AddQuotaForStrategy will handle AiGateway)
-	if err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, 500, 0, "concurrent-test-strategy", nil); err != nil {
+	if err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, decimal.New(500), 0, "concurrent-test-strategy", nil); err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Add initial quota failed: %v", err)}
 	}
 
@@ -37,7 +38,7 @@ func testConcurrentOperations(ctx *TestContext) TestResult {
 	go func() {
 		<-startChan
 		for i := 0; i < 5; i++ {
-			ctx.Gateway.DeltaUsedQuota(user1.ID, 10)
+			ctx.Gateway.DeltaUsedQuota(user1.ID, decimal.New(10))
 		}
 		resultChan <- nil
 	}()
@@ -53,7 +54,7 @@ func testConcurrentOperations(ctx *TestContext) TestResult {
 			transferOutReq := &services.TransferOutRequest{
 				ReceiverID: user2.ID,
 				QuotaList: []services.TransferQuotaItem{
-					{Amount: 30, ExpiryDate: expiry},
+					{Amount: decimal.New(30), ExpiryDate: expiry},
 				},
 			}
 			_, err := ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -67,7 +68,7 @@ func testConcurrentOperations(ctx *TestContext) TestResult {
 	go func() {
 		<-startChan
 		for i := 0; i < 2; i++ {
-			err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, 25, 0, fmt.Sprintf("concurrent-strategy-%d", i), nil)
+			err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, decimal.New(25), 0, fmt.Sprintf("concurrent-strategy-%d", i), nil)
 			resultChan <- err
 		}
 	}()
@@ -111,21 +112,21 @@ func testConcurrentOperations(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get final quota info failed: %v", err)}
 	}
 
-	expectedTotal := 460.0 // 500 + 50 - 90
-	expectedUsed := 50.0   // 5 * 10
-	expectedRemaining := expectedTotal - expectedUsed
+	expectedTotal := decimal.New(460) // 500 + 50 - 90
+	expectedUsed := decimal.New(50)   // 5 * 10
+	expectedRemaining := expectedTotal.Sub(expectedUsed)
 
 	if finalQuotaInfo.TotalQuota != expectedTotal {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total quota %f, got %f", expectedTotal, finalQuotaInfo.TotalQuota)}
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total quota %s, got %s", expectedTotal, finalQuotaInfo.TotalQuota)}
 	}
 
 	if finalQuotaInfo.UsedQuota != expectedUsed {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected used quota %f, got %f", expectedUsed, finalQuotaInfo.UsedQuota)}
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected used quota %s, got %s", expectedUsed, finalQuotaInfo.UsedQuota)}
 	}
 
-	actualRemaining := finalQuotaInfo.TotalQuota - finalQuotaInfo.UsedQuota
+	actualRemaining := finalQuotaInfo.TotalQuota.Sub(finalQuotaInfo.UsedQuota)
 	if actualRemaining != expectedRemaining {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota %f, got %f", expectedRemaining, actualRemaining)}
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota %s, got %s", expectedRemaining, actualRemaining)}
 	}
 
 	// Verify audit records consistency
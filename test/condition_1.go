@@ -6,6 +6,7 @@ import (
 
 	"quota-manager/internal/condition"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 )
 
 // testEmptyCondition test empty condition expression
@@ -21,7 +22,7 @@ func testTrueCondition(ctx *TestContext) TestResult {
 		Name:      "true-condition-test",
 		Title:     "True Condition Test",
 		Type:      "single",
-		Amount:    10,
+		Amount:    decimal.New(10),
 		Model:     "test-model",
 		Condition: "true()", // Always true condition
 		Status:    true,
@@ -64,7 +65,7 @@ func testMatchUserCondition(ctx *TestContext) TestResult {
 		Name:      "match-user-test",
 		Title:     "Match User Test",
 		Type:      "single",
-		Amount:    15,
+		Amount:    decimal.New(15),
 		Model:     "test-model",
 		Condition: fmt.Sprintf(`match-user("%s")`, user1.ID),
 		Status:    true,
@@ -171,7 +172,7 @@ func testRegisterBeforeCondition(ctx *TestContext) TestResult {
 		Name:      "register-before-test",
 		Title:     "Register Time Test",
 		Type:      "single",
-		Amount:    20,
+		Amount:    decimal.New(20),
 		Model:     "test-model",
 		Condition: fmt.Sprintf(`register-before("%s")`, cutoffTime.Format("2006-01-02 15:04:05")),
 		Status:    true,
@@ -229,7 +230,7 @@ func testAccessAfterCondition(ctx *TestContext) TestResult {
 		Name:      "access-after-test",
 		Title:     "Recent Access Test",
 		Type:      "single",
-		Amount:    25,
+		Amount:    decimal.New(25),
 		Model:     "test-model",
 		Condition: fmt.Sprintf(`access-after("%s")`, cutoffTime.Format("2006-01-02 15:04:05")),
 		Status:    true,
@@ -285,7 +286,7 @@ func testGithubStarCondition(ctx *TestContext) TestResult {
 		Name:      "github-star-test",
 		Title:     "GitHub Star Test",
 		Type:      "single",
-		Amount:    30,
+		Amount:    decimal.New(30),
 		Model:     "test-model",
 		Condition: `github-star("zgsm")`,
 		Status:    true,
@@ -346,7 +347,7 @@ func testQuotaLECondition(ctx *TestContext) TestResult {
 		Name:      "quota-le-test",
 		Title:     "Quota Less Than Test",
 		Type:      "single",
-		Amount:    35,
+		Amount:    decimal.New(35),
 		Model:     "test-model",
 		Condition: `quota-le("test-model", 10)`,
 		Status:    true,
@@ -397,7 +398,7 @@ func testIsVipCondition(ctx *TestContext) TestResult {
 		Name:      "is-vip-test",
 		Title:     "VIP Level Test",
 		Type:      "single",
-		Amount:    40,
+		Amount:    decimal.New(40),
 		Model:     "test-model",
 		Condition: `is-vip(2)`,
 		Status:    true,
@@ -448,7 +449,7 @@ func testEmptyConditionProhibited(ctx *TestContext) TestResult {
 		Name:      "empty-condition-prohibited-test",
 		Title:     "Empty Condition Prohibited Test",
 		Type:      "single",
-		Amount:    10,
+		Amount:    decimal.New(10),
 		Model:     "test-model",
 		Condition: "", // Empty condition should be prohibited
 		Status:    true,
@@ -485,7 +486,7 @@ func testFalseCondition(ctx *TestContext) TestResult {
 		Name:      "false-condition-test",
 		Title:     "False Condition Test",
 		Type:      "single",
-		Amount:    10,
+		Amount:    decimal.New(10),
 		Model:     "test-model",
 		Condition: "false()", // Always false condition
 		Status:    true,
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 	"time"
 )
 
@@ -31,7 +32,7 @@ func testBelongToCondition(ctx *TestContext) TestResult {
 		Name:      "belong-to-test",
 		Title:     "Organization Belonging Test",
 		Type:      "single",
-		Amount:    45,
+		Amount:    decimal.New(45),
 		Model:     "test-model",
 		Condition: `belong-to("org001")`,
 		Status:    true,
@@ -94,7 +95,7 @@ func testAndCondition(ctx *TestContext) TestResult {
 		Name:      "and-condition-test",
 		Title:     "AND Condition Test",
 		Type:      "single",
-		Amount:    50,
+		Amount:    decimal.New(50),
 		Model:     "test-model",
 		Condition: `and(is-vip(2), github-star("zgsm"))`,
 		Status:    true,
@@ -161,7 +162,7 @@ func testOrCondition(ctx *TestContext) TestResult {
 		Name:      uniqueStrategyName,
 		Title:     "OR Condition Test",
 		Type:      "single",
-		Amount:    55,
+		Amount:    decimal.New(55),
 		Model:     "test-model",
 		Condition: `or(is-vip(2), belong-to("org001"))`,
 		Status:    true,
@@ -225,7 +226,7 @@ func testNotCondition(ctx *TestContext) TestResult {
 		Name:      "not-condition-test",
 		Title:     "NOT Condition Test",
 		Type:      "single",
-		Amount:    60,
+		Amount:    decimal.New(60),
 		Model:     "test-model",
 		Condition: `not(is-vip(2))`,
 		Status:    true,
@@ -281,7 +282,7 @@ func testComplexCondition(ctx *TestContext) TestResult {
 		Name:      "complex-condition-test",
 		Title:     "Complex Condition Test",
 		Type:      "single",
-		Amount:    65,
+		Amount:    decimal.New(65),
 		Model:     "test-model",
 		Condition: `or(and(is-vip(2), github-star("zgsm")), belong-to("org001"))`,
 		Status:    true,
@@ -362,7 +363,7 @@ func testAndOrNestingCondition(ctx *TestContext) TestResult {
 		Name:      uniqueStrategyName,
 		Title:     "AND + OR Nesting Test",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "test-model",
 		Condition: `or(and(is-vip(2), github-star("zgsm")), belong-to("org001"))`,
 		Status:    true,
@@ -458,7 +459,7 @@ func testOrNotNestingCondition(ctx *TestContext) TestResult {
 		Name:      uniqueStrategyName,
 		Title:     "OR + NOT Nesting Test",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "test-model",
 		Condition: `or(is-vip(3), not(github-star("zgsm")))`,
 		Status:    true,
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 	"time"
 )
 
@@ -50,7 +51,7 @@ func testThreeLevelNestingCondition(ctx *TestContext) TestResult {
 		Name:      uniqueStrategyName,
 		Title:     "Three-Level Nesting Test",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "test-model",
 		Condition: `and(is-vip(3), or(belong-to("org001"), not(github-star("zgsm"))))`,
 		Status:    true,
@@ -168,7 +169,7 @@ func testMultipleConditionsNestingCondition(ctx *TestContext) TestResult {
 		Name:      uniqueStrategyName,
 		Title:     "Multiple Conditions Nesting Test",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "test-model",
 		Condition: `or(and(is-vip(3), or(belong-to("org001"), github-star("zgsm"))), and(belong-to("org001"), github-star("zgsm")))`,
 		Status:    true,
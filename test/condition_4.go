@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 	"time"
 )
 
@@ -42,13 +43,13 @@ func testComplexNestedConditions1(ctx *TestContext) TestResult {
 	quotas := []*models.Quota{
 		{
 			UserID:     user2.ID,
-			Amount:     5,
+			Amount:     decimal.New(5),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user4.ID,
-			Amount:     20,
+			Amount:     decimal.New(20),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
@@ -65,7 +66,7 @@ func testComplexNestedConditions1(ctx *TestContext) TestResult {
 		Name:   "complex-nested-test-1",
 		Title:  "Complex Nested Test 1",
 		Type:   "single",
-		Amount: 100,
+		Amount: decimal.New(100),
 		Model:  "test-model",
 		Condition: fmt.Sprintf(`and(or(match-user("%s"),and(register-before("%s"),access-after("%s"))),or(github-star("test-project"),quota-le("test-model",10)))`,
 			user3.ID,
@@ -144,19 +145,19 @@ func testComplexNestedConditions2(ctx *TestContext) TestResult {
 	quotas := []*models.Quota{
 		{
 			UserID:     user2.ID,
-			Amount:     15,
+			Amount:     decimal.New(15),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user3.ID,
-			Amount:     15,
+			Amount:     decimal.New(15),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user4.ID,
-			Amount:     5,
+			Amount:     decimal.New(5),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
@@ -178,7 +179,7 @@ func testComplexNestedConditions2(ctx *TestContext) TestResult {
 		Name:   "complex-nested-test-2",
 		Title:  "Complex Nested Test 2",
 		Type:   "single",
-		Amount: 100,
+		Amount: decimal.New(100),
 		Model:  "test-model",
 		Condition: fmt.Sprintf(`or(and(is-vip(3),belong-to("test-org")),and(not(quota-le("test-model",10)),or(register-before("%s"),access-after("%s"))))`,
 			baseTime.Format("2006-01-02 15:04:05"),
@@ -253,25 +254,25 @@ func testComplexNestedConditions3(ctx *TestContext) TestResult {
 	quotas := []*models.Quota{
 		{
 			UserID:     user1.ID,
-			Amount:     15,
+			Amount:     decimal.New(15),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user2.ID,
-			Amount:     5,
+			Amount:     decimal.New(5),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user3.ID,
-			Amount:     5,
+			Amount:     decimal.New(5),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
 		{
 			UserID:     user4.ID,
-			Amount:     15,
+			Amount:     decimal.New(15),
 			ExpiryDate: time.Now().Add(24 * time.Hour),
 			Status:     "VALID",
 		},
@@ -288,7 +289,7 @@ func testComplexNestedConditions3(ctx *TestContext) TestResult {
 		Name:      "complex-nested-test-3",
 		Title:     "Complex Nested Test 3",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "test-model",
 		Condition: `not(and(or(quota-le("test-model",10),not(is-vip(2))),not(or(github-star("test-project"),belong-to("test-org")))))`,
 		Status:    true,
@@ -8,6 +8,7 @@ replace quota-manager => ../
 
 require (
 	github.com/gin-gonic/gin v1.10.1
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	github.com/stretchr/testify v1.10.0
 	gorm.io/gorm v1.25.4
@@ -114,6 +114,7 @@ func runAllTests(ctx *TestContext) []TestResult {
 		{"AiGateway Request Failure Test", testAiGatewayFailure},
 		{"Batch User Processing Test", testBatchUserProcessing},
 		{"Voucher Generation and Validation Test", testVoucherGenerationAndValidation},
+		{"Voucher Key Rotation Test", testVoucherKeyRotation},
 		{"Quota Expiry Test", testQuotaExpiry},
 		{"Quota Audit Records Test", testQuotaAuditRecords},
 		{"Strategy with Expiry Date Test", testStrategyWithExpiryDate},
@@ -156,6 +157,16 @@ func runAllTests(ctx *TestContext) []TestResult {
 		{"Transfer Out With Expired Quota Test", testTransferOutWithExpiredQuota},
 		{"Transfer In With Expired Voucher Test", testTransferInWithExpiredVoucher},
 		{"Transfer Out Expiry Date Validation Test", testTransferOutExpiryDateValidation},
+		{"Transfer Cancel Test", testTransferCancel},
+		{"Batch Transfer Out Test", testBatchTransferOut},
+		{"Red Packet Test", testRedPackets},
+		{"Promo Code Test", testPromoCodes},
+		{"Quota Request Test", testQuotaRequests},
+		{"Transfer Policy Test", testTransferPolicy},
+		{"Quota Merge Undo Test", testQuotaMergeUndo},
+		{"Quota Audit Search Test", testQuotaAuditSearch},
+		{"Voucher Expiry Refund Test", testVoucherExpiryRefund},
+		{"Short Voucher Codes Test", testShortVoucherCodes},
 
 		// Periodic Strategy Tests
 		{"Periodic Strategy Execution Test", testPeriodicStrategyExecution},
@@ -182,9 +193,22 @@ func runAllTests(ctx *TestContext) []TestResult {
 		{"API Invalid Strategy ID", testAPIInvalidStrategyID},
 		{"API Get Strategies", testAPIGetStrategies},
 		{"API Quota Unauthorized", testAPIQuotaUnauthorized},
+		{"API Quota Forged Token", testAPIQuotaForgedToken},
+		{"API Role Based Authorization", testAPIRoleBasedAuthorization},
+		{"API Key Lifecycle", testAPIKeyLifecycle},
+		{"API Quota Deduct Idempotency", testAPIQuotaDeductIdempotency},
+		{"Quota Reservations Test", testQuotaReservations},
+		{"Model Scoped Quota Test", testModelScopedQuota},
+		{"Admin Quota Adjust Test", testAdminQuotaAdjust},
+		{"Strategy Revert Test", testStrategyRevert},
+		{"AiGateway Outbox Test", testGatewayOutbox},
+		{"Quota Reconciliation Test", testQuotaReconciliation},
+		{"Expiring Quota Test", testExpiringQuota},
+		{"Balance History Test", testBalanceHistory},
 
 		// Sanity Tests
 		{"Concurrent Operations Test", testConcurrentOperations},
+		{"Concurrent Double Spend Test", testConcurrentDoubleSpend},
 
 		// Permission Management Tests
 		{"User Whitelist Management Test", testUserWhitelistManagement},
@@ -262,6 +286,7 @@ func runAllTests(ctx *TestContext) []TestResult {
 		// ExpiryDays Strategy Tests
 		{"ExpiryDays Strategy Test", testExpiryDaysStrategy},
 		{"ExpiryDays Quota Expiry Test", testExpiryDaysQuotaExpiry},
+		{"Expiry Rollover Policy Test", testExpiryRolloverPolicy},
 
 		// Invitation Reward Strategy Tests
 		{"Invite Register Reward Test", testStrategyInviteRegister},
@@ -55,6 +55,7 @@ type MockQuotaStoreUsedDeltaCall struct {
 // MockQuotaStore mock quota storage
 type MockQuotaStore struct {
 	data                 map[string]float64            // Total quota
+	modelData            map[string]float64            // Part of the total quota restricted to a model (user_id/model -> quota)
 	usedData             map[string]float64            // Used quota
 	starData             map[string]bool               // GitHub star status
 	permissionData       map[string][]string           // User permissions (employee_number -> models)
@@ -86,6 +87,19 @@ func (m *MockQuotaStore) DeltaQuota(consumer string, delta float64) float64 {
 	return m.data[consumer]
 }
 
+func (m *MockQuotaStore) GetModelQuota(consumer, model string) float64 {
+	return m.modelData[consumer+"/"+model]
+}
+
+func (m *MockQuotaStore) SetModelQuota(consumer, model string, quota float64) {
+	m.modelData[consumer+"/"+model] = quota
+}
+
+func (m *MockQuotaStore) DeltaModelQuota(consumer, model string, delta float64) float64 {
+	m.modelData[consumer+"/"+model] += delta
+	return m.modelData[consumer+"/"+model]
+}
+
 func (m *MockQuotaStore) GetUsed(consumer string) float64 {
 	if used, exists := m.usedData[consumer]; exists {
 		return used
@@ -281,6 +295,7 @@ func (m *MockQuotaStore) ClearAllCalls() {
 // ClearData 清除所有数据
 func (m *MockQuotaStore) ClearData() {
 	m.data = make(map[string]float64)
+	m.modelData = make(map[string]float64)
 	m.usedData = make(map[string]float64)
 	m.starData = make(map[string]bool)
 	m.permissionData = make(map[string][]string)
@@ -290,6 +305,7 @@ func (m *MockQuotaStore) ClearData() {
 
 var mockStore = &MockQuotaStore{
 	data:                 make(map[string]float64),
+	modelData:            make(map[string]float64),
 	usedData:             make(map[string]float64),
 	starData:             make(map[string]bool),
 	permissionData:       make(map[string][]string),
@@ -339,6 +355,16 @@ func createMockServer(shouldFail bool) *httptest.Server {
 					return
 				}
 
+				// Model-scoped refreshes set the part of the quota restricted to that model
+				if model := c.PostForm("model"); model != "" {
+					var value float64
+					if _, err := fmt.Sscanf(quota, "%f", &value); err != nil {
+						c.JSON(http.StatusBadRequest, gin.H{"error": "quota must be numeric"})
+						return
+					}
+					mockStore.SetModelQuota(userID, model, value)
+				}
+
 				c.JSON(http.StatusOK, gin.H{"message": "success"})
 			})
 
@@ -363,6 +389,9 @@ func createMockServer(shouldFail bool) *httptest.Server {
 				}
 
 				quota := mockStore.GetQuota(userID)
+				if model := c.Query("model"); model != "" {
+					quota = mockStore.GetModelQuota(userID, model)
+				}
 
 				c.JSON(http.StatusOK, gin.H{
 					"code":    "ai-gateway.queryquota",
@@ -409,6 +438,17 @@ func createMockServer(shouldFail bool) *httptest.Server {
 					return
 				}
 
+				// Model-scoped deltas only change the part of the quota restricted to that model
+				if model := c.PostForm("model"); model != "" {
+					mockStore.DeltaModelQuota(userID, model, delta)
+					c.JSON(http.StatusOK, gin.H{
+						"code":    "ai-gateway.deltaquota",
+						"message": "delta quota successful",
+						"success": true,
+					})
+					return
+				}
+
 				// Directly update the data instead of calling SyncQuota mock method
 				mockStore.DeltaQuota(userID, delta)
 
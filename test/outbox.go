@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// userOutboxItems returns the user's outbox operations in the order they were queued
+func userOutboxItems(ctx *TestContext, userID string) ([]models.GatewayOutbox, error) {
+	var items []models.GatewayOutbox
+	err := ctx.DB.Where("user_id = ?", userID).Order("id ASC").Find(&items).Error
+	return items, err
+}
+
+// testGatewayOutbox tests that quota changes survive an AiGateway outage and are replayed in order
+func testGatewayOutbox(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	bearer := "Bearer " + testServiceAccountToken
+
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	user, _, err := setupTransferCancelUsers(ctx, "outbox", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	grant := func(amount decimal.Amount) error {
+		_, err := ctx.QuotaService.AdjustQuota("test-automation", &services.AdjustQuotaRequest{
+			UserID:     user.ID,
+			Amount:     amount,
+			ExpiryDate: expiryDate,
+			Reason:     "outbox test",
+			TicketRef:  "OUTBOX-1",
+		})
+		return err
+	}
+
+	// Grants commit while AiGateway is down, the second one waits behind the first
+	restoreFunc := ctx.UseFailServer()
+	if err := grant(decimal.New(40)); err != nil {
+		restoreFunc()
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected grant to succeed while AiGateway is down: %v", err)}
+	}
+	if err := grant(decimal.New(10)); err != nil {
+		restoreFunc()
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected second grant to succeed while AiGateway is down: %v", err)}
+	}
+	restoreFunc()
+
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", user.ID, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(150) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected bucket of 150 after grants, got %s", quota.Amount)}
+	}
+	if gatewayQuota := mockStore.GetQuota(user.ID); gatewayQuota != 100 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota to stay 100 during the outage, got %g", gatewayQuota)}
+	}
+
+	items, err := userOutboxItems(ctx, user.ID)
+	if err != nil || len(items) != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 queued operations, got %d (%v)", len(items), err)}
+	}
+	if items[0].Attempts != 1 || items[0].LastError == "" || !items[0].NextAttemptAt.After(time.Now()) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected first operation to be retrying, got attempts %d, last error %q",
+			items[0].Attempts, items[0].LastError)}
+	}
+	if items[1].Attempts != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected second operation to wait for the first, got %d attempts", items[1].Attempts)}
+	}
+
+	// Operators see the stuck operations
+	code, resp := doAuthorizedRequest(router, http.MethodGet,
+		auth.APIPrefix+"/outbox?status=PENDING&user_id="+user.ID, "Authorization", bearer, "")
+	if code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 listing outbox, got %d: %s", code, resp.Message)}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	status, _ := data["status"].(map[string]interface{})
+	if retrying, _ := status["retrying"].(float64); data["total"] != float64(2) || retrying < 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected outbox listing: %v", resp.Data)}
+	}
+	if code, _ := doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/outbox?status=UNKNOWN", "Authorization", bearer, ""); code != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for unknown status filter, got %d", code)}
+	}
+
+	// Replaying the first operation once AiGateway is back also applies the one behind it
+	code, resp = doAuthorizedRequest(router, http.MethodPost,
+		fmt.Sprintf("%s/outbox/%d/replay", auth.APIPrefix, items[0].ID), "Authorization", bearer, "")
+	if code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 replaying operation, got %d: %s", code, resp.Message)}
+	}
+	if gatewayQuota := mockStore.GetQuota(user.ID); gatewayQuota != 150 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 150 after replay, got %g", gatewayQuota)}
+	}
+	if items, err = userOutboxItems(ctx, user.ID); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to query outbox: %v", err)}
+	}
+	for _, item := range items {
+		if item.Status != models.OutboxStatusDispatched || item.DispatchedAt == nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected operation %d to be dispatched, got %s", item.ID, item.Status)}
+		}
+	}
+	if code, _ := doAuthorizedRequest(router, http.MethodPost,
+		fmt.Sprintf("%s/outbox/%d/replay", auth.APIPrefix, items[0].ID), "Authorization", bearer, ""); code != http.StatusConflict {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 409 replaying a dispatched operation, got %d", code)}
+	}
+	if code, _ := doAuthorizedRequest(router, http.MethodPost, auth.APIPrefix+"/outbox/999999999/replay", "Authorization", bearer, ""); code != http.StatusNotFound {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 404 replaying an unknown operation, got %d", code)}
+	}
+
+	// Operations that run out of attempts are dead-lettered until an operator replays them
+	configManager := ctx.QuotaService.GetConfigManager()
+	originalMaxAttempts := configManager.GetDirect().Outbox.MaxAttempts
+	configManager.Update(func(cfg *config.Config) { cfg.Outbox.MaxAttempts = 1 })
+	defer configManager.Update(func(cfg *config.Config) { cfg.Outbox.MaxAttempts = originalMaxAttempts })
+
+	restoreFunc = ctx.UseFailServer()
+	err = grant(decimal.New(5))
+	restoreFunc()
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected grant to succeed while AiGateway is down: %v", err)}
+	}
+	var dead models.GatewayOutbox
+	if err := ctx.DB.Where("user_id = ? AND status = ?", user.ID, models.OutboxStatusDead).First(&dead).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a dead-lettered operation: %v", err)}
+	}
+
+	code, resp = doAuthorizedRequest(router, http.MethodPost, auth.APIPrefix+"/outbox/replay-dead", "Authorization", bearer, "")
+	if code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 replaying dead operations, got %d: %s", code, resp.Message)}
+	}
+	if data, _ := resp.Data.(map[string]interface{}); data["replayed"] != float64(1) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 1 replayed operation, got %v", resp.Data)}
+	}
+	if gatewayQuota := mockStore.GetQuota(user.ID); gatewayQuota != 155 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 155 after replaying dead operations, got %g", gatewayQuota)}
+	}
+
+	return TestResult{Passed: true, Message: "AiGateway Outbox Test Succeeded"}
+}
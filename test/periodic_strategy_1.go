@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 )
 
 // testPeriodicStrategyMaxExecLimitOne: max_exec_per_user = 1, execute twice -> only first succeeds
@@ -16,7 +17,7 @@ func testPeriodicStrategyMaxExecLimitOne(ctx *TestContext) TestResult {
 		Name:           "periodic-max1",
 		Title:          "Periodic Max 1",
 		Type:           "periodic",
-		Amount:         10,
+		Amount:         decimal.New(10),
 		Model:          "test-model",
 		PeriodicExpr:   "0 0 0 * * *",
 		Condition:      "true()",
@@ -53,7 +54,7 @@ func testPeriodicStrategyMaxExecLimitTwo(ctx *TestContext) TestResult {
 		Name:           "periodic-max2",
 		Title:          "Periodic Max 2",
 		Type:           "periodic",
-		Amount:         15,
+		Amount:         decimal.New(15),
 		Model:          "test-model",
 		PeriodicExpr:   "0 0 0 * * *",
 		Condition:      "true()",
@@ -91,7 +92,7 @@ func testPeriodicStrategyMaxExecUpdateUpDown(ctx *TestContext) TestResult {
 		Name:           "periodic-max-update",
 		Title:          "Periodic Max Update",
 		Type:           "periodic",
-		Amount:         20,
+		Amount:         decimal.New(20),
 		Model:          "test-model",
 		PeriodicExpr:   "0 0 0 * * *",
 		Condition:      "true()",
@@ -150,7 +151,7 @@ func testPeriodicStrategyMaxExecEndToEnd(ctx *TestContext) TestResult {
 		Name:           "periodic-max-e2e",
 		Title:          "Periodic Max E2E",
 		Type:           "periodic",
-		Amount:         33,
+		Amount:         decimal.New(33),
 		Model:          "test-model",
 		PeriodicExpr:   "0 0 0 * * *",
 		Condition:      "true()",
@@ -179,7 +180,7 @@ func testPeriodicStrategyMaxExecEndToEnd(ctx *TestContext) TestResult {
 	if err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Query AiGateway quota failed: %v", err)}
 	}
-	if int(quota) != 33 {
+	if quota != decimal.New(33) {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 33, got %v", quota)}
 	}
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 )
 
 // testPeriodicStrategyExecution tests that periodic strategies can execute properly
@@ -18,7 +19,7 @@ func testPeriodicStrategyExecution(ctx *TestContext) TestResult {
 		Name:         "periodic-execution-test",
 		Title:        "Periodic Execution Test",
 		Type:         "periodic",
-		Amount:       25,
+		Amount:       decimal.New(25),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 0 * * *", // Execute daily at midnight
 		Condition:    "true()",      // Always true condition, all users match
@@ -102,7 +103,7 @@ func testPeriodicStrategyCronRegistration(ctx *TestContext) TestResult {
 		Name:         "periodic-cron-test",
 		Title:        "Periodic Cron Registration Test",
 		Type:         "periodic",
-		Amount:       30,
+		Amount:       decimal.New(30),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 0 1 * *", // Execute on 1st day of every month at midnight
 		Condition:    "true()",
@@ -146,8 +147,8 @@ func testPeriodicStrategyCronRegistration(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get updated strategy failed: %v", err)}
 	}
 
-	if updatedStrategy.Amount != 50 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Strategy amount not updated, expected 50, got %g", updatedStrategy.Amount)}
+	if updatedStrategy.Amount != decimal.New(50) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Strategy amount not updated, expected 50, got %s", updatedStrategy.Amount)}
 	}
 
 	return TestResult{Passed: true, Message: "Periodic Cron Registration Test Succeeded"}
@@ -181,7 +182,7 @@ func testPeriodicCronExpressionValidation(ctx *TestContext) TestResult {
 			Name:         fmt.Sprintf("cron-validation-%d", i),
 			Title:        fmt.Sprintf("Cron Validation Test - %s", tc.expected),
 			Type:         "periodic",
-			Amount:       float64(10 + i*5),
+			Amount:       decimal.New(int64(10 + i*5)),
 			Model:        "test-model",
 			PeriodicExpr: tc.expr,
 			Condition:    "true()",
@@ -217,7 +218,7 @@ func testPeriodicStrategyCRUDOperations(ctx *TestContext) TestResult {
 		Name:         "crud-test-strategy",
 		Title:        "CRUD Test Strategy",
 		Type:         "periodic",
-		Amount:       100,
+		Amount:       decimal.New(100),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 12 * * *", // Daily at noon
 		Condition:    "true()",
@@ -260,8 +261,8 @@ func testPeriodicStrategyCRUDOperations(ctx *TestContext) TestResult {
 	if err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get updated strategy failed: %v", err)}
 	}
-	if updatedStrategy.Amount != 150 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Strategy amount not updated, expected 150, got %g", updatedStrategy.Amount)}
+	if updatedStrategy.Amount != decimal.New(150) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Strategy amount not updated, expected 150, got %s", updatedStrategy.Amount)}
 	}
 	if updatedStrategy.PeriodicExpr != "0 0 18 * * *" {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Strategy cron expression not updated, expected '0 0 18 * * *', got '%s'", updatedStrategy.PeriodicExpr)}
@@ -337,7 +338,7 @@ func testPeriodicStrategyFieldModifications(ctx *TestContext) TestResult {
 		Name:         "field-modification-test",
 		Title:        "Field Modification Test",
 		Type:         "periodic",
-		Amount:       75,
+		Amount:       decimal.New(75),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 9 * * 1", // Monday at 9 AM
 		Condition:    "true()",
@@ -447,7 +448,7 @@ func testPeriodicStrategyInvalidCronExpressions(ctx *TestContext) TestResult {
 			Name:         fmt.Sprintf("invalid-cron-test-%d", i),
 			Title:        fmt.Sprintf("Invalid Cron Test %d", i),
 			Type:         "periodic",
-			Amount:       50,
+			Amount:       decimal.New(50),
 			Model:        "test-model",
 			PeriodicExpr: expr,
 			Condition:    "true()",
@@ -475,7 +476,7 @@ func testPeriodicStrategyConcurrentModifications(ctx *TestContext) TestResult {
 		Name:         "concurrent-test-strategy",
 		Title:        "Concurrent Test Strategy",
 		Type:         "periodic",
-		Amount:       100,
+		Amount:       decimal.New(100),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 12 * * *", // Daily at noon
 		Condition:    "true()",
@@ -519,8 +520,8 @@ func testPeriodicStrategyConcurrentModifications(ctx *TestContext) TestResult {
 	if err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get updated strategy failed: %v", err)}
 	}
-	if updatedStrategy.Amount != 150 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Amount update failed, expected 150, got %g", updatedStrategy.Amount)}
+	if updatedStrategy.Amount != decimal.New(150) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Amount update failed, expected 150, got %s", updatedStrategy.Amount)}
 	}
 
 	// Test execution after concurrent modifications
@@ -545,7 +546,7 @@ func testPeriodicStrategyEdgeCases(ctx *TestContext) TestResult {
 		Name:         "zero-amount-test",
 		Title:        "Zero Amount Test",
 		Type:         "periodic",
-		Amount:       0,
+		Amount:       decimal.New(0),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 12 * * *",
 		Condition:    "true()",
@@ -568,7 +569,7 @@ func testPeriodicStrategyEdgeCases(ctx *TestContext) TestResult {
 		Name:         "large-amount-test",
 		Title:        "Large Amount Test",
 		Type:         "periodic",
-		Amount:       999999,
+		Amount:       decimal.New(999999),
 		Model:        "test-model",
 		PeriodicExpr: "0 0 12 * * *",
 		Condition:    "true()",
@@ -590,7 +591,7 @@ func testPeriodicStrategyEdgeCases(ctx *TestContext) TestResult {
 		Name:         "complex-cron-test",
 		Title:        "Complex Cron Test",
 		Type:         "periodic",
-		Amount:       25,
+		Amount:       decimal.New(25),
 		Model:        "test-model",
 		PeriodicExpr: "0 15,45 9,17 * * 1-5", // 9:15, 9:45, 17:15, 17:45 on weekdays
 		Condition:    "true()",
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+)
+
+// testPromoCodes tests promo code caps under concurrent redemption, eligibility conditions and the validity window
+func testPromoCodes(ctx *TestContext) TestResult {
+	users := make([]*models.AuthUser, 5)
+	for i := range users {
+		user := createTestUser(fmt.Sprintf("promo_user_%d", i), fmt.Sprintf("Promo User %d", i), i%2)
+		if err := ctx.DB.AuthDB.Create(user).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+		}
+		users[i] = &models.AuthUser{ID: user.ID, Name: user.Name}
+	}
+
+	expiryDays := 7
+	launch, err := ctx.QuotaService.CreatePromoCode(testAdminUserID, &services.CreatePromoCodeRequest{
+		Code: "launch-test", Amount: decimal.New(10), ExpiryDays: &expiryDays, MaxRedemptions: 3,
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create promo code failed: %v", err)}
+	}
+	if launch.Code != "LAUNCH-TEST" || launch.PerUserLimit != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected code LAUNCH-TEST with a per-user limit of 1, got %+v", launch)}
+	}
+	if _, err := ctx.QuotaService.CreatePromoCode(testAdminUserID, &services.CreatePromoCodeRequest{Code: "LAUNCH-TEST", Amount: decimal.New(1)}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a duplicate promo code to fail"}
+	}
+	if _, err := ctx.QuotaService.CreatePromoCode(testAdminUserID, &services.CreatePromoCodeRequest{Code: "BAD-CONDITION", Amount: decimal.New(1), Condition: "is-vip("}); err == nil {
+		return TestResult{Passed: false, Message: "Expected an invalid condition to fail"}
+	}
+
+	// Five users race for three redemptions
+	var wg sync.WaitGroup
+	results := make([]*services.RedeemPromoCodeResponse, len(users))
+	for i, user := range users {
+		wg.Add(1)
+		go func(i int, user *models.AuthUser) {
+			defer wg.Done()
+			if resp, err := ctx.QuotaService.RedeemPromoCode(user, &services.RedeemPromoCodeRequest{Code: "Launch-Test"}); err == nil {
+				results[i] = resp
+			}
+		}(i, user)
+	}
+	wg.Wait()
+	redeemed := 0
+	var redeemer *models.AuthUser
+	for i, resp := range results {
+		if resp == nil {
+			continue
+		}
+		redeemed++
+		redeemer = users[i]
+		if resp.Amount != decimal.New(10) {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected a grant of 10, got %s", resp.Amount)}
+		}
+	}
+	if redeemed != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 redemptions under the cap, got %d", redeemed)}
+	}
+	var promo models.PromoCode
+	if err := ctx.DB.First(&promo, launch.ID).Error; err != nil || promo.RedemptionCount != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected redemption count 3, got %d (%v)", promo.RedemptionCount, err)}
+	}
+	var audits int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("operation = ? AND promo_code = ?", models.OperationPromoRedeem, "LAUNCH-TEST").Count(&audits)
+	if audits != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 PROMO_REDEEM audit records, got %d", audits)}
+	}
+
+	// The grant expires like a strategy grant with the same expiry days
+	now := utils.NowInConfigTimezone(ctx.QuotaService.GetConfigManager().GetDirect()).Truncate(time.Second)
+	expiryDate := utils.CalculateExpiryDate(now, &expiryDays)
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", redeemer.ID, models.StatusValid).First(&quota).Error; err != nil ||
+		quota.Amount != decimal.New(10) || !quota.ExpiryDate.Equal(expiryDate) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 10 expiring at %s, got %s at %s (%v)", expiryDate, quota.Amount, quota.ExpiryDate, err)}
+	}
+	if gatewayQuota := mockStore.GetQuota(redeemer.ID); gatewayQuota != 10 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 10 after redemption, got %g", gatewayQuota)}
+	}
+
+	// Per-user limit and eligibility condition
+	vipOnly, err := ctx.QuotaService.CreatePromoCode(testAdminUserID, &services.CreatePromoCodeRequest{
+		Code: "VIP-ONLY", Amount: decimal.New(5), PerUserLimit: 2, Condition: "is-vip(1)",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create promo code failed: %v", err)}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := ctx.QuotaService.RedeemPromoCode(users[1], &services.RedeemPromoCodeRequest{Code: vipOnly.Code}); err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected VIP redemption %d to succeed, got %v", i+1, err)}
+		}
+	}
+	if _, err := ctx.QuotaService.RedeemPromoCode(users[1], &services.RedeemPromoCodeRequest{Code: vipOnly.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a redemption above the per-user limit to fail"}
+	}
+	if _, err := ctx.QuotaService.RedeemPromoCode(users[0], &services.RedeemPromoCodeRequest{Code: vipOnly.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a non-VIP redemption to fail"}
+	}
+
+	// Validity window and disabling
+	startsAt := time.Now().Add(time.Hour)
+	if _, err := ctx.QuotaService.CreatePromoCode(testAdminUserID, &services.CreatePromoCodeRequest{
+		Code: "NOT-YET", Amount: decimal.New(5), StartsAt: &startsAt,
+	}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create promo code failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.RedeemPromoCode(users[0], &services.RedeemPromoCodeRequest{Code: "NOT-YET"}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a redemption before starts_at to fail"}
+	}
+	if _, err := ctx.QuotaService.DisablePromoCode(vipOnly.ID); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Disable promo code failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.RedeemPromoCode(users[3], &services.RedeemPromoCodeRequest{Code: vipOnly.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a disabled promo code redemption to fail"}
+	}
+
+	// Unknown codes are 404, exhausted ones 409
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	userToken := "Bearer " + createTestJWTToken(users[4].ID)
+	redeemPath := auth.APIPrefix + "/quota/redeem"
+	expected := map[string]int{"NO-SUCH-CODE": http.StatusNotFound, "LAUNCH-TEST": http.StatusConflict}
+	for code, status := range expected {
+		if got, _ := doAuthorizedRequest(router, http.MethodPost, redeemPath, "Authorization", userToken, fmt.Sprintf(`{"code":"%s"}`, code)); got != status {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected %d redeeming %s, got %d", status, code, got)}
+		}
+	}
+	if got, _ := doAuthorizedRequest(router, http.MethodPost, auth.APIPrefix+"/quota/promo-codes", "Authorization", userToken, `{"code":"SELF-SERVE","amount":100}`); got != http.StatusForbidden {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 for a user creating a promo code, got %d", got)}
+	}
+
+	return TestResult{Passed: true, Message: "Promo Code Test Succeeded"}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/pkg/decimal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// doAdjustRequest sends an admin adjustment request as the test service account
+func doAdjustRequest(router *gin.Engine, path, body string) (*httptest.ResponseRecorder, response.ResponseData) {
+	req, _ := http.NewRequest(http.MethodPost, auth.APIPrefix+"/quota/adjust"+path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testServiceAccountToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp response.ResponseData
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// testAdminQuotaAdjust tests admin grants, clawbacks and bulk adjustments and their audit trail
+func testAdminQuotaAdjust(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	user, other, err := setupTransferCancelUsers(ctx, "adjust", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	mockStore.SetUsed(user.ID, 0)
+	expiry := expiryDate.Format(time.RFC3339)
+
+	// A grant merges into the existing bucket with the same expiry
+	w, resp := doAdjustRequest(router, "", fmt.Sprintf(
+		`{"user_id":"%s","amount":25,"expiry_date":"%s","reason":"outage compensation","ticket_ref":"SUP-101"}`, user.ID, expiry))
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for grant, got %d: %s", w.Code, resp.Message)}
+	}
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", user.ID, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(125) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected bucket of 125 after grant, got %s", quota.Amount)}
+	}
+	if gatewayQuota := mockStore.GetQuota(user.ID); gatewayQuota != 125 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 125 after grant, got %g", gatewayQuota)}
+	}
+
+	var audit models.QuotaAudit
+	if err := ctx.DB.Where("user_id = ? AND operation = ?", user.ID, models.OperationAdminAdjust).First(&audit).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected ADMIN_ADJUST audit record: %v", err)}
+	}
+	if audit.Operator != "service:test-automation" || audit.ReferenceID != "SUP-101" || audit.Reason != "outage compensation" || audit.Amount != decimal.New(25) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected audit record: operator=%s ref=%s reason=%s amount=%s",
+			audit.Operator, audit.ReferenceID, audit.Reason, audit.Amount)}
+	}
+
+	// Clawbacks are limited to the unused part of the bucket
+	mockStore.SetUsed(user.ID, 100)
+	if w, resp := doAdjustRequest(router, "", fmt.Sprintf(
+		`{"user_id":"%s","amount":-30,"expiry_date":"%s","reason":"duplicate grant","ticket_ref":"SUP-102"}`, user.ID, expiry)); w.Code != http.StatusBadRequest || resp.Code != response.InsufficientQuotaCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 insufficient quota for clawback, got %d %s", w.Code, resp.Code)}
+	}
+	if w, resp := doAdjustRequest(router, "", fmt.Sprintf(
+		`{"user_id":"%s","amount":-25,"expiry_date":"%s","reason":"duplicate grant","ticket_ref":"SUP-102"}`, user.ID, expiry)); w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for clawback, got %d: %s", w.Code, resp.Message)}
+	}
+	if gatewayQuota := mockStore.GetQuota(user.ID); gatewayQuota != 100 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 100 after clawback, got %g", gatewayQuota)}
+	}
+
+	// Requests without a ticket reference are rejected
+	if w, _ := doAdjustRequest(router, "", fmt.Sprintf(
+		`{"user_id":"%s","amount":5,"expiry_date":"%s","reason":"no ticket"}`, user.ID, expiry)); w.Code != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 without ticket_ref, got %d", w.Code)}
+	}
+
+	// Bulk grants read user IDs from CSV and report per-user results
+	mockStore.SetQuota(other.ID, 0)
+	csvData := "user_id\\n" + user.ID + "\\n" + other.ID + "\\n" + user.ID + "\\n"
+	w, resp = doAdjustRequest(router, "/bulk", fmt.Sprintf(
+		`{"csv":"%s","amount":10,"expiry_date":"%s","reason":"campaign","ticket_ref":"SUP-103"}`, csvData, expiry))
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for bulk grant, got %d: %s", w.Code, resp.Message)}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	if data["total"] != float64(2) || data["succeeded"] != float64(2) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 of 2 users adjusted, got %v", data)}
+	}
+	if gatewayQuota := mockStore.GetQuota(other.ID); gatewayQuota != 10 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 10 for bulk receiver, got %g", gatewayQuota)}
+	}
+	var auditCount int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("reference_id = ? AND operation = ?", "SUP-103", models.OperationAdminAdjust).Count(&auditCount)
+	if auditCount != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 bulk audit records, got %d", auditCount)}
+	}
+
+	return TestResult{Passed: true, Message: "Admin Quota Adjust Test Succeeded"}
+}
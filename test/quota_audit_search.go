@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testQuotaAuditSearch tests audit filters, sort order and cursor pagination, for one user and across users
+func testQuotaAuditSearch(ctx *TestContext) TestResult {
+	user := createTestUser("audit_search_user", "Audit Search User", 0)
+	peer := createTestUser("audit_search_peer", "Audit Search Peer", 0)
+	for _, info := range []*models.UserInfo{user, peer} {
+		if err := ctx.DB.AuthDB.Create(info).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+		}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	strategyID := 7
+	audits := []models.QuotaAudit{
+		{UserID: user.ID, Amount: decimal.New(50), Operation: models.OperationRecharge, StrategyID: &strategyID, StrategyName: "weekly-bonus", CreateTime: now.Add(-10 * 24 * time.Hour)},
+		{UserID: user.ID, Amount: decimal.New(-150), Operation: models.OperationTransferOut, RelatedUser: peer.ID, VoucherCode: "voucher-a", CreateTime: now.Add(-3 * 24 * time.Hour)},
+		{UserID: user.ID, Amount: decimal.New(-20), Operation: models.OperationTransferOut, RelatedUser: peer.ID, CreateTime: now.Add(-2 * 24 * time.Hour)},
+		{UserID: user.ID, Amount: decimal.New(50), Operation: models.OperationRecharge, StrategyID: &strategyID, StrategyName: "weekly-bonus", CreateTime: now.Add(-24 * time.Hour)},
+		{UserID: user.ID, Amount: decimal.New(-300), Operation: models.OperationTransferOut, RelatedUser: peer.ID, CreateTime: now.Add(-time.Hour)},
+		{UserID: peer.ID, Amount: decimal.New(150), Operation: models.OperationTransferIn, RelatedUser: user.ID, VoucherCode: "voucher-a", CreateTime: now.Add(-3 * 24 * time.Hour)},
+	}
+	for i := range audits {
+		audits[i].ExpiryDate = now.Add(30 * 24 * time.Hour)
+		if err := ctx.DB.Create(&audits[i]).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Create audit record failed: %v", err)}
+		}
+	}
+
+	search := func(filter *services.QuotaAuditFilter, cursor string, page, pageSize int) (*services.QuotaAuditPage, error) {
+		return ctx.QuotaService.SearchQuotaAudit(filter, cursor, page, pageSize)
+	}
+
+	// TRANSFER_OUT over 100 in the last week, newest first
+	since := now.Add(-7 * 24 * time.Hour)
+	minAmount := decimal.New(100)
+	result, err := search(&services.QuotaAuditFilter{UserID: user.ID, Operations: []string{models.OperationTransferOut}, MinAmount: &minAmount, Since: &since}, "", 1, 10)
+	if err != nil || result.Total != 2 || len(result.Records) != 2 || result.Records[0].ID != audits[4].ID || result.Records[1].ID != audits[1].ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the two large transfers of the week, got %+v (%v)", result, err)}
+	}
+	result, err = search(&services.QuotaAuditFilter{UserID: user.ID, StrategyName: "weekly-bonus", Ascending: true}, "", 1, 10)
+	if err != nil || result.Total != 2 || result.Records[0].ID != audits[0].ID || result.Records[0].StrategyID == nil || *result.Records[0].StrategyID != strategyID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the strategy's records oldest first, got %+v (%v)", result, err)}
+	}
+	until := now.Add(-2 * 24 * time.Hour)
+	result, err = search(&services.QuotaAuditFilter{UserID: user.ID, StrategyID: strategyID, Until: &until}, "", 1, 10)
+	if err != nil || result.Total != 1 || result.Records[0].ID != audits[0].ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected one strategy record before the cutoff, got %+v (%v)", result, err)}
+	}
+
+	// Following cursors visits every record once, in order
+	var visited []int
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		result, err = search(&services.QuotaAuditFilter{UserID: user.ID}, cursor, 1, 2)
+		if err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Cursor page failed: %v", err)}
+		}
+		for _, record := range result.Records {
+			visited = append(visited, record.ID)
+		}
+		if cursor = result.NextCursor; cursor == "" {
+			break
+		}
+	}
+	expected := []int{audits[4].ID, audits[3].ID, audits[2].ID, audits[1].ID, audits[0].ID}
+	if fmt.Sprint(visited) != fmt.Sprint(expected) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected cursor pages to visit %v, got %v", expected, visited)}
+	}
+	if _, err := search(&services.QuotaAuditFilter{UserID: user.ID}, "not-a-cursor", 1, 2); err == nil {
+		return TestResult{Passed: false, Message: "Expected an invalid cursor to fail"}
+	}
+
+	// Searching across users
+	result, err = search(&services.QuotaAuditFilter{VoucherCode: "voucher-a"}, "", 1, 10)
+	if err != nil || result.Total != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected both sides of the voucher across users, got %+v (%v)", result, err)}
+	}
+
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	query := url.Values{"operation": {"transfer_in,TRANSFER_OUT"}, "related_user": {user.ID}}
+	status, resp := doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/quota/audits?"+query.Encode(),
+		"Authorization", "Bearer "+createTestJWTToken(testAdminUserID), "")
+	if status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 searching across users, got %d %s", status, resp.Message)}
+	}
+	var page services.QuotaAuditPage
+	if data, err := json.Marshal(resp.Data); err != nil || json.Unmarshal(data, &page) != nil || page.Total != 1 || page.Records[0].UserID != peer.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the peer's TRANSFER_IN, got %+v", resp.Data)}
+	}
+	if status, resp := doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/quota/audits",
+		"Authorization", "Bearer "+createTestJWTToken(user.ID), ""); status != http.StatusForbidden || resp.Code != response.UnauthorizedCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 for a user searching across users, got %d %s", status, resp.Code)}
+	}
+	status, _ = doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/quota/audit?min_amount=500&max_amount=100",
+		"Authorization", "Bearer "+createTestJWTToken(user.ID), "")
+	if status != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for an empty amount range, got %d", status)}
+	}
+
+	return TestResult{Passed: true, Message: "Quota Audit Search Test Succeeded"}
+}
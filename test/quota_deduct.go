@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/pkg/decimal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// doDeductRequest posts a deduction as the test service account with an optional Idempotency-Key
+func doDeductRequest(router *gin.Engine, idempotencyKey, body string) (*httptest.ResponseRecorder, response.ResponseData) {
+	req, _ := http.NewRequest(http.MethodPost, auth.APIPrefix+"/quota/deduct", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testServiceAccountToken)
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp response.ResponseData
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// testAPIQuotaDeductIdempotency tests that POST /quota/deduct charges once per idempotency key
+func testAPIQuotaDeductIdempotency(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	userID := "deduct-idempotency-user"
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	if err := ctx.DB.Create(&models.Quota{UserID: userID, Amount: decimal.New(100), ExpiryDate: expiryDate, Status: models.StatusValid}).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota failed: %v", err)}
+	}
+	mockStore.SetQuota(userID, 100)
+	mockStore.SetUsed(userID, 0)
+
+	body := fmt.Sprintf(`{"user_id":"%s","amount":15,"reason":"image generation","reference_id":"job-1","model":"sd-xl"}`, userID)
+
+	// A user token cannot charge other users
+	userReq, _ := http.NewRequest(http.MethodPost, auth.APIPrefix+"/quota/deduct", bytes.NewBufferString(body))
+	userReq.Header.Set("Authorization", "Bearer "+createTestJWTToken(userID))
+	userReq.Header.Set("Idempotency-Key", "forbidden")
+	userW := httptest.NewRecorder()
+	router.ServeHTTP(userW, userReq)
+	if userW.Code != http.StatusForbidden {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 for user token, got %d", userW.Code)}
+	}
+
+	// Neither header nor reference_id
+	if w, _ := doDeductRequest(router, "", fmt.Sprintf(`{"user_id":"%s","amount":15}`, userID)); w.Code != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 without idempotency key, got %d", w.Code)}
+	}
+
+	w, first := doDeductRequest(router, "charge-1", body)
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for first deduction, got %d: %s", w.Code, first.Message)}
+	}
+
+	// Replay returns the original result without charging again
+	w, replay := doDeductRequest(router, "charge-1", body)
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected replayed 200, got %d replayed=%q", w.Code, w.Header().Get("Idempotent-Replayed"))}
+	}
+	firstData, _ := first.Data.(map[string]interface{})
+	replayData, _ := replay.Data.(map[string]interface{})
+	if firstData["audit_id"] != replayData["audit_id"] || replayData["replayed"] != true {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Replay did not return the original result: %v vs %v", firstData, replayData)}
+	}
+
+	// The same key with a different request is rejected
+	conflictBody := fmt.Sprintf(`{"user_id":"%s","amount":20,"reference_id":"job-1"}`, userID)
+	if w, resp := doDeductRequest(router, "charge-1", conflictBody); w.Code != http.StatusConflict || resp.Code != response.IdempotencyConflictCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 409 for reused key, got %d %s", w.Code, resp.Code)}
+	}
+
+	// reference_id serves as the key when the header is absent
+	refBody := fmt.Sprintf(`{"user_id":"%s","amount":5,"reference_id":"job-2"}`, userID)
+	if w, _ := doDeductRequest(router, "", refBody); w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for reference_id deduction, got %d", w.Code)}
+	}
+	if w, _ := doDeductRequest(router, "", refBody); w.Header().Get("Idempotent-Replayed") != "true" {
+		return TestResult{Passed: false, Message: "Expected reference_id retry to be replayed"}
+	}
+
+	// Insufficient quota is not stored, so the caller can retry later
+	if w, resp := doDeductRequest(router, "charge-big", fmt.Sprintf(`{"user_id":"%s","amount":1000}`, userID)); w.Code != http.StatusBadRequest || resp.Code != response.InsufficientQuotaCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 insufficient quota, got %d %s", w.Code, resp.Code)}
+	}
+
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", userID, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(80) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota 80 after two charges, got %s", quota.Amount)}
+	}
+	if gatewayQuota := mockStore.GetQuota(userID); gatewayQuota != 80 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 80, got %g", gatewayQuota)}
+	}
+
+	var audit models.QuotaAudit
+	if err := ctx.DB.Where("user_id = ? AND reference_id = ?", userID, "job-1").First(&audit).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected DEDUCT audit record for job-1: %v", err)}
+	}
+	if audit.Operation != models.OperationDeduct || audit.Reason != "image generation" || audit.Model != "sd-xl" || audit.StrategyName != "" || audit.RelatedUser != "" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected deduct audit fields: %+v", audit)}
+	}
+
+	var auditCount int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ? AND operation = ?", userID, models.OperationDeduct).Count(&auditCount)
+	if auditCount != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 DEDUCT audit records, got %d", auditCount)}
+	}
+
+	return TestResult{Passed: true, Message: "API Quota Deduct Idempotency Test Succeeded"}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// capturingExpiryNotifier records expiry warnings, failing for the users in failFor
+type capturingExpiryNotifier struct {
+	events  map[string][]*services.ExpiryWarningEvent
+	failFor map[string]bool
+}
+
+func (n *capturingExpiryNotifier) NotifyExpiring(event *services.ExpiryWarningEvent) error {
+	if n.failFor[event.UserID] {
+		return errors.New("webhook unavailable")
+	}
+	n.events[event.UserID] = append(n.events[event.UserID], event)
+	return nil
+}
+
+// testExpiringQuota tests the expiring quota query, the admin summary and expiry warnings
+func testExpiringQuota(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	now := time.Now().Truncate(time.Second)
+	user := createTestUser("expiring_user", "Expiring User", 0).ID
+	late := createTestUser("expiring_late", "Expiring Late", 0).ID
+	buckets := []models.Quota{
+		{UserID: user, Amount: decimal.New(20), ExpiryDate: now.Add(12 * time.Hour), Status: models.StatusValid},
+		{UserID: user, Amount: decimal.New(30), ExpiryDate: now.Add(3 * 24 * time.Hour), Status: models.StatusValid},
+		{UserID: user, Amount: decimal.New(40), ExpiryDate: now.Add(20 * 24 * time.Hour), Status: models.StatusValid},
+		{UserID: late, Amount: decimal.New(15), ExpiryDate: now.Add(2 * 24 * time.Hour), Status: models.StatusValid},
+	}
+	if err := ctx.DB.Create(&buckets).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create quota: %v", err)}
+	}
+	// Used quota comes out of the earliest bucket
+	mockStore.SetUsed(user, 10)
+	mockStore.SetUsed(late, 0)
+
+	expiring, err := ctx.QuotaService.GetExpiringQuota(user, 7*24*time.Hour)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get expiring quota failed: %v", err)}
+	}
+	if expiring.TotalAmount != decimal.New(40) || len(expiring.Items) != 2 ||
+		expiring.Items[0].Amount != decimal.New(10) || expiring.Items[1].Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 10 and 30 expiring within 7 days, got %+v", expiring)}
+	}
+
+	// The user endpoint reads the caller from the token
+	userToken := "Bearer " + createTestJWTToken(user)
+	code, resp := doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/quota/expiring?within=1d", "Authorization", userToken, "")
+	if data, _ := resp.Data.(map[string]interface{}); code != http.StatusOK || data["total_amount"] != "10" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 10 expiring within 1 day, got %d: %v", code, resp.Data)}
+	}
+	for _, within := range []string{"abc", "0d", "400d"} {
+		if code, _ := doAuthorizedRequest(router, http.MethodGet, auth.APIPrefix+"/quota/expiring?within="+within, "Authorization", userToken, ""); code != http.StatusBadRequest {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for within=%s, got %d", within, code)}
+		}
+	}
+
+	// The summary is for operators only
+	summaryPath := auth.APIPrefix + "/quota/expiring/summary?within=7d"
+	if code, _ := doAuthorizedRequest(router, http.MethodGet, summaryPath, "Authorization", userToken, ""); code != http.StatusForbidden {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 for a user reading the summary, got %d", code)}
+	}
+	code, resp = doAuthorizedRequest(router, http.MethodGet, summaryPath, "Authorization", "Bearer "+testServiceAccountToken, "")
+	if code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 reading the summary, got %d: %s", code, resp.Message)}
+	}
+	summary, err := ctx.QuotaService.GetExpiringQuotaSummary(7 * 24 * time.Hour)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get expiring quota summary failed: %v", err)}
+	}
+	// Bucket amounts, used quota is not subtracted
+	daysTotal := decimal.Zero
+	for _, day := range summary.Days {
+		daysTotal = daysTotal.Add(day.Amount)
+	}
+	if summary.TotalUsers < 2 || summary.TotalAmount.LessThan(decimal.New(65)) || daysTotal != summary.TotalAmount {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected at least 2 users and 65 expiring in the summary, got %+v", summary)}
+	}
+
+	// Each bucket is announced at the shortest lead time covering it, once
+	notifier := &capturingExpiryNotifier{
+		events:  make(map[string][]*services.ExpiryWarningEvent),
+		failFor: map[string]bool{late: true},
+	}
+	ctx.QuotaService.SetExpiryNotifier(notifier)
+	if _, err := ctx.QuotaService.SendExpiryWarnings(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Send expiry warnings failed: %v", err)}
+	}
+	events := notifier.events[user]
+	if len(events) != 2 || events[0].LeadDays != 7 || events[0].TotalAmount != decimal.New(30) ||
+		events[1].LeadDays != 1 || events[1].TotalAmount != decimal.New(10) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a 7-day warning for 30 and a 1-day warning for 10, got %d events", len(events))}
+	}
+	if events[0].Event != services.ExpiryWarningEventType || events[0].UserID != user {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected warning event: %+v", events[0])}
+	}
+
+	// Sent warnings are not repeated, failed ones are retried
+	notifier.failFor = nil
+	if _, err := ctx.QuotaService.SendExpiryWarnings(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Send expiry warnings failed: %v", err)}
+	}
+	if len(notifier.events[user]) != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected no repeated warnings, got %d events", len(notifier.events[user]))}
+	}
+	if lateEvents := notifier.events[late]; len(lateEvents) != 1 || lateEvents[0].LeadDays != 7 || lateEvents[0].TotalAmount != decimal.New(15) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the failed warning to be sent on retry, got %d events", len(lateEvents))}
+	}
+
+	var recorded int64
+	if err := ctx.DB.Model(&models.ExpiryNotification{}).Where("user_id IN ?", []string{user, late}).Count(&recorded).Error; err != nil || recorded != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 recorded notifications, got %d (%v)", recorded, err)}
+	}
+
+	return TestResult{Passed: true, Message: "Expiring Quota Test Succeeded"}
+}
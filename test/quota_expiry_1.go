@@ -7,6 +7,7 @@ import (
 
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 // testTransferOutWithExpiredQuota tests the scenario when transferring out expired quota
@@ -21,7 +22,7 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	expiredDate := time.Now().Truncate(time.Second).Add(-24 * time.Hour) // Expired 1 day ago
 	expiredQuota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: expiredDate,
 		Status:     models.StatusValid, // Initial status is valid, but time has expired
 	}
@@ -33,7 +34,7 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	validDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
 	validQuota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     50,
+		Amount:     decimal.New(50),
 		ExpiryDate: validDate,
 		Status:     models.StatusValid,
 	}
@@ -52,7 +53,7 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	transferReq := &services.TransferOutRequest{
 		ReceiverID: "receiver_test",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: expiredDate}, // Transfer out quota with expired date
+			{Amount: decimal.New(50), ExpiryDate: expiredDate}, // Transfer out quota with expired date
 		},
 	}
 
@@ -71,8 +72,8 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get updated expired quota: %v", err)}
 	}
 
-	if updatedExpiredQuota.Amount != 50 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining expired quota 50, got %g", updatedExpiredQuota.Amount)}
+	if updatedExpiredQuota.Amount != decimal.New(50) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining expired quota 50, got %s", updatedExpiredQuota.Amount)}
 	}
 
 	// Execute quota expiry processing
@@ -92,7 +93,7 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	transferReq2 := &services.TransferOutRequest{
 		ReceiverID: "receiver_test2",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: expiredDate}, // Try to transfer out remaining expired quota
+			{Amount: decimal.New(30), ExpiryDate: expiredDate}, // Try to transfer out remaining expired quota
 		},
 	}
 
@@ -110,7 +111,7 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	validTransferReq := &services.TransferOutRequest{
 		ReceiverID: "receiver_test_valid",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: validDate},
+			{Amount: decimal.New(30), ExpiryDate: validDate},
 		},
 	}
 
@@ -129,8 +130,8 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get updated valid quota: %v", err)}
 	}
 
-	if updatedValidQuota.Amount != 20 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining valid quota 20, got %g", updatedValidQuota.Amount)}
+	if updatedValidQuota.Amount != decimal.New(20) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining valid quota 20, got %s", updatedValidQuota.Amount)}
 	}
 
 	// Verify that user quota info only calculates valid quota
@@ -139,9 +140,9 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
 	}
 
-	expectedTotal := 20.0 // only valid quota minus the transferred part
+	expectedTotal := decimal.New(20) // only valid quota minus the transferred part
 	if quotaInfo.TotalQuota != expectedTotal {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total quota %f, got %f", expectedTotal, quotaInfo.TotalQuota)}
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total quota %s, got %s", expectedTotal, quotaInfo.TotalQuota)}
 	}
 
 	// Verify audit records
@@ -158,10 +159,10 @@ func testTransferOutWithExpiredQuota(ctx *TestContext) TestResult {
 	foundExpiredTransfer := false
 	foundValidTransfer := false
 	for _, record := range auditRecords {
-		if record.Amount == -50 && record.ExpiryDate.Equal(expiredDate) {
+		if record.Amount == decimal.New(-50) && record.ExpiryDate.Equal(expiredDate) {
 			foundExpiredTransfer = true
 		}
-		if record.Amount == -30 && record.ExpiryDate.Equal(validDate) {
+		if record.Amount == decimal.New(-30) && record.ExpiryDate.Equal(validDate) {
 			foundValidTransfer = true
 		}
 	}
@@ -196,8 +197,8 @@ func testTransferInWithExpiredVoucher(ctx *TestContext) TestResult {
 		GiverGithub: "giver_expired",
 		ReceiverID:  receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
-			{Amount: 40, ExpiryDate: expiredDate}, // expired quota
-			{Amount: 60, ExpiryDate: validDate},   // valid quota
+			{Amount: decimal.New(40), ExpiryDate: expiredDate}, // expired quota
+			{Amount: decimal.New(60), ExpiryDate: validDate},   // valid quota
 		},
 	}
 
@@ -226,8 +227,8 @@ func testTransferInWithExpiredVoucher(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get valid quota: %v", err)}
 	}
 
-	if validQuota.Amount != 60 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected valid quota 60, got %g", validQuota.Amount)}
+	if validQuota.Amount != decimal.New(60) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected valid quota 60, got %s", validQuota.Amount)}
 	}
 
 	// Verify that expired quota was not created
@@ -243,8 +244,8 @@ func testTransferInWithExpiredVoucher(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get audit record: %v", err)}
 	}
 
-	if auditRecord.Amount != 60 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount 60, got %g", auditRecord.Amount)}
+	if auditRecord.Amount != decimal.New(60) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount 60, got %s", auditRecord.Amount)}
 	}
 
 	// Verify transfer in status
@@ -277,7 +278,7 @@ func testQuotaExpiryDuringTransfer(ctx *TestContext) TestResult {
 	soonExpireDate := time.Now().Truncate(time.Second).Add(-1 * time.Hour)
 	quota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     80,
+		Amount:     decimal.New(80),
 		ExpiryDate: soonExpireDate,
 		Status:     models.StatusValid,
 	}
@@ -292,7 +293,7 @@ func testQuotaExpiryDuringTransfer(ctx *TestContext) TestResult {
 	validDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
 	validQuota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: validDate,
 		Status:     models.StatusValid,
 	}
@@ -311,7 +312,7 @@ func testQuotaExpiryDuringTransfer(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: receiver.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: validDate},
+			{Amount: decimal.New(50), ExpiryDate: validDate},
 		},
 	}
 
@@ -329,7 +330,7 @@ func testQuotaExpiryDuringTransfer(ctx *TestContext) TestResult {
 		GiverGithub: "giver_expiry",
 		ReceiverID:  receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
-			{Amount: 50, ExpiryDate: soonExpireDate}, // expired quota
+			{Amount: decimal.New(50), ExpiryDate: soonExpireDate}, // expired quota
 		},
 	}
 
@@ -375,8 +376,8 @@ func testQuotaExpiryDuringTransfer(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get final quota: %v", err)}
 	}
 
-	if finalQuota.Amount != 80 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected original expired quota amount 80, got %g", finalQuota.Amount)}
+	if finalQuota.Amount != decimal.New(80) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected original expired quota amount 80, got %s", finalQuota.Amount)}
 	}
 
 	// Verify expired quota status (may still be valid, because we didn't run expiry process)
@@ -398,10 +399,10 @@ func testBatchQuotaExpiryConsistency(ctx *TestContext) TestResult {
 	// Create multiple quotas with different expiry times
 	now := time.Now().Truncate(time.Second)
 	quotas := []*models.Quota{
-		{UserID: user.ID, Amount: 100, ExpiryDate: now.Add(-2 * time.Hour), Status: models.StatusValid},    // expired
-		{UserID: user.ID, Amount: 150, ExpiryDate: now.Add(-30 * time.Minute), Status: models.StatusValid}, // expired
-		{UserID: user.ID, Amount: 200, ExpiryDate: now.Add(24 * time.Hour), Status: models.StatusValid},    // valid
-		{UserID: user.ID, Amount: 120, ExpiryDate: now.Add(48 * time.Hour), Status: models.StatusValid},    // valid
+		{UserID: user.ID, Amount: decimal.New(100), ExpiryDate: now.Add(-2 * time.Hour), Status: models.StatusValid},    // expired
+		{UserID: user.ID, Amount: decimal.New(150), ExpiryDate: now.Add(-30 * time.Minute), Status: models.StatusValid}, // expired
+		{UserID: user.ID, Amount: decimal.New(200), ExpiryDate: now.Add(24 * time.Hour), Status: models.StatusValid},    // valid
+		{UserID: user.ID, Amount: decimal.New(120), ExpiryDate: now.Add(48 * time.Hour), Status: models.StatusValid},    // valid
 	}
 
 	for i, quota := range quotas {
@@ -456,9 +457,9 @@ func testBatchQuotaExpiryConsistency(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
 	}
 
-	expectedValidTotal := 200.0 + 120.0 // only non-expired quota
+	expectedValidTotal := decimal.New(200 + 120) // only non-expired quota
 	if quotaInfo.TotalQuota != expectedValidTotal {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total valid quota %f, got %f", expectedValidTotal, quotaInfo.TotalQuota)}
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected total valid quota %s, got %s", expectedValidTotal, quotaInfo.TotalQuota)}
 	}
 
 	return TestResult{Passed: true, Message: "Batch Quota Expiry Consistency Test Succeeded"}
@@ -476,7 +477,7 @@ func testTransferOutExpiryDateValidation(ctx *TestContext) TestResult {
 	validDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
 	quota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     200,
+		Amount:     decimal.New(200),
 		ExpiryDate: validDate,
 		Status:     models.StatusValid,
 	}
@@ -495,7 +496,7 @@ func testTransferOutExpiryDateValidation(ctx *TestContext) TestResult {
 	transferReqPast := &services.TransferOutRequest{
 		ReceiverID: "receiver_validation",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: pastDate},
+			{Amount: decimal.New(50), ExpiryDate: pastDate},
 		},
 	}
 
@@ -509,7 +510,7 @@ func testTransferOutExpiryDateValidation(ctx *TestContext) TestResult {
 	transferReqFuture := &services.TransferOutRequest{
 		ReceiverID: "receiver_validation",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: futureDate},
+			{Amount: decimal.New(50), ExpiryDate: futureDate},
 		},
 	}
 
@@ -522,7 +523,7 @@ func testTransferOutExpiryDateValidation(ctx *TestContext) TestResult {
 	transferReqValid := &services.TransferOutRequest{
 		ReceiverID: "receiver_validation",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: validDate},
+			{Amount: decimal.New(50), ExpiryDate: validDate},
 		},
 	}
 
@@ -541,8 +542,8 @@ func testTransferOutExpiryDateValidation(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get updated quota: %v", err)}
 	}
 
-	if updatedQuota.Amount != 150 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota 150, got %g", updatedQuota.Amount)}
+	if updatedQuota.Amount != decimal.New(150) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota 150, got %s", updatedQuota.Amount)}
 	}
 
 	return TestResult{Passed: true, Message: "Transfer Out Expiry Date Validation Test Succeeded"}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 	"time"
 
 	"github.com/stretchr/testify/mock"
@@ -60,7 +61,7 @@ func createTestQuotaWithExpiry(ctx *TestContext, userID string, amount float64,
 func createTestQuota(ctx *TestContext, userID string, amount float64, status string, expiryTime time.Time) (*models.Quota, error) {
 	quota := &models.Quota{
 		UserID:     userID,
-		Amount:     amount,
+		Amount:     decimal.FromFloat(amount),
 		Status:     status,
 		ExpiryDate: expiryTime,
 		CreateTime: time.Now(),
@@ -134,13 +135,14 @@ func verifyUserExpiredQuotaCount(ctx *TestContext, userID string, expectedCount
 
 // 验证用户配额总金额（按状态分组）
 func verifyUserQuotaAmountByStatus(ctx *TestContext, userID string, status string, expectedAmount float64) error {
-	var totalAmount float64
+	var result struct{ Total decimal.Amount }
 	err := ctx.DB.Model(&models.Quota{}).
 		Where("user_id = ? AND status = ?", userID, status).
-		Select("COALESCE(SUM(amount), 0)").Scan(&totalAmount).Error
+		Select("COALESCE(SUM(amount), 0) AS total").Scan(&result).Error
 	if err != nil {
 		return err
 	}
+	totalAmount := result.Total.Float64()
 	if math.Abs(totalAmount-expectedAmount) > 0.0001 {
 		return fmt.Errorf("expected amount %f for status %s, got %f", expectedAmount, status, totalAmount)
 	}
@@ -164,8 +166,8 @@ func verifyUserQuotaRecordsIntegrity(ctx *TestContext, userID string, expectedRe
 		if quota.Status != expected.Status {
 			return fmt.Errorf("quota record %d: expected status %s, got %s", i, expected.Status, quota.Status)
 		}
-		if math.Abs(quota.Amount-expected.Amount) > 0.0001 {
-			return fmt.Errorf("quota record %d: expected amount %f, got %f", i, expected.Amount, quota.Amount)
+		if math.Abs(quota.Amount.Float64()-expected.Amount) > 0.0001 {
+			return fmt.Errorf("quota record %d: expected amount %f, got %s", i, expected.Amount, quota.Amount)
 		}
 
 		// 使用秒级精度比较时间，避免数据库存储时纳秒精度截断导致的问题
@@ -305,8 +307,8 @@ func verifyQuotaExpiryAuditExists(ctx *TestContext, userID string, expectedAmoun
 		return err
 	}
 
-	if math.Abs(auditRecord.Amount-expectedAmount) > 0.0001 {
-		return fmt.Errorf("audit record amount mismatch: expected %f, got %f", expectedAmount, auditRecord.Amount)
+	if math.Abs(auditRecord.Amount.Float64()-expectedAmount) > 0.0001 {
+		return fmt.Errorf("audit record amount mismatch: expected %f, got %s", expectedAmount, auditRecord.Amount)
 	}
 
 	if auditRecord.Operation != "EXPIRE" {
@@ -335,7 +337,7 @@ func verifyNoUnexpectedAuditRecords(ctx *TestContext, userID string, excludedOpe
 		}
 
 		if !excluded {
-			return fmt.Errorf("found unexpected audit record: operation=%s, amount=%f", record.Operation, record.Amount)
+			return fmt.Errorf("found unexpected audit record: operation=%s, amount=%s", record.Operation, record.Amount)
 		}
 	}
 	return nil
@@ -461,8 +463,8 @@ func verifyQuotaExpiryAudit(ctx *TestContext, quotaID string, expectedOperation
 		return err
 	}
 
-	if math.Abs(auditRecord.Amount-expectedAmount) > 0.0001 {
-		return fmt.Errorf("audit record amount mismatch: expected %f, got %f", expectedAmount, auditRecord.Amount)
+	if math.Abs(auditRecord.Amount.Float64()-expectedAmount) > 0.0001 {
+		return fmt.Errorf("audit record amount mismatch: expected %f, got %s", expectedAmount, auditRecord.Amount)
 	}
 
 	if auditRecord.Operation != expectedOperation {
@@ -562,8 +564,8 @@ func verifyMonthlyQuotaUsageRecord(ctx *TestContext, userID string, expectedYear
 	}
 
 	// 验证已使用配额金额
-	if math.Abs(monthlyQuotaUsage.UsedQuota-expectedUsedQuota) > 0.0001 {
-		return fmt.Errorf("monthly quota usage amount mismatch for user %s: expected %f, got %f", userID, expectedUsedQuota, monthlyQuotaUsage.UsedQuota)
+	if math.Abs(monthlyQuotaUsage.UsedQuota.Float64()-expectedUsedQuota) > 0.0001 {
+		return fmt.Errorf("monthly quota usage amount mismatch for user %s: expected %f, got %s", userID, expectedUsedQuota, monthlyQuotaUsage.UsedQuota)
 	}
 
 	// 验证记录时间不为空
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testConcurrentDoubleSpend races transfers, deductions and holds against one user's quota and checks
+// that together they never spend more than the user has
+func testConcurrentDoubleSpend(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "double_spend", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	mockStore.SetUsed(giver.ID, 0)
+
+	// 100 quota, 40 attempts of 10 each
+	const workers = 40
+	unit := decimal.New(10)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	spent, heldCount, succeeded := decimal.Zero, 0, 0
+	var unexpected []error
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			var err error
+			switch i % 4 {
+			case 0, 1:
+				_, err = ctx.QuotaService.TransferOut(giver, &services.TransferOutRequest{
+					ReceiverID: receiver.ID,
+					QuotaList:  []services.TransferQuotaItem{{Amount: unit, ExpiryDate: expiryDate}},
+				})
+			case 2:
+				err = ctx.QuotaService.DeductQuota(giver.ID, unit, "stress test", fmt.Sprintf("double-spend-%d", i), "")
+			case 3:
+				_, err = ctx.QuotaService.CreateReservation("test-automation", &services.CreateReservationRequest{
+					UserID: giver.ID, Amount: unit, TTLSeconds: 600, Reason: "stress test",
+				})
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil && i%4 == 3:
+				heldCount++
+				succeeded++
+			case err == nil:
+				spent = spent.Add(unit)
+				succeeded++
+			case !strings.Contains(err.Error(), "insufficient"):
+				unexpected = append(unexpected, err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if len(unexpected) > 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected errors under contention: %v", unexpected)}
+	}
+	if succeeded != 10 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected exactly 10 of %d operations to succeed, got %d", workers, succeeded)}
+	}
+
+	var quotas []models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", giver.ID, models.StatusValid).Find(&quotas).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quotas: %v", err)}
+	}
+	remaining := decimal.Zero
+	for _, quota := range quotas {
+		if quota.Amount.IsNegative() {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Bucket went negative: %s", quota.Amount)}
+		}
+		remaining = remaining.Add(quota.Amount)
+	}
+	if remaining != decimal.New(100).Sub(spent) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected %s left after spending %s, got %s", decimal.New(100).Sub(spent), spent, remaining)}
+	}
+
+	quotaInfo, err := ctx.QuotaService.GetUserQuota(giver.ID)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
+	}
+	if quotaInfo.HeldQuota != unit.Mul(int64(heldCount)) || quotaInfo.TotalQuota.Sub(quotaInfo.HeldQuota).IsNegative() {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected %d holds within total %s, got held %s",
+			heldCount, quotaInfo.TotalQuota, quotaInfo.HeldQuota)}
+	}
+
+	// AiGateway ends up with the same balance once the outbox is drained
+	ctx.QuotaService.Outbox().DispatchUser(giver.ID)
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != remaining.Float64() {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota %s, got %g", remaining, gatewayQuota)}
+	}
+
+	return TestResult{Passed: true, Message: "Concurrent Double Spend Test Succeeded"}
+}
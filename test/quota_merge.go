@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// validQuotaSum sums the user's valid quota buckets
+func validQuotaSum(ctx *TestContext, userID string) decimal.Amount {
+	var quotas []models.Quota
+	ctx.DB.Where("user_id = ? AND status = ?", userID, models.StatusValid).Find(&quotas)
+	var total decimal.Amount
+	for _, quota := range quotas {
+		total = total.Add(quota.Amount)
+	}
+	return total
+}
+
+// testQuotaMergeUndo tests merge previews, merges carrying personal settings, and undoing merges within the undo window
+func testQuotaMergeUndo(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	laterExpiry := expiryDate.Add(30 * 24 * time.Hour)
+	other, main, err := setupTransferCancelUsers(ctx, "merge", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	// The other user's first bucket merges into the main user's, the gpt-4 bucket moves as is
+	mainBucket := &models.Quota{UserID: main.ID, Amount: decimal.New(40), ExpiryDate: expiryDate, Status: models.StatusValid}
+	modelBucket := &models.Quota{UserID: other.ID, Amount: decimal.New(20), Model: "gpt-4", ExpiryDate: laterExpiry, Status: models.StatusValid}
+	for _, quota := range []*models.Quota{mainBucket, modelBucket} {
+		if err := ctx.DB.Create(quota).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Create quota failed: %v", err)}
+		}
+	}
+	mockStore.SetQuota(main.ID, 40)
+	mockStore.SetQuota(other.ID, 120)
+	mockStore.SetModelQuota(other.ID, "gpt-4", 20)
+	mockStore.SetUsed(other.ID, 10)
+	execute := &models.QuotaExecute{StrategyID: 1, User: other.ID, BatchNumber: "merge-batch", Status: "completed", ExpiryDate: expiryDate}
+	if err := ctx.DB.Create(execute).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create strategy execution failed: %v", err)}
+	}
+	whitelist := &models.ModelWhitelist{TargetType: models.TargetTypeUser, TargetIdentifier: other.ID}
+	whitelist.SetAllowedModelsFromSlice([]string{"gpt-4", "deepseek-v3"})
+	if err := ctx.DB.Create(whitelist).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create whitelist failed: %v", err)}
+	}
+	aiGatewayConfig := &ctx.QuotaService.GetConfigManager().GetDirect().AiGateway
+	syncConfig := &config.EmployeeSyncConfig{Enabled: false}
+	ctx.QuotaService.SetPermissionServices(
+		services.NewPermissionService(ctx.DB, aiGatewayConfig, syncConfig, ctx.Gateway),
+		services.NewStarCheckPermissionService(ctx.DB, aiGatewayConfig, syncConfig, ctx.Gateway),
+		services.NewQuotaCheckPermissionService(ctx.DB, aiGatewayConfig, syncConfig, ctx.Gateway))
+	defer ctx.QuotaService.SetPermissionServices(nil, nil, nil)
+
+	// The preview reports what would move without moving it
+	req := &services.MergeQuotaRequest{MainUserID: main.ID, OtherUserID: other.ID, CarryPermissions: true}
+	preview, err := ctx.QuotaService.PreviewMergeUserQuota(req)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Preview merge failed: %v", err)}
+	}
+	if preview.Amount != decimal.New(120) || len(preview.Buckets) != 2 || preview.Buckets[0].MainQuotaID != mainBucket.ID ||
+		preview.Buckets[1].MainQuotaID != modelBucket.ID || preview.UsedQuota != decimal.New(10) || preview.StrategyExecutions != 1 ||
+		preview.Permissions == nil || len(preview.Permissions.ModelWhitelist) != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected merge preview: %+v", preview)}
+	}
+	if sum := validQuotaSum(ctx, other.ID); sum != decimal.New(120) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the preview to leave 120 with the other user, got %s", sum)}
+	}
+
+	merged, err := ctx.QuotaService.MergeUserQuota(testAdminUserID, req)
+	if err != nil || merged.Status != "SUCCESS" || merged.MergeID == 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Merge failed: %+v (%v)", merged, err)}
+	}
+	if mainSum, otherSum := validQuotaSum(ctx, main.ID), validQuotaSum(ctx, other.ID); mainSum != decimal.New(160) || !otherSum.IsZero() {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 160 with the main user and none left, got %s and %s", mainSum, otherSum)}
+	}
+	if mockStore.GetQuota(main.ID) != 160 || mockStore.GetUsed(main.ID) != 10 || mockStore.GetModelQuota(main.ID, "gpt-4") != 20 ||
+		mockStore.GetQuota(other.ID) != 0 || mockStore.GetUsed(other.ID) != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected AiGateway after merge: main %g/%g used, other %g/%g used",
+			mockStore.GetQuota(main.ID), mockStore.GetUsed(main.ID), mockStore.GetQuota(other.ID), mockStore.GetUsed(other.ID))}
+	}
+	var audits []models.QuotaAudit
+	ctx.DB.Where("merge_id = ?", merged.MergeID).Order("user_id").Find(&audits)
+	if len(audits) != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected MERGE_IN and MERGE_OUT audits, got %d", len(audits))}
+	}
+	for _, audit := range audits {
+		if (audit.UserID == main.ID) != (audit.Operation == models.OperationMergeIn && audit.Amount == decimal.New(120)) {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected merge audit %s %s for %s", audit.Operation, audit.Amount, audit.UserID)}
+		}
+	}
+	var carried, effective int64
+	ctx.DB.Model(&models.ModelWhitelist{}).Where("target_type = ? AND target_identifier = ?", models.TargetTypeUser, main.ID).Count(&carried)
+	ctx.DB.Model(&models.EffectivePermission{}).Where("employee_number = ?", main.ID).Count(&effective)
+	if carried != 1 || effective != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the whitelist carried over and applied, got %d whitelists and %d effective", carried, effective)}
+	}
+
+	records, total, err := ctx.QuotaService.GetQuotaMerges(other.ID, 1, 10)
+	if err != nil || total != 1 || records[0].Status != models.QuotaMergeStatusMerged || len(records[0].Snapshot.ExecuteIDs) != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected one merge record with its snapshot, got %d (%v)", total, err)}
+	}
+
+	// Undo restores the other user's buckets, AiGateway totals and settings, once
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	adminToken := "Bearer " + createTestJWTToken(testAdminUserID)
+	undoPath := fmt.Sprintf("%s/quota/merges/%d/undo", auth.APIPrefix, merged.MergeID)
+	if status, resp := doAuthorizedRequest(router, http.MethodPost, undoPath, "Authorization", adminToken, ""); status != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the undo to succeed, got %d %s", status, resp.Message)}
+	}
+	var restored []models.Quota
+	ctx.DB.Where("user_id = ? AND status = ?", other.ID, models.StatusValid).Order("expiry_date").Find(&restored)
+	if len(restored) != 2 || restored[0].Amount != decimal.New(100) || !restored[0].ExpiryDate.Equal(expiryDate) ||
+		restored[1].ID != modelBucket.ID || restored[1].Amount != decimal.New(20) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the other user's buckets restored, got %+v", restored)}
+	}
+	if sum := validQuotaSum(ctx, main.ID); sum != decimal.New(40) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the main user back at 40, got %s", sum)}
+	}
+	if mockStore.GetQuota(main.ID) != 40 || mockStore.GetUsed(main.ID) != 0 || mockStore.GetModelQuota(main.ID, "gpt-4") != 0 ||
+		mockStore.GetQuota(other.ID) != 120 || mockStore.GetUsed(other.ID) != 10 || mockStore.GetModelQuota(other.ID, "gpt-4") != 20 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected AiGateway after undo: main %g/%g used, other %g/%g used",
+			mockStore.GetQuota(main.ID), mockStore.GetUsed(main.ID), mockStore.GetQuota(other.ID), mockStore.GetUsed(other.ID))}
+	}
+	ctx.DB.Model(&models.ModelWhitelist{}).Where("target_type = ? AND target_identifier = ?", models.TargetTypeUser, main.ID).Count(&carried)
+	var executeUser models.QuotaExecute
+	ctx.DB.First(&executeUser, execute.ID)
+	if carried != 0 || executeUser.User != other.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the whitelist removed and execution restored, got %d whitelists and user %s", carried, executeUser.User)}
+	}
+	if status, resp := doAuthorizedRequest(router, http.MethodPost, undoPath, "Authorization", adminToken, ""); status != http.StatusConflict || resp.Code != response.MergeNotUndoableCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 409 undoing twice, got %d %s", status, resp.Code)}
+	}
+
+	// Merges past the undo window stay merged
+	again, err := ctx.QuotaService.MergeUserQuota(testAdminUserID, &services.MergeQuotaRequest{MainUserID: main.ID, OtherUserID: other.ID})
+	if err != nil || again.MergeID == 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Second merge failed: %+v (%v)", again, err)}
+	}
+	if err := ctx.DB.Model(&models.QuotaMerge{}).Where("id = ?", again.MergeID).
+		Update("undoable_until", time.Now().Add(-time.Minute)).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Backdate merge failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.UndoQuotaMerge(testAdminUserID, again.MergeID); err == nil {
+		return TestResult{Passed: false, Message: "Expected undoing a merge past its window to fail"}
+	}
+	if sum := validQuotaSum(ctx, main.ID); sum != decimal.New(160) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the main user to keep 160, got %s", sum)}
+	}
+
+	return TestResult{Passed: true, Message: "Quota Merge Undo Test Succeeded"}
+}
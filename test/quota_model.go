@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testModelScopedQuota tests that strategies with a model grant into that model's bucket and
+// deductions for the model use it before the general pool
+func testModelScopedQuota(ctx *TestContext) TestResult {
+	user := createTestUser("model_quota_user", "Model Quota User", 0)
+	if err := ctx.DB.AuthDB.Create(user).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+	}
+
+	generalExpiry := time.Now().Truncate(time.Second).AddDate(0, 2, 0)
+	if err := ctx.DB.Create(&models.Quota{UserID: user.ID, Amount: decimal.New(100), ExpiryDate: generalExpiry, Status: models.StatusValid}).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create general quota failed: %v", err)}
+	}
+	mockStore.SetQuota(user.ID, 100)
+	mockStore.SetUsed(user.ID, 0)
+
+	strategy := &models.QuotaStrategy{
+		Name:      "model-scoped-grant",
+		Title:     "Model Scoped Grant",
+		Type:      "single",
+		Amount:    decimal.New(30),
+		Model:     "gpt-4",
+		Condition: "true()",
+		Status:    true,
+	}
+	if err := ctx.StrategyService.CreateStrategy(strategy); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create strategy failed: %v", err)}
+	}
+	ctx.StrategyService.ExecStrategy(strategy, []models.UserInfo{*user})
+
+	// The grant lands in the model's bucket and is pushed to AiGateway for that model
+	var modelQuota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND model = ?", user.ID, "gpt-4").First(&modelQuota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected gpt-4 quota bucket: %v", err)}
+	}
+	if modelQuota.Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected gpt-4 bucket of 30, got %s", modelQuota.Amount)}
+	}
+	if total, model := mockStore.GetQuota(user.ID), mockStore.GetModelQuota(user.ID, "gpt-4"); total != 130 || model != 30 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway total 130 and gpt-4 30, got %g and %g", total, model)}
+	}
+
+	quotaInfo, err := ctx.QuotaService.GetUserQuota(user.ID)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
+	}
+	if quotaInfo.ModelQuotas["gpt-4"] != decimal.New(30) || len(quotaInfo.QuotaList) != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected gpt-4 balance 30 in 2 items, got %v in %d items", quotaInfo.ModelQuotas, len(quotaInfo.QuotaList))}
+	}
+
+	// Model-scoped quota cannot be given away
+	if _, err := ctx.QuotaService.TransferOut(&models.AuthUser{ID: user.ID, Name: user.Name}, &services.TransferOutRequest{
+		ReceiverID: "model_quota_receiver",
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(10), ExpiryDate: modelQuota.ExpiryDate}},
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected transfer of model-scoped quota to fail"}
+	}
+
+	// A gpt-4 charge drains the gpt-4 bucket, then the general pool
+	if err := ctx.QuotaService.DeductQuota(user.ID, decimal.New(40), "long context", "model-job-1", "gpt-4"); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Deduct for gpt-4 failed: %v", err)}
+	}
+	var remainingModel int64
+	ctx.DB.Model(&models.Quota{}).Where("user_id = ? AND model = ?", user.ID, "gpt-4").Count(&remainingModel)
+	if remainingModel != 0 {
+		return TestResult{Passed: false, Message: "Expected gpt-4 bucket to be used up"}
+	}
+	var general models.Quota
+	if err := ctx.DB.Where("user_id = ? AND model = ''", user.ID).First(&general).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get general quota: %v", err)}
+	}
+	if general.Amount != decimal.New(90) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected general quota 90, got %s", general.Amount)}
+	}
+	if total, model := mockStore.GetQuota(user.ID), mockStore.GetModelQuota(user.ID, "gpt-4"); total != 90 || model != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway total 90 and gpt-4 0, got %g and %g", total, model)}
+	}
+
+	// Other models only reach the general pool
+	if err := ctx.QuotaService.DeductQuota(user.ID, decimal.New(95), "", "model-job-2", "claude"); err == nil {
+		return TestResult{Passed: false, Message: "Expected deduction beyond the general pool to fail"}
+	}
+
+	return TestResult{Passed: true, Message: "Model Scoped Quota Test Succeeded"}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// capturingQuotaRequestNotifier records quota request notifications instead of delivering them
+type capturingQuotaRequestNotifier struct {
+	mu     sync.Mutex
+	events []*services.QuotaRequestNotification
+}
+
+func (n *capturingQuotaRequestNotifier) NotifyQuotaRequest(notification *services.QuotaRequestNotification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, notification)
+	return nil
+}
+
+// testQuotaRequests tests filing, approving, rejecting, cancelling and expiring quota requests
+func testQuotaRequests(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	approver, requester, err := setupTransferCancelUsers(ctx, "quota_request", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	notifier := &capturingQuotaRequestNotifier{}
+	ctx.QuotaService.SetQuotaRequestNotifier(notifier)
+
+	if _, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: requester.ID, Amount: decimal.New(10), Reason: "self",
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a request to yourself to fail"}
+	}
+
+	// Approval transfers the requested amount from the approver's earliest quota
+	request, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: approver.ID, Amount: decimal.New(30), Reason: "load test",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota request failed: %v", err)}
+	}
+	if request.Status != models.QuotaRequestStatusPending || !request.ExpiresAt.After(time.Now()) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a pending request expiring in the future, got %+v", request)}
+	}
+	inbox, total, err := ctx.QuotaService.GetQuotaRequests(approver.ID, true, "", 1, 10)
+	if err != nil || total != 1 || len(inbox) != 1 || inbox[0].ID != request.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the request in the approver's inbox, got %d (%v)", total, err)}
+	}
+	if len(notifier.events) != 1 || notifier.events[0].Event != services.QuotaRequestCreatedEvent || notifier.events[0].UserID != approver.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a created notification to the approver, got %d events", len(notifier.events))}
+	}
+
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(requester, request.ID, &services.ApproveQuotaRequestRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected the requester approving their own request to fail"}
+	}
+	approved, err := ctx.QuotaService.ApproveQuotaRequest(approver, request.ID, &services.ApproveQuotaRequestRequest{Note: "go ahead"})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Approve quota request failed: %v", err)}
+	}
+	if approved.Request.Status != models.QuotaRequestStatusApproved || len(approved.QuotaList) != 1 ||
+		approved.QuotaList[0].Amount != decimal.New(30) || !approved.QuotaList[0].ExpiryDate.Equal(expiryDate) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 30 transferred from the %s bucket, got %+v", expiryDate, approved)}
+	}
+	var requesterQuota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", requester.ID, models.StatusValid).First(&requesterQuota).Error; err != nil ||
+		requesterQuota.Amount != decimal.New(30) || !requesterQuota.ExpiryDate.Equal(expiryDate) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the requester to hold 30, got %s (%v)", requesterQuota.Amount, err)}
+	}
+	if gatewayQuota := mockStore.GetQuota(approver.ID); gatewayQuota != 70 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected approver AiGateway quota 70, got %g", gatewayQuota)}
+	}
+	if gatewayQuota := mockStore.GetQuota(requester.ID); gatewayQuota != 30 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected requester AiGateway quota 30, got %g", gatewayQuota)}
+	}
+	var audits int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("request_id = ? AND operation IN ?", request.ID,
+		[]string{models.OperationTransferOut, models.OperationTransferIn}).Count(&audits)
+	if audits != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected TRANSFER_OUT and TRANSFER_IN audits for the request, got %d", audits)}
+	}
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(approver, request.ID, &services.ApproveQuotaRequestRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected approving a decided request to fail"}
+	}
+
+	// Requests above the approver's transferable quota cannot be approved
+	tooMuch, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: approver.ID, Amount: decimal.New(500), Reason: "too much",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota request failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(approver, tooMuch.ID, &services.ApproveQuotaRequestRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected approving more than the transferable quota to fail"}
+	}
+	if _, err := ctx.QuotaService.RejectQuotaRequest(approver, tooMuch.ID, &services.DecideQuotaRequestRequest{Note: "not now"}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Reject quota request failed: %v", err)}
+	}
+	last := notifier.events[len(notifier.events)-1]
+	if last.Event != services.QuotaRequestRejectedEvent || last.UserID != requester.ID || last.DecisionNote != "not now" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a rejected notification to the requester, got %+v", last)}
+	}
+
+	// Items on the same expiry date are checked together, so they cannot add up to more than the bucket
+	split, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: approver.ID, Amount: decimal.New(120), Reason: "split",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota request failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(approver, split.ID, &services.ApproveQuotaRequestRequest{
+		QuotaList: []services.TransferQuotaItem{
+			{Amount: decimal.New(60), ExpiryDate: expiryDate},
+			{Amount: decimal.New(60), ExpiryDate: expiryDate},
+		},
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected approving two items over the same bucket to fail"}
+	}
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(approver, split.ID, &services.ApproveQuotaRequestRequest{
+		QuotaList: []services.TransferQuotaItem{{Amount: decimal.New(120), ExpiryDate: time.Now().Truncate(time.Second).Add(-time.Hour)}},
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected approving from expired quota to fail"}
+	}
+	if sum := validQuotaSum(ctx, approver.ID); sum != decimal.New(70) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the approver to keep 70, got %s", sum)}
+	}
+	if _, err := ctx.QuotaService.RejectQuotaRequest(approver, split.ID, &services.DecideQuotaRequestRequest{}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Reject quota request failed: %v", err)}
+	}
+
+	// Only the requester can cancel
+	cancelled, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: approver.ID, Amount: decimal.New(5), Reason: "cancel me",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota request failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.CancelQuotaRequest(approver, cancelled.ID, &services.DecideQuotaRequestRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected the approver cancelling the request to fail"}
+	}
+	if _, err := ctx.QuotaService.CancelQuotaRequest(requester, cancelled.ID, &services.DecideQuotaRequestRequest{}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Cancel quota request failed: %v", err)}
+	}
+
+	// Pending requests past their expiry are expired by the scheduler task
+	stale, err := ctx.QuotaService.CreateQuotaRequest(requester, &services.CreateQuotaRequestRequest{
+		ApproverID: approver.ID, Amount: decimal.New(5), Reason: "stale",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota request failed: %v", err)}
+	}
+	if err := ctx.DB.Model(&models.QuotaRequest{}).Where("id = ?", stale.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Backdate quota request failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ApproveQuotaRequest(approver, stale.ID, &services.ApproveQuotaRequestRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected approving an expired request to fail"}
+	}
+	if err := ctx.QuotaService.ExpireQuotaRequests(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expire quota requests failed: %v", err)}
+	}
+	detail, err := ctx.QuotaService.GetQuotaRequest(requester.ID, stale.ID)
+	if err != nil || detail.Status != models.QuotaRequestStatusExpired || len(detail.Events) != 2 ||
+		detail.Events[1].FromStatus != models.QuotaRequestStatusPending || detail.Events[1].Actor != "system" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the request expired by the system, got %+v (%v)", detail, err)}
+	}
+	last = notifier.events[len(notifier.events)-1]
+	if last.Event != services.QuotaRequestExpiredEvent || last.RequestID != stale.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected an expired notification, got %+v", last)}
+	}
+	sent, total, err := ctx.QuotaService.GetQuotaRequests(requester.ID, false, models.QuotaRequestStatusExpired, 1, 10)
+	if err != nil || total != 1 || len(sent) != 1 || sent[0].ID != stale.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected one expired sent request, got %d (%v)", total, err)}
+	}
+
+	// Requests are hidden from users who are not part of them
+	outsider := createTestUser("quota_request_outsider", "Quota Request Outsider", 0)
+	if err := ctx.DB.AuthDB.Create(outsider).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+	}
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	requestPath := fmt.Sprintf("%s/quota/requests/%d", auth.APIPrefix, request.ID)
+	if got, _ := doAuthorizedRequest(router, http.MethodGet, requestPath, "Authorization", "Bearer "+createTestJWTToken(outsider.ID), ""); got != http.StatusNotFound {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 404 for an outsider, got %d", got)}
+	}
+	if got, _ := doAuthorizedRequest(router, http.MethodGet, requestPath, "Authorization", "Bearer "+createTestJWTToken(requester.ID), ""); got != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for the requester, got %d", got)}
+	}
+	if got, _ := doAuthorizedRequest(router, http.MethodPost, requestPath+"/cancel", "Authorization", "Bearer "+createTestJWTToken(requester.ID), ""); got != http.StatusConflict {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 409 cancelling an approved request, got %d", got)}
+	}
+
+	return TestResult{Passed: true, Message: "Quota Request Test Succeeded"}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/utils"
+	"quota-manager/pkg/decimal"
+)
+
+// testExpiryRolloverPolicy tests the grace period, partial rollover with a cap and per-strategy rollover overrides
+func testExpiryRolloverPolicy(ctx *TestContext) TestResult {
+	configManager := ctx.QuotaService.GetConfigManager()
+	originalPolicy := configManager.GetDirect().ExpiryPolicy
+	configManager.Update(func(cfg *config.Config) {
+		cfg.ExpiryPolicy = config.ExpiryPolicyConfig{GraceHours: 24, RolloverPercent: 20, RolloverCap: decimal.New(50), RolloverMonths: 1}
+	})
+	defer configManager.Update(func(cfg *config.Config) { cfg.ExpiryPolicy = originalPolicy })
+
+	now := time.Now().Truncate(time.Second)
+	mixed := createTestUser("rollover_mixed", "Rollover Mixed", 0).ID
+	capped := createTestUser("rollover_capped", "Rollover Capped", 0).ID
+	grace := createTestUser("rollover_grace", "Rollover Grace", 0).ID
+	pastExpiry := now.Add(-48 * time.Hour)
+
+	// Promotional credit never rolls over
+	promoPercent := 0
+	promo := &models.QuotaStrategy{
+		Name: fmt.Sprintf("rollover-promo-%d", now.UnixNano()), Title: "Promo", Type: "single",
+		Amount: decimal.New(50), Condition: "false()", RolloverPercent: &promoPercent,
+	}
+	if err := ctx.DB.Create(promo).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create strategy: %v", err)}
+	}
+	if err := ctx.DB.Create(&models.QuotaExecute{
+		StrategyID: promo.ID, User: mixed, RecipientID: mixed, BatchNumber: "rollover", Status: "completed",
+		Amount: decimal.New(50), ExpiryDate: pastExpiry,
+	}).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create execution: %v", err)}
+	}
+
+	buckets := []models.Quota{
+		{UserID: mixed, Amount: decimal.New(150), ExpiryDate: pastExpiry, Status: models.StatusValid},
+		{UserID: capped, Amount: decimal.New(1000), ExpiryDate: pastExpiry, Status: models.StatusValid},
+		{UserID: grace, Amount: decimal.New(30), ExpiryDate: now.Add(-2 * time.Hour), Status: models.StatusValid},
+	}
+	if err := ctx.DB.Create(&buckets).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to create quota: %v", err)}
+	}
+	mockStore.SetQuota(mixed, 150)
+	mockStore.SetUsed(mixed, 60)
+	mockStore.SetQuota(capped, 1000)
+	mockStore.SetUsed(capped, 0)
+	mockStore.SetQuota(grace, 30)
+	mockStore.SetUsed(grace, 0)
+
+	if err := executeExpireQuotasTask(ctx); err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+
+	// Used quota comes out of the promotional 50 first, 20% of the remaining paid 90 rolls over
+	rolloverExpiry := utils.CalculateRolloverExpiryDate(utils.ToConfigTimezone(configManager.GetDirect(), pastExpiry), 1)
+	expected := map[string]decimal.Amount{mixed: decimal.New(18), capped: decimal.New(50)}
+	for userID, amount := range expected {
+		var rolled []models.Quota
+		if err := ctx.DB.Where("user_id = ? AND status = ?", userID, models.StatusValid).Find(&rolled).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quotas: %v", err)}
+		}
+		if len(rolled) != 1 || rolled[0].Amount != amount || !rolled[0].ExpiryDate.Equal(rolloverExpiry) {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected %s rolled over to %s, got %+v", amount, rolloverExpiry, rolled)}
+		}
+
+		var audit models.QuotaAudit
+		if err := ctx.DB.Where("user_id = ? AND operation = ?", userID, models.OperationRollover).First(&audit).Error; err != nil || audit.Amount != amount {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected a ROLLOVER audit of %s, got %+v (%v)", amount, audit, err)}
+		}
+		if gatewayQuota := mockStore.GetQuota(userID); gatewayQuota != amount.Float64() {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota %s after rollover, got %g", amount, gatewayQuota)}
+		}
+	}
+	if used := mockStore.GetUsed(mixed); used != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected used quota reset to 0, got %g", used)}
+	}
+
+	// Quota inside the grace period stays usable
+	var graceQuota models.Quota
+	if err := ctx.DB.First(&graceQuota, buckets[2].ID).Error; err != nil || graceQuota.Status != models.StatusValid {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota in its grace period to stay valid, got %+v (%v)", graceQuota, err)}
+	}
+
+	return TestResult{Passed: true, Message: "Expiry Rollover Policy Test Succeeded"}
+}
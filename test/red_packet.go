@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testRedPackets tests equal and random red packets, concurrent claims and the expiry refund
+func testRedPackets(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, _, err := setupTransferCancelUsers(ctx, "red_packet", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	claimers := make([]*models.AuthUser, 6)
+	for i := range claimers {
+		user := createTestUser(fmt.Sprintf("red_packet_claimer_%d", i), fmt.Sprintf("Claimer %d", i), 0)
+		claimers[i] = &models.AuthUser{ID: user.ID, Name: user.Name}
+	}
+
+	if _, err := ctx.QuotaService.CreateRedPacket(giver, &services.CreateRedPacketRequest{
+		TotalAmount: decimal.New(200), MaxClaims: 3, SplitMode: models.RedPacketSplitEqual, ExpiryDate: expiryDate,
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a red packet above the giver's quota to fail"}
+	}
+	equal, err := ctx.QuotaService.CreateRedPacket(giver, &services.CreateRedPacketRequest{
+		TotalAmount: decimal.New(10), MaxClaims: 3, SplitMode: models.RedPacketSplitEqual, ExpiryDate: expiryDate,
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create red packet failed: %v", err)}
+	}
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != 90 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 90 after funding, got %g", gatewayQuota)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(giver, &services.ClaimRedPacketRequest{Code: equal.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected the giver's own claim to fail"}
+	}
+
+	// Six users race for three shares
+	var wg sync.WaitGroup
+	shares := make([]decimal.Amount, len(claimers))
+	for i, claimer := range claimers {
+		wg.Add(1)
+		go func(i int, claimer *models.AuthUser) {
+			defer wg.Done()
+			if resp, err := ctx.QuotaService.ClaimRedPacket(claimer, &services.ClaimRedPacketRequest{Code: equal.Code}); err == nil {
+				shares[i] = resp.Amount
+			}
+		}(i, claimer)
+	}
+	wg.Wait()
+	claimed, total := 0, decimal.Zero
+	for i, share := range shares {
+		if share.IsZero() {
+			continue
+		}
+		claimed++
+		total = total.Add(share)
+		if share.LessThan(decimal.MustParse("3.333333")) || share.GreaterThan(decimal.MustParse("3.333334")) {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected an equal share, got %s", share)}
+		}
+		var quota models.Quota
+		if err := ctx.DB.Where("user_id = ? AND expiry_date = ? AND status = ?", claimers[i].ID, expiryDate, models.StatusValid).First(&quota).Error; err != nil || quota.Amount != share {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected claimer quota %s, got %s (%v)", share, quota.Amount, err)}
+		}
+	}
+	if claimed != 3 || total != decimal.New(10) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 claims of 10 in total, got %d of %s", claimed, total)}
+	}
+	var claimAudits int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("red_packet_id = ? AND operation = ?", equal.ID, models.OperationTransferIn).Count(&claimAudits)
+	if claimAudits != 3 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 3 TRANSFER_IN audit records for the red packet, got %d", claimAudits)}
+	}
+
+	// Random shares add up to the pot and leave the minimum for every later claim
+	random, err := ctx.QuotaService.CreateRedPacket(giver, &services.CreateRedPacketRequest{
+		TotalAmount: decimal.New(5), MaxClaims: 4, SplitMode: models.RedPacketSplitRandom, ExpiryDate: expiryDate,
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create red packet failed: %v", err)}
+	}
+	total = decimal.Zero
+	for _, claimer := range claimers[:4] {
+		resp, err := ctx.QuotaService.ClaimRedPacket(claimer, &services.ClaimRedPacketRequest{Code: random.Code})
+		if err != nil || resp.Amount.LessThan(decimal.MustParse("0.01")) {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected a random share of at least 0.01, got %+v (%v)", resp, err)}
+		}
+		total = total.Add(resp.Amount)
+	}
+	if total != decimal.New(5) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected random shares to add up to 5, got %s", total)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(claimers[4], &services.ClaimRedPacketRequest{Code: random.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a claim on an exhausted red packet to fail"}
+	}
+
+	// The unclaimed remainder of an expired pot goes back to the giver
+	expiring, err := ctx.QuotaService.CreateRedPacket(giver, &services.CreateRedPacketRequest{
+		TotalAmount: decimal.New(20), MaxClaims: 2, SplitMode: models.RedPacketSplitEqual, ExpiryDate: expiryDate,
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create red packet failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(claimers[0], &services.ClaimRedPacketRequest{Code: expiring.Code}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Claim red packet failed: %v", err)}
+	}
+	if err := ctx.DB.Model(expiring).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to expire red packet: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(claimers[1], &services.ClaimRedPacketRequest{Code: expiring.Code}); err == nil {
+		return TestResult{Passed: false, Message: "Expected a claim on an expired red packet to fail"}
+	}
+	if err := ctx.QuotaService.RefundExpiredRedPackets(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Refund expired red packets failed: %v", err)}
+	}
+	var refund models.QuotaAudit
+	if err := ctx.DB.Where("red_packet_id = ? AND operation = ?", expiring.ID, models.OperationTransferRefund).First(&refund).Error; err != nil || refund.Amount != decimal.New(10) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a TRANSFER_REFUND of 10, got %+v (%v)", refund, err)}
+	}
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND expiry_date = ? AND status = ?", giver.ID, expiryDate, models.StatusValid).First(&quota).Error; err != nil || quota.Amount != decimal.New(75) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected giver quota 75 after the refund, got %s (%v)", quota.Amount, err)}
+	}
+	var packet models.RedPacket
+	if err := ctx.DB.First(&packet, expiring.ID).Error; err != nil || packet.Status != models.RedPacketStatusRefunded {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the red packet to be refunded, got %s (%v)", packet.Status, err)}
+	}
+
+	// Unknown codes are 404, malformed ones 400
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	unknownCode, _ := services.GenerateShortVoucherCode()
+	claimerToken := "Bearer " + createTestJWTToken(claimers[5].ID)
+	claimPath := auth.APIPrefix + "/quota/red-packets/claim"
+	expected := map[string]int{unknownCode: http.StatusNotFound, "not-a-red-packet-code": http.StatusBadRequest}
+	for code, status := range expected {
+		if got, _ := doAuthorizedRequest(router, http.MethodPost, claimPath, "Authorization", claimerToken, fmt.Sprintf(`{"code":"%s"}`, code)); got != status {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected %d claiming %s, got %d", status, code, got)}
+		}
+	}
+
+	return TestResult{Passed: true, Message: "Red Packet Test Succeeded"}
+}
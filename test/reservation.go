@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+
+	"github.com/gin-gonic/gin"
+)
+
+// doReservationRequest posts to a reservation endpoint as the test service account
+func doReservationRequest(router *gin.Engine, path, body string) (*httptest.ResponseRecorder, response.ResponseData) {
+	req, _ := http.NewRequest(http.MethodPost, auth.APIPrefix+"/quota/reservations"+path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testServiceAccountToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp response.ResponseData
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+// testQuotaReservations tests hold, partial capture, release and TTL expiry of quota reservations
+func testQuotaReservations(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "reservation", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	mockStore.SetUsed(giver.ID, 0)
+
+	// Hold 60 of 100 over HTTP
+	w, resp := doReservationRequest(router, "", fmt.Sprintf(`{"user_id":"%s","amount":60,"reason":"batch job","reference_id":"job-7"}`, giver.ID))
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for hold, got %d: %s", w.Code, resp.Message)}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	idValue, _ := data["id"].(float64)
+	reservationID := int(idValue)
+	if data["status"] != models.ReservationStatusHeld || data["created_by"] != "service:test-automation" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected reservation: %v", data)}
+	}
+
+	// Holds reduce the available balance but not the stored quota
+	quotaInfo, err := ctx.QuotaService.GetUserQuota(giver.ID)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
+	}
+	if quotaInfo.HeldQuota != decimal.New(60) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected held quota 60, got %s", quotaInfo.HeldQuota)}
+	}
+	if _, err := ctx.QuotaService.TransferOut(giver, &services.TransferOutRequest{
+		ReceiverID: receiver.ID,
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(50), ExpiryDate: expiryDate}},
+	}); err == nil {
+		return TestResult{Passed: false, Message: "Expected transfer of held quota to fail"}
+	}
+	if w, resp := doReservationRequest(router, "", fmt.Sprintf(`{"user_id":"%s","amount":50}`, giver.ID)); w.Code != http.StatusBadRequest || resp.Code != response.InsufficientQuotaCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 insufficient quota for second hold, got %d %s", w.Code, resp.Code)}
+	}
+
+	// Capture 45 of the 60 held, the remaining 15 is released
+	w, resp = doReservationRequest(router, fmt.Sprintf("/%d/capture", reservationID), `{"amount":45}`)
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for capture, got %d: %s", w.Code, resp.Message)}
+	}
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND status = ?", giver.ID, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(55) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota 55 after capture, got %s", quota.Amount)}
+	}
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != 55 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 55 after capture, got %g", gatewayQuota)}
+	}
+
+	// A settled reservation cannot be settled again
+	if w, resp := doReservationRequest(router, fmt.Sprintf("/%d/release", reservationID), ""); w.Code != http.StatusConflict || resp.Code != response.ReservationNotHeldCode {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 409 for releasing a captured reservation, got %d %s", w.Code, resp.Code)}
+	}
+	if w, _ := doReservationRequest(router, "/999999/release", ""); w.Code != http.StatusNotFound {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 404 for unknown reservation, got %d", w.Code)}
+	}
+
+	// Release returns the hold without touching the balance
+	released, err := ctx.QuotaService.CreateReservation("test", &services.CreateReservationRequest{UserID: giver.ID, Amount: decimal.New(20)})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create reservation failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ReleaseReservation(released.ID); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Release reservation failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.CaptureReservation(released.ID, &services.CaptureReservationRequest{}); err == nil {
+		return TestResult{Passed: false, Message: "Expected capture of a released reservation to fail"}
+	}
+
+	// The release job settles holds past their TTL
+	expiring, err := ctx.QuotaService.CreateReservation("test", &services.CreateReservationRequest{UserID: giver.ID, Amount: decimal.New(30), TTLSeconds: 60})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create expiring reservation failed: %v", err)}
+	}
+	if err := ctx.DB.Model(&models.QuotaReservation{}).Where("id = ?", expiring.ID).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to backdate reservation: %v", err)}
+	}
+	if err := ctx.QuotaService.ReleaseExpiredReservations(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Release expired reservations failed: %v", err)}
+	}
+	expired, err := ctx.QuotaService.GetReservation(expiring.ID)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get reservation failed: %v", err)}
+	}
+	if expired.Status != models.ReservationStatusExpired {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected expired reservation, got %s", expired.Status)}
+	}
+
+	quotaInfo, err = ctx.QuotaService.GetUserQuota(giver.ID)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
+	}
+	if quotaInfo.HeldQuota != decimal.New(0) || quotaInfo.TotalQuota != decimal.New(55) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected no holds and 55 total, got held %s total %s", quotaInfo.HeldQuota, quotaInfo.TotalQuota)}
+	}
+
+	// Every state change is audited against its reservation
+	expectedAudits := map[string]int64{
+		models.OperationReservationHold:    3,
+		models.OperationReservationCapture: 1,
+		models.OperationReservationRelease: 1,
+		models.OperationReservationExpire:  1,
+	}
+	for operation, expected := range expectedAudits {
+		var count int64
+		ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ? AND operation = ? AND reservation_id IS NOT NULL", giver.ID, operation).Count(&count)
+		if count != expected {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Expected %d %s audit records, got %d", expected, operation, count)}
+		}
+	}
+	var captureAudit models.QuotaAudit
+	if err := ctx.DB.Where("reservation_id = ? AND operation = ?", reservationID, models.OperationReservationCapture).First(&captureAudit).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected capture audit record: %v", err)}
+	}
+	if captureAudit.Amount != decimal.New(-45) || captureAudit.ReferenceID != "job-7" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected capture audit fields: %+v", captureAudit)}
+	}
+
+	return TestResult{Passed: true, Message: "Quota Reservations Test Succeeded"}
+}
@@ -5,6 +5,7 @@ import (
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
 	"quota-manager/internal/validation"
+	"quota-manager/pkg/decimal"
 	"strings"
 	"time"
 )
@@ -18,7 +19,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:      "test-strategy",
 		Title:     "Test Strategy",
 		Type:      "single",
-		Amount:    100,
+		Amount:    decimal.New(100),
 		Model:     "gpt-3.5-turbo",
 		Condition: "true()",
 	}
@@ -32,7 +33,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:   "", // Invalid: empty name
 		Title:  "Test Strategy",
 		Type:   "single",
-		Amount: 100,
+		Amount: decimal.New(100),
 	}
 
 	if err := validation.ValidateStruct(&invalidStrategy1); err == nil {
@@ -44,7 +45,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:   "test-strategy",
 		Title:  "Test Strategy",
 		Type:   "invalid-type", // Invalid: not 'single' or 'periodic'
-		Amount: 100,
+		Amount: decimal.New(100),
 	}
 
 	if err := validation.ValidateStruct(&invalidStrategy2); err == nil {
@@ -56,7 +57,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:   "test-strategy-negative",
 		Title:  "Test Strategy Negative",
 		Type:   "single",
-		Amount: -10, // Valid: negative amount is allowed
+		Amount: decimal.New(-10), // Valid: negative amount is allowed
 	}
 
 	if err := validation.ValidateStruct(&validStrategy3); err != nil {
@@ -68,7 +69,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:         "periodic-test",
 		Title:        "Periodic Test Strategy",
 		Type:         "periodic",
-		Amount:       50,
+		Amount:       decimal.New(50),
 		PeriodicExpr: "0 0 8 * * *", // Valid: daily at 8 AM
 	}
 
@@ -81,7 +82,7 @@ func testSchemaValidation(ctx *TestContext) TestResult {
 		Name:         "periodic-test",
 		Title:        "Periodic Test Strategy",
 		Type:         "periodic",
-		Amount:       50,
+		Amount:       decimal.New(50),
 		PeriodicExpr: "invalid-cron", // Invalid: bad cron expression
 	}
 
@@ -99,7 +100,7 @@ func testTransferRequestValidation(ctx *TestContext) TestResult {
 		ReceiverID: "123e4567-e89b-12d3-a456-426614174000", // Valid UUID
 		QuotaList: []services.TransferQuotaItem{
 			{
-				Amount:     10,
+				Amount:     decimal.New(10),
 				ExpiryDate: time.Now().Add(24 * time.Hour),
 			},
 		},
@@ -114,7 +115,7 @@ func testTransferRequestValidation(ctx *TestContext) TestResult {
 		ReceiverID: "invalid-uuid", // Invalid: not a UUID
 		QuotaList: []services.TransferQuotaItem{
 			{
-				Amount:     10,
+				Amount:     decimal.New(10),
 				ExpiryDate: time.Now().Add(24 * time.Hour),
 			},
 		},
@@ -139,7 +140,7 @@ func testTransferRequestValidation(ctx *TestContext) TestResult {
 		ReceiverID: "123e4567-e89b-12d3-a456-426614174000",
 		QuotaList: []services.TransferQuotaItem{
 			{
-				Amount:     -10, // Invalid: negative amount
+				Amount:     decimal.New(-10), // Invalid: negative amount
 				ExpiryDate: time.Now().Add(24 * time.Hour),
 			},
 		},
@@ -252,9 +253,9 @@ func testCustomValidators(ctx *TestContext) TestResult {
 // testErrorMessages tests that validation errors provide helpful messages
 func testErrorMessages(ctx *TestContext) TestResult {
 	invalidStrategy := models.QuotaStrategy{
-		Name:   "",        // Invalid: empty name
-		Type:   "invalid", // Invalid: bad type
-		Amount: -10,       // Invalid: negative amount
+		Name:   "",               // Invalid: empty name
+		Type:   "invalid",        // Invalid: bad type
+		Amount: decimal.New(-10), // Invalid: negative amount
 	}
 
 	err := validation.ValidateStruct(&invalidStrategy)
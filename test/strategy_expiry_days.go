@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 )
 
 // testExpiryDaysStrategy test strategy custom expiry days functionality
@@ -25,7 +26,7 @@ func testExpiryDaysStrategy(ctx *TestContext) TestResult {
 		Name:       "test-expiry-days-7",
 		Title:      "Test ExpiryDays 7 Days",
 		Type:       "single",
-		Amount:     50,
+		Amount:     decimal.New(50),
 		Model:      "test-model",
 		Condition:  "true()",
 		Status:     true,
@@ -43,7 +44,7 @@ func testExpiryDaysStrategy(ctx *TestContext) TestResult {
 		Name:      "test-default-expiry",
 		Title:     "Test Default Expiry",
 		Type:      "single",
-		Amount:    30,
+		Amount:    decimal.New(30),
 		Model:     "test-model",
 		Condition: "true()",
 		Status:    true,
@@ -103,9 +104,9 @@ func testExpiryDaysStrategy(ctx *TestContext) TestResult {
 	var defaultQuota *models.Quota
 
 	for i := range quotas {
-		if quotas[i].Amount == 50 {
+		if quotas[i].Amount == decimal.New(50) {
 			sevenDayQuota = &quotas[i]
-		} else if quotas[i].Amount == 30 {
+		} else if quotas[i].Amount == decimal.New(30) {
 			defaultQuota = &quotas[i]
 		}
 	}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"quota-manager/internal/models"
+	"quota-manager/pkg/decimal"
 )
 
 // testStrategyInviteRegister test strategy invite register
@@ -44,7 +45,7 @@ func testStrategyInviteRegister(ctx *TestContext) TestResult {
 		Name:   "inviter-register-reward",
 		Title:  "Inviter Register Reward",
 		Type:   "single",
-		Amount: 25,
+		Amount: decimal.New(25),
 		Model:  "test-model",
 		// Condition: "true()", // Always true condition, all users match
 		Condition: `has-inviter()`,
@@ -106,7 +107,7 @@ func testStrategyInviteStar(ctx *TestContext) TestResult {
 		Name:      "inviter-star-reward",
 		Title:     "Inviter Star Reward",
 		Type:      "single",
-		Amount:    75,
+		Amount:    decimal.New(75),
 		Model:     "test-model",
 		Condition: `and(has-inviter(), github-star("zgsm-ai.zgsm"))`,
 		Status:    true,
@@ -164,7 +165,7 @@ func testStrategyInviteUserStar(ctx *TestContext) TestResult {
 		Name:      "invitee-star-reward",
 		Title:     "Invitee Star Reward",
 		Type:      "single",
-		Amount:    25,
+		Amount:    decimal.New(25),
 		Model:     "test-model",
 		Condition: `and(has-inviter(), github-star("zgsm-ai.zgsm"))`,
 		Status:    true,
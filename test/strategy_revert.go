@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testStrategyRevert tests previewing and reverting a strategy batch, clawing back only unconsumed quota
+func testStrategyRevert(ctx *TestContext) TestResult {
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+
+	idle := createTestUser("revert_idle_user", "Revert Idle User", 0)
+	active := createTestUser("revert_active_user", "Revert Active User", 0)
+	for _, user := range []*models.UserInfo{idle, active} {
+		if err := ctx.DB.AuthDB.Create(user).Error; err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+		}
+		mockStore.SetQuota(user.ID, 0)
+	}
+	mockStore.SetUsed(idle.ID, 0)
+	mockStore.SetUsed(active.ID, 30)
+
+	strategy := &models.QuotaStrategy{
+		Name:      "revert-misconfigured",
+		Title:     "Misconfigured Grant",
+		Type:      "single",
+		Amount:    decimal.New(50),
+		Condition: "true()",
+		Status:    true,
+	}
+	if err := ctx.StrategyService.CreateStrategy(strategy); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create strategy failed: %v", err)}
+	}
+	ctx.StrategyService.ExecStrategy(strategy, []models.UserInfo{*idle, *active})
+
+	var execution models.QuotaExecute
+	if err := ctx.DB.Where("strategy_id = ? AND status = ?", strategy.ID, "completed").First(&execution).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected completed execution: %v", err)}
+	}
+	if execution.Amount != decimal.New(50) || execution.RecipientID == "" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected execution to record the grant, got amount %s recipient %q", execution.Amount, execution.RecipientID)}
+	}
+
+	// Preview reports the clawback without changing anything
+	body := fmt.Sprintf(`{"batch_number":"%s","reason":"wrong amount","preview":true}`, execution.BatchNumber)
+	req, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/strategies/%d/revert", auth.APIPrefix, strategy.ID), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+testServiceAccountToken)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var resp response.ResponseData
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 200 for preview, got %d: %s", w.Code, resp.Message)}
+	}
+	data, _ := resp.Data.(map[string]interface{})
+	if data["total_granted"] != "100" || data["total_clawback"] != "70" {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected preview of 100 granted and 70 clawback, got %v", data)}
+	}
+	if gatewayQuota := mockStore.GetQuota(idle.ID); gatewayQuota != 50 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected preview to leave AiGateway quota at 50, got %g", gatewayQuota)}
+	}
+
+	// The revert takes back what is left of each grant
+	result, err := ctx.StrategyService.RevertStrategy("test", strategy.ID, &services.RevertStrategyRequest{
+		BatchNumber: execution.BatchNumber,
+		Reason:      "wrong amount",
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Revert strategy failed: %v", err)}
+	}
+	if result.Succeeded != 2 || result.TotalClawback != decimal.New(70) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 users and 70 clawed back, got %d and %s", result.Succeeded, result.TotalClawback)}
+	}
+
+	var idleCount int64
+	ctx.DB.Model(&models.Quota{}).Where("user_id = ?", idle.ID).Count(&idleCount)
+	if idleCount != 0 {
+		return TestResult{Passed: false, Message: "Expected the idle user's grant to be removed"}
+	}
+	var activeQuota models.Quota
+	if err := ctx.DB.Where("user_id = ?", active.ID).First(&activeQuota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get active user's quota: %v", err)}
+	}
+	if activeQuota.Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the consumed 30 to stay, got %s", activeQuota.Amount)}
+	}
+	if idleQuota, activeGateway := mockStore.GetQuota(idle.ID), mockStore.GetQuota(active.ID); idleQuota != 0 || activeGateway != 30 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quotas 0 and 30, got %g and %g", idleQuota, activeGateway)}
+	}
+
+	var revertedCount, auditCount int64
+	ctx.DB.Model(&models.QuotaExecute{}).Where("strategy_id = ? AND status = ?", strategy.ID, "reverted").Count(&revertedCount)
+	ctx.DB.Model(&models.QuotaAudit{}).Where("strategy_id = ? AND operation = ?", strategy.ID, models.OperationStrategyRevert).Count(&auditCount)
+	if revertedCount != 2 || auditCount != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 2 reverted executions and 2 audit records, got %d and %d", revertedCount, auditCount)}
+	}
+
+	// Reverted executions are not reverted twice
+	again, err := ctx.StrategyService.RevertStrategy("test", strategy.ID, &services.RevertStrategyRequest{BatchNumber: execution.BatchNumber})
+	if err != nil || again.Executions != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected second revert to match no executions, got %v", err)}
+	}
+
+	return TestResult{Passed: true, Message: "Strategy Revert Test Succeeded"}
+}
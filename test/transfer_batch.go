@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// testBatchTransferOut tests that a batch transfer issues one voucher per receiver atomically with one audit record
+func testBatchTransferOut(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, first, err := setupTransferCancelUsers(ctx, "batch", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	second := createTestUser("batch_second", "Batch Second", 0)
+
+	batch := func(firstAmount, secondAmount int64) *services.BatchTransferOutRequest {
+		return &services.BatchTransferOutRequest{Receivers: []services.BatchTransferReceiver{
+			{ReceiverID: first.ID, QuotaList: []services.TransferQuotaItem{{Amount: decimal.New(firstAmount), ExpiryDate: expiryDate}}},
+			{ReceiverID: second.ID, QuotaList: []services.TransferQuotaItem{{Amount: decimal.New(secondAmount), ExpiryDate: expiryDate}}},
+		}}
+	}
+
+	// Each receiver fits on its own, together they exceed the giver's quota
+	if _, err := ctx.QuotaService.BatchTransferOut(giver, batch(60, 50)); err == nil || !strings.Contains(err.Error(), "insufficient") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the batch to fail on insufficient quota, got %v", err)}
+	}
+	duplicate := batch(10, 10)
+	duplicate.Receivers[1].ReceiverID = first.ID
+	if _, err := ctx.QuotaService.BatchTransferOut(giver, duplicate); err == nil {
+		return TestResult{Passed: false, Message: "Expected a batch listing a receiver twice to fail"}
+	}
+	var auditCount int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ?", giver.ID).Count(&auditCount)
+	if auditCount != 0 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected no audit records after failed batches, got %d", auditCount)}
+	}
+
+	resp, err := ctx.QuotaService.BatchTransferOut(giver, batch(40, 30))
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Batch transfer out failed: %v", err)}
+	}
+	if resp.TotalAmount != decimal.New(70) || len(resp.Transfers) != 2 ||
+		resp.Transfers[0].RelatedUser != first.ID || resp.Transfers[1].RelatedUser != second.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected batch response: %+v", resp)}
+	}
+
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND expiry_date = ? AND status = ?", giver.ID, expiryDate, models.StatusValid).First(&quota).Error; err != nil || quota.Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected giver quota 30 after the batch, got %s (%v)", quota.Amount, err)}
+	}
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != 30 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 30 after the batch, got %g", gatewayQuota)}
+	}
+
+	// One grouped audit record with an item per receiver
+	var audits []models.QuotaAudit
+	if err := ctx.DB.Where("user_id = ? AND operation = ?", giver.ID, models.OperationTransferOut).Find(&audits).Error; err != nil || len(audits) != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 1 TRANSFER_OUT audit record, got %d (%v)", len(audits), err)}
+	}
+	details, err := audits[0].UnmarshalDetails()
+	if err != nil || audits[0].Amount != decimal.New(-70) || len(details.Items) != 2 ||
+		details.Items[0].RelatedUser != first.ID || details.Items[0].VoucherCode != resp.Transfers[0].VoucherCode ||
+		details.Items[1].RelatedUser != second.ID || details.Items[1].Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected batch audit record: %+v (%v)", audits[0], err)}
+	}
+
+	// The vouchers are redeemed and cancelled like single transfers
+	transferIn, err := ctx.QuotaService.TransferIn(first, &services.TransferInRequest{VoucherCode: resp.Transfers[0].VoucherCode})
+	if err != nil || transferIn.Status != services.TransferStatusSuccess {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the first receiver to redeem the voucher, got %+v (%v)", transferIn, err)}
+	}
+	secondAuth := &models.AuthUser{ID: second.ID, Name: second.Name, Phone: second.Phone, Github: second.GithubName}
+	if transferIn, err := ctx.QuotaService.TransferIn(secondAuth, &services.TransferInRequest{VoucherCode: resp.Transfers[0].VoucherCode}); err != nil || transferIn.Status == services.TransferStatusSuccess {
+		return TestResult{Passed: false, Message: "Expected the second receiver not to redeem the first receiver's voucher"}
+	}
+	if _, err := ctx.QuotaService.CancelTransfer(giver, &services.TransferCancelRequest{VoucherCode: resp.Transfers[1].VoucherCode}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Cancel transfer failed: %v", err)}
+	}
+	if err := ctx.DB.First(&quota, quota.ID).Error; err != nil || quota.Amount != decimal.New(60) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected giver quota 60 after cancel, got %s (%v)", quota.Amount, err)}
+	}
+
+	// Unclaimed batch vouchers are refunded once they expire
+	staleVoucherService := services.NewVoucherService("test-signing-key-at-least-32-bytes-long", -time.Minute)
+	staleQuotaService := services.NewQuotaService(ctx.DB, ctx.QuotaService.GetConfigManager(), ctx.Gateway, staleVoucherService)
+	if _, err := staleQuotaService.BatchTransferOut(giver, batch(15, 5)); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Batch transfer out failed: %v", err)}
+	}
+	if err := ctx.QuotaService.RefundExpiredVouchers(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Refund expired vouchers failed: %v", err)}
+	}
+	var refundCount int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ? AND operation = ?", giver.ID, models.OperationTransferRefund).Count(&refundCount)
+	if err := ctx.DB.First(&quota, quota.ID).Error; err != nil || quota.Amount != decimal.New(60) || refundCount != 2 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected both stale vouchers refunded to 60, got %s with %d refunds (%v)", quota.Amount, refundCount, err)}
+	}
+
+	// The endpoint validates every receiver
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	body := fmt.Sprintf(`{"receivers":[{"receiver_id":"%s","quota_list":[{"amount":5,"expiry_date":"%s"}]},{"receiver_id":"not-a-uuid","quota_list":[{"amount":5,"expiry_date":"%s"}]}]}`,
+		first.ID, expiryDate.Format(time.RFC3339), expiryDate.Format(time.RFC3339))
+	giverToken := "Bearer " + createTestJWTToken(giver.ID)
+	if code, _ := doAuthorizedRequest(router, http.MethodPost, auth.APIPrefix+"/quota/transfer-out/batch", "Authorization", giverToken, body); code != http.StatusBadRequest {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 400 for an invalid receiver, got %d", code)}
+	}
+
+	return TestResult{Passed: true, Message: "Batch Transfer Out Test Succeeded"}
+}
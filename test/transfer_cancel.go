@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// setupTransferCancelUsers creates a giver with 100 quota and a receiver
+func setupTransferCancelUsers(ctx *TestContext, prefix string, expiryDate time.Time) (*models.AuthUser, *models.AuthUser, error) {
+	giver := createTestUser(prefix+"_giver", prefix+" Giver", 0)
+	receiver := createTestUser(prefix+"_receiver", prefix+" Receiver", 0)
+	if err := ctx.DB.AuthDB.Create(giver).Error; err != nil {
+		return nil, nil, fmt.Errorf("create giver failed: %w", err)
+	}
+	if err := ctx.DB.AuthDB.Create(receiver).Error; err != nil {
+		return nil, nil, fmt.Errorf("create receiver failed: %w", err)
+	}
+
+	if err := ctx.DB.Create(&models.Quota{
+		UserID:     giver.ID,
+		Amount:     decimal.New(100),
+		ExpiryDate: expiryDate,
+		Status:     models.StatusValid,
+	}).Error; err != nil {
+		return nil, nil, fmt.Errorf("create giver quota failed: %w", err)
+	}
+	mockStore.SetQuota(giver.ID, 100)
+
+	giverAuth := &models.AuthUser{ID: giver.ID, Name: giver.Name, Phone: giver.Phone, Github: giver.GithubName}
+	receiverAuth := &models.AuthUser{ID: receiver.ID, Name: receiver.Name, Phone: receiver.Phone, Github: receiver.GithubName}
+	return giverAuth, receiverAuth, nil
+}
+
+// testTransferCancel tests that a giver can cancel an unredeemed voucher and get the quota back
+func testTransferCancel(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "cancel", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+
+	transferOut, err := ctx.QuotaService.TransferOut(giver, &services.TransferOutRequest{
+		ReceiverID: receiver.ID,
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(40), ExpiryDate: expiryDate}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer out failed: %v", err)}
+	}
+
+	// Only the giver may cancel
+	if _, err := ctx.QuotaService.CancelTransfer(receiver, &services.TransferCancelRequest{VoucherCode: transferOut.VoucherCode}); err == nil {
+		return TestResult{Passed: false, Message: "Expected cancellation by the receiver to fail"}
+	}
+
+	cancelResp, err := ctx.QuotaService.CancelTransfer(giver, &services.TransferCancelRequest{VoucherCode: transferOut.VoucherCode})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Cancel transfer failed: %v", err)}
+	}
+	if cancelResp.Amount != decimal.New(40) || cancelResp.Status != services.TransferStatusSuccess {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected full refund of 40, got %s (%s)", cancelResp.Amount, cancelResp.Status)}
+	}
+
+	// Giver quota and AiGateway total are restored
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND expiry_date = ? AND status = ?", giver.ID, expiryDate, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get giver quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(100) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected giver quota 100 after cancel, got %s", quota.Amount)}
+	}
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != 100 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected AiGateway quota 100 after cancel, got %g", gatewayQuota)}
+	}
+
+	// Audit record is written
+	var audit models.QuotaAudit
+	if err := ctx.DB.Where("user_id = ? AND operation = ?", giver.ID, models.OperationTransferCancel).First(&audit).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected TRANSFER_CANCEL audit record: %v", err)}
+	}
+	if audit.Amount != decimal.New(40) || audit.RelatedUser != receiver.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected cancel audit record: amount %s related %s", audit.Amount, audit.RelatedUser)}
+	}
+
+	// The voucher can no longer be redeemed or cancelled again
+	transferIn, err := ctx.QuotaService.TransferIn(receiver, &services.TransferInRequest{VoucherCode: transferOut.VoucherCode})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer in returned error: %v", err)}
+	}
+	if transferIn.Status != services.TransferStatusFailed {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected cancelled voucher to fail redemption, got %s", transferIn.Status)}
+	}
+	if _, err := ctx.QuotaService.CancelTransfer(giver, &services.TransferCancelRequest{VoucherCode: transferOut.VoucherCode}); err == nil {
+		return TestResult{Passed: false, Message: "Expected second cancellation to fail"}
+	}
+
+	return TestResult{Passed: true, Message: "Transfer Cancel Test Succeeded"}
+}
+
+// testVoucherExpiryRefund tests that stale vouchers are rejected and refunded to the giver by the refund job
+func testVoucherExpiryRefund(ctx *TestContext) TestResult {
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "voucher_ttl", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+
+	// A voucher service with a negative TTL issues vouchers that are already stale
+	staleVoucherService := services.NewVoucherService("test-signing-key-at-least-32-bytes-long", -time.Minute)
+	staleQuotaService := services.NewQuotaService(ctx.DB, ctx.QuotaService.GetConfigManager(), ctx.Gateway, staleVoucherService)
+
+	transferOut, err := staleQuotaService.TransferOut(giver, &services.TransferOutRequest{
+		ReceiverID: receiver.ID,
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(25), ExpiryDate: expiryDate}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer out failed: %v", err)}
+	}
+
+	transferIn, err := ctx.QuotaService.TransferIn(receiver, &services.TransferInRequest{VoucherCode: transferOut.VoucherCode})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer in returned error: %v", err)}
+	}
+	if transferIn.Status != services.TransferStatusVoucherExpired {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected VOUCHER_EXPIRED, got %s", transferIn.Status)}
+	}
+
+	if err := ctx.QuotaService.RefundExpiredVouchers(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Refund expired vouchers failed: %v", err)}
+	}
+
+	var quota models.Quota
+	if err := ctx.DB.Where("user_id = ? AND expiry_date = ? AND status = ?", giver.ID, expiryDate, models.StatusValid).First(&quota).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get giver quota: %v", err)}
+	}
+	if quota.Amount != decimal.New(100) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected giver quota 100 after refund, got %s", quota.Amount)}
+	}
+
+	var refundCount int64
+	ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ? AND operation = ?", giver.ID, models.OperationTransferRefund).Count(&refundCount)
+	if refundCount != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 1 TRANSFER_REFUND audit record, got %d", refundCount)}
+	}
+
+	// Running the job again must not refund twice
+	if err := ctx.QuotaService.RefundExpiredVouchers(); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Second refund run failed: %v", err)}
+	}
+	ctx.DB.Model(&models.QuotaAudit{}).Where("user_id = ? AND operation = ?", giver.ID, models.OperationTransferRefund).Count(&refundCount)
+	if refundCount != 1 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected refund to run once, got %d records", refundCount)}
+	}
+	var watermark models.JobWatermark
+	if err := ctx.DB.Where("job = ?", "voucher_refund").First(&watermark).Error; err != nil || watermark.ProcessedUntil.After(time.Now()) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the refund job to record its watermark, got %+v (%v)", watermark, err)}
+	}
+
+	return TestResult{Passed: true, Message: "Voucher Expiry Refund Test Succeeded"}
+}
+
+// testShortVoucherCodes tests transfers with short codes backed by the vouchers table
+func testShortVoucherCodes(ctx *TestContext) TestResult {
+	configManager := ctx.QuotaService.GetConfigManager()
+	configManager.Update(func(cfg *config.Config) { cfg.Voucher.ShortCodes = true })
+	defer configManager.Update(func(cfg *config.Config) { cfg.Voucher.ShortCodes = false })
+
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "short_code", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+
+	transferOut, err := ctx.QuotaService.TransferOut(giver, &services.TransferOutRequest{
+		ReceiverID: receiver.ID,
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(30), ExpiryDate: expiryDate}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer out failed: %v", err)}
+	}
+	code := transferOut.VoucherCode
+	if len(code) != 12 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a 12-character voucher code, got %q", code)}
+	}
+
+	var voucher models.Voucher
+	if err := ctx.DB.Where("code = ?", code).First(&voucher).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected stored voucher: %v", err)}
+	}
+	if voucher.Status != models.VoucherStatusIssued || voucher.GiverID != giver.ID || voucher.ReceiverID != receiver.ID {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected stored voucher: %+v", voucher)}
+	}
+
+	// A mistyped code fails the checksum instead of hitting another voucher
+	typo := []byte(code)
+	if typo[3] == 'A' {
+		typo[3] = 'B'
+	} else {
+		typo[3] = 'A'
+	}
+	if _, ok := services.NormalizeShortVoucherCode(string(typo)); ok {
+		return TestResult{Passed: false, Message: "Expected mistyped voucher code to fail the checksum"}
+	}
+
+	// Codes are accepted in lower case with dashes
+	input := strings.ToLower(code[:4] + "-" + code[4:8] + "-" + code[8:])
+	transferIn, err := ctx.QuotaService.TransferIn(receiver, &services.TransferInRequest{VoucherCode: input})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer in failed: %v", err)}
+	}
+	if transferIn.Status != services.TransferStatusSuccess || transferIn.Amount != decimal.New(30) || transferIn.VoucherCode != code {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Unexpected transfer in result: %s amount %s code %s", transferIn.Status, transferIn.Amount, transferIn.VoucherCode)}
+	}
+	if gatewayQuota := mockStore.GetQuota(receiver.ID); gatewayQuota != 30 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected receiver AiGateway quota 30, got %g", gatewayQuota)}
+	}
+
+	if err := ctx.DB.Where("code = ?", code).First(&voucher).Error; err != nil || voucher.Status != models.VoucherStatusRedeemed {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected stored voucher to be REDEEMED, got %s (%v)", voucher.Status, err)}
+	}
+
+	transferIn, err = ctx.QuotaService.TransferIn(receiver, &services.TransferInRequest{VoucherCode: code})
+	if err != nil || transferIn.Status != services.TransferStatusAlreadyRedeemed {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected second redemption to be ALREADY_REDEEMED, got %v (%v)", transferIn, err)}
+	}
+
+	// Cancelling a short-code voucher marks the stored record as cancelled
+	transferOut, err = ctx.QuotaService.TransferOut(giver, &services.TransferOutRequest{
+		ReceiverID: receiver.ID,
+		QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(20), ExpiryDate: expiryDate}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Second transfer out failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.CancelTransfer(giver, &services.TransferCancelRequest{VoucherCode: transferOut.VoucherCode}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Cancel short-code voucher failed: %v", err)}
+	}
+	if err := ctx.DB.Where("code = ?", transferOut.VoucherCode).First(&voucher).Error; err != nil || voucher.Status != models.VoucherStatusCancelled {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected stored voucher to be CANCELLED, got %s (%v)", voucher.Status, err)}
+	}
+
+	return TestResult{Passed: true, Message: "Short Voucher Codes Test Succeeded"}
+}
@@ -7,6 +7,7 @@ import (
 
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 // testTransferInGithubStarNotSet tests transfer-in when giver doesn't have star
@@ -36,7 +37,7 @@ func testTransferInGithubStarNotSet(ctx *TestContext) TestResult {
 		ReceiverID:      receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
 			{
-				Amount:     100,
+				Amount:     decimal.New(100),
 				ExpiryDate: time.Now().Add(30 * 24 * time.Hour),
 			},
 		},
@@ -98,7 +99,7 @@ func testTransferInGithubStarSet(ctx *TestContext) TestResult {
 		ReceiverID:      receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
 			{
-				Amount:     200,
+				Amount:     decimal.New(200),
 				ExpiryDate: time.Now().Add(30 * 24 * time.Hour),
 			},
 		},
@@ -168,7 +169,7 @@ func testTransferInGithubStarEmptyField(ctx *TestContext) TestResult {
 		ReceiverID:      receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
 			{
-				Amount:     150,
+				Amount:     decimal.New(150),
 				ExpiryDate: time.Now().Add(30 * 24 * time.Hour),
 			},
 		},
@@ -223,7 +224,7 @@ func testTransferOutGithubStarNotSet(ctx *TestContext) TestResult {
 	transferExpiryDate := time.Date(now.Year(), now.Month()+1, 0, 23, 59, 59, 0, now.Location())
 
 	// Add quota with the same expiry date that will be used in transfer
-	if err := ctx.QuotaService.AddQuotaForStrategy(giver.ID, 200, 0, "test-strategy", nil); err != nil {
+	if err := ctx.QuotaService.AddQuotaForStrategy(giver.ID, decimal.New(200), 0, "test-strategy", nil); err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to add quota: %v", err)}
 	}
 
@@ -232,7 +233,7 @@ func testTransferOutGithubStarNotSet(ctx *TestContext) TestResult {
 		ReceiverID: receiver.ID,
 		QuotaList: []services.TransferQuotaItem{
 			{
-				Amount:     100,
+				Amount:     decimal.New(100),
 				ExpiryDate: transferExpiryDate,
 			},
 		},
@@ -273,8 +274,8 @@ func testTransferOutGithubStarNotSet(ctx *TestContext) TestResult {
 	if len(voucherData.QuotaList) != 1 {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 1 quota item, got %d", len(voucherData.QuotaList))}
 	}
-	if voucherData.QuotaList[0].Amount != 100 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota amount 100, got %g", voucherData.QuotaList[0].Amount)}
+	if voucherData.QuotaList[0].Amount != decimal.New(100) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota amount 100, got %s", voucherData.QuotaList[0].Amount)}
 	}
 
 	return TestResult{Passed: true, Message: "Transfer-out correctly sets GiverGithubStar with all giver's starred projects"}
@@ -300,7 +301,7 @@ func testTransferOutGithubStarSet(ctx *TestContext) TestResult {
 	transferExpiryDate := time.Date(now.Year(), now.Month()+1, 0, 23, 59, 59, 0, now.Location())
 
 	// Add quota with the same expiry date that will be used in transfer
-	if err := ctx.QuotaService.AddQuotaForStrategy(giver.ID, 200, 0, "test-strategy", nil); err != nil {
+	if err := ctx.QuotaService.AddQuotaForStrategy(giver.ID, decimal.New(200), 0, "test-strategy", nil); err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to add quota: %v", err)}
 	}
 
@@ -309,7 +310,7 @@ func testTransferOutGithubStarSet(ctx *TestContext) TestResult {
 		ReceiverID: receiver.ID,
 		QuotaList: []services.TransferQuotaItem{
 			{
-				Amount:     100,
+				Amount:     decimal.New(100),
 				ExpiryDate: transferExpiryDate,
 			},
 		},
@@ -350,8 +351,8 @@ func testTransferOutGithubStarSet(ctx *TestContext) TestResult {
 	if len(voucherData.QuotaList) != 1 {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 1 quota item, got %d", len(voucherData.QuotaList))}
 	}
-	if voucherData.QuotaList[0].Amount != 100 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota amount 100, got %g", voucherData.QuotaList[0].Amount)}
+	if voucherData.QuotaList[0].Amount != decimal.New(100) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota amount 100, got %s", voucherData.QuotaList[0].Amount)}
 	}
 
 	return TestResult{Passed: true, Message: "Transfer-out correctly sets GiverGithubStar with projects when giver stars zgsm-ai.zgsm"}
@@ -7,6 +7,7 @@ import (
 
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 // testQuotaTransferIn test quota transfer in
@@ -26,7 +27,7 @@ func testQuotaTransferIn(ctx *TestContext) TestResult {
 		GiverGithub: "giver",
 		ReceiverID:  receiver.ID,
 		QuotaList: []services.VoucherQuotaItem{
-			{Amount: 30, ExpiryDate: expiryDate},
+			{Amount: decimal.New(30), ExpiryDate: expiryDate},
 		},
 	}
 
@@ -65,8 +66,8 @@ func testQuotaTransferIn(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get receiver quota: %v", err)}
 	}
 
-	if quota.Amount != 30 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected receiver quota 30, got %g", quota.Amount)}
+	if quota.Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected receiver quota 30, got %s", quota.Amount)}
 	}
 
 	// Verify audit record
@@ -75,8 +76,8 @@ func testQuotaTransferIn(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get audit record: %v", err)}
 	}
 
-	if auditRecord.Amount != 30 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount 30, got %g", auditRecord.Amount)}
+	if auditRecord.Amount != decimal.New(30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount 30, got %s", auditRecord.Amount)}
 	}
 
 	// Verify voucher redemption record
@@ -122,7 +123,7 @@ func testTransferInUserIDMismatch(ctx *TestContext) TestResult {
 	mockStore.SetQuota(user1.ID, 100)
 
 	// Add quota for user1
-	if err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, 100, 0, "test-strategy", nil); err != nil {
+	if err := ctx.QuotaService.AddQuotaForStrategy(user1.ID, decimal.New(100), 0, "test-strategy", nil); err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Add quota failed: %v", err)}
 	}
 
@@ -138,7 +139,7 @@ func testTransferInUserIDMismatch(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: transferExpiryDate},
+			{Amount: decimal.New(50), ExpiryDate: transferExpiryDate},
 		},
 	}
 	transferOutResp, err := ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -172,8 +173,8 @@ func testTransferInUserIDMismatch(ctx *TestContext) TestResult {
 	if err != nil {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get user3 quota failed: %v", err)}
 	}
-	if quotaInfo3.TotalQuota != 0 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("User3 should have no quota, got %g", quotaInfo3.TotalQuota)}
+	if quotaInfo3.TotalQuota != decimal.New(0) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("User3 should have no quota, got %s", quotaInfo3.TotalQuota)}
 	}
 
 	// Verify no audit records for user3
@@ -221,7 +222,7 @@ func testTransferInExpiredQuota(ctx *TestContext) TestResult {
 	shortValidDate := now.Add(-time.Hour)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: shortValidDate,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -232,7 +233,7 @@ func testTransferInExpiredQuota(ctx *TestContext) TestResult {
 	validDate := now.AddDate(0, 0, 30)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: validDate,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -244,8 +245,8 @@ func testTransferInExpiredQuota(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 80, ExpiryDate: shortValidDate}, // This is already expired
-			{Amount: 50, ExpiryDate: validDate},      // Valid quota
+			{Amount: decimal.New(80), ExpiryDate: shortValidDate}, // This is already expired
+			{Amount: decimal.New(50), ExpiryDate: validDate},      // Valid quota
 		},
 	}
 	transferOutResp, err := ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -268,8 +269,8 @@ func testTransferInExpiredQuota(ctx *TestContext) TestResult {
 
 	// Verify that only valid quota was transferred
 	// Should only get 50 quota (expired quota should be ignored)
-	if transferInResp.Amount != 50 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 50 transferred quota (excluding expired), got %g", transferInResp.Amount)}
+	if transferInResp.Amount != decimal.New(50) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 50 transferred quota (excluding expired), got %s", transferInResp.Amount)}
 	}
 
 	// Verify user2's quota records - should only contain the valid quota
@@ -317,8 +318,8 @@ func testTransferInExpiredQuota(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get user2 quota failed: %v", err)}
 	}
 
-	if quotaInfo2.TotalQuota != 50 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected user2 total quota 50, got %g", quotaInfo2.TotalQuota)}
+	if quotaInfo2.TotalQuota != decimal.New(50) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected user2 total quota 50, got %s", quotaInfo2.TotalQuota)}
 	}
 
 	return TestResult{Passed: true, Message: "Transfer in expired quota test succeeded"}
@@ -376,8 +377,8 @@ func testTransferInInvalidVoucher(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Get user quota failed: %v", err)}
 	}
 
-	if quotaInfo.TotalQuota != 0 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("User should have no quota after failed transfers, got %g", quotaInfo.TotalQuota)}
+	if quotaInfo.TotalQuota != decimal.New(0) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("User should have no quota after failed transfers, got %s", quotaInfo.TotalQuota)}
 	}
 
 	// Verify no audit records were created
@@ -415,7 +416,7 @@ func testTransferInQuotaExpiryConsistency(ctx *TestContext) TestResult {
 	earlyExpiry := now.AddDate(0, 0, 15)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     50,
+		Amount:     decimal.New(50),
 		ExpiryDate: earlyExpiry,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -426,7 +427,7 @@ func testTransferInQuotaExpiryConsistency(ctx *TestContext) TestResult {
 	lateExpiry := now.AddDate(0, 0, 45)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     150,
+		Amount:     decimal.New(150),
 		ExpiryDate: lateExpiry,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -437,8 +438,8 @@ func testTransferInQuotaExpiryConsistency(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: earlyExpiry}, // Early expiry
-			{Amount: 70, ExpiryDate: lateExpiry},  // Late expiry
+			{Amount: decimal.New(30), ExpiryDate: earlyExpiry}, // Early expiry
+			{Amount: decimal.New(70), ExpiryDate: lateExpiry},  // Late expiry
 		},
 	}
 	transferOutResp, err := ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -7,6 +7,7 @@ import (
 
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 // testTransferInStatusCases tests all different transfer in status cases
@@ -34,7 +35,7 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: validExpiry1,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -43,7 +44,7 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     200,
+		Amount:     decimal.New(200),
 		ExpiryDate: validExpiry2,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -54,8 +55,8 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 80, ExpiryDate: validExpiry1},
-			{Amount: 150, ExpiryDate: validExpiry2},
+			{Amount: decimal.New(80), ExpiryDate: validExpiry1},
+			{Amount: decimal.New(150), ExpiryDate: validExpiry2},
 		},
 	}
 
@@ -82,8 +83,8 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Expected SUCCESS status, got %s", transferInResp.Status)}
 	}
 
-	if transferInResp.Amount != 230 { // 80 + 150
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 230 transferred amount, got %g", transferInResp.Amount)}
+	if transferInResp.Amount != decimal.New(230) { // 80 + 150
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 230 transferred amount, got %s", transferInResp.Amount)}
 	}
 
 	// Verify all quotas are marked as successful
@@ -119,7 +120,7 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user3.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: shortValidDate,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -128,7 +129,7 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user3.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: validDate,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -139,8 +140,8 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 	transferOutReq2 := &services.TransferOutRequest{
 		ReceiverID: user4.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 80, ExpiryDate: shortValidDate}, // This will expire by transfer in time
-			{Amount: 80, ExpiryDate: validDate},      // This will remain valid
+			{Amount: decimal.New(80), ExpiryDate: shortValidDate}, // This will expire by transfer in time
+			{Amount: decimal.New(80), ExpiryDate: validDate},      // This will remain valid
 		},
 	}
 
@@ -170,8 +171,8 @@ func testTransferInStatusCases(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Expected PARTIAL_SUCCESS status, got %s", transferInResp2.Status)}
 	}
 
-	if transferInResp2.Amount != 80 { // Only valid quota
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 80 transferred amount (excluding expired), got %g", transferInResp2.Amount)}
+	if transferInResp2.Amount != decimal.New(80) { // Only valid quota
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 80 transferred amount (excluding expired), got %s", transferInResp2.Amount)}
 	}
 
 	// Verify quota results contain failure reasons
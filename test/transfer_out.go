@@ -1,12 +1,15 @@
 package main
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"time"
 
+	"quota-manager/internal/config"
 	"quota-manager/internal/models"
 	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
 )
 
 // testVoucherGenerationAndValidation test voucher generation and validation
@@ -19,8 +22,8 @@ func testVoucherGenerationAndValidation(ctx *TestContext) TestResult {
 		GiverGithub: "zhangsan",
 		ReceiverID:  "receiver456",
 		QuotaList: []services.VoucherQuotaItem{
-			{Amount: 10, ExpiryDate: time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)},
-			{Amount: 20, ExpiryDate: time.Now().Truncate(time.Second).Add(60 * 24 * time.Hour)},
+			{Amount: decimal.New(10), ExpiryDate: time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)},
+			{Amount: decimal.New(20), ExpiryDate: time.Now().Truncate(time.Second).Add(60 * 24 * time.Hour)},
 		},
 	}
 
@@ -57,6 +60,113 @@ func testVoucherGenerationAndValidation(ctx *TestContext) TestResult {
 	return TestResult{Passed: true, Message: "Voucher Generation and Validation Test Succeeded"}
 }
 
+// testVoucherKeyRotation tests that vouchers stay valid across signing key rotation
+func testVoucherKeyRotation(ctx *TestContext) TestResult {
+	const (
+		legacyKey = "legacy-signing-key-at-least-32-bytes-long"
+		oldSecret = "old-voucher-signing-secret-32-bytes-long"
+		newSecret = "new-voucher-signing-secret-32-bytes-long"
+	)
+	newVoucherData := func() *services.VoucherData {
+		return &services.VoucherData{
+			GiverID:    "giver123",
+			GiverName:  "Key|Rotation}Giver",
+			ReceiverID: "receiver456",
+			QuotaList:  []services.VoucherQuotaItem{{Amount: decimal.New(10), ExpiryDate: time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)}},
+		}
+	}
+	newService := func(cfg *config.VoucherConfig) (*services.VoucherService, error) {
+		keyring, err := services.NewVoucherKeyring(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return services.NewVoucherServiceWithKeyring(keyring, time.Hour), nil
+	}
+
+	// Vouchers issued before key IDs were introduced
+	legacyCode, err := services.NewVoucherService(legacyKey, time.Hour).GenerateVoucher(newVoucherData())
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Generate legacy voucher failed: %v", err)}
+	}
+
+	oldService, err := newService(&config.VoucherConfig{
+		SigningKey:  legacyKey,
+		ActiveKeyID: "2025-01",
+		Keys:        []config.VoucherKeyConfig{{ID: "2025-01", Secret: oldSecret}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create old keyring failed: %v", err)}
+	}
+	oldCode, err := oldService.GenerateVoucher(newVoucherData())
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Generate voucher with old key failed: %v", err)}
+	}
+
+	// Rotate: the new key signs, the old key and the legacy key only verify
+	rotatedService, err := newService(&config.VoucherConfig{
+		SigningKey:  legacyKey,
+		ActiveKeyID: "2025-07",
+		Keys: []config.VoucherKeyConfig{
+			{ID: "2025-01", Secret: oldSecret},
+			{ID: "2025-07", Secret: newSecret},
+		},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create rotated keyring failed: %v", err)}
+	}
+	newCode, err := rotatedService.GenerateVoucher(newVoucherData())
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Generate voucher with new key failed: %v", err)}
+	}
+
+	for name, code := range map[string]string{"legacy": legacyCode, "old key": oldCode, "new key": newCode} {
+		data, err := rotatedService.ValidateAndDecodeVoucher(code)
+		if err != nil {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Rotated keyring rejected %s voucher: %v", name, err)}
+		}
+		if data.GiverName != "Key|Rotation}Giver" {
+			return TestResult{Passed: false, Message: fmt.Sprintf("Decoded %s voucher data mismatch: %s", name, data.GiverName)}
+		}
+	}
+
+	// The previous deployment cannot verify vouchers signed with a key it does not know
+	if _, err := oldService.ValidateAndDecodeVoucher(newCode); err == nil {
+		return TestResult{Passed: false, Message: "Expected voucher with unknown key ID to fail validation"}
+	}
+
+	// Retiring the old key invalidates its vouchers, dropping the legacy key rejects legacy vouchers
+	retiredService, err := newService(&config.VoucherConfig{
+		ActiveKeyID: "2025-07",
+		Keys:        []config.VoucherKeyConfig{{ID: "2025-07", Secret: newSecret}},
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create retired keyring failed: %v", err)}
+	}
+	if _, err := retiredService.ValidateAndDecodeVoucher(oldCode); err == nil {
+		return TestResult{Passed: false, Message: "Expected voucher signed with a retired key to fail validation"}
+	}
+	if _, err := retiredService.ValidateAndDecodeVoucher(legacyCode); err == nil {
+		return TestResult{Passed: false, Message: "Expected legacy voucher to fail without a legacy key"}
+	}
+
+	// A forged key ID must not select a different key
+	decoded, _ := base64.RawURLEncoding.DecodeString(newCode)
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(decoded), "|2025-07|", "|2025-01|", 1)))
+	if _, err := rotatedService.ValidateAndDecodeVoucher(forged); err == nil {
+		return TestResult{Passed: false, Message: "Expected voucher with swapped key ID to fail validation"}
+	}
+
+	// Misconfigured keyrings are rejected
+	if _, err := services.NewVoucherKeyring(&config.VoucherConfig{ActiveKeyID: "missing", Keys: []config.VoucherKeyConfig{{ID: "2025-07", Secret: newSecret}}}); err == nil {
+		return TestResult{Passed: false, Message: "Expected keyring with unknown active key to be rejected"}
+	}
+	if _, err := services.NewVoucherKeyring(&config.VoucherConfig{ActiveKeyID: "bad|id", Keys: []config.VoucherKeyConfig{{ID: "bad|id", Secret: newSecret}}}); err == nil {
+		return TestResult{Passed: false, Message: "Expected keyring with invalid key ID to be rejected"}
+	}
+
+	return TestResult{Passed: true, Message: "Voucher Key Rotation Test Succeeded"}
+}
+
 // testQuotaTransferOut test quota transfer out
 func testQuotaTransferOut(ctx *TestContext) TestResult {
 	// Create test users
@@ -69,7 +179,7 @@ func testQuotaTransferOut(ctx *TestContext) TestResult {
 	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
 	quota := &models.Quota{
 		UserID:     giver.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: expiryDate,
 		Status:     models.StatusValid,
 	}
@@ -90,7 +200,7 @@ func testQuotaTransferOut(ctx *TestContext) TestResult {
 	transferReq := &services.TransferOutRequest{
 		ReceiverID: "receiver_user",
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: expiryDate},
+			{Amount: decimal.New(30), ExpiryDate: expiryDate},
 		},
 	}
 
@@ -110,8 +220,8 @@ func testQuotaTransferOut(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get updated quota: %v", err)}
 	}
 
-	if updatedQuota.Amount != 70 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota 70, got %g", updatedQuota.Amount)}
+	if updatedQuota.Amount != decimal.New(70) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected remaining quota 70, got %s", updatedQuota.Amount)}
 	}
 
 	// Verify audit record
@@ -120,8 +230,8 @@ func testQuotaTransferOut(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get audit record: %v", err)}
 	}
 
-	if auditRecord.Amount != -30 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount -30, got %g", auditRecord.Amount)}
+	if auditRecord.Amount != decimal.New(-30) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected audit amount -30, got %s", auditRecord.Amount)}
 	}
 
 	// Verify no strategy name in transfer out audit record
@@ -154,7 +264,7 @@ func testTransferOutInsufficientAvailable(ctx *TestContext) TestResult {
 	earlyExpiry := now.AddDate(0, 0, 10)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: earlyExpiry,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -165,7 +275,7 @@ func testTransferOutInsufficientAvailable(ctx *TestContext) TestResult {
 	lateExpiry := now.AddDate(0, 0, 30)
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: lateExpiry,
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -174,13 +284,13 @@ func testTransferOutInsufficientAvailable(ctx *TestContext) TestResult {
 
 	// Consume 120 quota (should consume all 100 from early + 20 from late)
 	// This leaves 80 available in late-expiry quota
-	ctx.Gateway.DeltaUsedQuota(user1.ID, 120)
+	ctx.Gateway.DeltaUsedQuota(user1.ID, decimal.New(120))
 
 	// Try to transfer 90 quota with early expiry date (should fail - only has 0 available with early expiry)
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 90, ExpiryDate: earlyExpiry},
+			{Amount: decimal.New(90), ExpiryDate: earlyExpiry},
 		},
 	}
 	_, err := ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -200,7 +310,7 @@ func testTransferOutInsufficientAvailable(ctx *TestContext) TestResult {
 	transferOutReq2 := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 80, ExpiryDate: lateExpiry},
+			{Amount: decimal.New(80), ExpiryDate: lateExpiry},
 		},
 	}
 	_, err = ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -218,16 +328,16 @@ func testTransferOutInsufficientAvailable(ctx *TestContext) TestResult {
 	}
 
 	// Should have 0 remaining quota (all consumed or transferred)
-	actualRemaining1 := quotaInfo1.TotalQuota - quotaInfo1.UsedQuota
-	if actualRemaining1 != 0 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 0 remaining quota, got %g", actualRemaining1)}
+	actualRemaining1 := quotaInfo1.TotalQuota.Sub(quotaInfo1.UsedQuota)
+	if !actualRemaining1.IsZero() {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 0 remaining quota, got %s", actualRemaining1)}
 	}
 
 	// Try to transfer 1 more quota (should fail - no remaining quota)
 	transferOutReq3 := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 1, ExpiryDate: lateExpiry},
+			{Amount: decimal.New(1), ExpiryDate: lateExpiry},
 		},
 	}
 	_, err = ctx.QuotaService.TransferOut(&models.AuthUser{
@@ -266,7 +376,7 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 	// Add quotas in non-chronological order to test ordering
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     50,
+		Amount:     decimal.New(50),
 		ExpiryDate: expiry2, // Middle expiry
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -275,7 +385,7 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: expiry1, // Earliest expiry
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -284,7 +394,7 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     150,
+		Amount:     decimal.New(150),
 		ExpiryDate: expiry3, // Latest expiry
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -295,9 +405,9 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 	transferOutReq := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 50, ExpiryDate: expiry2}, // Middle expiry
-			{Amount: 80, ExpiryDate: expiry1}, // Earliest expiry
-			{Amount: 70, ExpiryDate: expiry3}, // Latest expiry
+			{Amount: decimal.New(50), ExpiryDate: expiry2}, // Middle expiry
+			{Amount: decimal.New(80), ExpiryDate: expiry1}, // Earliest expiry
+			{Amount: decimal.New(70), ExpiryDate: expiry3}, // Latest expiry
 		},
 	}
 
@@ -364,7 +474,7 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 	mockStore.DeltaQuota(user1.ID, 200) // Add 200 more to mock store
 	if err := ctx.DB.Create(&models.Quota{
 		UserID:     user1.ID,
-		Amount:     200,
+		Amount:     decimal.New(200),
 		ExpiryDate: expiry2, // Middle expiry
 		Status:     models.StatusValid,
 	}).Error; err != nil {
@@ -375,8 +485,8 @@ func testTransferEarliestExpiryDate(ctx *TestContext) TestResult {
 	transferOutReq2 := &services.TransferOutRequest{
 		ReceiverID: user2.ID,
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: expiry3}, // Latest expiry
-			{Amount: 40, ExpiryDate: expiry2}, // Middle expiry
+			{Amount: decimal.New(30), ExpiryDate: expiry3}, // Latest expiry
+			{Amount: decimal.New(40), ExpiryDate: expiry2}, // Middle expiry
 		},
 	}
 
@@ -419,7 +529,7 @@ func testTransferOutEmptyReceiverID(ctx *TestContext) TestResult {
 	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
 	quota := &models.Quota{
 		UserID:     user.ID,
-		Amount:     100,
+		Amount:     decimal.New(100),
 		ExpiryDate: expiryDate,
 		Status:     models.StatusValid,
 	}
@@ -443,7 +553,7 @@ func testTransferOutEmptyReceiverID(ctx *TestContext) TestResult {
 	transferReq := &services.TransferOutRequest{
 		ReceiverID: "", // Empty receiver_id
 		QuotaList: []services.TransferQuotaItem{
-			{Amount: 30, ExpiryDate: expiryDate},
+			{Amount: decimal.New(30), ExpiryDate: expiryDate},
 		},
 	}
 
@@ -464,8 +574,8 @@ func testTransferOutEmptyReceiverID(ctx *TestContext) TestResult {
 		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to get quota: %v", err)}
 	}
 
-	if unchangedQuota.Amount != 100 {
-		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota to remain unchanged at 100, got %g", unchangedQuota.Amount)}
+	if unchangedQuota.Amount != decimal.New(100) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected quota to remain unchanged at 100, got %s", unchangedQuota.Amount)}
 	}
 
 	// Verify no audit record was created for the failed transfer
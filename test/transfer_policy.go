@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"quota-manager/internal/auth"
+	"quota-manager/internal/config"
+	"quota-manager/internal/models"
+	"quota-manager/internal/response"
+	"quota-manager/internal/services"
+	"quota-manager/pkg/decimal"
+)
+
+// isTransferPolicyError reports whether err is a violation of check
+func isTransferPolicyError(err error, check string) bool {
+	serviceErr, ok := err.(*services.ServiceError)
+	return ok && serviceErr.Code == services.ErrorTransferPolicy && strings.Contains(serviceErr.Message, "("+check+")")
+}
+
+// testTransferPolicy tests transfer rule selection by giver condition, amount limits, account age and receiver scope
+func testTransferPolicy(ctx *TestContext) TestResult {
+	configManager := ctx.QuotaService.GetConfigManager()
+	originalPolicy := configManager.GetDirect().TransferPolicy
+	configManager.Update(func(cfg *config.Config) {
+		cfg.TransferPolicy = config.TransferPolicyConfig{Rules: []config.TransferRuleConfig{
+			{Name: "vip", GiverCondition: "is-vip(1)", MaxSingleTransfer: decimal.New(1000)},
+			{Name: "default", DailyLimit: decimal.New(50), MaxSingleTransfer: decimal.New(30), MinAccountAgeDays: 1, ReceiverScope: config.TransferScopeSameCompany},
+		}}
+	})
+	defer configManager.Update(func(cfg *config.Config) { cfg.TransferPolicy = originalPolicy })
+
+	expiryDate := time.Now().Truncate(time.Second).Add(30 * 24 * time.Hour)
+	giver, receiver, err := setupTransferCancelUsers(ctx, "policy", expiryDate)
+	if err != nil {
+		return TestResult{Passed: false, Message: err.Error()}
+	}
+	outsiderInfo := createTestUser("policy_outsider", "Policy Outsider", 0)
+	outsiderInfo.Company = "OtherCompany"
+	if err := ctx.DB.AuthDB.Create(outsiderInfo).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+	}
+	outsider := &models.AuthUser{ID: outsiderInfo.ID, Name: outsiderInfo.Name}
+	transfer := func(from *models.AuthUser, to string, amount int64) error {
+		_, err := ctx.QuotaService.TransferOut(from, &services.TransferOutRequest{
+			ReceiverID: to,
+			QuotaList:  []services.TransferQuotaItem{{Amount: decimal.New(amount), ExpiryDate: expiryDate}},
+		})
+		return err
+	}
+
+	// Single transfer maximum, receiver scope and the daily limit of the default rule
+	if err := transfer(giver, receiver.ID, 40); !isTransferPolicyError(err, "max_single_transfer") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a max_single_transfer violation, got %v", err)}
+	}
+	if err := transfer(giver, outsider.ID, 10); !isTransferPolicyError(err, "receiver_scope") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a receiver_scope violation, got %v", err)}
+	}
+	if err := transfer(giver, receiver.ID, 30); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Transfer within the rule failed: %v", err)}
+	}
+	if err := transfer(giver, receiver.ID, 25); !isTransferPolicyError(err, "daily_limit") || !strings.Contains(err.Error(), `"default"`) {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a daily_limit violation of the default rule, got %v", err)}
+	}
+	if gatewayQuota := mockStore.GetQuota(giver.ID); gatewayQuota != 70 {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected denied transfers to leave AiGateway quota at 70, got %g", gatewayQuota)}
+	}
+
+	// Red packets count towards the limits and claimants are checked against the giver's rule
+	packet, err := ctx.QuotaService.CreateRedPacket(giver, &services.CreateRedPacketRequest{
+		TotalAmount: decimal.New(20), MaxClaims: 2, SplitMode: "equal", ExpiryDate: expiryDate,
+	})
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create red packet within the daily limit failed: %v", err)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(outsider, &services.ClaimRedPacketRequest{Code: packet.Code}); !isTransferPolicyError(err, "receiver_scope") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a receiver_scope violation claiming the red packet, got %v", err)}
+	}
+	if _, err := ctx.QuotaService.ClaimRedPacket(receiver, &services.ClaimRedPacketRequest{Code: packet.Code}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Claim within the giver's rule failed: %v", err)}
+	}
+
+	// New accounts cannot send quota
+	youngInfo := createTestUser("policy_young", "Policy Young", 0)
+	youngInfo.CreatedAt = time.Now()
+	if err := ctx.DB.AuthDB.Create(youngInfo).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+	}
+	if err := transfer(&models.AuthUser{ID: youngInfo.ID, Name: youngInfo.Name}, receiver.ID, 1); !isTransferPolicyError(err, "min_account_age_days") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected a min_account_age_days violation, got %v", err)}
+	}
+
+	// VIP givers match the first rule, which only caps single transfers
+	vipInfo := createTestUser("policy_vip", "Policy VIP", 1)
+	if err := ctx.DB.AuthDB.Create(vipInfo).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create user failed: %v", err)}
+	}
+	if err := ctx.DB.Create(&models.Quota{UserID: vipInfo.ID, Amount: decimal.New(100), ExpiryDate: expiryDate, Status: models.StatusValid}).Error; err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Create quota failed: %v", err)}
+	}
+	mockStore.SetQuota(vipInfo.ID, 100)
+	vip := &models.AuthUser{ID: vipInfo.ID, Name: vipInfo.Name}
+	if err := transfer(vip, outsider.ID, 60); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the VIP rule to allow the transfer, got %v", err)}
+	}
+	if _, err := ctx.QuotaService.BatchTransferOut(vip, &services.BatchTransferOutRequest{Receivers: []services.BatchTransferReceiver{
+		{ReceiverID: receiver.ID, QuotaList: []services.TransferQuotaItem{{Amount: decimal.New(10), ExpiryDate: expiryDate}}},
+		{ReceiverID: outsider.ID, QuotaList: []services.TransferQuotaItem{{Amount: decimal.New(10), ExpiryDate: expiryDate}}},
+	}}); err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected the VIP batch transfer to pass, got %v", err)}
+	}
+
+	// Violations are reported as 403 with their own code
+	router, err := setupAuthorizedRouter(ctx)
+	if err != nil {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Failed to set up router: %v", err)}
+	}
+	body := fmt.Sprintf(`{"receiver_id":"%s","quota_list":[{"amount":10,"expiry_date":"%s"}]}`, receiver.ID, expiryDate.Format(time.RFC3339))
+	status, resp := doAuthorizedRequest(router, http.MethodPost, auth.APIPrefix+"/quota/transfer-out", "Authorization", "Bearer "+createTestJWTToken(giver.ID), body)
+	if status != http.StatusForbidden || resp.Code != response.TransferPolicyCode || !strings.Contains(resp.Message, "daily_limit") {
+		return TestResult{Passed: false, Message: fmt.Sprintf("Expected 403 %s for the daily limit, got %d %s: %s", response.TransferPolicyCode, status, resp.Code, resp.Message)}
+	}
+
+	return TestResult{Passed: true, Message: "Transfer Policy Test Succeeded"}
+}